@@ -7,8 +7,8 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"mime/multipart"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -43,6 +43,12 @@ type LocalBot struct {
 	videoMutex     sync.RWMutex
 	platformCache  map[int64]string
 	platformMutex  sync.RWMutex
+	metadataCache  map[int64]*services.VideoMetadata
+	metadataMutex  sync.RWMutex
+	clipCache      map[int64]services.TimeRange // Фрагмент, который нужно скачать вместо всего видео
+	awaitingClip   map[int64]bool               // Ждем от пользователя фрагмент после "✂️ Обрезать"
+	burnSubtitles  map[int64]services.SubtitleTrack // Субтитры, которые нужно вшить в видео
+	clipMutex      sync.RWMutex
 	lastRequestTime map[int64]time.Time
 	requestMutex   sync.RWMutex
 	
@@ -67,6 +73,24 @@ type LocalBot struct {
 	adminIDs map[int64]bool
 	adminMutex sync.RWMutex
 	
+	// Активные загрузки: chatID -> ID статусного сообщения -> отмена
+	activeDownloads map[int64]map[int64]context.CancelFunc
+	downloadsMutex  sync.Mutex
+	
+	// Загрузки по пользователям: один пользователь не должен занять весь downloadPool
+	userLimits     services.UserLimits
+	userDownloads  map[int64]*userDownloadSlots
+	userDownloadsMutex sync.Mutex
+	
+	// Максимальный размер части для видео больше лимита Telegram (0 = не резать)
+	maxPartSize int64
+	
+	// Целевой размер для режима "сжать до N МБ" (0 = режим выключен)
+	compressTarget int64
+	
+	// Домены универсального извлечения через yt-dlp (nil = извлечение выключено)
+	genericDomains *services.DomainList
+	
 	// Контекст для graceful shutdown
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -85,7 +109,7 @@ type BotMetrics struct {
 }
 
 // NewLocalBot создает новый экземпляр LocalBot
-func NewLocalBot(token, apiURL string, timeout time.Duration, youtubeService *services.YouTubeService, universalService *services.UniversalService, cacheService *services.CacheService, proxyConfig *config.ProxyConfig) *LocalBot {
+func NewLocalBot(token, apiURL string, timeout time.Duration, youtubeService *services.YouTubeService, universalService *services.UniversalService, cacheService *services.CacheService, proxyConfig *config.ProxyConfig, userLimits services.UserLimits) *LocalBot {
 	// Создаем контекст для graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	
@@ -111,6 +135,10 @@ func NewLocalBot(token, apiURL string, timeout time.Duration, youtubeService *se
 		formatCache:    make(map[int64][]services.VideoFormat),
 		videoURLCache:  make(map[int64]string),
 		platformCache:  make(map[int64]string),
+		metadataCache:  make(map[int64]*services.VideoMetadata),
+		clipCache:      make(map[int64]services.TimeRange),
+		awaitingClip:   make(map[int64]bool),
+		burnSubtitles:  make(map[int64]services.SubtitleTrack),
 		lastRequestTime: make(map[int64]time.Time),
 		rateLimiter:    make(map[int64]*time.Timer),
 		
@@ -129,6 +157,9 @@ func NewLocalBot(token, apiURL string, timeout time.Duration, youtubeService *se
 			LastActivity: time.Now(),
 		},
 		adminIDs: adminIDs,
+		activeDownloads: make(map[int64]map[int64]context.CancelFunc),
+		userLimits:     userLimits,
+		userDownloads:  make(map[int64]*userDownloadSlots),
 		ctx:    ctx,
 		cancel: cancel,
 	}
@@ -227,6 +258,92 @@ func (b *LocalBot) getPlatformCache(chatID int64) (string, bool) {
 	return platform, exists
 }
 
+// cacheKey возвращает ID видео и пространство кэша для ссылки чата: ID - из реестра платформ,
+// пространство - сохраненное при разборе ссылки (у ссылок с произвольных сайтов оно известно
+// только после ответа yt-dlp), а если его нет - пространство платформы
+func (b *LocalBot) cacheKey(chatID int64, videoURL string) (videoID, platform string) {
+	platformInfo := b.universalService.GetPlatformInfo(videoURL)
+	platform, _ = b.getPlatformCache(chatID)
+	if platform == "" {
+		platform = platformInfo.CacheNamespace
+	}
+	return platformInfo.VideoID, platform
+}
+
+// setMetadataCache thread-safe установка метаданных видео
+func (b *LocalBot) setMetadataCache(chatID int64, metadata *services.VideoMetadata) {
+	b.metadataMutex.Lock()
+	defer b.metadataMutex.Unlock()
+	b.metadataCache[chatID] = metadata
+}
+
+// getMetadataCache thread-safe получение метаданных видео
+func (b *LocalBot) getMetadataCache(chatID int64) (*services.VideoMetadata, bool) {
+	b.metadataMutex.RLock()
+	defer b.metadataMutex.RUnlock()
+	metadata, exists := b.metadataCache[chatID]
+	return metadata, exists
+}
+
+// setClipRange thread-safe установка фрагмента для скачивания (nil - все видео)
+func (b *LocalBot) setClipRange(chatID int64, clip *services.TimeRange) {
+	b.clipMutex.Lock()
+	defer b.clipMutex.Unlock()
+	delete(b.awaitingClip, chatID)
+	if clip == nil {
+		delete(b.clipCache, chatID)
+		return
+	}
+	b.clipCache[chatID] = *clip
+}
+
+// getClipRange thread-safe получение фрагмента для скачивания (nil - все видео)
+func (b *LocalBot) getClipRange(chatID int64) *services.TimeRange {
+	b.clipMutex.RLock()
+	defer b.clipMutex.RUnlock()
+	clip, exists := b.clipCache[chatID]
+	if !exists {
+		return nil
+	}
+	return &clip
+}
+
+// setAwaitingClip отмечает, что следующее сообщение чата - фрагмент для обрезки
+func (b *LocalBot) setAwaitingClip(chatID int64) {
+	b.clipMutex.Lock()
+	defer b.clipMutex.Unlock()
+	b.awaitingClip[chatID] = true
+}
+
+// isAwaitingClip проверяет, ждем ли от чата фрагмент для обрезки
+func (b *LocalBot) isAwaitingClip(chatID int64) bool {
+	b.clipMutex.RLock()
+	defer b.clipMutex.RUnlock()
+	return b.awaitingClip[chatID]
+}
+
+// setBurnSubtitle thread-safe установка субтитров, которые нужно вшить в видео (nil - не вшивать)
+func (b *LocalBot) setBurnSubtitle(chatID int64, track *services.SubtitleTrack) {
+	b.clipMutex.Lock()
+	defer b.clipMutex.Unlock()
+	if track == nil {
+		delete(b.burnSubtitles, chatID)
+		return
+	}
+	b.burnSubtitles[chatID] = *track
+}
+
+// getBurnSubtitle thread-safe получение субтитров, которые нужно вшить в видео (nil - не вшивать)
+func (b *LocalBot) getBurnSubtitle(chatID int64) *services.SubtitleTrack {
+	b.clipMutex.RLock()
+	defer b.clipMutex.RUnlock()
+	track, exists := b.burnSubtitles[chatID]
+	if !exists {
+		return nil
+	}
+	return &track
+}
+
 // setLastRequestTime thread-safe установка времени последнего запроса
 func (b *LocalBot) setLastRequestTime(chatID int64, t time.Time) {
 	b.requestMutex.Lock()
@@ -256,6 +373,13 @@ func (b *LocalBot) clearCacheForChat(chatID int64) {
 	delete(b.platformCache, chatID)
 	b.platformMutex.Unlock()
 	
+	b.metadataMutex.Lock()
+	delete(b.metadataCache, chatID)
+	b.metadataMutex.Unlock()
+	
+	b.setClipRange(chatID, nil)
+	b.setBurnSubtitle(chatID, nil)
+	
 	b.requestMutex.Lock()
 	delete(b.lastRequestTime, chatID)
 	b.requestMutex.Unlock()
@@ -336,6 +460,193 @@ func (b *LocalBot) releaseDownload() {
 	}
 }
 
+// userDownloadSlots - загрузки одного пользователя
+type userDownloadSlots struct {
+	total   int           // Ожидающие и выполняющиеся загрузки
+	running chan struct{} // Семафор одновременных загрузок (nil - без ограничения)
+}
+
+// reserveUserDownload резервирует место под загрузку пользователя.
+// Возвращает число его загрузок с учетом новой и false, если лимит исчерпан.
+func (b *LocalBot) reserveUserDownload(userID int64) (*userDownloadSlots, int, bool) {
+	b.userDownloadsMutex.Lock()
+	defer b.userDownloadsMutex.Unlock()
+	
+	slots, exists := b.userDownloads[userID]
+	if !exists {
+		slots = &userDownloadSlots{}
+		if b.userLimits.MaxConcurrent > 0 {
+			slots.running = make(chan struct{}, b.userLimits.MaxConcurrent)
+		}
+		b.userDownloads[userID] = slots
+	}
+	
+	if b.userLimits.MaxConcurrent > 0 && b.userLimits.MaxQueued > 0 &&
+		slots.total >= b.userLimits.MaxConcurrent+b.userLimits.MaxQueued {
+		return slots, slots.total, false
+	}
+	slots.total++
+	return slots, slots.total, true
+}
+
+// acquireUserDownload ждет свободный слот пользователя
+func (b *LocalBot) acquireUserDownload(slots *userDownloadSlots) {
+	if slots.running != nil {
+		slots.running <- struct{}{}
+	}
+}
+
+// releaseUserDownload освобождает слот и резерв пользователя
+func (b *LocalBot) releaseUserDownload(userID int64, slots *userDownloadSlots) {
+	if slots.running != nil {
+		<-slots.running
+	}
+	
+	b.userDownloadsMutex.Lock()
+	defer b.userDownloadsMutex.Unlock()
+	slots.total--
+	if slots.total == 0 {
+		delete(b.userDownloads, userID)
+	}
+}
+
+// registerDownload запоминает отмену загрузки, привязанной к статусному сообщению
+func (b *LocalBot) registerDownload(chatID, statusID int64, cancel context.CancelFunc) {
+	b.downloadsMutex.Lock()
+	defer b.downloadsMutex.Unlock()
+	if b.activeDownloads[chatID] == nil {
+		b.activeDownloads[chatID] = make(map[int64]context.CancelFunc)
+	}
+	b.activeDownloads[chatID][statusID] = cancel
+}
+
+// unregisterDownload удаляет завершенную загрузку
+func (b *LocalBot) unregisterDownload(chatID, statusID int64) {
+	b.downloadsMutex.Lock()
+	defer b.downloadsMutex.Unlock()
+	delete(b.activeDownloads[chatID], statusID)
+	if len(b.activeDownloads[chatID]) == 0 {
+		delete(b.activeDownloads, chatID)
+	}
+}
+
+// cancelDownloads отменяет загрузки чата (statusID == 0 - все загрузки чата) и возвращает их количество
+func (b *LocalBot) cancelDownloads(chatID, statusID int64) int {
+	b.downloadsMutex.Lock()
+	defer b.downloadsMutex.Unlock()
+	cancelled := 0
+	for id, cancel := range b.activeDownloads[chatID] {
+		if statusID == 0 || id == statusID {
+			cancel()
+			cancelled++
+		}
+	}
+	return cancelled
+}
+
+// cancelKeyboard - кнопка отмены под статусным сообщением загрузки
+func cancelKeyboard() [][]map[string]interface{} {
+	return [][]map[string]interface{}{
+		{
+			{
+				"text":          "✖ Отмена",
+				"callback_data": "cancel_download",
+			},
+		},
+	}
+}
+
+// compressButton - кнопка "сжать" для видеоформата, который можно уменьшить хотя бы до
+// одного из размеров меню сжатия (nil если не нужна)
+func (b *LocalBot) compressButton(format services.VideoFormat) map[string]interface{} {
+	if format.IsAudioOnly() || format.FileSize <= 0 || len(services.CompressTargets(format.FileSize, b.compressTarget)) == 0 {
+		return nil
+	}
+	return map[string]interface{}{
+		"text":          "🗜 Сжать",
+		"callback_data": fmt.Sprintf("compress_%s", format.ID),
+	}
+}
+
+// compressTargetsKeyboard - меню размеров, до которых сжать формат: fit_<МБ>_<id>
+func compressTargetsKeyboard(formatID string, targets []int64) [][]map[string]interface{} {
+	var row []map[string]interface{}
+	for _, target := range targets {
+		row = append(row, map[string]interface{}{
+			"text":          fmt.Sprintf("🗜 %d МБ", target/(1024*1024)),
+			"callback_data": fmt.Sprintf("fit_%d_%s", target/(1024*1024), formatID),
+		})
+	}
+	return [][]map[string]interface{}{row}
+}
+
+// compressTargetFromCallback возвращает выбранный размер сжатия из "fit_<МБ>_<id>" в байтах.
+// 0 - сжатие не выбрано или размер больше limit.
+func compressTargetFromCallback(data string, limit int64) int64 {
+	if !strings.HasPrefix(data, "fit_") {
+		return 0
+	}
+	mb, _, _ := strings.Cut(strings.TrimPrefix(data, "fit_"), "_")
+	target, err := strconv.ParseInt(mb, 10, 64)
+	if err != nil || target <= 0 || target*1024*1024 > limit {
+		return 0
+	}
+	return target * 1024 * 1024
+}
+
+// compressedFormatID - ID формата в кэше для файла, сжатого до target байт.
+// Без "_", потому что callback_data кнопок кэша разбирается по "_".
+func compressedFormatID(formatID string, target int64) string {
+	return fmt.Sprintf("%s-fit%dmb", formatID, target/(1024*1024))
+}
+
+// getUserAudioFormat возвращает формат звука, который пользователь выбрал в меню
+func (b *LocalBot) getUserAudioFormat(userID int64) services.AudioOutput {
+	key, err := b.cacheService.GetUserAudioFormat(userID)
+	if err != nil {
+		log.Printf("⚠️ %v", err)
+	}
+	return services.AudioOutputByKey(key)
+}
+
+// maxSubtitleTracksInMenu - сколько дорожек субтитров показываем в меню
+const maxSubtitleTracksInMenu = 20
+
+// subtitlesKeyboard - меню субтитров: на каждую дорожку файл SRT/VTT, текст и вшивание в видео
+func subtitlesKeyboard(tracks []services.SubtitleTrack) [][]map[string]interface{} {
+	var keyboard [][]map[string]interface{}
+	for i, track := range tracks {
+		if i == maxSubtitleTracksInMenu {
+			break
+		}
+		keyboard = append(keyboard, []map[string]interface{}{
+			{"text": "💬 " + track.Label() + " · SRT", "callback_data": fmt.Sprintf("subs_%d_%s", i, services.SubtitleSRT)},
+			{"text": "VTT", "callback_data": fmt.Sprintf("subs_%d_%s", i, services.SubtitleVTT)},
+			{"text": "📝 Текст", "callback_data": fmt.Sprintf("subs_%d_%s", i, services.SubtitleTranscript)},
+			{"text": "🔥", "callback_data": fmt.Sprintf("subs_%d_burn", i)},
+		})
+	}
+	return keyboard
+}
+
+// audioOutputKeyboard - меню форматов звука, выбранный отмечен галочкой
+func audioOutputKeyboard(current services.AudioOutput) [][]map[string]interface{} {
+	var keyboard [][]map[string]interface{}
+	for _, output := range services.AudioOutputs {
+		text := output.Label
+		if output.Key == current.Key {
+			text = "✅ " + text
+		}
+		keyboard = append(keyboard, []map[string]interface{}{
+			{
+				"text":          text,
+				"callback_data": "audio_out_" + output.Key,
+			},
+		})
+	}
+	return keyboard
+}
+
 // Метрики
 
 // updateMetrics thread-safe обновление метрик
@@ -470,6 +781,86 @@ func (b *LocalBot) SendMessage(chatID int64, text string) error {
 	return nil
 }
 
+// SendMessageWithID отправляет текстовое сообщение (с клавиатурой, если она задана)
+// и возвращает его ID для последующего редактирования
+func (b *LocalBot) SendMessageWithID(chatID int64, text string, keyboard [][]map[string]interface{}) (int64, error) {
+	message := map[string]interface{}{
+		"chat_id": chatID,
+		"text":    text,
+	}
+	if keyboard != nil {
+		message["reply_markup"] = map[string]interface{}{"inline_keyboard": keyboard}
+	}
+
+	jsonData, err := json.Marshal(message)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка маршалинга сообщения: %v", err)
+	}
+
+	resp, err := b.LocalClient.Post(
+		fmt.Sprintf("%s/bot%s/sendMessage", b.APIURL, b.Token),
+		"application/json",
+		bytes.NewBuffer(jsonData),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка отправки сообщения: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("неуспешный статус sendMessage: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		OK     bool    `json:"ok"`
+		Result Message `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("ошибка декодирования ответа sendMessage: %v", err)
+	}
+
+	return result.Result.MessageID, nil
+}
+
+// EditMessageText заменяет текст ранее отправленного сообщения.
+// Клавиатура сохраняется, только если передана заново (nil - убрать кнопки)
+func (b *LocalBot) EditMessageText(chatID, messageID int64, text string, keyboard [][]map[string]interface{}) error {
+	message := map[string]interface{}{
+		"chat_id":    chatID,
+		"message_id": messageID,
+		"text":       text,
+	}
+	if keyboard != nil {
+		message["reply_markup"] = map[string]interface{}{"inline_keyboard": keyboard}
+	}
+
+	jsonData, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("ошибка маршалинга сообщения: %v", err)
+	}
+
+	resp, err := b.LocalClient.Post(
+		fmt.Sprintf("%s/bot%s/editMessageText", b.APIURL, b.Token),
+		"application/json",
+		bytes.NewBuffer(jsonData),
+	)
+	if err != nil {
+		return fmt.Errorf("ошибка редактирования сообщения: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		// Telegram отвечает ошибкой, если текст не изменился - это не проблема
+		if strings.Contains(string(body), "message is not modified") {
+			return nil
+		}
+		return fmt.Errorf("неуспешный статус editMessageText: %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
 // ClearChatHistory очищает историю чата (удаляет сообщения бота)
 func (b *LocalBot) ClearChatHistory(chatID int64) error {
 	// Получаем последние сообщения бота
@@ -552,178 +943,671 @@ func (b *LocalBot) SendVideoPreview(chatID int64, metadata *services.VideoMetada
 		log.Printf("❌ Ошибка SendMessage: %v", err)
 		return err
 	}
-	log.Printf("✅ SendMessage выполнен успешно")
-	return nil
-}
+	log.Printf("✅ SendMessage выполнен успешно")
+	return nil
+}
+
+// SendVideo отправляет видео файл
+func (b *LocalBot) SendVideo(chatID int64, videoPath, caption string) error {
+	_, err := b.uploadVideo(chatID, videoPath, caption, nil)
+	return err
+}
+
+// uploadVideo загружает видео файл, сообщая прогресс в onProgress (может быть nil),
+// и возвращает file_id, присвоенный ему Telegram. Файл отправляется потоком, без буфера в памяти.
+func (b *LocalBot) uploadVideo(chatID int64, videoPath, caption string, onProgress services.ProgressFunc) (string, error) {
+	log.Printf("🎬 Отправляю видео: chatID=%d, path=%s", chatID, videoPath)
+	
+	// Валидация файла перед отправкой
+	if !b.validateVideoFile(videoPath) {
+		return "", fmt.Errorf("файл не прошел валидацию: %s", videoPath)
+	}
+	
+	// Получаем информацию о файле
+	fileInfo, err := os.Stat(videoPath)
+	if err != nil {
+		return "", fmt.Errorf("ошибка получения информации о файле: %v", err)
+	}
+
+	upload := services.NewMultipartUpload()
+	upload.Progress = onProgress
+
+	// Добавляем chat_id
+	upload.AddField("chat_id", fmt.Sprintf("%d", chatID))
+	
+	// Caption уже содержит описание бота, не дублируем
+	upload.AddField("caption", caption)
+
+	// Добавляем длительность (в секундах)
+	// Пытаемся получить длительность из метаданных файла
+	duration := b.getVideoDuration(videoPath)
+	if duration > 0 {
+		upload.AddField("duration", fmt.Sprintf("%d", duration))
+		log.Printf("⏱️ Установлена длительность: %d секунд", duration)
+	}
+
+	// Добавляем размер файла
+	upload.AddField("file_size", fmt.Sprintf("%d", fileInfo.Size()))
+
+	// Добавляем миниатюру если есть
+	thumbnailPath := b.getVideoThumbnail(videoPath)
+	if thumbnailPath != "" {
+		if err := upload.AddFile("thumbnail", thumbnailPath); err == nil {
+			log.Printf("🖼️ Добавлена миниатюра: %s", thumbnailPath)
+		}
+		// Удаляем миниатюру после отправки
+		defer func() {
+			if err := os.Remove(thumbnailPath); err != nil {
+				log.Printf("⚠️ Не удалось удалить миниатюру: %v", err)
+			} else {
+				log.Printf("🗑️ Миниатюра удалена: %s", thumbnailPath)
+			}
+		}()
+	}
+
+	// Добавляем файл
+	if err := upload.AddFile("video", videoPath); err != nil {
+		return "", err
+	}
+
+	// Отправляем запрос
+	resp, err := upload.Post(b.LocalClient, fmt.Sprintf("%s/bot%s/sendVideo", b.APIURL, b.Token))
+	if err != nil {
+		return "", fmt.Errorf("ошибка отправки видео: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("❌ Ошибка sendVideo: %d, ответ: %s", resp.StatusCode, string(body))
+		return "", fmt.Errorf("неуспешный статус sendVideo: %d, ответ: %s", resp.StatusCode, string(body))
+	}
+
+	log.Printf("✅ Видео отправлено успешно с миниатюрой и длительностью")
+	return services.ParseSentFileID(body), nil
+}
+
+// SendAudio отправляет аудио файл
+func (b *LocalBot) SendAudio(chatID int64, audioPath, caption string) error {
+	_, err := b.uploadAudio(chatID, audioPath, caption, nil)
+	return err
+}
+
+// uploadAudio загружает аудио файл, сообщая прогресс в onProgress (может быть nil),
+// и возвращает file_id, присвоенный ему Telegram
+func (b *LocalBot) uploadAudio(chatID int64, audioPath, caption string, onProgress services.ProgressFunc) (string, error) {
+	log.Printf("🎵 Отправляю аудио: chatID=%d, path=%s", chatID, audioPath)
+	
+	// Получаем информацию о файле
+	fileInfo, err := os.Stat(audioPath)
+	if err != nil {
+		return "", fmt.Errorf("ошибка получения информации о файле: %v", err)
+	}
+
+	upload := services.NewMultipartUpload()
+	upload.Progress = onProgress
+
+	// Добавляем chat_id
+	upload.AddField("chat_id", fmt.Sprintf("%d", chatID))
+	
+	// Caption
+	upload.AddField("caption", caption)
+
+	// Добавляем длительность (в секундах)
+	duration := b.getVideoDuration(audioPath)
+	if duration > 0 {
+		upload.AddField("duration", fmt.Sprintf("%d", duration))
+		log.Printf("⏱️ Установлена длительность: %d секунд", duration)
+	}
+
+	// Добавляем размер файла
+	upload.AddField("file_size", fmt.Sprintf("%d", fileInfo.Size()))
+
+	// Название и исполнитель из тегов файла, чтобы плеер Telegram не показывал имя файла
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if tags, err := services.ReadAudioTags(ctx, audioPath); err == nil {
+		if tags.Title != "" {
+			upload.AddField("title", tags.Title)
+		}
+		if tags.Artist != "" {
+			upload.AddField("performer", tags.Artist)
+		}
+	}
+
+	// Встроенную обложку отправляем как миниатюру
+	thumbnailPath := strings.TrimSuffix(audioPath, filepath.Ext(audioPath)) + "_thumb.jpg"
+	if err := services.ExtractAudioCover(ctx, audioPath, thumbnailPath); err == nil {
+		defer os.Remove(thumbnailPath)
+		if err := upload.AddFile("thumbnail", thumbnailPath); err == nil {
+			log.Printf("🖼️ Добавлена обложка: %s", thumbnailPath)
+		}
+	}
+
+	// Добавляем файл
+	if err := upload.AddFile("audio", audioPath); err != nil {
+		return "", err
+	}
+
+	// Отправляем запрос
+	resp, err := upload.Post(b.LocalClient, fmt.Sprintf("%s/bot%s/sendAudio", b.APIURL, b.Token))
+	if err != nil {
+		return "", fmt.Errorf("ошибка отправки аудио: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("❌ Ошибка sendAudio: %d, ответ: %s", resp.StatusCode, string(body))
+		return "", fmt.Errorf("неуспешный статус sendAudio: %d, ответ: %s", resp.StatusCode, string(body))
+	}
+
+	log.Printf("✅ Аудио отправлено успешно")
+	return services.ParseSentFileID(body), nil
+}
+
+// sendByFileID отправляет уже загруженный в Telegram файл по file_id (method: sendVideo/sendAudio, field: video/audio)
+func (b *LocalBot) sendByFileID(chatID int64, method, field, fileID, caption string) error {
+	message := map[string]interface{}{
+		"chat_id": chatID,
+		field:     fileID,
+		"caption": caption,
+	}
+
+	jsonData, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("ошибка маршалинга сообщения: %v", err)
+	}
+
+	resp, err := b.LocalClient.Post(
+		fmt.Sprintf("%s/bot%s/%s", b.APIURL, b.Token, method),
+		"application/json",
+		bytes.NewBuffer(jsonData),
+	)
+	if err != nil {
+		return fmt.Errorf("ошибка отправки по file_id: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("неуспешный статус %s: %d, ответ: %s", method, resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// sendStoredFile отправляет файл по сохраненному file_id без повторной загрузки.
+// Возвращает false, если file_id нет или Telegram его не принял (тогда file_id забывается).
+func (b *LocalBot) sendStoredFile(chatID int64, videoID, platform, formatID, caption string) bool {
+	botID := services.BotIDFromToken(b.Token)
+	fileID, isAudio, err := b.cacheService.GetFileID(videoID, platform, formatID, botID)
+	if err != nil {
+		log.Printf("⚠️ %v", err)
+		return false
+	}
+	if fileID == "" {
+		return false
+	}
+
+	method, field := "sendVideo", "video"
+	if isAudio {
+		method, field = "sendAudio", "audio"
+	}
+	if err := b.sendByFileID(chatID, method, field, fileID, caption); err != nil {
+		log.Printf("⚠️ Telegram не принял file_id, файл будет загружен заново: %v", err)
+		b.cacheService.DeleteFileID(videoID, platform, formatID, botID)
+		return false
+	}
+
+	log.Printf("⚡ Файл %s (%s) отправлен по file_id без загрузки", videoID, formatID)
+	return true
+}
+
+// sendCachedFile отправляет файл: сначала по сохраненному file_id, а если не вышло -
+// загружает локальный файл и запоминает новый file_id для следующих отправок
+func (b *LocalBot) sendCachedFile(chatID int64, videoID, platform, formatID, filePath, caption string, isAudio bool, onProgress services.ProgressFunc) error {
+	if b.sendStoredFile(chatID, videoID, platform, formatID, caption) {
+		return nil
+	}
+
+	if filePath == "" {
+		return fmt.Errorf("локальная копия файла %s (%s) не сохранилась", videoID, formatID)
+	}
+
+	var fileID string
+	var err error
+	if isAudio {
+		fileID, err = b.uploadAudio(chatID, filePath, caption, onProgress)
+	} else {
+		fileID, err = b.uploadVideo(chatID, filePath, caption, onProgress)
+	}
+	if err != nil {
+		return err
+	}
+
+	if fileID != "" {
+		if err := b.cacheService.SaveFileID(videoID, platform, formatID, services.BotIDFromToken(b.Token), fileID, isAudio); err != nil {
+			log.Printf("⚠️ %v", err)
+		}
+	}
+	return nil
+}
+
+// sendVideoParts отправляет части видео по порядку с подписями "Часть 1/3".
+// Каждая часть отправляется по своему file_id, если он есть, иначе загружается с диска.
+func (b *LocalBot) sendVideoParts(chatID int64, videoID, platform, formatID string, parts []services.VideoPart, caption string, onProgress services.ProgressFunc) error {
+	for _, part := range parts {
+		partFormatID := services.PartFormatID(formatID, part.Index, part.Count)
+		if err := b.sendCachedFile(chatID, videoID, platform, partFormatID, part.FilePath, services.PartCaption(caption, part), false, onProgress); err != nil {
+			return fmt.Errorf("ошибка отправки части %d/%d: %v", part.Index, part.Count, err)
+		}
+		log.Printf("✅ Часть %d/%d отправлена: %s (%s)", part.Index, part.Count, videoID, formatID)
+	}
+	return nil
+}
+
+// downloadChapters скачивает звук в формате formatID, режет его по главам и отправляет треки
+// медиагруппами по 10 или одним ZIP, если треков больше 10. Полное аудио остается в кэше.
+func (b *LocalBot) downloadChapters(chatID, userID int64, formatID string) {
+	userSlots, userTotal, ok := b.reserveUserDownload(userID)
+	if !ok {
+		b.SendMessage(chatID, fmt.Sprintf("⏳ У вас уже %d загрузок в очереди.\n\n💡 Дождитесь их завершения или отмените /cancel", userTotal))
+		return
+	}
+	defer b.releaseUserDownload(userID, userSlots)
+	b.acquireUserDownload(userSlots)
+	b.acquireDownload()
+	defer b.releaseDownload()
+	startTime := time.Now()
+
+	videoURL, exists := b.getVideoURLCache(chatID)
+	metadata, _ := b.getMetadataCache(chatID)
+	if !exists || videoURL == "" || metadata == nil || len(metadata.Chapters) == 0 {
+		b.SendMessage(chatID, "❌ Ошибка: данные видео не найдены. Отправьте ссылку заново.")
+		return
+	}
+	videoID, platform := b.cacheKey(chatID, videoURL)
+
+	opts := services.DownloadOptions{Audio: true, AudioFormat: b.getUserAudioFormat(userID).Key, Metadata: metadata}
+	cacheFormatID := opts.FileFormatID(formatID)
+
+	statusID, err := b.SendMessageWithID(chatID, fmt.Sprintf("🎼 Скачиваю аудио для %d треков...", len(metadata.Chapters)), cancelKeyboard())
+	if err != nil {
+		log.Printf("⚠️ Не удалось отправить статусное сообщение: %v", err)
+	}
+	ctx, cancel := context.WithCancel(b.ctx)
+	defer cancel()
+	b.registerDownload(chatID, statusID, cancel)
+	defer b.unregisterDownload(chatID, statusID)
+
+	setStatusKeyboard := func(text string, keyboard [][]map[string]interface{}) {
+		if statusID == 0 {
+			b.SendMessage(chatID, text)
+			return
+		}
+		if err := b.EditMessageText(chatID, statusID, text, keyboard); err != nil {
+			log.Printf("⚠️ Не удалось обновить статус: %v", err)
+		}
+	}
+	setStatus := func(text string) {
+		setStatusKeyboard(text, nil)
+	}
+
+	// Полное аудио берем из кэша, если оно там есть
+	var audioPath string
+	if cached, entry, err := b.cacheService.IsVideoCached(videoID, platform, cacheFormatID); err == nil && cached && entry.FilePath != "" {
+		if _, err := os.Stat(entry.FilePath); err == nil {
+			log.Printf("⚡ Аудио для нарезки по главам найдено в кэше: %s", entry.FilePath)
+			audioPath = entry.FilePath
+		}
+	}
+	if audioPath == "" {
+		var onProgress services.ProgressFunc
+		if statusID != 0 {
+			onProgress = services.NewProgressReporter(3*time.Second, func(text string) {
+				if ctx.Err() == nil {
+					setStatusKeyboard(text, cancelKeyboard())
+				}
+			}).Report
+		}
+		if platform == string(services.PlatformYouTube) {
+			audioPath, err = b.youtubeService.DownloadWithOptions(ctx, videoURL, formatID, opts, onProgress)
+		} else {
+			audioPath, err = b.universalService.DownloadWithOptions(ctx, videoURL, formatID, opts, onProgress)
+		}
+		if err != nil && ctx.Err() != nil {
+			setStatus("✖ Загрузка отменена")
+			return
+		}
+		if err != nil {
+			log.Printf("❌ Ошибка загрузки аудио для глав: %v", err)
+			setStatus("❌ Ошибка загрузки аудио\n\n🔧 Попробуйте другой формат или видео")
+			return
+		}
+		if info, err := os.Stat(audioPath); err == nil {
+			title := b.universalService.GetPlatformInfo(videoURL).DisplayName + " Audio"
+			if err := b.cacheService.AddToCache(videoID, platform, videoURL, title, cacheFormatID, "audio", audioPath, info.Size()); err != nil {
+				log.Printf("⚠️ Не удалось добавить в кэш: %v", err)
+			}
+		}
+	}
+
+	setStatusKeyboard(fmt.Sprintf("🎼 Режу аудио на %d треков по главам...", len(metadata.Chapters)), cancelKeyboard())
+	tracks, err := services.SplitAudioByChapters(ctx, audioPath, metadata.Chapters, metadata.Title)
+	if err != nil && ctx.Err() != nil {
+		setStatus("✖ Загрузка отменена")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка нарезки по главам: %v", err)
+		setStatus("❌ Не удалось разрезать аудио по главам")
+		return
+	}
+	defer services.RemoveChapterTracks(tracks)
+
+	setStatus(fmt.Sprintf("✅ Готово %d треков! 📤 Отправляю в Telegram...", len(tracks)))
+	caption := fmt.Sprintf("🎼 %s\n\n%d треков по главам", metadata.Title, len(tracks))
+	if len(tracks) > services.MaxMediaGroupSize {
+		err = b.sendChapterZip(chatID, audioPath, tracks, caption)
+	} else {
+		err = b.SendAudioGroup(chatID, tracks, services.AudioTagsFromMetadata(metadata).Artist, caption)
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка отправки треков: %v", err)
+		b.SendMessage(chatID, fmt.Sprintf("❌ Ошибка отправки: %v", err))
+		return
+	}
+
+	log.Printf("✅ %d треков по главам отправлено: %s (%s)", len(tracks), videoID, formatID)
+	b.UpdateMetrics("download", true, time.Since(startTime))
+}
+
+// downloadLink скачивает ссылку из сообщения с несколькими ссылками без меню форматов:
+// YouTube - видео до 720p (или аудио), остальные платформы - в формате по умолчанию.
+// Каждая ссылка - отдельная загрузка со своим статусом и кнопкой отмены, лимиты
+// пользователя те же, что и у загрузок из меню.
+func (b *LocalBot) downloadLink(chatID, userID int64, link services.Link) {
+	platformInfo := b.universalService.GetPlatformInfo(link.URL)
+	if !platformInfo.Supported {
+		b.SendMessage(chatID, "❌ Неподдерживаемая ссылка: "+link.URL)
+		return
+	}
+
+	userSlots, userTotal, ok := b.reserveUserDownload(userID)
+	if !ok {
+		b.SendMessage(chatID, fmt.Sprintf("⏳ У вас уже %d загрузок в очереди, ссылка пропущена:\n%s\n\n💡 Отправьте ее после завершения загрузок", userTotal, link.URL))
+		return
+	}
+	defer b.releaseUserDownload(userID, userSlots)
+
+	statusID, err := b.SendMessageWithID(chatID, fmt.Sprintf("⏳ В очереди: %s %s", platformInfo.Icon, link.URL), cancelKeyboard())
+	if err != nil {
+		log.Printf("⚠️ Не удалось отправить статусное сообщение: %v", err)
+	}
+	ctx, cancel := context.WithCancel(b.ctx)
+	defer cancel()
+	b.registerDownload(chatID, statusID, cancel)
+	defer b.unregisterDownload(chatID, statusID)
+
+	setStatusKeyboard := func(text string, keyboard [][]map[string]interface{}) {
+		if statusID == 0 {
+			b.SendMessage(chatID, text)
+			return
+		}
+		if err := b.EditMessageText(chatID, statusID, text, keyboard); err != nil {
+			log.Printf("⚠️ Не удалось обновить статус: %v", err)
+		}
+	}
+	setStatus := func(text string) {
+		setStatusKeyboard(text, nil)
+	}
+
+	b.acquireUserDownload(userSlots)
+	b.acquireDownload()
+	defer b.releaseDownload()
+	if ctx.Err() != nil {
+		setStatus("✖ Загрузка отменена")
+		return
+	}
+	startTime := time.Now()
 
-// SendVideo отправляет видео файл
-func (b *LocalBot) SendVideo(chatID int64, videoPath, caption string) error {
-	log.Printf("🎬 Отправляю видео: chatID=%d, path=%s", chatID, videoPath)
-	
-	// Валидация файла перед отправкой
-	if !b.validateVideoFile(videoPath) {
-		return fmt.Errorf("файл не прошел валидацию: %s", videoPath)
+	isYouTube := platformInfo.Type == services.PlatformYouTube || platformInfo.Type == services.PlatformYouTubeShorts
+	opts := services.DownloadOptions{Audio: platformInfo.AudioOnly, Clip: link.Clip}
+	formatID := services.DefaultVideoFormat
+	switch {
+	case isYouTube:
+		formatID = services.BatchVideoFormat
+	case opts.Audio:
+		formatID = "bestaudio"
 	}
-	
-	file, err := os.Open(videoPath)
-	if err != nil {
-		return fmt.Errorf("ошибка открытия файла: %v", err)
+	if opts.Audio {
+		opts.AudioFormat = b.getUserAudioFormat(userID).Key
 	}
-	defer file.Close()
+	cacheFormatID := opts.FileFormatID(formatID)
 
-	// Получаем информацию о файле
-	fileInfo, err := file.Stat()
-	if err != nil {
-		return fmt.Errorf("ошибка получения информации о файле: %v", err)
+	caption := fmt.Sprintf("%s %s", platformInfo.Icon, link.URL)
+	if link.Clip != nil {
+		caption = fmt.Sprintf("✂️ Фрагмент %s\n\n%s", link.Clip, caption)
 	}
 
-	// Создаем multipart form
-	var buf bytes.Buffer
-	writer := multipart.NewWriter(&buf)
+	// Уже отправленный файл пересылаем по file_id без скачивания
+	if platformInfo.VideoID != "" && b.sendStoredFile(chatID, platformInfo.VideoID, platformInfo.CacheNamespace, cacheFormatID, caption) {
+		setStatus("✅ Отправлено из кэша")
+		b.UpdateMetrics("download", true, time.Since(startTime))
+		return
+	}
 
-	// Добавляем chat_id
-	writer.WriteField("chat_id", fmt.Sprintf("%d", chatID))
-	
-	// Caption уже содержит описание бота, не дублируем
-	botCaption := caption
-	writer.WriteField("caption", botCaption)
+	var onProgress services.ProgressFunc
+	if statusID != 0 {
+		onProgress = services.NewProgressReporter(3*time.Second, func(text string) {
+			if ctx.Err() == nil {
+				setStatusKeyboard(text, cancelKeyboard())
+			}
+		}).Report
+	}
+	setStatusKeyboard(fmt.Sprintf("📥 Скачиваю: %s %s", platformInfo.Icon, link.URL), cancelKeyboard())
 
-	// Добавляем длительность (в секундах)
-	// Пытаемся получить длительность из метаданных файла
-	duration := b.getVideoDuration(videoPath)
-	if duration > 0 {
-		writer.WriteField("duration", fmt.Sprintf("%d", duration))
-		log.Printf("⏱️ Установлена длительность: %d секунд", duration)
+	var videoPath string
+	if isYouTube {
+		videoPath, err = b.youtubeService.DownloadWithOptions(ctx, link.URL, formatID, opts, onProgress)
+	} else {
+		videoPath, err = b.universalService.DownloadWithOptions(ctx, link.URL, formatID, opts, onProgress)
+	}
+	if err != nil && ctx.Err() != nil {
+		setStatus("✖ Загрузка отменена")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка загрузки %s: %v", link.URL, err)
+		setStatus(fmt.Sprintf("❌ Ошибка загрузки %s\n\n🔧 Попробуйте отправить ссылку отдельно", link.URL))
+		b.UpdateMetrics("download", false, time.Since(startTime))
+		return
 	}
+	// ID ссылки с произвольного сайта известен только после разбора yt-dlp
+	platformInfo = b.universalService.GetPlatformInfo(link.URL)
+	videoID, platform := platformInfo.VideoID, platformInfo.CacheNamespace
 
-	// Добавляем миниатюру если есть
-	thumbnailPath := b.getVideoThumbnail(videoPath)
-	if thumbnailPath != "" {
-		// Добавляем миниатюру как файл
-		thumbFile, err := os.Open(thumbnailPath)
-		if err == nil {
-			defer thumbFile.Close()
-			thumbWriter, err := writer.CreateFormFile("thumbnail", filepath.Base(thumbnailPath))
-			if err == nil {
-				io.Copy(thumbWriter, thumbFile)
-				log.Printf("🖼️ Добавлена миниатюра: %s", thumbnailPath)
-			}
+	var parts []services.VideoPart
+	if !opts.Audio {
+		if compatiblePath, err := b.ensureMP4MacCompatible(ctx, videoPath); err != nil {
+			log.Printf("⚠️ Не удалось обеспечить совместимость MP4: %v", err)
+		} else {
+			videoPath = compatiblePath
 		}
-		// Удаляем миниатюру после отправки
-		defer func() {
-			if err := os.Remove(thumbnailPath); err != nil {
-				log.Printf("⚠️ Не удалось удалить миниатюру: %v", err)
-			} else {
-				log.Printf("🗑️ Миниатюра удалена: %s", thumbnailPath)
+		if info, err := os.Stat(videoPath); err == nil && b.maxPartSize > 0 && info.Size() > b.maxPartSize {
+			setStatusKeyboard(fmt.Sprintf("✂️ Файл больше %s, режу на части...", formatFileSize(b.maxPartSize)), cancelKeyboard())
+			parts, err = services.SplitVideo(ctx, videoPath, b.maxPartSize)
+			if err != nil {
+				log.Printf("❌ Ошибка нарезки видео: %v", err)
+				setStatus("❌ Не удалось разрезать видео на части")
+				os.Remove(videoPath)
+				return
 			}
-		}()
+		}
 	}
 
-	// Добавляем размер файла
-	writer.WriteField("file_size", fmt.Sprintf("%d", fileInfo.Size()))
+	setStatus("✅ Файл готов! 📤 Отправляю в Telegram...")
+	var uploadProgress services.ProgressFunc
+	if statusID != 0 {
+		uploadProgress = services.NewProgressReporter(3*time.Second, setStatus).Report
+	}
 
-	// Добавляем файл
-	part, err := writer.CreateFormFile("video", filepath.Base(videoPath))
+	if parts != nil {
+		if err := b.cacheService.AddPartsToCache(videoID, platform, cacheFormatID, parts); err != nil {
+			log.Printf("⚠️ Не удалось добавить части в кэш: %v", err)
+		}
+		err = b.sendVideoParts(chatID, videoID, platform, cacheFormatID, parts, caption, uploadProgress)
+	} else {
+		if info, statErr := os.Stat(videoPath); statErr == nil {
+			title := platformInfo.DisplayName + " Video"
+			if opts.Audio {
+				title = platformInfo.DisplayName + " Audio"
+			}
+			if err := b.cacheService.AddToCache(videoID, platform, link.URL, title, cacheFormatID, "", videoPath, info.Size()); err != nil {
+				log.Printf("⚠️ Не удалось добавить в кэш: %v", err)
+			}
+		}
+		err = b.sendCachedFile(chatID, videoID, platform, cacheFormatID, videoPath, caption, opts.Audio, uploadProgress)
+	}
 	if err != nil {
-		return fmt.Errorf("ошибка создания form file: %v", err)
+		log.Printf("❌ Ошибка отправки %s: %v", link.URL, err)
+		b.SendMessage(chatID, fmt.Sprintf("❌ Ошибка отправки %s: %v", link.URL, err))
+		b.UpdateMetrics("download", false, time.Since(startTime))
+		return
 	}
 
-	_, err = io.Copy(part, file)
-	if err != nil {
-		return fmt.Errorf("ошибка копирования файла: %v", err)
+	log.Printf("✅ Ссылка из сообщения отправлена: %s (%s)", link.URL, cacheFormatID)
+	b.UpdateMetrics("download", true, time.Since(startTime))
+}
+
+// sendChapterZip упаковывает треки в ZIP рядом с исходным аудио и отправляет его документом
+func (b *LocalBot) sendChapterZip(chatID int64, audioPath string, tracks []services.ChapterTrack, caption string) error {
+	zipPath := strings.TrimSuffix(audioPath, filepath.Ext(audioPath)) + "_chapters.zip"
+	if err := services.ZipChapterTracks(tracks, zipPath); err != nil {
+		return err
 	}
+	defer os.Remove(zipPath)
+	return b.SendDocument(chatID, zipPath, caption)
+}
 
-	writer.Close()
+// SendAudioGroup отправляет до 10 треков одной медиагруппой; подпись - у первого трека
+func (b *LocalBot) SendAudioGroup(chatID int64, tracks []services.ChapterTrack, performer, caption string) error {
+	upload := services.NewMultipartUpload()
+	upload.AddField("chat_id", fmt.Sprintf("%d", chatID))
 
-	// Отправляем запрос
-	resp, err := b.LocalClient.Post(
-		fmt.Sprintf("%s/bot%s/sendVideo", b.APIURL, b.Token),
-		writer.FormDataContentType(),
-		&buf,
-	)
+	var mediaArray []map[string]interface{}
+	for i, track := range tracks {
+		field := fmt.Sprintf("audio_%d", i)
+		if err := upload.AddFile(field, track.FilePath); err != nil {
+			return err
+		}
+		mediaItem := map[string]interface{}{
+			"type":     "audio",
+			"media":    "attach://" + field,
+			"title":    track.Title,
+			"duration": track.Duration,
+		}
+		if performer != "" {
+			mediaItem["performer"] = performer
+		}
+		if i == 0 {
+			mediaItem["caption"] = caption
+		}
+		mediaArray = append(mediaArray, mediaItem)
+	}
+
+	mediaJSON, err := json.Marshal(mediaArray)
+	if err != nil {
+		return fmt.Errorf("ошибка маршалинга media: %v", err)
+	}
+	upload.AddField("media", string(mediaJSON))
+
+	resp, err := upload.Post(b.LocalClient, fmt.Sprintf("%s/bot%s/sendMediaGroup", b.APIURL, b.Token))
 	if err != nil {
-		return fmt.Errorf("ошибка отправки видео: %v", err)
+		return fmt.Errorf("ошибка отправки медиагруппы: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		log.Printf("❌ Ошибка sendVideo: %d, ответ: %s", resp.StatusCode, string(body))
-		return fmt.Errorf("неуспешный статус sendVideo: %d, ответ: %s", resp.StatusCode, string(body))
+		return fmt.Errorf("неуспешный статус sendMediaGroup: %d, ответ: %s", resp.StatusCode, string(body))
 	}
-
-	log.Printf("✅ Видео отправлено успешно с миниатюрой и длительностью")
+	log.Printf("✅ Медиагруппа из %d треков отправлена", len(tracks))
 	return nil
 }
 
-// SendAudio отправляет аудио файл
-func (b *LocalBot) SendAudio(chatID int64, audioPath, caption string) error {
-	log.Printf("🎵 Отправляю аудио: chatID=%d, path=%s", chatID, audioPath)
-	
-	file, err := os.Open(audioPath)
-	if err != nil {
-		return fmt.Errorf("ошибка открытия файла: %v", err)
+// SendDocument отправляет файл как документ
+func (b *LocalBot) SendDocument(chatID int64, filePath, caption string) error {
+	upload := services.NewMultipartUpload()
+	upload.AddField("chat_id", fmt.Sprintf("%d", chatID))
+	upload.AddField("caption", caption)
+	if err := upload.AddFile("document", filePath); err != nil {
+		return err
 	}
-	defer file.Close()
 
-	// Получаем информацию о файле
-	fileInfo, err := file.Stat()
+	resp, err := upload.Post(b.LocalClient, fmt.Sprintf("%s/bot%s/sendDocument", b.APIURL, b.Token))
 	if err != nil {
-		return fmt.Errorf("ошибка получения информации о файле: %v", err)
+		return fmt.Errorf("ошибка отправки документа: %v", err)
 	}
+	defer resp.Body.Close()
 
-	// Создаем multipart form
-	var buf bytes.Buffer
-	writer := multipart.NewWriter(&buf)
-
-	// Добавляем chat_id
-	writer.WriteField("chat_id", fmt.Sprintf("%d", chatID))
-	
-	// Caption
-	writer.WriteField("caption", caption)
-
-	// Добавляем длительность (в секундах)
-	duration := b.getVideoDuration(audioPath)
-	if duration > 0 {
-		writer.WriteField("duration", fmt.Sprintf("%d", duration))
-		log.Printf("⏱️ Установлена длительность: %d секунд", duration)
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("неуспешный статус sendDocument: %d, ответ: %s", resp.StatusCode, string(body))
 	}
+	log.Printf("✅ Документ отправлен: %s", filePath)
+	return nil
+}
 
-	// Добавляем размер файла
-	writer.WriteField("file_size", fmt.Sprintf("%d", fileInfo.Size()))
-
-	// Добавляем файл
-	part, err := writer.CreateFormFile("audio", filepath.Base(audioPath))
-	if err != nil {
-		return fmt.Errorf("ошибка создания form file: %v", err)
+// downloadSubtitles скачивает дорожку субтитров видео из кэша чата в формате srt или vtt
+func (b *LocalBot) downloadSubtitles(ctx context.Context, chatID int64, track services.SubtitleTrack, format string) (string, error) {
+	videoURL, exists := b.getVideoURLCache(chatID)
+	if !exists || videoURL == "" {
+		return "", fmt.Errorf("URL видео не найден")
 	}
-
-	_, err = io.Copy(part, file)
-	if err != nil {
-		return fmt.Errorf("ошибка копирования файла: %v", err)
+	_, platform := b.cacheKey(chatID, videoURL)
+	if platform == string(services.PlatformYouTube) {
+		return b.youtubeService.DownloadSubtitles(ctx, videoURL, track, format)
 	}
+	return b.universalService.DownloadSubtitles(ctx, videoURL, track, format)
+}
 
-	writer.Close()
+// sendSubtitles отправляет субтитры документом: SRT, VTT или очищенный текст (txt)
+func (b *LocalBot) sendSubtitles(chatID int64, track services.SubtitleTrack, format string) {
+	ctx, cancel := context.WithTimeout(b.ctx, 2*time.Minute)
+	defer cancel()
 
-	// Отправляем запрос
-	resp, err := b.LocalClient.Post(
-		fmt.Sprintf("%s/bot%s/sendAudio", b.APIURL, b.Token),
-		writer.FormDataContentType(),
-		&buf,
-	)
+	downloadFormat := format
+	if format == services.SubtitleTranscript {
+		downloadFormat = services.SubtitleSRT
+	}
+	subtitlePath, err := b.downloadSubtitles(ctx, chatID, track, downloadFormat)
 	if err != nil {
-		return fmt.Errorf("ошибка отправки аудио: %v", err)
+		log.Printf("❌ Ошибка скачивания субтитров: %v", err)
+		b.SendMessage(chatID, "❌ Не удалось скачать субтитры")
+		return
 	}
-	defer resp.Body.Close()
+	defer os.Remove(subtitlePath)
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		log.Printf("❌ Ошибка sendAudio: %d, ответ: %s", resp.StatusCode, string(body))
-		return fmt.Errorf("неуспешный статус sendAudio: %d, ответ: %s", resp.StatusCode, string(body))
+	filePath := subtitlePath
+	if format == services.SubtitleTranscript {
+		filePath, err = services.WriteTranscript(subtitlePath)
+		if err != nil {
+			log.Printf("❌ Ошибка подготовки текста: %v", err)
+			b.SendMessage(chatID, "❌ Не удалось получить текст из субтитров")
+			return
+		}
+		defer os.Remove(filePath)
 	}
 
-	log.Printf("✅ Аудио отправлено успешно")
-	return nil
+	caption := "💬 Субтитры: " + track.Label()
+	if metadata, ok := b.getMetadataCache(chatID); ok && metadata != nil {
+		caption = fmt.Sprintf("💬 %s\n\n%s", track.Label(), metadata.Title)
+	}
+	if err := b.SendDocument(chatID, filePath, caption); err != nil {
+		log.Printf("❌ Ошибка отправки субтитров: %v", err)
+		b.SendMessage(chatID, fmt.Sprintf("❌ Ошибка отправки: %v", err))
+	}
 }
 
 // getVideoDuration получает длительность видео в секундах
@@ -750,6 +1634,23 @@ func (b *LocalBot) getVideoDuration(videoPath string) int {
 	return int(duration)
 }
 
+// getVideoDurationContext получает точную длительность видео в секундах с учетом отмены ctx
+func (b *LocalBot) getVideoDurationContext(ctx context.Context, videoPath string) (float64, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "quiet", "-show_entries", "format=duration", "-of", "csv=p=0", videoPath)
+	output, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return 0, services.ErrCancelled
+		}
+		return 0, fmt.Errorf("не удалось получить длительность видео: %v", err)
+	}
+	duration, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось распарсить длительность: %v", err)
+	}
+	return duration, nil
+}
+
 // getVideoThumbnail получает путь к миниатюре видео
 func (b *LocalBot) getVideoThumbnail(videoPath string) string {
 	// Создаем путь для миниатюры
@@ -847,6 +1748,40 @@ func (b *LocalBot) SendFormatTypeMenu(chatID int64, audioCount, videoCount int)
 		log.Printf("⚠️ Видео форматов нет, кнопка не добавляется")
 	}
 	
+	// Кнопка обрезки: задать фрагмент или сбросить уже заданный
+	if clip := b.getClipRange(chatID); clip != nil {
+		keyboard = append(keyboard, []map[string]interface{}{
+			{
+				"text":          fmt.Sprintf("✂️ Фрагмент %s ✖", clip),
+				"callback_data": "clip_clear",
+			},
+		})
+	} else if videoCount > 0 || audioCount > 0 {
+		keyboard = append(keyboard, []map[string]interface{}{
+			{
+				"text":          "✂️ Обрезать",
+				"callback_data": "clip_ask",
+			},
+		})
+	}
+	
+	// Субтитры: файлом, текстом или вшитыми в видео
+	if burn := b.getBurnSubtitle(chatID); burn != nil {
+		keyboard = append(keyboard, []map[string]interface{}{
+			{
+				"text":          fmt.Sprintf("🔥 Субтитры в видео: %s ✖", burn.Label()),
+				"callback_data": "subs_burn_clear",
+			},
+		})
+	} else if metadata, ok := b.getMetadataCache(chatID); ok && metadata != nil && len(metadata.Subtitles) > 0 {
+		keyboard = append(keyboard, []map[string]interface{}{
+			{
+				"text":          fmt.Sprintf("💬 Субтитры (%d)", len(metadata.Subtitles)),
+				"callback_data": "subs_menu",
+			},
+		})
+	}
+	
 	// Кнопка "Мгновенно" - убираем из главного меню
 	// log.Printf("⚡ Добавляю кнопку мгновенной загрузки")
 	// keyboard = append(keyboard, []map[string]interface{}{
@@ -944,51 +1879,23 @@ func (b *LocalBot) SendPhotoFromFile(chatID int64, filePath, caption string) err
 		return fmt.Errorf("файл не найден: %s", filePath)
 	}
 	
-	// Открываем файл
-	file, err := os.Open(filePath)
-	if err != nil {
-		log.Printf("❌ Ошибка открытия файла: %v", err)
-		return fmt.Errorf("ошибка открытия файла: %v", err)
-	}
-	defer file.Close()
-	
-	// Создаем multipart form
-	var buf bytes.Buffer
-	writer := multipart.NewWriter(&buf)
+	upload := services.NewMultipartUpload()
 	
 	// Добавляем chat_id
-	writer.WriteField("chat_id", fmt.Sprintf("%d", chatID))
+	upload.AddField("chat_id", fmt.Sprintf("%d", chatID))
 	
 	// Добавляем caption
-	writer.WriteField("caption", caption)
-	writer.WriteField("parse_mode", "Markdown")
+	upload.AddField("caption", caption)
+	upload.AddField("parse_mode", "Markdown")
 	
 	// Добавляем файл
-	part, err := writer.CreateFormFile("photo", filepath.Base(filePath))
-	if err != nil {
-		log.Printf("❌ Ошибка создания form file: %v", err)
-		return fmt.Errorf("ошибка создания form file: %v", err)
-	}
-	
-	_, err = io.Copy(part, file)
-	if err != nil {
-		log.Printf("❌ Ошибка копирования файла: %v", err)
-		return fmt.Errorf("ошибка копирования файла: %v", err)
+	if err := upload.AddFile("photo", filePath); err != nil {
+		log.Printf("❌ Ошибка добавления файла: %v", err)
+		return err
 	}
 	
-	writer.Close()
-	
 	// Отправляем запрос
-	req, err := http.NewRequest("POST", 
-		fmt.Sprintf("%s/bot%s/sendPhoto", b.APIURL, b.Token), &buf)
-	if err != nil {
-		log.Printf("❌ Ошибка создания запроса: %v", err)
-		return fmt.Errorf("ошибка создания запроса: %v", err)
-	}
-	
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	
-	resp, err := b.LocalClient.Do(req)
+	resp, err := upload.Post(b.LocalClient, fmt.Sprintf("%s/bot%s/sendPhoto", b.APIURL, b.Token))
 	if err != nil {
 		log.Printf("❌ Ошибка HTTP запроса: %v", err)
 		return fmt.Errorf("ошибка отправки фото: %v", err)
@@ -1015,25 +1922,23 @@ func (b *LocalBot) SendMediaGroup(chatID int64, mediaFiles []string) error {
 		return fmt.Errorf("нет файлов для отправки")
 	}
 	
-	// Создаем multipart form
-	var buf bytes.Buffer
-	writer := multipart.NewWriter(&buf)
+	upload := services.NewMultipartUpload()
 	
 	// Добавляем chat_id
-	writer.WriteField("chat_id", fmt.Sprintf("%d", chatID))
+	upload.AddField("chat_id", fmt.Sprintf("%d", chatID))
 	
-	// Создаем массив медиафайлов
+	// Создаем массив медиафайлов и добавляем файлы (их содержимое читается при отправке)
 	var mediaArray []map[string]interface{}
 	for i, filePath := range mediaFiles {
-		// Проверяем существование файла
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		field := fmt.Sprintf("photo_%d", i)
+		if err := upload.AddFile(field, filePath); err != nil {
 			log.Printf("⚠️ Файл не найден: %s", filePath)
 			continue
 		}
 		
 		mediaItem := map[string]interface{}{
 			"type": "photo",
-			"media": fmt.Sprintf("attach://photo_%d", i),
+			"media": "attach://" + field,
 		}
 		mediaArray = append(mediaArray, mediaItem)
 	}
@@ -1047,48 +1952,10 @@ func (b *LocalBot) SendMediaGroup(chatID int64, mediaFiles []string) error {
 	if err != nil {
 		return fmt.Errorf("ошибка маршалинга media: %v", err)
 	}
-	writer.WriteField("media", string(mediaJSON))
-	
-	// Добавляем файлы
-	for i, filePath := range mediaFiles {
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
-			continue
-		}
-		
-		file, err := os.Open(filePath)
-		if err != nil {
-			log.Printf("❌ Ошибка открытия файла %s: %v", filePath, err)
-			continue
-		}
-		
-		part, err := writer.CreateFormFile(fmt.Sprintf("photo_%d", i), filepath.Base(filePath))
-		if err != nil {
-			file.Close()
-			log.Printf("❌ Ошибка создания form file: %v", err)
-			continue
-		}
-		
-		_, err = io.Copy(part, file)
-		file.Close()
-		if err != nil {
-			log.Printf("❌ Ошибка копирования файла: %v", err)
-			continue
-		}
-	}
-	
-	writer.Close()
+	upload.AddField("media", string(mediaJSON))
 	
 	// Отправляем запрос
-	req, err := http.NewRequest("POST", 
-		fmt.Sprintf("%s/bot%s/sendMediaGroup", b.APIURL, b.Token), &buf)
-	if err != nil {
-		log.Printf("❌ Ошибка создания запроса: %v", err)
-		return fmt.Errorf("ошибка создания запроса: %v", err)
-	}
-	
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	
-	resp, err := b.LocalClient.Do(req)
+	resp, err := upload.Post(b.LocalClient, fmt.Sprintf("%s/bot%s/sendMediaGroup", b.APIURL, b.Token))
 	if err != nil {
 		log.Printf("❌ Ошибка HTTP запроса: %v", err)
 		return fmt.Errorf("ошибка отправки медиагруппы: %v", err)
@@ -1175,7 +2042,7 @@ func (b *LocalBot) SendVideoFormatsOnly(chatID int64, text string, formats []ser
 	log.Printf("🔍 Детали видео форматов для меню:")
 	for i, f := range formats {
 		log.Printf("  🎥 %d. ID: %s, Resolution: %s, Extension: %s, HasAudio: %v, Size: %s", 
-			i+1, f.ID, f.Resolution, f.Extension, f.HasAudio, f.FileSize)
+			i+1, f.ID, f.Resolution, f.Extension, f.HasAudio, f.SizeString())
 	}
 	
 	// Создаем inline keyboard только для видео форматов
@@ -1186,9 +2053,12 @@ func (b *LocalBot) SendVideoFormatsOnly(chatID int64, text string, formats []ser
 		// Используем одинаковый значок для всех форматов
 		icon := "🎥"
 		
-		buttonText := fmt.Sprintf("%s %s / %s", icon, format.Resolution, format.FileSize)
-		if format.FileSize == "" {
+		buttonText := fmt.Sprintf("%s %s / %s", icon, format.Resolution, format.SizeString())
+		if format.FileSize == 0 {
 			buttonText = fmt.Sprintf("%s %s / ~?", icon, format.Resolution)
+		} else if b.maxPartSize > 0 && format.FileSize > b.maxPartSize && !format.IsAudioOnly() {
+			// Будет отправлено несколькими частями
+			buttonText += " ✂️"
 		}
 		
 		// Создаем callback data для кнопки
@@ -1200,20 +2070,19 @@ func (b *LocalBot) SendVideoFormatsOnly(chatID int64, text string, formats []ser
 				"callback_data": callbackData,
 			},
 		})
+		
+		// Слишком большой формат можно сжать до целевого размера
+		if button := b.compressButton(format); button != nil {
+			keyboard[len(keyboard)-1] = append(keyboard[len(keyboard)-1], button)
+		}
 	}
 	
 	// Проверяем, есть ли видео в кэше для мгновенного скачивания
 	videoURL, exists := b.getVideoURLCache(chatID)
 	if exists && videoURL != "" {
-		// Извлекаем videoID из URL
-		videoID := extractVideoID(videoURL)
+		// ID видео и пространство кэша ссылки чата
+		videoID, platform := b.cacheKey(chatID, videoURL)
 		if videoID != "" {
-			// Получаем платформу из кэша
-			platform := b.platformCache[chatID]
-			if platform == "" {
-				platform = "youtube" // По умолчанию YouTube
-			}
-			
 			// Проверяем, есть ли видео в кэше
 			if inCache, cachedFormats, err := b.isVideoInCache(videoID, platform); err == nil && inCache {
 				log.Printf("⚡ Видео найдено в кэше (%d форматов), добавляю кнопку мгновенного скачивания", len(cachedFormats))
@@ -1290,11 +2159,11 @@ func (b *LocalBot) SendAllFormats(chatID int64, text string, formats []services.
 	log.Printf("🔍 Детали всех форматов для меню:")
 	for i, f := range formats {
 		formatType := "🎥"
-		if f.Extension == "audio" {
+		if f.IsAudioOnly() {
 			formatType = "🎵"
 		}
 		log.Printf("  %s %d. ID: %s, Resolution: %s, Extension: %s, HasAudio: %v, Size: %s", 
-			formatType, i+1, f.ID, f.Resolution, f.Extension, f.HasAudio, f.FileSize)
+			formatType, i+1, f.ID, f.Resolution, f.Extension, f.HasAudio, f.SizeString())
 	}
 	
 	// Создаем inline keyboard для всех форматов
@@ -1304,13 +2173,16 @@ func (b *LocalBot) SendAllFormats(chatID int64, text string, formats []services.
 	for _, format := range formats {
 		// Выбираем иконку в зависимости от типа
 		icon := "🎥"
-		if format.Extension == "audio" {
+		if format.IsAudioOnly() {
 			icon = "🎵"
 		}
 		
-		buttonText := fmt.Sprintf("%s %s / %s", icon, format.Resolution, format.FileSize)
-		if format.FileSize == "" {
+		buttonText := fmt.Sprintf("%s %s / %s", icon, format.Resolution, format.SizeString())
+		if format.FileSize == 0 {
 			buttonText = fmt.Sprintf("%s %s / ~?", icon, format.Resolution)
+		} else if b.maxPartSize > 0 && format.FileSize > b.maxPartSize && !format.IsAudioOnly() {
+			// Будет отправлено несколькими частями
+			buttonText += " ✂️"
 		}
 		
 		// Создаем callback data для кнопки
@@ -1322,20 +2194,19 @@ func (b *LocalBot) SendAllFormats(chatID int64, text string, formats []services.
 				"callback_data": callbackData,
 			},
 		})
+		
+		// Слишком большой формат можно сжать до целевого размера
+		if button := b.compressButton(format); button != nil {
+			keyboard[len(keyboard)-1] = append(keyboard[len(keyboard)-1], button)
+		}
 	}
 	
 	// Проверяем, есть ли видео в кэше для мгновенного скачивания
 	videoURL, exists := b.getVideoURLCache(chatID)
 	if exists && videoURL != "" {
-		// Извлекаем videoID из URL
-		videoID := extractVideoID(videoURL)
+		// ID видео и пространство кэша ссылки чата
+		videoID, platform := b.cacheKey(chatID, videoURL)
 		if videoID != "" {
-			// Получаем платформу из кэша
-			platform := b.platformCache[chatID]
-			if platform == "" {
-				platform = "youtube" // По умолчанию YouTube
-			}
-			
 			// Проверяем, есть ли видео в кэше
 			if inCache, cachedFormats, err := b.isVideoInCache(videoID, platform); err == nil && inCache {
 				log.Printf("⚡ Видео найдено в кэше (%d форматов), добавляю кнопку мгновенного скачивания", len(cachedFormats))
@@ -1405,14 +2276,14 @@ func (b *LocalBot) SendAllFormats(chatID int64, text string, formats []services.
 }
 
 // SendAudioFormatsOnly отправляет только аудио форматы без кнопки "Мгновенно"
-func (b *LocalBot) SendAudioFormatsOnly(chatID int64, text string, formats []services.VideoFormat) error {
+func (b *LocalBot) SendAudioFormatsOnly(chatID, userID int64, text string, formats []services.VideoFormat) error {
 	log.Printf("🎵 Отправляю только аудио форматы (%d штук)", len(formats))
 	
 	// Отладка: показываем все форматы
 	log.Printf("🔍 Детали аудио форматов для меню:")
 	for i, f := range formats {
 		log.Printf("  🎵 %d. ID: %s, Resolution: %s, Extension: %s, HasAudio: %v, Size: %s", 
-			i+1, f.ID, f.Resolution, f.Extension, f.HasAudio, f.FileSize)
+			i+1, f.ID, f.Resolution, f.Extension, f.HasAudio, f.SizeString())
 	}
 	
 	// Создаем inline keyboard только для аудио форматов
@@ -1423,9 +2294,12 @@ func (b *LocalBot) SendAudioFormatsOnly(chatID int64, text string, formats []ser
 		// Используем значок для аудио
 		icon := "🎵"
 		
-		buttonText := fmt.Sprintf("%s %s / %s", icon, format.Resolution, format.FileSize)
-		if format.FileSize == "" {
+		buttonText := fmt.Sprintf("%s %s / %s", icon, format.Resolution, format.SizeString())
+		if format.FileSize == 0 {
 			buttonText = fmt.Sprintf("%s %s / ~?", icon, format.Resolution)
+		} else if b.maxPartSize > 0 && format.FileSize > b.maxPartSize && !format.IsAudioOnly() {
+			// Будет отправлено несколькими частями
+			buttonText += " ✂️"
 		}
 		
 		// Создаем callback data для кнопки
@@ -1437,20 +2311,43 @@ func (b *LocalBot) SendAudioFormatsOnly(chatID int64, text string, formats []ser
 				"callback_data": callbackData,
 			},
 		})
+		
+		// Слишком большой формат можно сжать до целевого размера
+		if button := b.compressButton(format); button != nil {
+			keyboard[len(keyboard)-1] = append(keyboard[len(keyboard)-1], button)
+		}
+	}
+	
+	// Формат, в который будет сохранен звук, выбирается в отдельном меню
+	keyboard = append(keyboard, []map[string]interface{}{
+		{
+			"text":          "🎚 Сохранить как: " + b.getUserAudioFormat(userID).Label,
+			"callback_data": "audio_menu",
+		},
+	})
+	
+	// Аудио с главами (альбомы, миксы, подкасты) можно разрезать на отдельные треки
+	if metadata, ok := b.getMetadataCache(chatID); ok && metadata != nil && len(metadata.Chapters) > 1 && len(formats) > 0 {
+		best := formats[0]
+		for _, format := range formats {
+			if format.FileSize > best.FileSize {
+				best = format
+			}
+		}
+		keyboard = append(keyboard, []map[string]interface{}{
+			{
+				"text":          fmt.Sprintf("🎼 По главам (%d треков)", len(metadata.Chapters)),
+				"callback_data": "chapters_" + best.ID,
+			},
+		})
 	}
 	
 	// Проверяем, есть ли видео в кэше для мгновенного скачивания
 	videoURL, exists := b.getVideoURLCache(chatID)
 	if exists && videoURL != "" {
-		// Извлекаем videoID из URL
-		videoID := extractVideoID(videoURL)
+		// ID видео и пространство кэша ссылки чата
+		videoID, platform := b.cacheKey(chatID, videoURL)
 		if videoID != "" {
-			// Получаем платформу из кэша
-			platform := b.platformCache[chatID]
-			if platform == "" {
-				platform = "youtube" // По умолчанию YouTube
-			}
-			
 			// Проверяем, есть ли видео в кэше
 			if inCache, cachedFormats, err := b.isVideoInCache(videoID, platform); err == nil && inCache {
 				log.Printf("⚡ Видео найдено в кэше (%d форматов), добавляю кнопку мгновенного скачивания", len(cachedFormats))
@@ -1529,9 +2426,12 @@ func (b *LocalBot) SendInlineKeyboard(chatID int64, text string, formats []servi
 		// Используем одинаковый значок для всех форматов
 		icon := "🎥"
 		
-		buttonText := fmt.Sprintf("%s %s / %s", icon, format.Resolution, format.FileSize)
-		if format.FileSize == "" {
+		buttonText := fmt.Sprintf("%s %s / %s", icon, format.Resolution, format.SizeString())
+		if format.FileSize == 0 {
 			buttonText = fmt.Sprintf("%s %s / ~?", icon, format.Resolution)
+		} else if b.maxPartSize > 0 && format.FileSize > b.maxPartSize && !format.IsAudioOnly() {
+			// Будет отправлено несколькими частями
+			buttonText += " ✂️"
 		}
 		
 		// Создаем callback data для кнопки
@@ -1543,6 +2443,11 @@ func (b *LocalBot) SendInlineKeyboard(chatID int64, text string, formats []servi
 				"callback_data": callbackData,
 			},
 		})
+		
+		// Слишком большой формат можно сжать до целевого размера
+		if button := b.compressButton(format); button != nil {
+			keyboard[len(keyboard)-1] = append(keyboard[len(keyboard)-1], button)
+		}
 	}
 	
 	// НЕ добавляем кнопку "Мгновенно" в подменю форматов
@@ -1620,15 +2525,39 @@ type Update struct {
 type CallbackQuery struct {
 	ID   string  `json:"id"`
 	Data string  `json:"data"`
+	From User    `json:"from"`
 	Message *Message `json:"message"`
 }
 
 // Message представляет сообщение от Telegram
 type Message struct {
-	MessageID int64  `json:"message_id"`
-	Text      string `json:"text"`
-	Chat      Chat   `json:"chat"`
-	From      User   `json:"from"`
+	MessageID       int64           `json:"message_id"`
+	Text            string          `json:"text"`
+	Caption         string          `json:"caption,omitempty"`
+	Entities        []MessageEntity `json:"entities,omitempty"`
+	CaptionEntities []MessageEntity `json:"caption_entities,omitempty"`
+	Chat            Chat            `json:"chat"`
+	From            User            `json:"from"`
+}
+
+// MessageEntity представляет разметку в тексте сообщения (нужны только скрытые ссылки text_link)
+type MessageEntity struct {
+	Type string `json:"type"`
+	URL  string `json:"url,omitempty"`
+}
+
+// links находит ссылки в тексте, подписи к медиа и скрытых ссылках сообщения
+// (в том числе пересланного)
+func (m *Message) links() []services.Link {
+	var entityURLs []string
+	for _, entities := range [][]MessageEntity{m.Entities, m.CaptionEntities} {
+		for _, entity := range entities {
+			if entity.Type == "text_link" && entity.URL != "" {
+				entityURLs = append(entityURLs, entity.URL)
+			}
+		}
+	}
+	return services.FindLinks(m.Text+"\n"+m.Caption, entityURLs)
 }
 
 // User представляет пользователя Telegram
@@ -1678,9 +2607,42 @@ func main() {
 		log.Fatalf("❌ Ошибка создания кэш-сервиса: %v", err)
 	}
 	defer cacheService.Close()
+	if cfg.EvictUploadedFiles {
+		// Файлы, уже загруженные в Telegram, отправляются по file_id - локальная копия не нужна
+		cacheService.SetEvictUploaded(true)
+		log.Printf("📤 Включено вытеснение загруженных в Telegram файлов")
+	}
 	
 	// Создаем локального бота
-	bot := NewLocalBot(cfg.TelegramToken, cfg.TelegramAPI, time.Duration(cfg.HTTPTimeout)*time.Second, youtubeService, universalService, cacheService, cfg.Proxy)
+	bot := NewLocalBot(cfg.TelegramToken, cfg.TelegramAPI, time.Duration(cfg.HTTPTimeout)*time.Second, youtubeService, universalService, cacheService, cfg.Proxy, services.UserLimits{
+		MaxConcurrent: cfg.UserMaxConcurrent,
+		MaxQueued:     cfg.UserMaxQueued,
+	})
+
+	if cfg.CompressTargetMB > 0 {
+		bot.compressTarget = int64(cfg.CompressTargetMB) * 1024 * 1024
+	}
+	if cfg.GenericExtractor {
+		// Ссылки с разрешенных администраторами доменов разбирает yt-dlp
+		genericDomains, err := services.NewDomainList(cacheService, cfg.GenericAllowDomains, cfg.GenericDenyDomains)
+		if err != nil {
+			log.Fatalf("❌ Ошибка загрузки доменов универсального извлечения: %v", err)
+		}
+		universalService.SetGenericExtractor(genericDomains)
+		bot.genericDomains = genericDomains
+		allow, deny := genericDomains.Domains()
+		log.Printf("🌐 Универсальное извлечение включено: разрешено доменов %d, запрещено %d", len(allow), len(deny))
+	}
+	if cfg.SplitLargeVideos {
+		// Большие форматы больше не скрываются: после скачивания их режут на части
+		youtubeService.SetSplitOversized(true)
+		universalService.SetSplitOversized(true)
+		bot.maxPartSize = cfg.MaxPartSize
+		if bot.maxPartSize <= 0 || bot.maxPartSize > services.TelegramMaxFileSize {
+			bot.maxPartSize = services.TelegramMaxFileSize
+		}
+		log.Printf("✂️ Видео больше %s будут разрезаны на части", formatFileSize(bot.maxPartSize))
+	}
 
 	// Проверяем подключение к локальному серверу Telegram API
 	if err := bot.GetMe(); err != nil {
@@ -1821,6 +2783,7 @@ func main() {
 /ping - Проверка отзывчивости
 /version - Информация о версии
 /history - История скачиваний
+/cancel - Отменить текущие загрузки
 
 🔒 Административные команды:
 /stats - Детальная статистика (только для админов)
@@ -1875,6 +2838,13 @@ func main() {
 							health["telegram"], health["yt-dlp"],
 							len(bot.formatCache), len(bot.videoURLCache))
 						bot.SendMessage(message.Chat.ID, statusText)
+					} else if message.Text == "/generic" || strings.HasPrefix(message.Text, "/generic ") {
+						// Управление доменами универсального извлечения (только для админов)
+						if !bot.IsAdmin(message.From.ID) {
+							bot.SendMessage(message.Chat.ID, "❌ Доступ запрещен\n\n🔒 Эта команда доступна только администраторам")
+							continue
+						}
+						bot.handleGenericCommand(message.Chat.ID, strings.Fields(strings.TrimPrefix(message.Text, "/generic")))
 					} else if message.Text == "/stats" {
 						// Проверяем, является ли пользователь администратором
 						if !bot.IsAdmin(message.From.ID) {
@@ -1981,6 +2951,13 @@ func main() {
 
 🔄 История обновляется в реальном времени`
 						bot.SendMessage(message.Chat.ID, historyText)
+					} else if message.Text == "/cancel" {
+						if cancelled := bot.cancelDownloads(message.Chat.ID, 0); cancelled > 0 {
+							log.Printf("✖️ Пользователь отменил загрузки в чате %d: %d", message.Chat.ID, cancelled)
+							bot.SendMessage(message.Chat.ID, fmt.Sprintf("✖ Отменено загрузок: %d", cancelled))
+						} else {
+							bot.SendMessage(message.Chat.ID, "ℹ️ Нет активных загрузок для отмены")
+						}
 					} else if message.Text == "/version" {
 						versionText := `📋 Информация о версии
 
@@ -2009,30 +2986,66 @@ func main() {
 
 💡 Для получения справки используйте /help`
 						bot.SendMessage(message.Chat.ID, versionText)
-					} else if len(message.Text) > 10 && bot.universalService.IsValidURL(message.Text) {
-						// Видео ссылка - показываем доступные форматы
-						log.Printf("🔍 Обрабатываю видео ссылку: %s", message.Text)
-						
-						// Валидация URL на безопасность
-						if !bot.validateURL(message.Text) {
-							bot.SendMessage(message.Chat.ID, "❌ Небезопасная ссылка. Используйте только YouTube ссылки.")
+					} else if clip, ok := services.ParseTimeRange(message.Text); ok && bot.isAwaitingClip(message.Chat.ID) {
+						// Фрагмент после нажатия "✂️ Обрезать"
+						if _, exists := bot.getVideoURLCache(message.Chat.ID); !exists {
+							bot.setClipRange(message.Chat.ID, nil)
+							bot.SendMessage(message.Chat.ID, "❌ Сначала отправьте ссылку на видео")
 							continue
 						}
-						
-						// Определяем платформу
-						platformInfo := bot.universalService.GetPlatformInfo(message.Text)
-						log.Printf("🎯 Обнаружена платформа: %s %s", platformInfo.Icon, platformInfo.DisplayName)
-						
-						// Дополнительная валидация URL перед обработкой
-						if !platformInfo.Supported {
-							bot.SendMessage(message.Chat.ID, "❌ Неверный формат ссылки\n\n💡 Поддерживаемые платформы:\n🎬 YouTube\n🎬 YouTube Shorts")
-							continue
+						if metadata, ok := bot.getMetadataCache(message.Chat.ID); ok && metadata != nil {
+							fitted, ok := clip.FitDuration(metadata.DurationSeconds)
+							if !ok {
+								bot.SendMessage(message.Chat.ID, fmt.Sprintf("❌ Фрагмент начинается после конца видео (%s). Отправьте другой фрагмент", services.FormatTimestamp(metadata.DurationSeconds)))
+								continue
+							}
+							clip = &fitted
 						}
+						bot.setClipRange(message.Chat.ID, clip)
+						log.Printf("✂️ Чат %d: задан фрагмент %s", message.Chat.ID, clip)
+						bot.SendMessage(message.Chat.ID, fmt.Sprintf("✅ Будет скачан фрагмент %s\n\n💡 Выберите формат в меню выше", clip))
+					} else if links := message.links(); len(links) > 0 {
+						// Ссылки из текста, подписи или пересланного сообщения - короткие ссылки
+						// раскрываются по сети, поэтому разбор идет в горутине
+						log.Printf("🔗 Найдено ссылок в сообщении: %d", len(links))
 						
-						// Защита от спама уже проверена выше в основном цикле
-						
-						// Запускаем обработку в worker pool
-						go func(url string, chatID int64, platform services.PlatformInfo) {
+						go func(links []services.Link, chatID int64) {
+							ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+							links = services.ResolveLinks(ctx, links, bot.validateURL)
+							cancel()
+							if len(links) == 0 {
+								bot.SendMessage(chatID, "❌ В сообщении нет ссылок на поддерживаемые видео\n\n💡 Поддерживаемые платформы:\n"+supportedPlatformsText(bot.universalService.GetSupportedPlatforms()))
+								return
+							}
+							if len(links) > 1 {
+								// Меню форматов в чате одно - несколько ссылок сразу ставим в очередь загрузок
+								userID := message.From.ID
+								if userID == 0 {
+									userID = chatID
+								}
+								log.Printf("🔗 Чат %d: %d ссылок ставлю в очередь", chatID, len(links))
+								bot.SendMessage(chatID, fmt.Sprintf("🔗 Ссылок в сообщении: %d. Скачиваю все, каждая придет отдельным файлом.", len(links)))
+								for _, link := range links {
+									go bot.downloadLink(chatID, userID, link)
+								}
+								return
+							}
+							url, clip := links[0].URL, links[0].Clip
+							log.Printf("🔍 Обрабатываю видео ссылку: %s", url)
+							
+							// Определяем платформу
+							platformInfo := bot.universalService.GetPlatformInfo(url)
+							log.Printf("🎯 Обнаружена платформа: %s %s", platformInfo.Icon, platformInfo.DisplayName)
+							
+							// Дополнительная валидация URL перед обработкой
+							if !platformInfo.Supported {
+								bot.SendMessage(chatID, "❌ Неверный формат ссылки\n\n💡 Поддерживаемые платформы:\n"+supportedPlatformsText(bot.universalService.GetSupportedPlatforms()))
+								return
+							}
+							platform := *platformInfo
+							
+							// Защита от спама уже проверена выше в основном цикле
+							
 							// Получаем worker из pool
 							bot.acquireWorker()
 							defer bot.releaseWorker()
@@ -2051,54 +3064,18 @@ func main() {
 							log.Printf("🚀 Запускаю анализ видео для: %s", url)
 							bot.SendMessage(chatID, "🔍 Анализирую видео... ⏳ Пожалуйста, подождите до 2 минут для больших видео.")
 							
-							// Получаем метаданные видео для превью
-							log.Printf("🔍 ОТЛАДКА: platform.Type = %s", platform.Type)
-							log.Printf("🔍 ОТЛАДКА: PlatformYouTube = %s", services.PlatformYouTube)
-							log.Printf("🔍 ОТЛАДКА: PlatformYouTubeShorts = %s", services.PlatformYouTubeShorts)
-							
-							var metadata *services.VideoMetadata
-							if platform.Type == services.PlatformYouTube || platform.Type == services.PlatformYouTubeShorts {
-								log.Printf("🔍 Получаю метаданные для YouTube видео...")
-								log.Printf("🔍 URL для метаданных: %s", url)
-								log.Printf("🔍 ChatID для метаданных: %d", chatID)
-								
-								metadata, err := bot.youtubeService.GetVideoMetadata(url)
-								if err != nil {
-									log.Printf("❌ ОШИБКА получения метаданных: %v", err)
-									log.Printf("❌ Детали ошибки: %+v", err)
-									// Продолжаем без метаданных
-								} else {
-									log.Printf("✅ Метаданные получены успешно!")
-									log.Printf("✅ Заголовок: %s", metadata.Title)
-									log.Printf("✅ Автор: %s", metadata.Author)
-									log.Printf("✅ Миниатюра: %s", metadata.Thumbnail)
-									log.Printf("✅ Отправляю превью...")
-									
-									// Отправляем превью с метаданными
-									if err := bot.SendVideoPreview(chatID, metadata); err != nil {
-										log.Printf("❌ ОШИБКА отправки превью: %v", err)
-										log.Printf("❌ Детали ошибки отправки: %+v", err)
-									} else {
-										log.Printf("✅ Превью отправлено успешно!")
-									}
-								}
-							} else {
-								log.Printf("⚠️ Платформа %s не поддерживает метаданные", platform.Type)
-							}
-							
-							// Получаем список форматов
-							log.Printf("📋 Вызываю GetVideoFormats для %s...", platform.DisplayName)
-							// Получаем доступные форматы через youtubeService для YouTube
-							var formats []services.VideoFormat
+							// Получаем метаданные и форматы одним вызовом yt-dlp
+							log.Printf("📋 Вызываю GetVideoInfo для %s...", platform.DisplayName)
+							var info *services.VideoInfo
 							var err error
 							
 							if platform.Type == services.PlatformYouTube || platform.Type == services.PlatformYouTubeShorts {
-								formats, err = bot.youtubeService.GetVideoFormats(url)
+								info, err = bot.youtubeService.GetVideoInfo(url)
 							} else {
-								formats, err = bot.universalService.GetVideoFormats(url)
+								info, err = bot.universalService.GetVideoInfo(url)
 							}
 							if err != nil {
-								log.Printf("❌ Ошибка GetVideoFormats: %v", err)
+								log.Printf("❌ Ошибка GetVideoInfo: %v", err)
 								
 								// Улучшенные сообщения об ошибках для пользователя
 								var userMessage string
@@ -2127,15 +3104,24 @@ func main() {
 								return
 							}
 							
+							metadata := info.Metadata
+							formats := info.Formats
 							log.Printf("📊 Получено форматов: %d", len(formats))
+							if platform.Type == services.PlatformGeneric {
+								// Платформу и ID ссылки с произвольного сайта определил yt-dlp
+								platform = *bot.universalService.GetPlatformInfo(url)
+							}
 							
-							// Уведомляем о завершении анализа
-							if metadata != nil {
-								bot.SendMessage(chatID, "✅ Анализ завершен! Найдено несколько доступных форматов.")
+							// Отправляем превью с метаданными
+							if err := bot.SendVideoPreview(chatID, metadata); err != nil {
+								log.Printf("❌ ОШИБКА отправки превью: %v", err)
 							} else {
-								bot.SendMessage(chatID, "✅ Анализ завершен! Найдено несколько доступных форматов.")
+								log.Printf("✅ Превью отправлено успешно!")
 							}
 							
+							// Уведомляем о завершении анализа
+							bot.SendMessage(chatID, "✅ Анализ завершен! Найдено несколько доступных форматов.")
+							
 							// Проверяем, что URL в кэше соответствует текущему запросу
 							cachedURL, exists := bot.getVideoURLCache(chatID)
 							if exists && cachedURL != "" && cachedURL != url {
@@ -2151,7 +3137,7 @@ func main() {
 							log.Printf("🔍 Детали полученных форматов:")
 							for i, f := range formats {
 								log.Printf("  %d. ID: %s, Extension: %s, Resolution: %s, HasAudio: %v, Size: %s", 
-									i+1, f.ID, f.Extension, f.Resolution, f.HasAudio, f.FileSize)
+									i+1, f.ID, f.Extension, f.Resolution, f.HasAudio, f.SizeString())
 							}
 							
 							if len(formats) == 0 {
@@ -2163,8 +3149,13 @@ func main() {
 							// Сохраняем форматы, URL и платформу в кэше для этого чата thread-safe
 							bot.setFormatCache(chatID, formats)
 							bot.setVideoURLCache(chatID, url)
-							bot.setPlatformCache(chatID, string(platform.Type))
+							bot.setPlatformCache(chatID, platform.CacheNamespace)
+							bot.setMetadataCache(chatID, metadata)
+							bot.setClipRange(chatID, clip)
 							log.Printf("💾 Сохранил в кэш: %d форматов, URL: %s, платформа: %s для чата %d", len(formats), url, platform.Type, chatID)
+							if clip != nil {
+								bot.SendMessage(chatID, fmt.Sprintf("✂️ Будет скачан только фрагмент %s", clip))
+							}
 							
 							// Разделяем форматы на аудио и видео
 							var audioFormats []services.VideoFormat
@@ -2178,7 +3169,7 @@ func main() {
 							for _, format := range formats {
 								log.Printf("🔍 Разделяю формат: %s %s %s (тип: %s, аудио: %v)", 
 									format.ID, format.Resolution, format.Extension, format.Extension, format.HasAudio)
-								if format.Extension == "audio" {
+								if format.IsAudioOnly() {
 									audioFormats = append(audioFormats, format)
 									log.Printf("🎵 Добавлен в аудио: %s", format.ID)
 								} else {
@@ -2195,8 +3186,8 @@ func main() {
 								
 								// Сортируем форматы по размеру файла (от меньшего к большему)
 								sort.Slice(formats, func(i, j int) bool {
-									sizeI := parseFileSize(formats[i].FileSize)
-									sizeJ := parseFileSize(formats[j].FileSize)
+									sizeI := formats[i].FileSize
+									sizeJ := formats[j].FileSize
 									return sizeI < sizeJ
 								})
 								
@@ -2208,7 +3199,7 @@ func main() {
 									if f.HasAudio {
 										bestFormat = &f
 										log.Printf("🎵 Найден формат с аудио для %s: %s (%s)", 
-											resolution, f.ID, f.FileSize)
+											resolution, f.ID, f.SizeString())
 										break
 									}
 								}
@@ -2217,13 +3208,13 @@ func main() {
 								if bestFormat == nil {
 									bestFormat = &formats[0]
 									log.Printf("📹 Нет аудио для %s, беру самый маленький: %s (%s)", 
-										resolution, bestFormat.ID, bestFormat.FileSize)
+										resolution, bestFormat.ID, bestFormat.SizeString())
 								}
 								
 								// Добавляем лучший формат
 								videoFormats = append(videoFormats, *bestFormat)
 								log.Printf("🎥 Добавлен в видео: %s (%s) - %s (аудио: %v)", 
-									bestFormat.ID, bestFormat.Resolution, bestFormat.FileSize, bestFormat.HasAudio)
+									bestFormat.ID, bestFormat.Resolution, bestFormat.SizeString(), bestFormat.HasAudio)
 							}
 							
 							log.Printf("📊 Найдено %d аудио и %d видео форматов", len(audioFormats), len(videoFormats))
@@ -2233,7 +3224,7 @@ func main() {
 								log.Printf("⚠️ ВНИМАНИЕ: Мало видео форматов! Проверяю детали:")
 								for i, f := range videoFormats {
 									log.Printf("  🎥 %d. ID: %s, Resolution: %s, Extension: %s, HasAudio: %v, Size: %s", 
-										i+1, f.ID, f.Resolution, f.Extension, f.HasAudio, f.FileSize)
+										i+1, f.ID, f.Resolution, f.Extension, f.HasAudio, f.SizeString())
 								}
 							}
 							
@@ -2246,6 +3237,26 @@ func main() {
 							}
 							log.Printf("🎵 Видео форматов со звуком: %d из %d", videoWithAudio, len(videoFormats))
 							
+							// Платформа только со звуком (SoundCloud) - сразу меню аудио, без видео форматов
+							if platform.AudioOnly {
+								if len(audioFormats) == 0 {
+									bot.SendMessage(chatID, "❌ Не найдено аудио форматов. Попробуйте другую ссылку.")
+									return
+								}
+								userID := message.From.ID
+								if userID == 0 {
+									userID = chatID
+								}
+								if err := bot.SendAudioFormatsOnly(chatID, userID, "🎧 Аудио форматы:", audioFormats); err != nil {
+									log.Printf("❌ Ошибка отправки аудио форматов: %v", err)
+									bot.SendMessage(chatID, "❌ Ошибка создания меню форматов")
+									bot.UpdateMetrics("get_formats", false, time.Since(startTime))
+									return
+								}
+								bot.UpdateMetrics("get_formats", true, time.Since(startTime))
+								return
+							}
+							
 							// Проверяем, есть ли видео форматы с аудио
 							if len(videoFormats) == 0 {
 								log.Printf("⚠️ НЕ НАЙДЕНО видео форматов с аудио!")
@@ -2293,7 +3304,7 @@ func main() {
 							
 							// НЕ скачиваем автоматически - ждем команду пользователя
 							log.Printf("⏸️ Ожидаю выбор пользователя...")
-						}(message.Text, message.Chat.ID, *platformInfo)
+						}(links, message.Chat.ID)
 					} else if message.Text == "best" || message.Text == "1" {
 						// Пользователь выбрал формат - скачиваем
 						log.Printf("🎯 Пользователь выбрал формат: %s", message.Text)
@@ -2311,10 +3322,106 @@ func main() {
 					callback := update.CallbackQuery
 					log.Printf("🎯 Получен callback: %s", callback.Data)
 					
-					if callback.Data == "type_audio" {
+					if callback.Data == "cancel_download" {
+						// Кнопка "✖ Отмена" под статусным сообщением загрузки
+						bot.AnswerCallbackQuery(callback.ID)
+						if bot.cancelDownloads(callback.Message.Chat.ID, callback.Message.MessageID) == 0 {
+							log.Printf("ℹ️ Загрузка для сообщения %d уже завершена", callback.Message.MessageID)
+						}
+					} else if callback.Data == "clip_ask" {
+						// Пользователь хочет скачать только фрагмент - ждем диапазон следующим сообщением
+						bot.AnswerCallbackQuery(callback.ID)
+						bot.setAwaitingClip(callback.Message.Chat.ID)
+						bot.SendMessage(callback.Message.Chat.ID, "✂️ Отправьте фрагмент, который нужно скачать, например:\n\n01:20-02:45\n1:02:03-1:10:00")
+					} else if callback.Data == "clip_clear" {
+						// Пользователь передумал обрезать
+						bot.AnswerCallbackQuery(callback.ID)
+						bot.setClipRange(callback.Message.Chat.ID, nil)
+						bot.SendMessage(callback.Message.Chat.ID, "✅ Обрезка отменена, будет скачано все видео")
+					} else if callback.Data == "audio_menu" {
+						// Меню формата, в который сохраняется звук
+						bot.AnswerCallbackQuery(callback.ID)
+						userID := callback.From.ID
+						if userID == 0 {
+							userID = callback.Message.Chat.ID
+						}
+						if _, err := bot.SendMessageWithID(callback.Message.Chat.ID, "🎚 В каком формате сохранять звук?", audioOutputKeyboard(bot.getUserAudioFormat(userID))); err != nil {
+							log.Printf("❌ Ошибка отправки меню форматов звука: %v", err)
+						}
+					} else if strings.HasPrefix(callback.Data, "audio_out_") {
+						// Пользователь выбрал формат звука - запоминаем его
+						bot.AnswerCallbackQuery(callback.ID)
+						userID := callback.From.ID
+						if userID == 0 {
+							userID = callback.Message.Chat.ID
+						}
+						output := services.AudioOutputByKey(strings.TrimPrefix(callback.Data, "audio_out_"))
+						if err := bot.cacheService.SetUserAudioFormat(userID, output.Key); err != nil {
+							log.Printf("❌ %v", err)
+							bot.SendMessage(callback.Message.Chat.ID, "❌ Не удалось сохранить формат звука")
+							continue
+						}
+						log.Printf("🎚 Пользователь %d выбрал формат звука %s", userID, output.Key)
+						text := fmt.Sprintf("✅ Звук будет сохраняться как %s.\n\nВыберите аудиоформат еще раз, чтобы скачать.", output.Label)
+						if err := bot.EditMessageText(callback.Message.Chat.ID, callback.Message.MessageID, text, audioOutputKeyboard(output)); err != nil {
+							bot.SendMessage(callback.Message.Chat.ID, text)
+						}
+					} else if strings.HasPrefix(callback.Data, "chapters_") {
+						// Пользователь хочет получить аудио отдельными треками по главам
+						bot.AnswerCallbackQuery(callback.ID)
+						userID := callback.From.ID
+						if userID == 0 {
+							userID = callback.Message.Chat.ID
+						}
+						go bot.downloadChapters(callback.Message.Chat.ID, userID, strings.TrimPrefix(callback.Data, "chapters_"))
+					} else if callback.Data == "subs_menu" {
+						// Меню субтитров
+						bot.AnswerCallbackQuery(callback.ID)
+						metadata, ok := bot.getMetadataCache(callback.Message.Chat.ID)
+						if !ok || metadata == nil || len(metadata.Subtitles) == 0 {
+							bot.SendMessage(callback.Message.Chat.ID, "❌ Субтитры не найдены. Отправьте ссылку заново.")
+							continue
+						}
+						text := "💬 Выберите субтитры:\n\nSRT/VTT - файл субтитров, 📝 - текст без таймингов, 🔥 - вшить в видео"
+						if _, err := bot.SendMessageWithID(callback.Message.Chat.ID, text, subtitlesKeyboard(metadata.Subtitles)); err != nil {
+							log.Printf("❌ Ошибка отправки меню субтитров: %v", err)
+						}
+					} else if callback.Data == "subs_burn_clear" {
+						// Пользователь передумал вшивать субтитры
+						bot.AnswerCallbackQuery(callback.ID)
+						bot.setBurnSubtitle(callback.Message.Chat.ID, nil)
+						bot.SendMessage(callback.Message.Chat.ID, "✅ Субтитры не будут вшиты в видео")
+					} else if strings.HasPrefix(callback.Data, "subs_") {
+						// Выбрана дорожка субтитров: subs_<номер>_<srt|vtt|txt|burn>
+						bot.AnswerCallbackQuery(callback.ID)
+						parts := strings.Split(callback.Data, "_")
+						metadata, ok := bot.getMetadataCache(callback.Message.Chat.ID)
+						index := -1
+						if len(parts) == 3 {
+							if n, err := strconv.Atoi(parts[1]); err == nil {
+								index = n
+							}
+						}
+						if !ok || metadata == nil || index < 0 || index >= len(metadata.Subtitles) {
+							bot.SendMessage(callback.Message.Chat.ID, "❌ Субтитры не найдены. Отправьте ссылку заново.")
+							continue
+						}
+						track := metadata.Subtitles[index]
+						if parts[2] == "burn" {
+							bot.setBurnSubtitle(callback.Message.Chat.ID, &track)
+							bot.SendMessage(callback.Message.Chat.ID, fmt.Sprintf("🔥 Субтитры %s будут вшиты в видео.\n\nВыберите видео формат в меню выше.", track.Label()))
+						} else {
+							log.Printf("💬 Пользователь запросил субтитры %s (%s)", track.Language, parts[2])
+							go bot.sendSubtitles(callback.Message.Chat.ID, track, parts[2])
+						}
+					} else if callback.Data == "type_audio" {
 						// Пользователь выбрал аудио форматы
 						log.Printf("🎵 Пользователь выбрал аудио форматы")
 						bot.AnswerCallbackQuery(callback.ID)
+						userID := callback.From.ID
+						if userID == 0 {
+							userID = callback.Message.Chat.ID
+						}
 						
 						// Показываем список аудио форматов
 						formats, exists := bot.getFormatCache(callback.Message.Chat.ID)
@@ -2324,7 +3431,7 @@ func main() {
 						}
 						var audioFormats []services.VideoFormat
 						for _, format := range formats {
-							if format.Extension == "audio" {
+							if format.IsAudioOnly() {
 								audioFormats = append(audioFormats, format)
 							}
 						}
@@ -2333,7 +3440,7 @@ func main() {
 						
 						if len(audioFormats) > 0 {
 							// Отправляем аудио форматы БЕЗ кнопки "Мгновенно"
-							bot.SendAudioFormatsOnly(callback.Message.Chat.ID, "🎵 Аудио форматы:", audioFormats)
+							bot.SendAudioFormatsOnly(callback.Message.Chat.ID, userID, "🎵 Аудио форматы:", audioFormats)
 						} else {
 							bot.SendMessage(callback.Message.Chat.ID, "❌ Аудио форматы не найдены")
 						}
@@ -2355,7 +3462,7 @@ func main() {
 						resolutionGroups := make(map[string][]services.VideoFormat)
 						
 						for _, format := range formats {
-							if format.Extension != "audio" {
+							if !format.IsAudioOnly() {
 								// Группируем по разрешению
 								resolutionGroups[format.Resolution] = append(resolutionGroups[format.Resolution], format)
 							}
@@ -2370,8 +3477,8 @@ func main() {
 							
 							// Сортируем форматы по размеру файла (от меньшего к большему)
 							sort.Slice(formatList, func(i, j int) bool {
-								sizeI := parseFileSize(formatList[i].FileSize)
-								sizeJ := parseFileSize(formatList[j].FileSize)
+								sizeI := formatList[i].FileSize
+								sizeJ := formatList[j].FileSize
 								return sizeI < sizeJ
 							})
 							
@@ -2383,7 +3490,7 @@ func main() {
 								if f.HasAudio {
 									bestFormat = &f
 									log.Printf("🎵 Найден формат с аудио для %s: %s (%s)", 
-										resolution, f.ID, f.FileSize)
+										resolution, f.ID, f.SizeString())
 									break
 								}
 							}
@@ -2392,13 +3499,13 @@ func main() {
 							if bestFormat == nil {
 								bestFormat = &formatList[0]
 								log.Printf("📹 Нет аудио для %s, беру самый маленький: %s (%s)", 
-									resolution, bestFormat.ID, bestFormat.FileSize)
+									resolution, bestFormat.ID, bestFormat.SizeString())
 							}
 							
 							// Добавляем лучший формат
 							videoFormats = append(videoFormats, *bestFormat)
 							log.Printf("🎥 Добавлен в видео: %s (%s) - %s (аудио: %v)", 
-								bestFormat.ID, bestFormat.Resolution, bestFormat.FileSize, bestFormat.HasAudio)
+								bestFormat.ID, bestFormat.Resolution, bestFormat.SizeString(), bestFormat.HasAudio)
 						}
 						
 						// Сортируем по разрешению
@@ -2413,17 +3520,91 @@ func main() {
 							bot.SendMessage(callback.Message.Chat.ID, "❌ Не найдено видео форматов с аудио. Попробуйте другое видео.")
 						}
 						
-					} else if strings.HasPrefix(callback.Data, "format_") {
-						// Пользователь выбрал формат
-						parts := strings.Split(callback.Data, "_")
-						if len(parts) >= 2 {
-							formatID := parts[1]
+					} else if strings.HasPrefix(callback.Data, "compress_") {
+						// Пользователь хочет сжать формат - предлагаем размеры, до которых можно сжать
+						bot.AnswerCallbackQuery(callback.ID)
+						formatID := strings.TrimPrefix(callback.Data, "compress_")
+						var fileSize int64
+						if cachedFormats, exists := bot.getFormatCache(callback.Message.Chat.ID); exists {
+							for _, format := range cachedFormats {
+								if format.ID == formatID {
+									fileSize = format.FileSize
+									break
+								}
+							}
+						}
+						targets := services.CompressTargets(fileSize, bot.compressTarget)
+						if len(targets) == 0 {
+							bot.SendMessage(callback.Message.Chat.ID, "❌ Этот формат не нужно сжимать. Выберите формат еще раз.")
+							continue
+						}
+						if _, err := bot.SendMessageWithID(callback.Message.Chat.ID, "🗜 До какого размера сжать видео?", compressTargetsKeyboard(formatID, targets)); err != nil {
+							log.Printf("❌ Ошибка отправки меню сжатия: %v", err)
+						}
+					} else if strings.HasPrefix(callback.Data, "format_") || strings.HasPrefix(callback.Data, "fit_") {
+						// Пользователь выбрал формат (fit_ - то же, но со сжатием до выбранного размера)
+						if formatID := formatFromCallback(callback.Data); formatID != "" {
 							log.Printf("📹 Пользователь выбрал формат: %s", formatID)
+							
+							userID := callback.From.ID
+							if userID == 0 {
+								userID = callback.Message.Chat.ID
+							}
+							
+							// Аудиорежим определяется по выбранному формату: только звук без видео
+							isAudioFormat := services.IsAudioFormatID(formatID)
+							if cachedFormats, exists := bot.getFormatCache(callback.Message.Chat.ID); exists {
+								for _, format := range cachedFormats {
+									if format.ID == formatID {
+										isAudioFormat = format.IsAudioOnly()
+										break
+									}
+								}
+							}
+							
+							// Фрагмент, другой формат звука и сжатый файл кэшируются отдельно от исходного формата
+							downloadOpts := services.DownloadOptions{Clip: bot.getClipRange(callback.Message.Chat.ID), Audio: isAudioFormat}
+							if isAudioFormat {
+								downloadOpts.AudioFormat = bot.getUserAudioFormat(userID).Key
+							}
+							cacheFormatID := downloadOpts.FileFormatID(formatID)
+							clip := downloadOpts.Clip
+							if clip != nil {
+								log.Printf("✂️ Будет скачан фрагмент %s", clip)
+							}
+							var burnTrack *services.SubtitleTrack
+							if !isAudioFormat {
+								if burnTrack = bot.getBurnSubtitle(callback.Message.Chat.ID); burnTrack != nil {
+									cacheFormatID = services.SubtitleFormatID(cacheFormatID, *burnTrack)
+									log.Printf("🔥 В видео будут вшиты субтитры %s", burnTrack.Language)
+								}
+							}
+							compressTarget := compressTargetFromCallback(callback.Data, bot.compressTarget)
+							if compressTarget > 0 {
+								cacheFormatID = compressedFormatID(cacheFormatID, compressTarget)
+								log.Printf("🗜 Видео будет сжато до %s", formatFileSize(compressTarget))
+							}
 							bot.AnswerCallbackQuery(callback.ID)
-							bot.SendMessage(callback.Message.Chat.ID, fmt.Sprintf("⏳ Скачиваю видео в формате %s...", formatID))
 							
 							// Запускаем загрузку в отдельной горутине с download pool
 							go func() {
+								// Лимит на пользователя: сверх MaxConcurrent загрузки ждут, сверх очереди - отказ
+								userSlots, userTotal, ok := bot.reserveUserDownload(userID)
+								if !ok {
+									log.Printf("⚖️ Пользователь %d превысил лимит загрузок (%d)", userID, userTotal)
+									bot.SendMessage(callback.Message.Chat.ID, fmt.Sprintf("⏳ У вас уже %d загрузок в очереди (одновременно: %d, в очереди: %d).\n\n💡 Дождитесь их завершения или отмените /cancel",
+										userTotal, bot.userLimits.MaxConcurrent, bot.userLimits.MaxQueued))
+									return
+								}
+								defer bot.releaseUserDownload(userID, userSlots)
+								
+								if position := userTotal - bot.userLimits.MaxConcurrent; bot.userLimits.MaxConcurrent > 0 && position > 0 {
+									bot.SendMessage(callback.Message.Chat.ID, fmt.Sprintf("⏳ У вас %d загрузок, эта в очереди на позиции %d. Скачаю в формате %s после предыдущих...", userTotal, position, formatID))
+								} else {
+									bot.SendMessage(callback.Message.Chat.ID, fmt.Sprintf("⏳ Скачиваю видео в формате %s...", formatID))
+								}
+								bot.acquireUserDownload(userSlots)
+								
 								// Получаем download slot
 								bot.acquireDownload()
 								defer bot.releaseDownload()
@@ -2440,7 +3621,7 @@ func main() {
 							}
 							
 							// Проверяем, что URL в кэше соответствует текущему запросу
-							if !strings.Contains(videoURL, "youtube.com") && !strings.Contains(videoURL, "youtu.be") {
+							if !bot.universalService.IsValidURL(videoURL) {
 								log.Printf("❌ URL в кэше недействителен: %s", videoURL)
 								bot.SendMessage(callback.Message.Chat.ID, "❌ Ошибка: недействительный URL в кэше. Отправьте ссылку заново.")
 								return
@@ -2453,7 +3634,7 @@ func main() {
 							
 							// Проверяем, что URL в кэше соответствует текущему запросу
 							// Если URL не соответствует - очищаем кэш и просим отправить ссылку заново
-							if !strings.Contains(videoURL, "youtube.com") && !strings.Contains(videoURL, "youtu.be") {
+							if !bot.universalService.IsValidURL(videoURL) {
 								log.Printf("❌ URL в кэше недействителен: %s", videoURL)
 								bot.SendMessage(callback.Message.Chat.ID, "❌ Ошибка: недействительный URL в кэше. Отправьте ссылку заново.")
 								return
@@ -2462,25 +3643,33 @@ func main() {
 							log.Printf("🔗 Использую URL из кэша: %s", videoURL)
 								
 								if videoURL != "" {
-									// Получаем платформу из кэша
-									platform := bot.platformCache[callback.Message.Chat.ID]
-									if platform == "" {
-										platform = "youtube" // По умолчанию YouTube
-									}
-									
-									// Определяем платформу и извлекаем Video ID
-									platformInfo := bot.universalService.GetPlatformInfo(videoURL)
-									videoID := platformInfo.VideoID
+									// ID видео и пространство кэша ссылки чата
+									videoID, platform := bot.cacheKey(callback.Message.Chat.ID, videoURL)
 									if videoID == "" {
 										log.Printf("❌ Не удалось извлечь Video ID из URL: %s", videoURL)
 										bot.SendMessage(callback.Message.Chat.ID, "❌ Ошибка: неверный формат ссылки")
 										return
 									}
 									
-									log.Printf("🔍 Проверяю кэш для videoID: %s, platform: %s, formatID: %s", videoID, platform, formatID)
+									log.Printf("🔍 Проверяю кэш для videoID: %s, platform: %s, formatID: %s", videoID, platform, cacheFormatID)
+									
+									// Видео, разрезанное на части, хранится в кэше группой
+									if parts, err := bot.cacheService.GetCachedParts(videoID, platform, cacheFormatID); err != nil {
+										log.Printf("⚠️ Ошибка проверки частей в кэше: %v", err)
+									} else if parts != nil {
+										log.Printf("⚡ Видео из %d частей найдено в кэше: %s (формат: %s)", len(parts), videoID, formatID)
+										bot.SendMessage(callback.Message.Chat.ID, fmt.Sprintf("⚡ Отправляю видео из кэша (%d частей)...", len(parts)))
+										if err := bot.sendVideoParts(callback.Message.Chat.ID, videoID, platform, cacheFormatID, parts, fmt.Sprintf("Видео в формате %s (из кэша)", formatID), nil); err != nil {
+											log.Printf("❌ Ошибка отправки частей из кэша: %v", err)
+											bot.SendMessage(callback.Message.Chat.ID, "❌ Ошибка отправки видео из кэша")
+											return
+										}
+										bot.SendMessage(callback.Message.Chat.ID, "✅ Файл отправлен из кэша!")
+										return
+									}
 									
 									// Проверяем кэш
-									if isCached, cachedVideo, err := bot.cacheService.IsVideoCached(videoID, platform, formatID); err != nil {
+									if isCached, cachedVideo, err := bot.cacheService.IsVideoCached(videoID, platform, cacheFormatID); err != nil {
 										log.Printf("⚠️ Ошибка проверки кэша: %v", err)
 									} else if isCached {
 										// Файл в кэше - отправляем мгновенно
@@ -2488,12 +3677,12 @@ func main() {
 										
 										// Определяем тип файла по расширению
 										fileExt := strings.ToLower(filepath.Ext(cachedVideo.FilePath))
-										isAudio := fileExt == ".mp3" || fileExt == ".m4a" || fileExt == ".ogg"
+										isAudio := services.IsAudioExtension(fileExt)
 										
 										if isAudio {
 											bot.SendMessage(callback.Message.Chat.ID, "⚡ Отправляю аудио из кэша...")
-											// Отправляем аудио из кэша
-											if err := bot.SendAudio(callback.Message.Chat.ID, cachedVideo.FilePath, fmt.Sprintf("Аудио в формате %s (из кэша)", formatID)); err != nil {
+											// Отправляем аудио из кэша (по file_id, если оно уже загружалось)
+											if err := bot.sendCachedFile(callback.Message.Chat.ID, videoID, platform, cacheFormatID, cachedVideo.FilePath, fmt.Sprintf("Аудио в формате %s (из кэша)", formatID), true, nil); err != nil {
 												log.Printf("❌ Ошибка отправки аудио из кэша: %v", err)
 												bot.SendMessage(callback.Message.Chat.ID, "❌ Ошибка отправки аудио из кэша")
 												return
@@ -2501,8 +3690,8 @@ func main() {
 											log.Printf("✅ Аудио отправлено из кэша: %s", formatID)
 										} else {
 											bot.SendMessage(callback.Message.Chat.ID, "⚡ Отправляю видео из кэша...")
-											// Отправляем видео из кэша
-											if err := bot.SendVideo(callback.Message.Chat.ID, cachedVideo.FilePath, fmt.Sprintf("Видео в формате %s (из кэша)", formatID)); err != nil {
+											// Отправляем видео из кэша (по file_id, если оно уже загружалось)
+											if err := bot.sendCachedFile(callback.Message.Chat.ID, videoID, platform, cacheFormatID, cachedVideo.FilePath, fmt.Sprintf("Видео в формате %s (из кэша)", formatID), false, nil); err != nil {
 												log.Printf("❌ Ошибка отправки видео из кэша: %v", err)
 												bot.SendMessage(callback.Message.Chat.ID, "❌ Ошибка отправки видео из кэша")
 												return
@@ -2511,25 +3700,70 @@ func main() {
 										}
 										
 										// Увеличиваем счетчик скачиваний
-										bot.cacheService.IncrementDownloadCount(videoID, string(platformInfo.Type), formatID)
+										bot.cacheService.IncrementDownloadCount(videoID, platform, cacheFormatID)
 										
+										bot.SendMessage(callback.Message.Chat.ID, "✅ Файл отправлен из кэша!")
+										return
+									} else if bot.sendStoredFile(callback.Message.Chat.ID, videoID, platform, cacheFormatID, fmt.Sprintf("Формат %s (из кэша)", formatID)) {
+										// Локальная копия вытеснена, но файл уже есть в Telegram
+										bot.cacheService.IncrementDownloadCount(videoID, platform, cacheFormatID)
 										bot.SendMessage(callback.Message.Chat.ID, "✅ Файл отправлен из кэша!")
 										return
 									}
 									
 									// Видео не в кэше - скачиваем
 									log.Printf("📥 Видео не в кэше, скачиваю: %s", videoURL)
-									bot.SendMessage(callback.Message.Chat.ID, "📥 Скачиваю файл... ⏳ Это может занять от 30 секунд до 5 минут")
+									
+									// Одно статусное сообщение с кнопкой отмены, которое редактируется по мере скачивания
+									chatID := callback.Message.Chat.ID
+									statusID, statusErr := bot.SendMessageWithID(chatID, "📥 Скачиваю файл... ⏳ Это может занять от 30 секунд до 5 минут", cancelKeyboard())
+									if statusErr != nil {
+										log.Printf("⚠️ Не удалось отправить статусное сообщение: %v", statusErr)
+									}
+									
+									// Контекст загрузки: отменяется кнопкой, /cancel или при остановке бота
+									ctx, cancel := context.WithCancel(bot.ctx)
+									defer cancel()
+									bot.registerDownload(chatID, statusID, cancel)
+									defer bot.unregisterDownload(chatID, statusID)
+									
+									setStatusKeyboard := func(text string, keyboard [][]map[string]interface{}) {
+										if statusID == 0 {
+											bot.SendMessage(chatID, text)
+											return
+										}
+										if err := bot.EditMessageText(chatID, statusID, text, keyboard); err != nil {
+											log.Printf("⚠️ Не удалось обновить статус: %v", err)
+										}
+									}
+									setStatus := func(text string) {
+										setStatusKeyboard(text, nil)
+									}
+									
+									var onProgress services.ProgressFunc
+									if statusID != 0 {
+										onProgress = services.NewProgressReporter(3*time.Second, func(text string) {
+											if ctx.Err() == nil {
+												setStatusKeyboard(text, cancelKeyboard())
+											}
+										}).Report
+									}
 									
 							// Реальная загрузка через правильный сервис
 							var videoPath string
 							var err error
 							
-							if platform == "youtube" || platform == "youtube_shorts" {
-								videoPath, err = bot.youtubeService.DownloadVideoWithFormat(videoURL, formatID)
+							downloadOpts.Metadata, _ = bot.getMetadataCache(callback.Message.Chat.ID)
+							if platform == string(services.PlatformYouTube) {
+								videoPath, err = bot.youtubeService.DownloadWithOptions(ctx, videoURL, formatID, downloadOpts, onProgress)
 							} else {
-								videoPath, err = bot.universalService.DownloadVideoWithFormat(videoURL, formatID)
+								videoPath, err = bot.universalService.DownloadWithOptions(ctx, videoURL, formatID, downloadOpts, onProgress)
 							}
+									if err != nil && ctx.Err() != nil {
+										log.Printf("✖️ Загрузка отменена: %s (%s)", videoURL, formatID)
+										setStatus("✖ Загрузка отменена")
+										return
+									}
 									if err != nil {
 										log.Printf("❌ Ошибка загрузки видео: %v", err)
 										
@@ -2545,35 +3779,18 @@ func main() {
 											userMessage = fmt.Sprintf("❌ Ошибка загрузки видео\n\n🔧 Попробуйте другое качество или видео")
 										}
 										
-										bot.SendMessage(callback.Message.Chat.ID, userMessage)
+										setStatus(userMessage)
 										return
 									}
 									
 									log.Printf("📥 Файл скачан: %s", videoPath)
-									bot.SendMessage(callback.Message.Chat.ID, "✅ Файл скачан! 📤 Отправляю в Telegram...")
+									setStatusKeyboard("✅ Файл скачан! 🔄 Подготавливаю файл...", cancelKeyboard())
 									
 									// Определяем тип файла по расширению и выбранному формату
 									fileExt := strings.ToLower(filepath.Ext(videoPath))
 									
-									// Проверяем, является ли выбранный формат аудио
-									var isAudioFormat bool
-									if cachedFormats, exists := bot.getFormatCache(callback.Message.Chat.ID); exists {
-										for _, format := range cachedFormats {
-											if format.ID == formatID {
-												// Формат считается аудио если:
-												// 1. В ID есть "audio", "drc", "bestaudio"
-												// 2. Или это только аудио формат (без видео)
-												isAudioFormat = strings.Contains(formatID, "audio") || 
-																strings.Contains(formatID, "drc") || 
-																strings.Contains(formatID, "bestaudio") ||
-																format.Extension == "audio"
-												break
-											}
-										}
-									}
-									
 									// Определяем финальный тип файла
-									isAudio := isAudioFormat || fileExt == ".mp3" || fileExt == ".m4a" || fileExt == ".ogg"
+									isAudio := isAudioFormat || services.IsAudioExtension(fileExt)
 									
 									// Если это аудио и файл имеет двойное расширение (.mp4.mp3), исправляем это
 									if isAudio && strings.Contains(videoPath, ".mp4.mp3") {
@@ -2592,7 +3809,12 @@ func main() {
 										if isAudio {
 											// Для аудио конвертируем WebM в MP3
 											log.Printf("🎵 Конвертирую WebM аудио в MP3: %s", videoPath)
-											convertedPath, err := bot.convertWebmToMp3(videoPath)
+											convertedPath, err := bot.convertWebmToMp3(ctx, videoPath, downloadOpts.AudioOutput().Bitrate())
+											if err != nil && ctx.Err() != nil {
+												setStatus("✖ Загрузка отменена")
+												os.Remove(videoPath)
+												return
+											}
 											if err != nil {
 												log.Printf("❌ Ошибка конвертации WebM аудио: %v", err)
 												bot.SendMessage(callback.Message.Chat.ID, "❌ Ошибка конвертации аудио файла")
@@ -2604,7 +3826,12 @@ func main() {
 										} else {
 											// Для видео конвертируем WebM в MP4
 											log.Printf("🎬 Конвертирую WebM видео в MP4: %s", videoPath)
-											convertedPath, err := bot.convertWebmToMp4(videoPath)
+											convertedPath, err := bot.convertWebmToMp4(ctx, videoPath)
+											if err != nil && ctx.Err() != nil {
+												setStatus("✖ Загрузка отменена")
+												os.Remove(videoPath)
+												return
+											}
 											if err != nil {
 												log.Printf("❌ Ошибка конвертации WebM видео: %v", err)
 												bot.SendMessage(callback.Message.Chat.ID, "❌ Ошибка конвертации видео файла")
@@ -2616,9 +3843,60 @@ func main() {
 										}
 									}
 									
-									// Для MP4 проверяем совместимость с macOS (H.264/AAC, yuv420p, faststart)
-									if !isAudio && fileExt == ".mp4" {
-										compatiblePath, err := bot.ensureMP4MacCompatible(videoPath)
+									// Вшиваем субтитры; результат уже в H.264 с faststart
+									burned := false
+									if !isAudio && burnTrack != nil {
+										setStatusKeyboard("🔥 Вшиваю субтитры в видео...", cancelKeyboard())
+										subtitlePath, err := bot.downloadSubtitles(ctx, callback.Message.Chat.ID, *burnTrack, services.SubtitleSRT)
+										if err == nil {
+											var burnedPath string
+											burnedPath, err = bot.burnSubtitlesInto(ctx, videoPath, subtitlePath)
+											os.Remove(subtitlePath)
+											if err == nil {
+												videoPath = burnedPath
+											}
+										}
+										if err != nil && ctx.Err() != nil {
+											setStatus("✖ Загрузка отменена")
+											os.Remove(videoPath)
+											return
+										}
+										if err != nil {
+											log.Printf("❌ Ошибка вшивания субтитров: %v", err)
+											setStatus("❌ Не удалось вшить субтитры в видео")
+											os.Remove(videoPath)
+											return
+										}
+										fileExt = ".mp4"
+										burned = true
+									}
+									
+									// Сжатие до целевого размера перекодирует в H.264/AAC с faststart,
+									// поэтому отдельная проверка совместимости не нужна
+									if !isAudio && compressTarget > 0 {
+										setStatusKeyboard(fmt.Sprintf("🗜 Сжимаю видео до %d МБ...", compressTarget/(1024*1024)), cancelKeyboard())
+										compressedPath, err := bot.compressToFit(ctx, videoPath, compressTarget)
+										if err != nil && ctx.Err() != nil {
+											setStatus("✖ Загрузка отменена")
+											os.Remove(videoPath)
+											return
+										}
+										if err != nil {
+											log.Printf("❌ Ошибка сжатия видео: %v", err)
+											setStatus(fmt.Sprintf("❌ Не удалось сжать видео до %d МБ: %v", compressTarget/(1024*1024), err))
+											os.Remove(videoPath)
+											return
+										}
+										videoPath = compressedPath
+										fileExt = ".mp4"
+									} else if !isAudio && fileExt == ".mp4" && !burned {
+										// Для MP4 проверяем совместимость с macOS (H.264/AAC, yuv420p, faststart)
+										compatiblePath, err := bot.ensureMP4MacCompatible(ctx, videoPath)
+										if err != nil && ctx.Err() != nil {
+											setStatus("✖ Загрузка отменена")
+											os.Remove(videoPath)
+											return
+										}
 										if err != nil {
 											log.Printf("⚠️ Не удалось обеспечить совместимость MP4: %v", err)
 										} else if compatiblePath != videoPath {
@@ -2627,15 +3905,38 @@ func main() {
 										}
 									}
 									
-									// Получаем метаданные для красивого caption
-									var metadata *services.VideoMetadata
-									if platform == "youtube" || platform == "youtube_shorts" {
-										metadata, err = bot.youtubeService.GetVideoMetadata(videoURL)
-										if err != nil {
-											log.Printf("⚠️ Не удалось получить метаданные для caption: %v", err)
+									// Видео больше лимита Telegram режем на части по ключевым кадрам
+									var parts []services.VideoPart
+									if !isAudio && bot.maxPartSize > 0 {
+										if info, err := os.Stat(videoPath); err == nil && info.Size() > bot.maxPartSize {
+											setStatusKeyboard(fmt.Sprintf("✂️ Файл больше %s, режу на части...", formatFileSize(bot.maxPartSize)), cancelKeyboard())
+											parts, err = services.SplitVideo(ctx, videoPath, bot.maxPartSize)
+											if err != nil && ctx.Err() != nil {
+												setStatus("✖ Загрузка отменена")
+												os.Remove(videoPath)
+												return
+											}
+											if err != nil {
+												log.Printf("❌ Ошибка нарезки видео: %v", err)
+												setStatus("❌ Не удалось разрезать видео на части")
+												os.Remove(videoPath)
+												return
+											}
 										}
 									}
 									
+									// Дальше отмена не поддерживается - убираем кнопку
+									setStatus("✅ Файл готов! 📤 Отправляю в Telegram...")
+									
+									// Прогресс загрузки в Telegram показываем в том же статусном сообщении
+									var uploadProgress services.ProgressFunc
+									if statusID != 0 {
+										uploadProgress = services.NewProgressReporter(3*time.Second, setStatus).Report
+									}
+									
+									// Метаданные для красивого caption сохранены при анализе ссылки
+									metadata, _ := bot.getMetadataCache(callback.Message.Chat.ID)
+									
 									// Создаем красивый caption
 									var caption string
 									if metadata != nil {
@@ -2659,6 +3960,27 @@ func main() {
 											caption = fmt.Sprintf("Видео в формате %s", formatID)
 										}
 									}
+									if clip != nil {
+										caption = fmt.Sprintf("✂️ Фрагмент %s\n\n%s", clip, caption)
+									}
+									if burned {
+										caption = fmt.Sprintf("🔥 Субтитры: %s\n\n%s", burnTrack.Label(), caption)
+									}
+									
+									// Части сохраняем в кэш группой и отправляем по порядку
+									if parts != nil {
+										if err := bot.cacheService.AddPartsToCache(videoID, platform, cacheFormatID, parts); err != nil {
+											log.Printf("⚠️ Не удалось добавить части в кэш: %v", err)
+										}
+										if err := bot.sendVideoParts(callback.Message.Chat.ID, videoID, platform, cacheFormatID, parts, caption, uploadProgress); err != nil {
+											log.Printf("❌ Ошибка отправки частей: %v", err)
+											bot.SendMessage(callback.Message.Chat.ID, fmt.Sprintf("❌ Ошибка отправки: %v", err))
+											return
+										}
+										log.Printf("✅ Видео из %d частей успешно отправлено: %s", len(parts), formatID)
+										bot.UpdateMetrics("download", true, time.Since(startTime))
+										return
+									}
 									
 									// СНАЧАЛА сохраняем файл в кэш (ПЕРЕД отправкой)
 									// Получаем информацию о файле
@@ -2688,7 +4010,7 @@ func main() {
 										
 										// Добавляем в кэш
 										title := bot.universalService.GetPlatformInfo(videoURL).DisplayName + " " + contentType
-										if err := bot.cacheService.AddToCache(videoID, platform, videoURL, title, formatID, resolution, videoPath, fileInfo.Size()); err != nil {
+										if err := bot.cacheService.AddToCache(videoID, platform, videoURL, title, cacheFormatID, resolution, videoPath, fileInfo.Size()); err != nil {
 											log.Printf("⚠️ Не удалось добавить в кэш: %v", err)
 										} else {
 											log.Printf("💾 %s добавлено в кэш: %s (%s)", contentType, videoID, formatID)
@@ -2698,7 +4020,7 @@ func main() {
 									// ПОТОМ отправляем файл в Telegram
 									if isAudio {
 										// Для аудио файлов используем SendAudio
-										if err := bot.SendAudio(callback.Message.Chat.ID, videoPath, caption); err != nil {
+										if err := bot.sendCachedFile(callback.Message.Chat.ID, videoID, platform, cacheFormatID, videoPath, caption, true, uploadProgress); err != nil {
 											log.Printf("❌ Ошибка отправки аудио: %v", err)
 											bot.SendMessage(callback.Message.Chat.ID, fmt.Sprintf("❌ Ошибка отправки: %v", err))
 											// Удаляем файл при ошибке
@@ -2711,7 +4033,7 @@ func main() {
 										log.Printf("💾 Аудио файл сохранен в кэше: %s", videoPath)
 									} else {
 										// Для видео файлов
-										if err := bot.SendVideo(callback.Message.Chat.ID, videoPath, caption); err != nil {
+										if err := bot.sendCachedFile(callback.Message.Chat.ID, videoID, platform, cacheFormatID, videoPath, caption, false, uploadProgress); err != nil {
 											log.Printf("❌ Ошибка отправки видео: %v", err)
 											bot.SendMessage(callback.Message.Chat.ID, fmt.Sprintf("❌ Ошибка отправки: %v", err))
 											// Удаляем файл при ошибке
@@ -2746,20 +4068,14 @@ func main() {
 							return
 						}
 						
-						// Извлекаем videoID из URL
-						videoID := extractVideoID(videoURL)
+						// ID видео и пространство кэша ссылки чата
+						videoID, platform := bot.cacheKey(callback.Message.Chat.ID, videoURL)
 						if videoID == "" {
 							log.Printf("❌ Не удалось извлечь videoID из URL: %s", videoURL)
 							bot.SendMessage(callback.Message.Chat.ID, "❌ Ошибка: не удалось извлечь ID видео.")
 							return
 						}
 						
-						// Получаем платформу из кэша
-						platform := bot.platformCache[callback.Message.Chat.ID]
-						if platform == "" {
-							platform = "youtube" // По умолчанию YouTube
-						}
-						
 						// Получаем все форматы из кэша
 						inCache, cachedFormats, err := bot.isVideoInCache(videoID, platform)
 						if err != nil {
@@ -2781,18 +4097,18 @@ func main() {
 							
 							// Определяем тип файла по расширению
 							fileExt := strings.ToLower(filepath.Ext(cachedVideo.FilePath))
-							isAudio := fileExt == ".mp3" || fileExt == ".m4a" || fileExt == ".ogg"
+							isAudio := services.IsAudioExtension(fileExt)
 							
 							if isAudio {
 								// Отправляем аудио
-								if err := bot.SendAudio(callback.Message.Chat.ID, cachedVideo.FilePath, fmt.Sprintf("Аудио в формате %s (из кэша)", cachedVideo.FormatID)); err != nil {
+								if err := bot.sendCachedFile(callback.Message.Chat.ID, videoID, platform, cachedVideo.FormatID, cachedVideo.FilePath, fmt.Sprintf("Аудио в формате %s (из кэша)", cachedVideo.FormatID), true, nil); err != nil {
 									log.Printf("❌ Ошибка отправки аудио из кэша: %v", err)
 								} else {
 									log.Printf("✅ Аудио отправлено из кэша: %s", cachedVideo.FormatID)
 								}
 							} else {
 								// Отправляем видео
-								if err := bot.SendVideo(callback.Message.Chat.ID, cachedVideo.FilePath, fmt.Sprintf("Видео в формате %s (из кэша)", cachedVideo.FormatID)); err != nil {
+								if err := bot.sendCachedFile(callback.Message.Chat.ID, videoID, platform, cachedVideo.FormatID, cachedVideo.FilePath, fmt.Sprintf("Видео в формате %s (из кэша)", cachedVideo.FormatID), false, nil); err != nil {
 									log.Printf("❌ Ошибка отправки видео из кэша: %v", err)
 								} else {
 									log.Printf("✅ Видео отправлено из кэша: %s", cachedVideo.FormatID)
@@ -2817,7 +4133,7 @@ func main() {
 							for _, cachedVideo := range cachedFormats {
 								// Определяем иконку по типу файла
 								fileExt := strings.ToLower(filepath.Ext(cachedVideo.FilePath))
-								isAudio := fileExt == ".mp3" || fileExt == ".m4a" || fileExt == ".ogg"
+								isAudio := services.IsAudioExtension(fileExt)
 								
 								icon := "🎥"
 								if isAudio {
@@ -2873,10 +4189,7 @@ func main() {
 						
 					} else if strings.HasPrefix(callback.Data, "cached_format_") {
 						// Пользователь выбрал формат из кэша
-						parts := strings.Split(callback.Data, "_")
-						if len(parts) >= 3 {
-							formatID := parts[2]
-							resolution := parts[3]
+						if formatID, resolution, ok := splitFormatCallback(strings.TrimPrefix(callback.Data, "cached_format_")); ok {
 							log.Printf("⚡ Пользователь выбрал формат из кэша: %s (%s)", formatID, resolution)
 							bot.AnswerCallbackQuery(callback.ID)
 							
@@ -2888,20 +4201,14 @@ func main() {
 								return
 							}
 							
-							// Извлекаем videoID из URL
-							videoID := extractVideoID(videoURL)
+							// ID видео и пространство кэша ссылки чата
+							videoID, platform := bot.cacheKey(callback.Message.Chat.ID, videoURL)
 							if videoID == "" {
 								log.Printf("❌ Не удалось извлечь videoID из URL: %s", videoURL)
 								bot.SendMessage(callback.Message.Chat.ID, "❌ Ошибка: не удалось извлечь ID видео.")
 								return
 							}
 							
-							// Получаем платформу из кэша
-							platform := bot.platformCache[callback.Message.Chat.ID]
-							if platform == "" {
-								platform = "youtube" // По умолчанию YouTube
-							}
-							
 							// Находим нужный формат в кэше
 							inCache, cachedFormats, err := bot.isVideoInCache(videoID, platform)
 							if err != nil || !inCache {
@@ -2929,11 +4236,11 @@ func main() {
 							
 							// Определяем тип файла по расширению
 							fileExt := strings.ToLower(filepath.Ext(selectedFormat.FilePath))
-							isAudio := fileExt == ".mp3" || fileExt == ".m4a" || fileExt == ".ogg"
+							isAudio := services.IsAudioExtension(fileExt)
 							
 							if isAudio {
 								// Отправляем аудио
-								if err := bot.SendAudio(callback.Message.Chat.ID, selectedFormat.FilePath, fmt.Sprintf("Аудио в формате %s (из кэша)", selectedFormat.FormatID)); err != nil {
+								if err := bot.sendCachedFile(callback.Message.Chat.ID, videoID, platform, selectedFormat.FormatID, selectedFormat.FilePath, fmt.Sprintf("Аудио в формате %s (из кэша)", selectedFormat.FormatID), true, nil); err != nil {
 									log.Printf("❌ Ошибка отправки аудио из кэша: %v", err)
 									bot.SendMessage(callback.Message.Chat.ID, "❌ Ошибка отправки аудио.")
 								} else {
@@ -2942,7 +4249,7 @@ func main() {
 								}
 							} else {
 								// Отправляем видео
-								if err := bot.SendVideo(callback.Message.Chat.ID, selectedFormat.FilePath, fmt.Sprintf("Видео в формате %s (из кэша)", selectedFormat.FormatID)); err != nil {
+								if err := bot.sendCachedFile(callback.Message.Chat.ID, videoID, platform, selectedFormat.FormatID, selectedFormat.FilePath, fmt.Sprintf("Видео в формате %s (из кэша)", selectedFormat.FormatID), false, nil); err != nil {
 									log.Printf("❌ Ошибка отправки видео из кэша: %v", err)
 									bot.SendMessage(callback.Message.Chat.ID, "❌ Ошибка отправки видео.")
 								} else {
@@ -2980,46 +4287,6 @@ func main() {
 	}
 }
 
-// parseFileSize парсит размер файла в байты
-func parseFileSize(fileSize string) int64 {
-	if fileSize == "" {
-		return 0
-	}
-	
-	// Убираем пробелы
-	fileSize = strings.TrimSpace(fileSize)
-	
-	// Парсим размеры в разных единицах
-	var multiplier float64 = 1
-	var sizeStr string
-	
-	if strings.HasSuffix(fileSize, "GiB") {
-		multiplier = 1024 * 1024 * 1024
-		sizeStr = strings.TrimSuffix(fileSize, "GiB")
-	} else if strings.HasSuffix(fileSize, "MiB") {
-		multiplier = 1024 * 1024
-		sizeStr = strings.TrimSuffix(fileSize, "MiB")
-	} else if strings.HasSuffix(fileSize, "KiB") {
-		multiplier = 1024
-		sizeStr = strings.TrimSuffix(fileSize, "KiB")
-	} else if strings.HasSuffix(fileSize, "B") {
-		multiplier = 1
-		sizeStr = strings.TrimSuffix(fileSize, "B")
-	} else {
-		// Пробуем парсить как число
-		if size, err := strconv.ParseFloat(fileSize, 64); err == nil {
-			return int64(size)
-		}
-		return 0
-	}
-	
-	if size, err := strconv.ParseFloat(sizeStr, 64); err == nil {
-		return int64(size * multiplier)
-	}
-	
-	return 0
-}
-
 // formatFileSize форматирует размер файла в человеко-читаемый вид
 func formatFileSize(size int64) string {
     if size <= 0 {
@@ -3052,21 +4319,6 @@ func sortVideoFormatsByResolution(formats []services.VideoFormat) {
 	})
 }
 
-// extractVideoID извлекает YouTube Video ID из URL
-func extractVideoID(url string) string {
-	// Поддерживаемые форматы:
-	// https://www.youtube.com/watch?v=VIDEO_ID
-	// https://youtu.be/VIDEO_ID
-	// https://youtube.com/watch?v=VIDEO_ID&feature=shared
-	
-	re := regexp.MustCompile(`(?:youtube\.com/watch\?v=|youtu\.be/|youtube\.com/embed/)([a-zA-Z0-9_-]{11})`)
-	matches := re.FindStringSubmatch(url)
-	if len(matches) > 1 {
-		return matches[1]
-	}
-	return ""
-}
-
 // fixUTF8Encoding исправляет UTF-8 кодировку строки
 // getPopularCachedVideos возвращает популярные видео из кэша
 func (b *LocalBot) getPopularCachedVideos(limit int) ([]services.VideoCache, error) {
@@ -3084,6 +4336,13 @@ func (b *LocalBot) isVideoInCache(videoID, platform string) (bool, []services.Vi
 	// Проверяем, какие файлы действительно существуют
 	var existingFormats []services.VideoCache
 	for _, format := range cachedFormats {
+		if format.FilePath == "" {
+			// Локальная копия вытеснена - формат доступен, пока есть file_id
+			if fileID, _, _ := b.cacheService.GetFileID(videoID, platform, format.FormatID, services.BotIDFromToken(b.Token)); fileID != "" {
+				existingFormats = append(existingFormats, format)
+			}
+			continue
+		}
 		if _, err := os.Stat(format.FilePath); err == nil {
 			log.Printf("✅ Файл существует в кэше: %s", format.FilePath)
 			existingFormats = append(existingFormats, format)
@@ -3096,19 +4355,19 @@ func (b *LocalBot) isVideoInCache(videoID, platform string) (bool, []services.Vi
 	return len(existingFormats) > 0, existingFormats, nil
 }
 
-// convertWebmToMp3 конвертирует WebM аудио файл в MP3 используя ffmpeg
-func (b *LocalBot) convertWebmToMp3(webmPath string) (string, error) {
+// convertWebmToMp3 конвертирует WebM аудио файл в MP3 с битрейтом bitrate ("192k") используя ffmpeg
+func (b *LocalBot) convertWebmToMp3(ctx context.Context, webmPath, bitrate string) (string, error) {
 	// Создаем путь для MP3 файла, убирая все расширения и добавляя .mp3
 	basePath := strings.TrimSuffix(webmPath, ".webm")
 	basePath = strings.TrimSuffix(basePath, ".mp4") // Убираем .mp4 если есть
 	mp3Path := basePath + ".mp3"
 	
 	// Команда ffmpeg для конвертации аудио
-	cmd := exec.Command("ffmpeg", 
+	cmd := exec.CommandContext(ctx, "ffmpeg", 
 		"-i", webmPath,
 		"-vn", // Без видео
 		"-acodec", "mp3",
-		"-ab", "192k", // Битрейт аудио
+		"-ab", bitrate, // Битрейт аудио
 		"-ar", "44100", // Частота дискретизации
 		"-y", // Перезаписывать файл если существует
 		mp3Path)
@@ -3118,6 +4377,10 @@ func (b *LocalBot) convertWebmToMp3(webmPath string) (string, error) {
 	// Запускаем конвертацию
 	output, err := cmd.CombinedOutput()
 	if err != nil {
+		if ctx.Err() != nil {
+			os.Remove(mp3Path)
+			return "", services.ErrCancelled
+		}
 		log.Printf("❌ Ошибка ffmpeg (аудио): %s", string(output))
 		return "", fmt.Errorf("ошибка конвертации WebM в MP3: %v", err)
 	}
@@ -3132,12 +4395,12 @@ func (b *LocalBot) convertWebmToMp3(webmPath string) (string, error) {
 }
 
 // convertWebmToMp4 конвертирует WebM файл в MP4 используя ffmpeg
-func (b *LocalBot) convertWebmToMp4(webmPath string) (string, error) {
+func (b *LocalBot) convertWebmToMp4(ctx context.Context, webmPath string) (string, error) {
 	// Создаем путь для MP4 файла
 	mp4Path := strings.TrimSuffix(webmPath, ".webm") + ".mp4"
 	
 	// Команда ffmpeg для конвертации
-	cmd := exec.Command("ffmpeg", 
+	cmd := exec.CommandContext(ctx, "ffmpeg", 
 		"-i", webmPath,
 		"-c:v", "libx264",
 		"-pix_fmt", "yuv420p",
@@ -3154,6 +4417,10 @@ func (b *LocalBot) convertWebmToMp4(webmPath string) (string, error) {
 	// Запускаем конвертацию
 	output, err := cmd.CombinedOutput()
 	if err != nil {
+		if ctx.Err() != nil {
+			os.Remove(mp4Path)
+			return "", services.ErrCancelled
+		}
 		log.Printf("❌ Ошибка ffmpeg: %s", string(output))
 		return "", fmt.Errorf("ошибка конвертации WebM в MP4: %v", err)
 	}
@@ -3168,8 +4435,8 @@ func (b *LocalBot) convertWebmToMp4(webmPath string) (string, error) {
 }
 
 // getVideoStreamInfo возвращает codec и pix_fmt для первого видеопотока
-func (b *LocalBot) getVideoStreamInfo(videoPath string) (string, string, error) {
-    ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+func (b *LocalBot) getVideoStreamInfo(ctx context.Context, videoPath string) (string, string, error) {
+    ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
     defer cancel()
 
     cmdCodec := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-select_streams", "v:0", "-show_entries", "stream=codec_name", "-of", "default=nw=1:nk=1", videoPath)
@@ -3190,8 +4457,8 @@ func (b *LocalBot) getVideoStreamInfo(videoPath string) (string, string, error)
 }
 
 // ensureMP4MacCompatible гарантирует H.264/AAC, yuv420p и faststart для MP4
-func (b *LocalBot) ensureMP4MacCompatible(mp4Path string) (string, error) {
-    codec, pix, err := b.getVideoStreamInfo(mp4Path)
+func (b *LocalBot) ensureMP4MacCompatible(ctx context.Context, mp4Path string) (string, error) {
+    codec, pix, err := b.getVideoStreamInfo(ctx, mp4Path)
     if err != nil {
         log.Printf("⚠️ Не удалось получить информацию о видео: %v", err)
     }
@@ -3204,7 +4471,8 @@ func (b *LocalBot) ensureMP4MacCompatible(mp4Path string) (string, error) {
     outPath := mp4Path
     if needsTranscode {
         tmpPath := strings.TrimSuffix(mp4Path, ".mp4") + "_h264.mp4"
-        cmd := exec.Command(
+        cmd := exec.CommandContext(
+            ctx,
             "ffmpeg",
             "-i", mp4Path,
             "-c:v", "libx264",
@@ -3219,6 +4487,10 @@ func (b *LocalBot) ensureMP4MacCompatible(mp4Path string) (string, error) {
         )
         log.Printf("🎞️ Транскодирую в H.264/AAC: %s", strings.Join(cmd.Args, " "))
         if output, err := cmd.CombinedOutput(); err != nil {
+            if ctx.Err() != nil {
+                os.Remove(tmpPath)
+                return "", services.ErrCancelled
+            }
             log.Printf("❌ Ошибка транскодирования: %s", string(output))
             return "", fmt.Errorf("ошибка транскодирования: %v", err)
         }
@@ -3228,7 +4500,8 @@ func (b *LocalBot) ensureMP4MacCompatible(mp4Path string) (string, error) {
         outPath = tmpPath
     } else {
         tmpPath := strings.TrimSuffix(mp4Path, ".mp4") + "_faststart.mp4"
-        cmd := exec.Command(
+        cmd := exec.CommandContext(
+            ctx,
             "ffmpeg",
             "-i", mp4Path,
             "-c", "copy",
@@ -3238,6 +4511,10 @@ func (b *LocalBot) ensureMP4MacCompatible(mp4Path string) (string, error) {
         )
         log.Printf("🚀 Применяю faststart без перекодирования: %s", strings.Join(cmd.Args, " "))
         if output, err := cmd.CombinedOutput(); err != nil {
+            if ctx.Err() != nil {
+                os.Remove(tmpPath)
+                return "", services.ErrCancelled
+            }
             log.Printf("⚠️ Ошибка faststart: %s", string(output))
         } else {
             if err := os.Remove(mp4Path); err != nil {
@@ -3250,6 +4527,126 @@ func (b *LocalBot) ensureMP4MacCompatible(mp4Path string) (string, error) {
     return outPath, nil
 }
 
+// burnSubtitlesInto вшивает субтитры в видео (перекодирование в H.264 с faststart, звук копируется).
+// Исходный файл удаляется.
+func (b *LocalBot) burnSubtitlesInto(ctx context.Context, videoPath, subtitlePath string) (string, error) {
+	outPath := strings.TrimSuffix(videoPath, filepath.Ext(videoPath)) + "_subs.mp4"
+
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-i", videoPath,
+		"-vf", services.SubtitlesFilter(subtitlePath),
+		"-c:v", "libx264",
+		"-preset", "fast",
+		"-crf", "23",
+		"-pix_fmt", "yuv420p",
+		"-c:a", "copy",
+		"-movflags", "+faststart",
+		"-y", outPath,
+	)
+	log.Printf("🔥 Вшиваю субтитры: %s", strings.Join(cmd.Args, " "))
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(outPath)
+		if ctx.Err() != nil {
+			return "", services.ErrCancelled
+		}
+		log.Printf("❌ Ошибка ffmpeg (субтитры): %s", string(output))
+		return "", fmt.Errorf("ошибка вшивания субтитров: %v", err)
+	}
+
+	if err := os.Remove(videoPath); err != nil {
+		log.Printf("⚠️ Не удалось удалить исходный файл после вшивания субтитров: %v", err)
+	}
+	return outPath, nil
+}
+
+// compressToFit перекодирует видео в H.264/AAC так, чтобы файл уложился в targetSize байт.
+// Битрейт считается по длительности из ffprobe, разрешение ограничивается под битрейт,
+// кодирование идет в два прохода. Если результат все же вышел больше, битрейт снижается и
+// кодирование повторяется. Исходный файл удаляется.
+func (b *LocalBot) compressToFit(ctx context.Context, mp4Path string, targetSize int64) (string, error) {
+	duration, err := b.getVideoDurationContext(ctx, mp4Path)
+	if err != nil {
+		return "", err
+	}
+
+	outPath := strings.TrimSuffix(mp4Path, filepath.Ext(mp4Path)) + fmt.Sprintf("_fit%dmb.mp4", targetSize/(1024*1024))
+	passLog := strings.TrimSuffix(outPath, ".mp4") + "_2pass"
+	defer func() {
+		// Удаляем служебные файлы двухпроходного кодирования
+		matches, _ := filepath.Glob(passLog + "*")
+		for _, match := range matches {
+			os.Remove(match)
+		}
+	}()
+
+	budget := targetSize
+	for attempt := 1; attempt <= 2; attempt++ {
+		videoKbps, audioKbps, maxHeight, err := services.FitEncodingParams(duration, budget)
+		if err != nil {
+			return "", err
+		}
+		log.Printf("🗜 Сжимаю до %s (попытка %d): видео %d кбит/с, аудио %d кбит/с, до %dp",
+			formatFileSize(targetSize), attempt, videoKbps, audioKbps, maxHeight)
+
+		if err := b.encodeTwoPass(ctx, mp4Path, outPath, passLog, videoKbps, audioKbps, maxHeight); err != nil {
+			os.Remove(outPath)
+			return "", err
+		}
+
+		info, err := os.Stat(outPath)
+		if err != nil {
+			return "", fmt.Errorf("ошибка получения информации о файле: %v", err)
+		}
+		if info.Size() <= targetSize {
+			log.Printf("✅ Видео сжато: %s -> %s", mp4Path, formatFileSize(info.Size()))
+			if err := os.Remove(mp4Path); err != nil {
+				log.Printf("⚠️ Не удалось удалить исходный файл после сжатия: %v", err)
+			}
+			return outPath, nil
+		}
+
+		// Перебор обычно небольшой - уменьшаем бюджет пропорционально и пробуем еще раз
+		log.Printf("⚠️ Сжатый файл больше цели: %s > %s", formatFileSize(info.Size()), formatFileSize(targetSize))
+		budget = budget * targetSize / info.Size() * 95 / 100
+	}
+
+	os.Remove(outPath)
+	return "", fmt.Errorf("не удалось уложиться в %s", formatFileSize(targetSize))
+}
+
+// encodeTwoPass выполняет двухпроходное кодирование libx264 с заданным битрейтом
+func (b *LocalBot) encodeTwoPass(ctx context.Context, inPath, outPath, passLog string, videoKbps, audioKbps, maxHeight int) error {
+	videoArgs := []string{
+		"-vf", fmt.Sprintf("scale=-2:'min(%d,ih)'", maxHeight),
+		"-c:v", "libx264",
+		"-preset", "medium",
+		"-b:v", fmt.Sprintf("%dk", videoKbps),
+		"-maxrate", fmt.Sprintf("%dk", videoKbps*3/2),
+		"-bufsize", fmt.Sprintf("%dk", videoKbps*2),
+		"-pix_fmt", "yuv420p",
+		"-passlogfile", passLog,
+	}
+
+	passes := [][]string{
+		append(append([]string{"-y", "-i", inPath}, videoArgs...), "-pass", "1", "-an", "-f", "mp4", os.DevNull),
+		append(append([]string{"-y", "-i", inPath}, videoArgs...), "-pass", "2",
+			"-c:a", "aac", "-b:a", fmt.Sprintf("%dk", audioKbps), "-movflags", "+faststart", outPath),
+	}
+	for i, args := range passes {
+		cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+		log.Printf("🎞️ Проход %d: %s", i+1, strings.Join(cmd.Args, " "))
+		if output, err := cmd.CombinedOutput(); err != nil {
+			if ctx.Err() != nil {
+				return services.ErrCancelled
+			}
+			log.Printf("❌ Ошибка сжатия: %s", string(output))
+			return fmt.Errorf("ошибка сжатия (проход %d): %v", i+1, err)
+		}
+	}
+	return nil
+}
+
 func fixUTF8Encoding(s string) string {
 	// Проверяем, что строка валидна UTF-8
 	if utf8.ValidString(s) {
@@ -3334,7 +4731,7 @@ func (b *LocalBot) validateVideoFile(videoPath string) bool {
 	
 	// Проверяем расширение файла
 	ext := strings.ToLower(filepath.Ext(videoPath))
-	allowedExts := []string{".mp4", ".avi", ".mov", ".mkv", ".m4v", ".mp3", ".m4a", ".ogg", ".webm"}
+	allowedExts := []string{".mp4", ".avi", ".mov", ".mkv", ".m4v", ".mp3", ".m4a", ".ogg", ".opus", ".flac", ".wav", ".webm"}
 	isValidExt := false
 	for _, allowedExt := range allowedExts {
 		if ext == allowedExt {
@@ -3384,26 +4781,25 @@ func (b *LocalBot) isSafePath(path string) bool {
 	return strings.HasPrefix(absPath, absDownloadDir)
 }
 
-// validateURL проверяет безопасность URL
-func (b *LocalBot) validateURL(url string) bool {
+// validateURL проверяет ссылку из сообщения: http(s) с хостом, не длиннее 2048 символов,
+// платформа из реестра или разрешенный домен. Через нее проходят все ссылки сообщения.
+func (b *LocalBot) validateURL(rawURL string) bool {
 	// Проверяем длину URL
-	if len(url) > 2048 {
-		log.Printf("❌ URL слишком длинный: %d символов", len(url))
+	if len(rawURL) > 2048 {
+		log.Printf("❌ URL слишком длинный: %d символов", len(rawURL))
 		return false
 	}
 	
-	// Проверяем на подозрительные символы
-	suspiciousChars := []string{"<", ">", "\"", "'", "&", "script", "javascript", "data:"}
-	for _, char := range suspiciousChars {
-		if strings.Contains(strings.ToLower(url), char) {
-			log.Printf("❌ URL содержит подозрительные символы: %s", char)
-			return false
-		}
+	// Принимаем только http(s) ссылки с хостом и без логина в адресе
+	parsed, err := neturl.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" || parsed.User != nil {
+		log.Printf("❌ Некорректная ссылка: %s", rawURL)
+		return false
 	}
 	
-	// Проверяем что это YouTube URL
-	if !strings.Contains(url, "youtube.com") && !strings.Contains(url, "youtu.be") {
-		log.Printf("❌ URL не является YouTube ссылкой: %s", url)
+	// Проверяем что ссылка относится к платформе из реестра или к разрешенному домену
+	if !b.universalService.IsValidURL(rawURL) {
+		log.Printf("❌ URL не относится к поддерживаемой платформе: %s", rawURL)
 		return false
 	}
 	
@@ -3448,18 +4844,94 @@ func isValidVideoURL(url string) bool {
 		return false
 	}
 	
-	// Проверяем только YouTube платформы
-	supportedPatterns := []string{
-		"youtube.com", "youtu.be",           // YouTube
+	// Платформы берутся из реестра services.RegisterPlatform
+	return services.NewPlatformDetector().DetectPlatform(url).Supported
+}
+
+// handleGenericCommand выполняет /generic: без аргументов показывает списки доменов,
+// "allow <домен>", "deny <домен>" и "remove <домен>" меняют их
+func (b *LocalBot) handleGenericCommand(chatID int64, args []string) {
+	if b.genericDomains == nil {
+		b.SendMessage(chatID, "🌐 Универсальное извлечение выключено\n\n💡 Включите его в конфигурации: GENERIC_EXTRACTOR=true")
+		return
+	}
+	
+	if len(args) == 0 {
+		allow, deny := b.genericDomains.Domains()
+		text := "🌐 Универсальное извлечение через yt-dlp\n\n✅ Разрешены:\n" + domainListText(allow) +
+			"\n\n⛔ Запрещены:\n" + domainListText(deny) +
+			"\n\n💡 /generic allow <домен>\n💡 /generic deny <домен>\n💡 /generic remove <домен>\n\n\"*\" среди разрешенных - все домены, кроме запрещенных"
+		b.SendMessage(chatID, text)
+		return
+	}
+	if len(args) != 2 {
+		b.SendMessage(chatID, "❌ Использование: /generic allow|deny|remove <домен>")
+		return
 	}
 	
-	for _, pattern := range supportedPatterns {
-		if strings.Contains(url, pattern) {
-			return true
+	domain := args[1]
+	var err error
+	switch args[0] {
+	case "allow":
+		err = b.genericDomains.Allow(domain)
+	case "deny":
+		err = b.genericDomains.Deny(domain)
+	case "remove":
+		var removed bool
+		if removed, err = b.genericDomains.Remove(domain); err == nil && !removed {
+			b.SendMessage(chatID, fmt.Sprintf("ℹ️ Домена %s нет в списках", domain))
+			return
 		}
+	default:
+		b.SendMessage(chatID, "❌ Использование: /generic allow|deny|remove <домен>")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка изменения доменов: %v", err)
+		b.SendMessage(chatID, "❌ "+err.Error())
+		return
 	}
 	
-	return false
+	log.Printf("🌐 Домены универсального извлечения: %s %s", args[0], services.NormalizeDomain(domain))
+	b.SendMessage(chatID, fmt.Sprintf("✅ Готово: %s %s", args[0], services.NormalizeDomain(domain)))
+}
+
+// domainListText формирует список доменов для сообщения
+func domainListText(domains []string) string {
+	if len(domains) == 0 {
+		return "—"
+	}
+	return "• " + strings.Join(domains, "\n• ")
+}
+
+// formatFromCallback извлекает ID формата из "format_<id>_<разрешение>" или "fit_<МБ>_<id>".
+// ID форматов некоторых платформ содержат "_" (SoundCloud "http_mp3_128", Twitch "audio_only"),
+// поэтому разрешение отделяется по последнему "_", а размер сжатия - по первому.
+func formatFromCallback(data string) string {
+	if strings.HasPrefix(data, "fit_") {
+		_, formatID, _ := strings.Cut(strings.TrimPrefix(data, "fit_"), "_")
+		return formatID
+	}
+	formatID, _, _ := splitFormatCallback(strings.TrimPrefix(data, "format_"))
+	return formatID
+}
+
+// splitFormatCallback делит "<id>_<разрешение>" по последнему "_"
+func splitFormatCallback(data string) (formatID, resolution string, ok bool) {
+	i := strings.LastIndex(data, "_")
+	if i <= 0 {
+		return "", "", false
+	}
+	return data[:i], data[i+1:], true
+}
+
+// supportedPlatformsText формирует список платформ для подсказки пользователю
+func supportedPlatformsText(platforms []services.PlatformInfo) string {
+	var lines []string
+	for _, platform := range platforms {
+		lines = append(lines, platform.Icon+" "+platform.DisplayName)
+	}
+	return strings.Join(lines, "\n")
 }
 
 // HealthCheck проверяет состояние всех сервисов
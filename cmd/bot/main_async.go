@@ -2,11 +2,12 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"mime/multipart"
 	"net/http"
 	"os"
 	"os/signal"
@@ -45,15 +46,31 @@ type AsyncLocalBot struct {
 	// Активные задачи пользователей
 	userJobs       map[int64]string // chatID -> jobID
 	userJobsMux    sync.RWMutex
+	// ID администраторов (их задачи получают максимальный приоритет)
+	adminIDs       map[int64]bool
+	// Открытые списки видео плейлистов и каналов по чатам
+	playlists      map[int64]*playlistSelection
+	playlistsMux   sync.Mutex
+	// Идущие пакетные загрузки по ID пакета
+	batches        map[string]*activeBatch
+	batchesMux     sync.Mutex
+	// Подписки на каналы и их проверка
+	subscriptionStore *services.SubscriptionStore
+	subscriptions     *services.SubscriptionPoller
 }
 
 // NewAsyncLocalBot создает новый экземпляр AsyncLocalBot
-func NewAsyncLocalBot(token, apiURL string, timeout time.Duration, youtubeService *services.YouTubeService, cacheService *services.CacheService, downloadQueue *services.DownloadQueue) *AsyncLocalBot {
+func NewAsyncLocalBot(token, apiURL string, timeout time.Duration, youtubeService *services.YouTubeService, cacheService *services.CacheService, downloadQueue *services.DownloadQueue, adminIDs []int64) *AsyncLocalBot {
 	// Создаем HTTP клиент с настройками прокси
 	httpClient := &http.Client{
 		Timeout: timeout,
 	}
 	
+	admins := make(map[int64]bool)
+	for _, id := range adminIDs {
+		admins[id] = true
+	}
+	
 	// Применяем настройки прокси если они включены
 	// TODO: Добавить поддержку конфигурации прокси в AsyncLocalBot
 	// if cfg.Proxy != nil && cfg.Proxy.UseProxy {
@@ -70,6 +87,9 @@ func NewAsyncLocalBot(token, apiURL string, timeout time.Duration, youtubeServic
 		cacheService:  cacheService,
 		downloadQueue: downloadQueue,
 		userJobs:      make(map[int64]string),
+		adminIDs:      admins,
+		playlists:     make(map[int64]*playlistSelection),
+		batches:       make(map[string]*activeBatch),
 	}
 }
 
@@ -140,55 +160,275 @@ func (b *AsyncLocalBot) SendMessage(chatID int64, text string) error {
 	return nil
 }
 
+// SendMessageWithID отправляет сообщение с клавиатурой (если задана) и возвращает его ID
+func (b *AsyncLocalBot) SendMessageWithID(chatID int64, text string, keyboard [][]map[string]interface{}) (int64, error) {
+	message := map[string]interface{}{
+		"chat_id": chatID,
+		"text":    text,
+	}
+	if keyboard != nil {
+		message["reply_markup"] = map[string]interface{}{"inline_keyboard": keyboard}
+	}
+
+	jsonData, err := json.Marshal(message)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка маршалинга сообщения: %v", err)
+	}
+
+	resp, err := b.Client.Post(
+		fmt.Sprintf("%s/bot%s/sendMessage", b.APIURL, b.Token),
+		"application/json",
+		bytes.NewBuffer(jsonData),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка отправки сообщения: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("неуспешный статус sendMessage: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		OK     bool    `json:"ok"`
+		Result Message `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("ошибка декодирования ответа sendMessage: %v", err)
+	}
+
+	return result.Result.MessageID, nil
+}
+
+// EditMessageText заменяет текст сообщения (клавиатура сохраняется, только если передана заново)
+func (b *AsyncLocalBot) EditMessageText(chatID, messageID int64, text string, keyboard [][]map[string]interface{}) error {
+	message := map[string]interface{}{
+		"chat_id":    chatID,
+		"message_id": messageID,
+		"text":       text,
+	}
+	if keyboard != nil {
+		message["reply_markup"] = map[string]interface{}{"inline_keyboard": keyboard}
+	}
+
+	jsonData, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("ошибка маршалинга сообщения: %v", err)
+	}
+
+	resp, err := b.Client.Post(
+		fmt.Sprintf("%s/bot%s/editMessageText", b.APIURL, b.Token),
+		"application/json",
+		bytes.NewBuffer(jsonData),
+	)
+	if err != nil {
+		return fmt.Errorf("ошибка редактирования сообщения: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		// Telegram отвечает ошибкой, если текст не изменился - это не проблема
+		if strings.Contains(string(body), "message is not modified") {
+			return nil
+		}
+		return fmt.Errorf("неуспешный статус editMessageText: %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// jobCancelKeyboard - кнопка отмены задачи под статусным сообщением
+func jobCancelKeyboard(jobID string) [][]map[string]interface{} {
+	return [][]map[string]interface{}{
+		{
+			{
+				"text":          "✖ Отмена",
+				"callback_data": "cancel_" + jobID,
+			},
+		},
+	}
+}
+
 // SendVideo отправляет видео файл
 func (b *AsyncLocalBot) SendVideo(chatID int64, videoPath, caption string) error {
-	file, err := os.Open(videoPath)
+	_, err := b.uploadVideo(chatID, videoPath, caption, nil)
+	return err
+}
+
+// SendAudio отправляет аудио файл с названием и исполнителем из его тегов
+func (b *AsyncLocalBot) SendAudio(chatID int64, audioPath, caption string) error {
+	_, err := b.uploadAudio(chatID, audioPath, caption, nil)
+	return err
+}
+
+// uploadAudio загружает аудио в Telegram и возвращает file_id отправленного файла
+func (b *AsyncLocalBot) uploadAudio(chatID int64, audioPath, caption string, onProgress services.ProgressFunc) (string, error) {
+	upload := services.NewMultipartUpload()
+	upload.Progress = onProgress
+	upload.AddField("chat_id", fmt.Sprintf("%d", chatID))
+	if caption != "" {
+		upload.AddField("caption", caption)
+	}
+
+	// Название и исполнитель из тегов файла, чтобы плеер Telegram не показывал имя файла
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if tags, err := services.ReadAudioTags(ctx, audioPath); err == nil {
+		if tags.Title != "" {
+			upload.AddField("title", tags.Title)
+		}
+		if tags.Artist != "" {
+			upload.AddField("performer", tags.Artist)
+		}
+	}
+
+	if err := upload.AddFile("audio", audioPath); err != nil {
+		return "", err
+	}
+
+	resp, err := upload.Post(b.Client, fmt.Sprintf("%s/bot%s/sendAudio", b.APIURL, b.Token))
 	if err != nil {
-		return fmt.Errorf("ошибка открытия файла: %v", err)
+		return "", fmt.Errorf("ошибка отправки аудио: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("неуспешный статус sendAudio: %d, ответ: %s", resp.StatusCode, string(body))
 	}
-	defer file.Close()
+	return services.ParseSentFileID(body), nil
+}
 
-	// Создаем multipart form
-	var buf bytes.Buffer
-	writer := multipart.NewWriter(&buf)
+// uploadVideo загружает видео файл, сообщая прогресс в onProgress (может быть nil),
+// и возвращает file_id, присвоенный ему Telegram. Файл отправляется потоком, без буфера в памяти.
+func (b *AsyncLocalBot) uploadVideo(chatID int64, videoPath, caption string, onProgress services.ProgressFunc) (string, error) {
+	upload := services.NewMultipartUpload()
+	upload.Progress = onProgress
 
 	// Добавляем chat_id
-	writer.WriteField("chat_id", fmt.Sprintf("%d", chatID))
+	upload.AddField("chat_id", fmt.Sprintf("%d", chatID))
 	
 	// Добавляем caption если есть
 	if caption != "" {
-		writer.WriteField("caption", caption)
+		upload.AddField("caption", caption)
 	}
 
 	// Добавляем файл
-	part, err := writer.CreateFormFile("video", filepath.Base(videoPath))
-	if err != nil {
-		return fmt.Errorf("ошибка создания form file: %v", err)
+	if err := upload.AddFile("video", videoPath); err != nil {
+		return "", err
 	}
 
-	_, err = io.Copy(part, file)
+	// Отправляем запрос
+	resp, err := upload.Post(b.Client, fmt.Sprintf("%s/bot%s/sendVideo", b.APIURL, b.Token))
 	if err != nil {
-		return fmt.Errorf("ошибка копирования файла: %v", err)
+		return "", fmt.Errorf("ошибка отправки видео: %v", err)
 	}
+	defer resp.Body.Close()
 
-	writer.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("неуспешный статус sendVideo: %d, ответ: %s", resp.StatusCode, string(body))
+	}
+
+	return services.ParseSentFileID(body), nil
+}
+
+// sendByFileID отправляет уже загруженный в Telegram файл по file_id: аудио - через
+// sendAudio, видео - через sendVideo
+func (b *AsyncLocalBot) sendByFileID(chatID int64, fileID, caption string, isAudio bool) error {
+	method, field := "sendVideo", "video"
+	if isAudio {
+		method, field = "sendAudio", "audio"
+	}
+	message := map[string]interface{}{
+		"chat_id": chatID,
+		field:     fileID,
+		"caption": caption,
+	}
+
+	jsonData, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("ошибка маршалинга сообщения: %v", err)
+	}
 
-	// Отправляем запрос
 	resp, err := b.Client.Post(
-		fmt.Sprintf("%s/bot%s/sendVideo", b.APIURL, b.Token),
-		writer.FormDataContentType(),
-		&buf,
+		fmt.Sprintf("%s/bot%s/%s", b.APIURL, b.Token, method),
+		"application/json",
+		bytes.NewBuffer(jsonData),
 	)
 	if err != nil {
-		return fmt.Errorf("ошибка отправки видео: %v", err)
+		return fmt.Errorf("ошибка отправки по file_id: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("неуспешный статус sendVideo: %d, ответ: %s", resp.StatusCode, string(body))
+		return fmt.Errorf("неуспешный статус %s: %d, ответ: %s", method, resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// cacheKey возвращает ID видео и пространство кэша ссылки по реестру платформ
+// ("" - ссылка не на видео поддерживаемой платформы)
+func cacheKey(videoURL string) (videoID, platform string) {
+	info := services.NewPlatformDetector().DetectPlatform(videoURL)
+	if !info.Supported || info.Collection {
+		return "", ""
+	}
+	return info.VideoID, info.CacheNamespace
+}
+
+// sendStoredFile отправляет файл по сохраненному file_id без повторной загрузки.
+// Возвращает false, если file_id нет или Telegram его не принял (тогда file_id забывается).
+func (b *AsyncLocalBot) sendStoredFile(chatID int64, videoID, platform, formatID, caption string) bool {
+	botID := services.BotIDFromToken(b.Token)
+	fileID, isAudio, err := b.cacheService.GetFileID(videoID, platform, formatID, botID)
+	if err != nil {
+		log.Printf("⚠️ %v", err)
+		return false
+	}
+	if fileID == "" {
+		return false
+	}
+
+	if err := b.sendByFileID(chatID, fileID, caption, isAudio); err != nil {
+		log.Printf("⚠️ Telegram не принял file_id, файл будет загружен заново: %v", err)
+		b.cacheService.DeleteFileID(videoID, platform, formatID, botID)
+		return false
+	}
+
+	log.Printf("⚡ Файл %s/%s (%s) отправлен по file_id без загрузки", platform, videoID, formatID)
+	return true
+}
+
+// deliverFile отправляет скачанный файл: по сохраненному file_id, а если не вышло - загружает
+// его как аудио или видео (сообщая прогресс в onProgress) и запоминает новый file_id
+func (b *AsyncLocalBot) deliverFile(chatID int64, videoURL, formatID, filePath, caption string, onProgress services.ProgressFunc) error {
+	isAudio := services.IsAudioExtension(filepath.Ext(filePath))
+	upload := b.uploadVideo
+	if isAudio {
+		upload = b.uploadAudio
+	}
+
+	videoID, platform := cacheKey(videoURL)
+	if videoID == "" {
+		_, err := upload(chatID, filePath, caption, onProgress)
+		return err
+	}
+	if b.sendStoredFile(chatID, videoID, platform, formatID, caption) {
+		return nil
 	}
 
+	fileID, err := upload(chatID, filePath, caption, onProgress)
+	if err != nil {
+		return err
+	}
+	if fileID != "" {
+		if err := b.cacheService.SaveFileID(videoID, platform, formatID, services.BotIDFromToken(b.Token), fileID, isAudio); err != nil {
+			log.Printf("⚠️ %v", err)
+		}
+	}
 	return nil
 }
 
@@ -246,51 +486,23 @@ func (b *AsyncLocalBot) SendPhotoFromFile(chatID int64, filePath, caption string
 		return fmt.Errorf("файл не найден: %s", filePath)
 	}
 	
-	// Открываем файл
-	file, err := os.Open(filePath)
-	if err != nil {
-		log.Printf("❌ Ошибка открытия файла: %v", err)
-		return fmt.Errorf("ошибка открытия файла: %v", err)
-	}
-	defer file.Close()
-	
-	// Создаем multipart form
-	var buf bytes.Buffer
-	writer := multipart.NewWriter(&buf)
+	upload := services.NewMultipartUpload()
 	
 	// Добавляем chat_id
-	writer.WriteField("chat_id", fmt.Sprintf("%d", chatID))
+	upload.AddField("chat_id", fmt.Sprintf("%d", chatID))
 	
 	// Добавляем caption
-	writer.WriteField("caption", caption)
-	writer.WriteField("parse_mode", "Markdown")
+	upload.AddField("caption", caption)
+	upload.AddField("parse_mode", "Markdown")
 	
 	// Добавляем файл
-	part, err := writer.CreateFormFile("photo", filepath.Base(filePath))
-	if err != nil {
-		log.Printf("❌ Ошибка создания form file: %v", err)
-		return fmt.Errorf("ошибка создания form file: %v", err)
+	if err := upload.AddFile("photo", filePath); err != nil {
+		log.Printf("❌ Ошибка добавления файла: %v", err)
+		return err
 	}
 	
-	_, err = io.Copy(part, file)
-	if err != nil {
-		log.Printf("❌ Ошибка копирования файла: %v", err)
-		return fmt.Errorf("ошибка копирования файла: %v", err)
-	}
-	
-	writer.Close()
-	
 	// Отправляем запрос
-	req, err := http.NewRequest("POST", 
-		fmt.Sprintf("%s/bot%s/sendPhoto", b.APIURL, b.Token), &buf)
-	if err != nil {
-		log.Printf("❌ Ошибка создания запроса: %v", err)
-		return fmt.Errorf("ошибка создания запроса: %v", err)
-	}
-	
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	
-	resp, err := b.Client.Do(req)
+	resp, err := upload.Post(b.Client, fmt.Sprintf("%s/bot%s/sendPhoto", b.APIURL, b.Token))
 	if err != nil {
 		log.Printf("❌ Ошибка HTTP запроса: %v", err)
 		return fmt.Errorf("ошибка отправки фото: %v", err)
@@ -317,25 +529,23 @@ func (b *AsyncLocalBot) SendMediaGroup(chatID int64, mediaFiles []string) error
 		return fmt.Errorf("нет файлов для отправки")
 	}
 	
-	// Создаем multipart form
-	var buf bytes.Buffer
-	writer := multipart.NewWriter(&buf)
+	upload := services.NewMultipartUpload()
 	
 	// Добавляем chat_id
-	writer.WriteField("chat_id", fmt.Sprintf("%d", chatID))
+	upload.AddField("chat_id", fmt.Sprintf("%d", chatID))
 	
-	// Создаем массив медиафайлов
+	// Создаем массив медиафайлов и добавляем файлы (их содержимое читается при отправке)
 	var mediaArray []map[string]interface{}
 	for i, filePath := range mediaFiles {
-		// Проверяем существование файла
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		field := fmt.Sprintf("photo_%d", i)
+		if err := upload.AddFile(field, filePath); err != nil {
 			log.Printf("⚠️ Файл не найден: %s", filePath)
 			continue
 		}
 		
 		mediaItem := map[string]interface{}{
 			"type": "photo",
-			"media": fmt.Sprintf("attach://photo_%d", i),
+			"media": "attach://" + field,
 		}
 		mediaArray = append(mediaArray, mediaItem)
 	}
@@ -349,48 +559,10 @@ func (b *AsyncLocalBot) SendMediaGroup(chatID int64, mediaFiles []string) error
 	if err != nil {
 		return fmt.Errorf("ошибка маршалинга media: %v", err)
 	}
-	writer.WriteField("media", string(mediaJSON))
-	
-	// Добавляем файлы
-	for i, filePath := range mediaFiles {
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
-			continue
-		}
-		
-		file, err := os.Open(filePath)
-		if err != nil {
-			log.Printf("❌ Ошибка открытия файла %s: %v", filePath, err)
-			continue
-		}
-		
-		part, err := writer.CreateFormFile(fmt.Sprintf("photo_%d", i), filepath.Base(filePath))
-		if err != nil {
-			file.Close()
-			log.Printf("❌ Ошибка создания form file: %v", err)
-			continue
-		}
-		
-		_, err = io.Copy(part, file)
-		file.Close()
-		if err != nil {
-			log.Printf("❌ Ошибка копирования файла: %v", err)
-			continue
-		}
-	}
-	
-	writer.Close()
+	upload.AddField("media", string(mediaJSON))
 	
 	// Отправляем запрос
-	req, err := http.NewRequest("POST", 
-		fmt.Sprintf("%s/bot%s/sendMediaGroup", b.APIURL, b.Token), &buf)
-	if err != nil {
-		log.Printf("❌ Ошибка создания запроса: %v", err)
-		return fmt.Errorf("ошибка создания запроса: %v", err)
-	}
-	
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	
-	resp, err := b.Client.Do(req)
+	resp, err := upload.Post(b.Client, fmt.Sprintf("%s/bot%s/sendMediaGroup", b.APIURL, b.Token))
 	if err != nil {
 		log.Printf("❌ Ошибка HTTP запроса: %v", err)
 		return fmt.Errorf("ошибка отправки медиагруппы: %v", err)
@@ -565,7 +737,7 @@ func (b *AsyncLocalBot) handleYouTubeLink(chatID int64, videoURL string) {
 		resolutionGroups := make(map[string][]services.VideoFormat)
 
 		for _, format := range formats {
-			if format.Extension == "audio" {
+			if format.IsAudioOnly() {
 				audioFormats = append(audioFormats, format)
 			} else {
 				// Группируем по разрешению
@@ -614,8 +786,41 @@ func (b *AsyncLocalBot) handleYouTubeLink(chatID int64, videoURL string) {
 	}()
 }
 
+// chosenFormat ищет выбранный формат в списке, показанном пользователю
+func (b *AsyncLocalBot) chosenFormat(chatID int64, formatID string) (services.VideoFormat, bool) {
+	b.formatCacheMux.RLock()
+	defer b.formatCacheMux.RUnlock()
+	for _, format := range b.formatCache[chatID] {
+		if format.ID == formatID {
+			return format, true
+		}
+	}
+	return services.VideoFormat{}, false
+}
+
+// jobPriority вычисляет приоритет задачи: админы, Premium и маленькое аудио идут раньше
+func (b *AsyncLocalBot) jobPriority(chatID int64, user User, videoURL, formatID string) int {
+	hints := services.PriorityHints{
+		IsAdmin:   b.adminIDs[user.ID],
+		IsPremium: user.IsPremium,
+	}
+
+	if format, ok := b.chosenFormat(chatID, formatID); ok {
+		hints.IsAudio = format.IsAudioOnly()
+		hints.FileSize = format.FileSize
+	}
+
+	if videoID, platform := cacheKey(videoURL); videoID != "" {
+		if isCached, _, err := b.cacheService.IsVideoCached(videoID, platform, formatID); err == nil {
+			hints.Cached = isCached
+		}
+	}
+
+	return services.JobPriority(hints)
+}
+
 // handleFormatSelection обрабатывает выбор формата пользователем
-func (b *AsyncLocalBot) handleFormatSelection(chatID int64, formatID string) {
+func (b *AsyncLocalBot) handleFormatSelection(chatID int64, user User, formatID string) {
 	// Получаем URL видео из кэша
 	b.videoURLCacheMux.RLock()
 	videoURL := b.videoURLCache[chatID]
@@ -627,8 +832,29 @@ func (b *AsyncLocalBot) handleFormatSelection(chatID int64, formatID string) {
 		return
 	}
 
+	userID := user.ID
+	if userID == 0 {
+		userID = chatID
+	}
+
+	// Видео уже загружалось в Telegram - отправляем по file_id без очереди
+	if videoID, platform := cacheKey(videoURL); videoID != "" && b.sendStoredFile(chatID, videoID, platform, formatID, fmt.Sprintf("Видео в формате %s (из кэша)", formatID)) {
+		b.cacheService.IncrementDownloadCount(videoID, platform, formatID)
+		b.SendMessage(chatID, "🎉 Видео успешно отправлено!")
+		return
+	}
+
 	// Добавляем задачу в очередь
-	jobID, err := b.downloadQueue.AddJob(chatID, chatID, videoURL, formatID, 5) // Приоритет 5 (средний)
+	priority := b.jobPriority(chatID, user, videoURL, formatID)
+	format, _ := b.chosenFormat(chatID, formatID)
+	jobID, err := b.downloadQueue.AddJob(userID, chatID, videoURL, formatID, format.Resolution, priority)
+	var limitErr *services.UserLimitError
+	if errors.As(err, &limitErr) {
+		log.Printf("⚖️ Пользователь %d превысил лимит очереди: %v", userID, err)
+		b.SendMessage(chatID, fmt.Sprintf("⏳ У вас уже %d задач в очереди (максимум %d), ближайшая на позиции %d.\n\n💡 Дождитесь их выполнения или отмените /cancel",
+			limitErr.Queued, limitErr.Limit, limitErr.Position))
+		return
+	}
 	if err != nil {
 		log.Printf("❌ Ошибка добавления задачи в очередь: %v", err)
 		b.SendMessage(chatID, "❌ Ошибка: не удалось добавить задачу в очередь. Попробуйте позже.")
@@ -641,152 +867,776 @@ func (b *AsyncLocalBot) handleFormatSelection(chatID int64, formatID string) {
 	b.userJobsMux.Unlock()
 
 	log.Printf("📝 Задача добавлена в очередь: %s для пользователя %d", jobID, chatID)
-	b.SendMessage(chatID, "⏳ Задача добавлена в очередь загрузок. Ожидайте...")
+	statusText := "⏳ Задача добавлена в очередь загрузок. Ожидайте..."
+	if position := b.downloadQueue.JobPosition(jobID); position > 0 {
+		statusText = queuedStatusText(b.downloadQueue.QueuedJobs(userID), position)
+	}
+	statusID, err := b.SendMessageWithID(chatID, statusText, jobCancelKeyboard(jobID))
+	if err != nil {
+		log.Printf("⚠️ Не удалось отправить статусное сообщение: %v", err)
+	}
 
-	// Запускаем мониторинг задачи
-	go b.monitorJob(chatID, jobID)
-	
-	// Дополнительно запускаем быструю проверку для кэшированных видео
-	go b.quickCheckForCachedVideo(chatID, jobID, videoURL, formatID)
+	// Запускаем мониторинг задачи (в том числе мгновенно завершенных из кэша)
+	go b.monitorJob(chatID, jobID, statusID)
 }
 
-// quickCheckForCachedVideo быстро проверяет кэшированные видео
-func (b *AsyncLocalBot) quickCheckForCachedVideo(chatID int64, jobID, videoURL, formatID string) {
-	// Ждем немного, чтобы дать время очереди обработать задачу
-	time.Sleep(1 * time.Second)
-	
-	// Проверяем, есть ли задача в активных
-	job, exists := b.downloadQueue.GetJobStatus(jobID)
+// restoreJobs восстанавливает задачи из хранилища и сообщает чатам о судьбе их загрузок
+func (b *AsyncLocalBot) restoreJobs() {
+	resumed, failed, err := b.downloadQueue.Restore()
+	if err != nil {
+		log.Printf("❌ Не удалось восстановить очередь: %v", err)
+		return
+	}
+
+	for _, job := range resumed {
+		b.userJobsMux.Lock()
+		b.userJobs[job.ChatID] = job.ID
+		b.userJobsMux.Unlock()
+
+		statusText := "🔄 Бот был перезапущен, ваша загрузка возвращена в очередь."
+		if position := b.downloadQueue.JobPosition(job.ID); position > 0 {
+			statusText += "\n\n" + queuedStatusText(b.downloadQueue.QueuedJobs(job.UserID), position)
+		}
+		statusID, err := b.SendMessageWithID(job.ChatID, statusText, jobCancelKeyboard(job.ID))
+		if err != nil {
+			log.Printf("⚠️ Не удалось уведомить чат %d о восстановлении задачи: %v", job.ChatID, err)
+		}
+		go b.monitorJob(job.ChatID, job.ID, statusID)
+	}
+
+	for _, job := range failed {
+		b.SendMessage(job.ChatID, fmt.Sprintf("❌ Загрузка %s была прервана перезапуском бота и не может быть продолжена.\n\n💡 Отправьте ссылку заново.", job.VideoURL))
+	}
+}
+
+// queuedStatusText формирует текст статуса ожидающей задачи
+func queuedStatusText(queued, position int) string {
+	return fmt.Sprintf("⏳ У вас задач в очереди: %d. Эта задача на позиции %d. Ожидайте...", queued, position)
+}
+
+// cancelUserJobs отменяет все незавершенные задачи пользователя и возвращает их количество
+func (b *AsyncLocalBot) cancelUserJobs(userID int64) int {
+	cancelled := 0
+
+	// Сначала останавливаем пакеты, чтобы они не ставили в очередь новые видео
+	b.batchesMux.Lock()
+	var batchIDs []string
+	for batchID, batch := range b.batches {
+		if batch.userID == userID {
+			batchIDs = append(batchIDs, batchID)
+		}
+	}
+	b.batchesMux.Unlock()
+	for _, batchID := range batchIDs {
+		if b.cancelBatch(batchID) {
+			cancelled++
+		}
+	}
+
+	for _, job := range b.downloadQueue.GetUserJobs(userID) {
+		if job.Status != services.JobStatusPending && job.Status != services.JobStatusProcessing {
+			continue
+		}
+		if err := b.downloadQueue.CancelJob(job.ID); err == nil {
+			cancelled++
+		}
+	}
+	return cancelled
+}
+
+// playlistPageSize - сколько видео плейлиста показываем на одной странице
+const playlistPageSize = 10
+
+// playlistSelection - плейлист, открытый в чате, и выбор пользователя
+type playlistSelection struct {
+	playlist  *services.Playlist
+	selected  map[int]bool // Выбранные видео по индексу в playlist.Entries
+	selecting bool         // Режим выбора: видео страницы показываются кнопками
+	page      int
+}
+
+// activeBatch - идущая пакетная загрузка
+type activeBatch struct {
+	userID int64
+	cancel func()
+}
+
+// handleLinks раскрывает и канонизирует ссылки из сообщения: одно видео - меню форматов,
+// плейлист или канал - список его видео, несколько видео - сразу пакет загрузок
+func (b *AsyncLocalBot) handleLinks(chatID int64, user User, links []services.Link) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	links = services.ResolveLinks(ctx, links, func(url string) bool {
+		return services.IsYouTubeVideoURL(url) || services.IsPlaylistURL(url)
+	})
+	cancel()
+
+	var videos, collections []string
+	for _, link := range links {
+		if services.IsPlaylistURL(link.URL) {
+			collections = append(collections, link.URL)
+		} else {
+			videos = append(videos, link.URL)
+		}
+	}
+	log.Printf("🔗 Чат %d: ссылок на видео %d, на плейлисты и каналы %d", chatID, len(videos), len(collections))
+
+	switch {
+	case len(videos) > 1:
+		b.queueLinks(chatID, user, videos)
+	case len(videos) == 1:
+		b.handleYouTubeLink(chatID, videos[0])
+	case len(collections) > 0:
+		b.handlePlaylistLink(chatID, collections[0])
+		collections = collections[1:]
+	default:
+		b.SendMessage(chatID, "Отправьте ссылку на YouTube видео для скачивания.")
+		return
+	}
+
+	// Список видео в чате один - остальные плейлисты нужно прислать отдельно
+	if len(collections) > 0 {
+		var text strings.Builder
+		text.WriteString("📃 Плейлисты и каналы отправьте отдельными сообщениями:")
+		for _, url := range collections {
+			text.WriteString("\n• " + url)
+		}
+		b.SendMessage(chatID, text.String())
+	}
+}
+
+// queueLinks ставит несколько присланных видео в очередь одним пакетом: по задаче
+// на ссылку, со сводным прогрессом и отменой всего пакета
+func (b *AsyncLocalBot) queueLinks(chatID int64, user User, urls []string) {
+	var entries []services.PlaylistEntry
+	for _, url := range urls {
+		entries = append(entries, services.PlaylistEntry{
+			ID:    services.NewPlatformDetector().DetectPlatform(url).VideoID,
+			Title: url,
+			URL:   url,
+		})
+	}
+	b.startBatch(chatID, user, "Ссылки из сообщения", entries, services.BatchVideoFormat)
+}
+
+// handlePlaylistLink получает список видео плейлиста или канала и показывает первую страницу
+func (b *AsyncLocalBot) handlePlaylistLink(chatID int64, playlistURL string) {
+	log.Printf("📃 Анализирую плейлист: %s", playlistURL)
+	b.SendMessage(chatID, "📃 Получаю список видео...")
+
+	go func() {
+		playlist, err := b.youtubeService.GetPlaylist(playlistURL)
+		if err != nil {
+			log.Printf("❌ Ошибка GetPlaylist: %v", err)
+			b.SendMessage(chatID, fmt.Sprintf("❌ Ошибка получения списка видео: %v", err))
+			return
+		}
+
+		selection := &playlistSelection{playlist: playlist, selected: make(map[int]bool)}
+		b.playlistsMux.Lock()
+		b.playlists[chatID] = selection
+		text, keyboard := selection.render()
+		b.playlistsMux.Unlock()
+
+		if _, err := b.SendMessageWithID(chatID, text, keyboard); err != nil {
+			log.Printf("❌ Ошибка отправки списка видео: %v", err)
+			b.SendMessage(chatID, "❌ Ошибка создания меню выбора")
+		}
+	}()
+}
+
+// pageCount возвращает количество страниц списка
+func (s *playlistSelection) pageCount() int {
+	return (len(s.playlist.Entries) + playlistPageSize - 1) / playlistPageSize
+}
+
+// render формирует текст и клавиатуру текущей страницы (вызывается под playlistsMux)
+func (s *playlistSelection) render() (string, [][]map[string]interface{}) {
+	playlist := s.playlist
+	start := s.page * playlistPageSize
+	end := start + playlistPageSize
+	if end > len(playlist.Entries) {
+		end = len(playlist.Entries)
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "📃 %s\n", playlist.Title)
+	if playlist.Uploader != "" {
+		fmt.Fprintf(&text, "👤 %s\n", playlist.Uploader)
+	}
+	fmt.Fprintf(&text, "🎬 Видео: %d", len(playlist.Entries))
+	if playlist.Total > len(playlist.Entries) {
+		fmt.Fprintf(&text, " (первые из %d)", playlist.Total)
+	}
+	text.WriteString("\n\n")
+	for i := start; i < end; i++ {
+		entry := playlist.Entries[i]
+		fmt.Fprintf(&text, "%d. %s", i+1, shortTitle(entry.Title, 60))
+		if entry.Duration > 0 {
+			fmt.Fprintf(&text, " (%s)", formatSeconds(entry.Duration))
+		}
+		text.WriteString("\n")
+	}
+
+	var keyboard [][]map[string]interface{}
+	if s.selecting {
+		text.WriteString("\n☑️ Отметьте видео и выберите, что скачать")
+		for i := start; i < end; i++ {
+			mark := "⬜"
+			if s.selected[i] {
+				mark = "✅"
+			}
+			keyboard = append(keyboard, []map[string]interface{}{{
+				"text":          fmt.Sprintf("%s %d. %s", mark, i+1, shortTitle(playlist.Entries[i].Title, 40)),
+				"callback_data": fmt.Sprintf("pl_toggle_%d", i),
+			}})
+		}
+	}
+
+	// Навигация по страницам
+	if pages := s.pageCount(); pages > 1 {
+		var nav []map[string]interface{}
+		if s.page > 0 {
+			nav = append(nav, map[string]interface{}{"text": "◀️", "callback_data": fmt.Sprintf("pl_page_%d", s.page-1)})
+		}
+		nav = append(nav, map[string]interface{}{"text": fmt.Sprintf("%d/%d", s.page+1, pages), "callback_data": fmt.Sprintf("pl_page_%d", s.page)})
+		if s.page < pages-1 {
+			nav = append(nav, map[string]interface{}{"text": "▶️", "callback_data": fmt.Sprintf("pl_page_%d", s.page+1)})
+		}
+		keyboard = append(keyboard, nav)
+	}
+
+	if s.selecting {
+		count := len(s.selected)
+		keyboard = append(keyboard,
+			[]map[string]interface{}{
+				{"text": fmt.Sprintf("⬇️ Видео (%d)", count), "callback_data": "pl_sel_video"},
+				{"text": fmt.Sprintf("🎵 Аудио (%d)", count), "callback_data": "pl_sel_audio"},
+			},
+			[]map[string]interface{}{
+				{"text": "↩️ Назад", "callback_data": "pl_select_off"},
+			},
+		)
+	} else {
+		keyboard = append(keyboard,
+			[]map[string]interface{}{
+				{"text": fmt.Sprintf("⬇️ Скачать все (%d)", len(playlist.Entries)), "callback_data": "pl_all_video"},
+				{"text": "🎵 Аудио всех", "callback_data": "pl_all_audio"},
+			},
+			[]map[string]interface{}{
+				{"text": "☑️ Выбрать видео", "callback_data": "pl_select_on"},
+			},
+		)
+	}
+	return text.String(), keyboard
+}
+
+// shortTitle обрезает название до limit символов
+func shortTitle(title string, limit int) string {
+	runes := []rune(strings.TrimSpace(title))
+	if len(runes) <= limit {
+		return string(runes)
+	}
+	return string(runes[:limit-1]) + "…"
+}
+
+// formatSeconds форматирует длительность в секундах как M:SS или H:MM:SS
+func formatSeconds(seconds int) string {
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+// handlePlaylistCallback обрабатывает кнопки списка видео (pl_*)
+func (b *AsyncLocalBot) handlePlaylistCallback(chatID, messageID int64, user User, data string) {
+	b.playlistsMux.Lock()
+	selection := b.playlists[chatID]
+	if selection == nil {
+		b.playlistsMux.Unlock()
+		b.SendMessage(chatID, "❌ Список видео устарел. Отправьте ссылку заново.")
+		return
+	}
+
+	var entries []services.PlaylistEntry
+	switch {
+	case strings.HasPrefix(data, "pl_page_"):
+		if page, err := strconv.Atoi(strings.TrimPrefix(data, "pl_page_")); err == nil && page >= 0 && page < selection.pageCount() {
+			selection.page = page
+		}
+	case strings.HasPrefix(data, "pl_toggle_"):
+		if index, err := strconv.Atoi(strings.TrimPrefix(data, "pl_toggle_")); err == nil && index >= 0 && index < len(selection.playlist.Entries) {
+			if selection.selected[index] {
+				delete(selection.selected, index)
+			} else {
+				selection.selected[index] = true
+			}
+		}
+	case data == "pl_select_on":
+		selection.selecting = true
+	case data == "pl_select_off":
+		selection.selecting = false
+	case data == "pl_all_video", data == "pl_all_audio":
+		entries = selection.playlist.Entries
+	case data == "pl_sel_video", data == "pl_sel_audio":
+		for i, entry := range selection.playlist.Entries {
+			if selection.selected[i] {
+				entries = append(entries, entry)
+			}
+		}
+		if len(entries) == 0 {
+			b.playlistsMux.Unlock()
+			b.SendMessage(chatID, "☑️ Сначала отметьте хотя бы одно видео")
+			return
+		}
+	}
+	title := selection.playlist.Title
+	text, keyboard := selection.render()
+	b.playlistsMux.Unlock()
+
+	if len(entries) == 0 {
+		if err := b.EditMessageText(chatID, messageID, text, keyboard); err != nil {
+			log.Printf("⚠️ Не удалось обновить список видео: %v", err)
+		}
+		return
+	}
+
+	formatID := services.BatchVideoFormat
+	if strings.HasSuffix(data, "_audio") {
+		formatID = services.BatchAudioFormat
+	}
+	b.startBatch(chatID, user, title, entries, formatID)
+}
+
+// startBatch ставит видео пакета в очередь с общим ID пакета и показывает сводный прогресс
+func (b *AsyncLocalBot) startBatch(chatID int64, user User, title string, entries []services.PlaylistEntry, formatID string) {
+	userID := user.ID
+	if userID == 0 {
+		userID = chatID
+	}
+
+	batchID := b.downloadQueue.NewBatchID()
+	progress := services.NewBatchProgress(batchID, title, len(entries))
+	statusID, err := b.SendMessageWithID(chatID, progress.Text(), batchCancelKeyboard(batchID))
+	if err != nil {
+		log.Printf("⚠️ Не удалось отправить статус пакета: %v", err)
+	}
+
+	stop := make(chan struct{})
+	var once sync.Once
+	b.batchesMux.Lock()
+	b.batches[batchID] = &activeBatch{userID: userID, cancel: func() { once.Do(func() { close(stop) }) }}
+	b.batchesMux.Unlock()
+
+	log.Printf("📦 Пакет %s: %d видео (%s) для пользователя %d", batchID, len(entries), formatID, userID)
+	go b.runBatch(chatID, user, batchID, statusID, entries, formatID, progress, stop)
+}
+
+// batchCancelKeyboard - кнопка отмены всего пакета под статусным сообщением
+func batchCancelKeyboard(batchID string) [][]map[string]interface{} {
+	return [][]map[string]interface{}{
+		{
+			{
+				"text":          "✖ Отменить все",
+				"callback_data": "batchcancel_" + batchID,
+			},
+		},
+	}
+}
+
+// cancelBatch останавливает постановку видео пакета в очередь и отменяет его задачи
+func (b *AsyncLocalBot) cancelBatch(batchID string) bool {
+	b.batchesMux.Lock()
+	batch, exists := b.batches[batchID]
+	b.batchesMux.Unlock()
 	if !exists {
-		// Задача уже завершена - возможно это кэшированное видео
-		log.Printf("🔍 Быстрая проверка: задача %s уже завершена, проверяю кэш", jobID)
-		
-		// Проверяем кэш напрямую
-		videoID := extractVideoID(videoURL)
-		if videoID != "" {
-			if isCached, cachedVideo, err := b.cacheService.IsVideoCached(videoID, "youtube", formatID); err == nil && isCached {
-				log.Printf("⚡ Быстрая проверка: найдено кэшированное видео для задачи %s", jobID)
-				
-				// Отправляем кэшированное видео
-				b.SendMessage(chatID, "✅ Видео найдено в кэше! Отправляю файл...")
-				if err := b.SendVideo(chatID, cachedVideo.FilePath, fmt.Sprintf("Видео в формате %s", formatID)); err != nil {
-					log.Printf("❌ Ошибка отправки кэшированного видео: %v", err)
-					b.SendMessage(chatID, "❌ Ошибка отправки файла")
-				} else {
-					b.SendMessage(chatID, "🎉 Видео успешно отправлено!")
+		return false
+	}
+	batch.cancel()
+	b.downloadQueue.CancelBatch(batchID)
+	return true
+}
+
+// runBatch ставит видео пакета в очередь по мере освобождения лимита пользователя,
+// отправляет готовые файлы и обновляет сводный прогресс в statusID
+func (b *AsyncLocalBot) runBatch(chatID int64, user User, batchID string, statusID int64, entries []services.PlaylistEntry, formatID string, progress *services.BatchProgress, stop chan struct{}) {
+	defer func() {
+		b.batchesMux.Lock()
+		delete(b.batches, batchID)
+		b.batchesMux.Unlock()
+	}()
+
+	userID := user.ID
+	if userID == 0 {
+		userID = chatID
+	}
+	priority := services.JobPriority(services.PriorityHints{IsAdmin: b.adminIDs[user.ID], IsPremium: user.IsPremium})
+
+	// События всех задач пакета сводим в один канал
+	events := make(chan services.JobEvent)
+	quit := make(chan struct{})
+	defer close(quit)
+	follow := func(jobID string) {
+		jobEvents, unsubscribe, err := b.downloadQueue.Subscribe(jobID)
+		if err != nil {
+			go func() {
+				select {
+				case events <- services.JobEvent{JobID: jobID, Type: services.JobEventDone, Status: services.JobStatusFailed, Error: err}:
+				case <-quit:
 				}
-				
-				// Удаляем задачу из активных пользователя
-				b.userJobsMux.Lock()
-				delete(b.userJobs, chatID)
-				b.userJobsMux.Unlock()
+			}()
+			return
+		}
+		go func() {
+			defer unsubscribe()
+			for event := range jobEvents {
+				select {
+				case events <- event:
+				case <-quit:
+					return
+				}
+			}
+		}()
+	}
+
+	jobEntries := make(map[string]services.PlaylistEntry)
+	next := 0
+	stopped := false
+	submit := func() {
+		for next < len(entries) && !stopped {
+			entry := entries[next]
+			jobID, err := b.downloadQueue.AddBatchJob(batchID, userID, chatID, entry.URL, formatID, priority)
+			var limitErr *services.UserLimitError
+			if errors.As(err, &limitErr) {
+				// Очередь пользователя заполнена - продолжим, когда задачи начнут завершаться
 				return
 			}
+			next++
+			if err != nil {
+				log.Printf("❌ Пакет %s: не удалось добавить %s: %v", batchID, entry.URL, err)
+				progress.Fail()
+				continue
+			}
+			jobEntries[jobID] = entry
+			follow(jobID)
 		}
-	} else if job.Status == services.JobStatusCompleted {
-		// Задача уже завершена
-		log.Printf("✅ Быстрая проверка: задача %s уже завершена", jobID)
-		b.SendMessage(chatID, "✅ Видео готово! Отправляю файл...")
-		
-		if err := b.SendVideo(chatID, job.Result, fmt.Sprintf("Видео в формате %s", job.FormatID)); err != nil {
-			log.Printf("❌ Ошибка отправки видео: %v", err)
-			b.SendMessage(chatID, "❌ Ошибка отправки файла")
-		} else {
-			b.SendMessage(chatID, "🎉 Видео успешно отправлено!")
+	}
+
+	lastUpdate := time.Time{}
+	updateStatus := func(force bool) {
+		if statusID == 0 || (!force && time.Since(lastUpdate) < 3*time.Second) {
+			return
 		}
-		
-		// Удаляем задачу из активных
-		b.userJobsMux.Lock()
-		delete(b.userJobs, chatID)
-		b.userJobsMux.Unlock()
+		lastUpdate = time.Now()
+		keyboard := batchCancelKeyboard(batchID)
+		if progress.Done() {
+			keyboard = nil
+		}
+		if err := b.EditMessageText(chatID, statusID, progress.Text(), keyboard); err != nil {
+			log.Printf("⚠️ Не удалось обновить статус пакета %s: %v", batchID, err)
+		}
+	}
+
+	// Повторяем постановку, если очередь была занята задачами вне пакета
+	retry := time.NewTicker(10 * time.Second)
+	defer retry.Stop()
+
+	// Сдаемся, если от пакета 30 минут нет никаких событий
+	const idleTimeout = 30 * time.Minute
+	idle := time.NewTimer(idleTimeout)
+	defer idle.Stop()
+
+	for !progress.Done() {
+		submit()
+
+		select {
+		case event := <-events:
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(idleTimeout)
+
+			if progress.Update(event) {
+				entry := jobEntries[event.JobID]
+				delete(jobEntries, event.JobID)
+				b.deliverBatchItem(chatID, entry, formatID, event)
+				updateStatus(true)
+				continue
+			}
+			updateStatus(false)
+
+		case <-retry.C:
+
+		case <-stop:
+			if !stopped {
+				stopped = true
+				// Не поставленные в очередь видео считаются отмененными
+				progress.Cancelled += len(entries) - next
+				next = len(entries)
+				updateStatus(true)
+			}
+			stop = nil
+
+		case <-idle.C:
+			log.Printf("⏰ Таймаут ожидания пакета %s", batchID)
+			b.downloadQueue.CancelBatch(batchID)
+			b.SendMessage(chatID, "⏰ Время ожидания пакета истекло. Попробуйте позже.")
+			return
+		}
+	}
+
+	updateStatus(true)
+	log.Printf("🏁 Пакет %s завершен: готово %d, ошибок %d, отменено %d", batchID, progress.Completed, progress.Failed, progress.Cancelled)
+}
+
+// deliverBatchItem отправляет файл завершенного видео пакета без отдельных статусных сообщений
+func (b *AsyncLocalBot) deliverBatchItem(chatID int64, entry services.PlaylistEntry, formatID string, event services.JobEvent) {
+	switch event.Status {
+	case services.JobStatusCompleted:
+		caption := entry.Title
+		if err := b.deliverFile(chatID, entry.URL, formatID, event.Result, caption, nil); err != nil {
+			log.Printf("❌ Ошибка отправки файла пакета: %v", err)
+			b.SendMessage(chatID, fmt.Sprintf("❌ Не удалось отправить «%s»", shortTitle(entry.Title, 60)))
+		}
+
+	case services.JobStatusFailed:
+		log.Printf("❌ Задача %s пакета завершена с ошибкой: %v", event.JobID, event.Error)
+		b.SendMessage(chatID, fmt.Sprintf("❌ «%s»: %v", shortTitle(entry.Title, 60), event.Error))
 	}
 }
 
-// monitorJob отслеживает выполнение задачи
-func (b *AsyncLocalBot) monitorJob(chatID int64, jobID string) {
-	ticker := time.NewTicker(2 * time.Second) // Уменьшаем интервал для быстрого отклика
-	defer ticker.Stop()
+// handleSubscribe подписывает пользователя на канал: /subscribe <канал> [audio]
+func (b *AsyncLocalBot) handleSubscribe(chatID, userID int64, args string) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		b.sendSubscriptions(chatID, userID, "🔔 Подписка на канал: /subscribe <ссылка или @канал> [audio]\n\nНовые видео канала будут приходить сюда автоматически. С audio - только звук.")
+		return
+	}
+
+	format := services.SubscriptionVideo
+	if len(fields) > 1 && (strings.EqualFold(fields[1], "audio") || strings.EqualFold(fields[1], "аудио")) {
+		format = services.SubscriptionAudio
+	}
+
+	b.SendMessage(chatID, "🔍 Проверяю канал...")
+	go func() {
+		sub, err := b.subscriptions.Subscribe(userID, chatID, fields[0], format)
+		if err != nil {
+			log.Printf("❌ Ошибка подписки пользователя %d на %s: %v", userID, fields[0], err)
+			b.SendMessage(chatID, fmt.Sprintf("❌ Не удалось подписаться: %v\n\n💡 Пример: /subscribe https://www.youtube.com/@channel", err))
+			return
+		}
+		what := "видео"
+		if sub.Format == services.SubscriptionAudio {
+			what = "аудио"
+		}
+		b.SendMessage(chatID, fmt.Sprintf("✅ Вы подписаны на «%s».\n\n🔔 Новые видео будут приходить сюда (%s). Отписаться: /unsubscribe", sub.Title, what))
+	}()
+}
+
+// sendSubscriptions показывает подписки пользователя после текста header
+func (b *AsyncLocalBot) sendSubscriptions(chatID, userID int64, header string) {
+	subs, err := b.subscriptionStore.UserSubscriptions(userID)
+	if err != nil {
+		log.Printf("⚠️ %v", err)
+	}
+	text := header
+	if len(subs) > 0 {
+		text += "\n\n📋 Ваши подписки:"
+		for _, sub := range subs {
+			text += fmt.Sprintf("\n• %s (%s)", sub.Title, sub.Format)
+		}
+	}
+	b.SendMessage(chatID, text)
+}
 
-	timeout := time.NewTimer(10 * time.Minute) // Таймаут 10 минут
+// handleUnsubscribe показывает подписки пользователя кнопками для отписки
+func (b *AsyncLocalBot) handleUnsubscribe(chatID, userID int64) {
+	subs, err := b.subscriptionStore.UserSubscriptions(userID)
+	if err != nil {
+		log.Printf("⚠️ %v", err)
+		b.SendMessage(chatID, "❌ Не удалось загрузить подписки")
+		return
+	}
+	if len(subs) == 0 {
+		b.SendMessage(chatID, "ℹ️ У вас нет подписок.\n\n💡 Подписаться: /subscribe <ссылка на канал>")
+		return
+	}
+
+	var keyboard [][]map[string]interface{}
+	for _, sub := range subs {
+		keyboard = append(keyboard, []map[string]interface{}{{
+			"text":          "✖ " + shortTitle(sub.Title, 40),
+			"callback_data": fmt.Sprintf("unsub_%d", sub.ID),
+		}})
+	}
+	if _, err := b.SendMessageWithID(chatID, "🔕 Выберите канал, от которого отписаться:", keyboard); err != nil {
+		log.Printf("❌ Ошибка отправки списка подписок: %v", err)
+	}
+}
+
+// unsubscribe удаляет подписку по кнопке и обновляет сообщение со списком
+func (b *AsyncLocalBot) unsubscribe(chatID, messageID, userID int64, data string) {
+	subscriptionID, err := strconv.ParseInt(strings.TrimPrefix(data, "unsub_"), 10, 64)
+	if err != nil {
+		return
+	}
+	removed, err := b.subscriptionStore.Unsubscribe(userID, subscriptionID)
+	if err != nil {
+		log.Printf("⚠️ %v", err)
+	}
+	text := "ℹ️ Эта подписка уже удалена"
+	if removed {
+		text = "✅ Подписка отменена"
+		log.Printf("🔕 Пользователь %d отменил подписку %d", userID, subscriptionID)
+	}
+	if err := b.EditMessageText(chatID, messageID, text, nil); err != nil {
+		b.SendMessage(chatID, text)
+	}
+}
+
+// handleSubscriptionVideo ставит новое видео канала в очередь для подписчика
+func (b *AsyncLocalBot) handleSubscriptionVideo(sub services.Subscription, entry services.PlaylistEntry) {
+	announce := fmt.Sprintf("🔔 Новое видео на канале «%s»:\n%s\n%s", sub.Title, entry.Title, entry.URL)
+
+	priority := services.JobPriority(services.PriorityHints{IsAdmin: b.adminIDs[sub.UserID]})
+	jobID, err := b.downloadQueue.AddJob(sub.UserID, sub.ChatID, entry.URL, sub.FormatID(), "", priority)
+	var limitErr *services.UserLimitError
+	if errors.As(err, &limitErr) {
+		log.Printf("⚖️ Подписка %d: очередь пользователя заполнена, видео %s не поставлено", sub.ID, entry.ID)
+		b.SendMessage(sub.ChatID, announce+"\n\n⏳ Очередь загрузок заполнена - отправьте ссылку, когда она освободится.")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Подписка %d: не удалось добавить видео %s: %v", sub.ID, entry.ID, err)
+		b.SendMessage(sub.ChatID, announce)
+		return
+	}
+
+	statusID, err := b.SendMessageWithID(sub.ChatID, announce+"\n\n⏳ Скачиваю...", jobCancelKeyboard(jobID))
+	if err != nil {
+		log.Printf("⚠️ Не удалось отправить уведомление о новом видео: %v", err)
+	}
+	go b.monitorJob(sub.ChatID, jobID, statusID)
+}
+
+// monitorJob подписывается на события задачи и обновляет статусное сообщение statusID.
+// Итог задачи приходит ровно один раз, даже если она завершилась до подписки.
+func (b *AsyncLocalBot) monitorJob(chatID int64, jobID string, statusID int64) {
+	events, unsubscribe, err := b.downloadQueue.Subscribe(jobID)
+	if err != nil {
+		log.Printf("⚠️ Не удалось подписаться на задачу %s: %v", jobID, err)
+		return
+	}
+	defer unsubscribe()
+
+	// Удаляем задачу из активных пользователя, если за это время он не начал новую
+	defer func() {
+		b.userJobsMux.Lock()
+		if b.userJobs[chatID] == jobID {
+			delete(b.userJobs, chatID)
+		}
+		b.userJobsMux.Unlock()
+	}()
+
+	// Прогресс показываем в статусном сообщении, не чаще раза в 3 секунды
+	progress := services.NewProgressReporter(3*time.Second, func(text string) {
+		if err := b.EditMessageText(chatID, statusID, text, jobCancelKeyboard(jobID)); err != nil {
+			log.Printf("⚠️ Не удалось обновить статус задачи %s: %v", jobID, err)
+		}
+	})
+
+	// Сдаемся, если от задачи 10 минут нет никаких событий
+	const idleTimeout = 10 * time.Minute
+	timeout := time.NewTimer(idleTimeout)
 	defer timeout.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
-			job, exists := b.downloadQueue.GetJobStatus(jobID)
-			if !exists {
-				// Задача не найдена - возможно уже завершена (особенно для кэшированных видео)
-				// Для кэшированных видео это нормально - они обрабатываются мгновенно
-				log.Printf("⚠️ Задача %s не найдена в активных - возможно завершена", jobID)
-				
-				// Удаляем задачу из активных пользователя
-				b.userJobsMux.Lock()
-				delete(b.userJobs, chatID)
-				b.userJobsMux.Unlock()
+		case event, ok := <-events:
+			if !ok {
+				// Очередь остановлена - итога не будет
+				log.Printf("⚠️ Подписка на задачу %s закрыта без результата", jobID)
 				return
 			}
+			if !timeout.Stop() {
+				<-timeout.C
+			}
+			timeout.Reset(idleTimeout)
 
-			switch job.Status {
-			case services.JobStatusCompleted:
-				log.Printf("✅ Задача %s завершена успешно", jobID)
-				b.SendMessage(chatID, "✅ Видео готово! Отправляю файл...")
-				
-				// Отправляем файл
-				if err := b.SendVideo(chatID, job.Result, fmt.Sprintf("Видео в формате %s", job.FormatID)); err != nil {
-					log.Printf("❌ Ошибка отправки видео: %v", err)
-					b.SendMessage(chatID, "❌ Ошибка отправки файла")
-				} else {
-					b.SendMessage(chatID, "🎉 Видео успешно отправлено!")
+			switch event.Type {
+			case services.JobEventPosition:
+				if statusID != 0 {
+					b.EditMessageText(chatID, statusID, queuedStatusText(event.Queued, event.Position), jobCancelKeyboard(jobID))
 				}
 
-				// Удаляем задачу из активных
-				b.userJobsMux.Lock()
-				delete(b.userJobs, chatID)
-				b.userJobsMux.Unlock()
-				return
-
-			case services.JobStatusFailed:
-				log.Printf("❌ Задача %s завершена с ошибкой: %v", jobID, job.Error)
-				b.SendMessage(chatID, fmt.Sprintf("❌ Ошибка загрузки: %v", job.Error))
-
-				// Удаляем задачу из активных
-				b.userJobsMux.Lock()
-				delete(b.userJobs, chatID)
-				b.userJobsMux.Unlock()
-				return
+			case services.JobEventProgress:
+				if statusID != 0 {
+					progress.Report(event.Progress)
+				}
 
-			case services.JobStatusCancelled:
-				log.Printf("❌ Задача %s отменена", jobID)
-				b.SendMessage(chatID, "❌ Задача отменена")
+			case services.JobEventStatus:
+				if statusID != 0 && event.Status == services.JobStatusCancelled {
+					b.EditMessageText(chatID, statusID, "✖ Отменяю загрузку...", nil)
+				}
 
-				// Удаляем задачу из активных
-				b.userJobsMux.Lock()
-				delete(b.userJobs, chatID)
-				b.userJobsMux.Unlock()
+			case services.JobEventDone:
+				b.reportJobResult(chatID, statusID, event)
 				return
-
-			case services.JobStatusProcessing:
-				// Задача выполняется, продолжаем ждать
-				continue
-
-			case services.JobStatusPending:
-				// Задача в очереди, продолжаем ждать
-				continue
 			}
 
 		case <-timeout.C:
 			log.Printf("⏰ Таймаут ожидания задачи %s", jobID)
 			b.SendMessage(chatID, "⏰ Время ожидания истекло. Попробуйте позже.")
-
-			// Удаляем задачу из активных
-			b.userJobsMux.Lock()
-			delete(b.userJobs, chatID)
-			b.userJobsMux.Unlock()
 			return
 		}
 	}
 }
 
+// reportJobResult сообщает пользователю итог задачи и отправляет файл
+func (b *AsyncLocalBot) reportJobResult(chatID, statusID int64, event services.JobEvent) {
+	switch event.Status {
+	case services.JobStatusCompleted:
+		log.Printf("✅ Задача %s завершена успешно", event.JobID)
+		if statusID == 0 || b.EditMessageText(chatID, statusID, "✅ Видео готово! Отправляю файл...", nil) != nil {
+			b.SendMessage(chatID, "✅ Видео готово! Отправляю файл...")
+		}
+
+		// Прогресс загрузки в Telegram показываем в статусном сообщении
+		var onProgress services.ProgressFunc
+		if statusID != 0 {
+			onProgress = services.NewProgressReporter(3*time.Second, func(text string) {
+				b.EditMessageText(chatID, statusID, text, nil)
+			}).Report
+		}
+
+		job, exists := b.downloadQueue.GetJobStatus(event.JobID)
+		var err error
+		if exists {
+			err = b.deliverFile(chatID, job.VideoURL, job.FormatID, event.Result, fmt.Sprintf("Файл в формате %s", job.FormatID), onProgress)
+		} else if services.IsAudioExtension(filepath.Ext(event.Result)) {
+			err = b.SendAudio(chatID, event.Result, "")
+		} else {
+			_, err = b.uploadVideo(chatID, event.Result, "Видео", onProgress)
+		}
+		if err != nil {
+			log.Printf("❌ Ошибка отправки видео: %v", err)
+			b.SendMessage(chatID, "❌ Ошибка отправки файла")
+		} else {
+			b.SendMessage(chatID, "🎉 Видео успешно отправлено!")
+		}
+
+	case services.JobStatusFailed:
+		log.Printf("❌ Задача %s завершена с ошибкой: %v", event.JobID, event.Error)
+		b.SendMessage(chatID, fmt.Sprintf("❌ Ошибка загрузки: %v", event.Error))
+
+	case services.JobStatusCancelled:
+		log.Printf("❌ Задача %s отменена", event.JobID)
+		if statusID == 0 || b.EditMessageText(chatID, statusID, "✖ Загрузка отменена", nil) != nil {
+			b.SendMessage(chatID, "❌ Задача отменена")
+		}
+	}
+}
+
 // SendFormatTypeMenu отправляет меню выбора типа формата (аудио/видео)
 func (b *AsyncLocalBot) SendFormatTypeMenu(chatID int64, audioCount, videoCount int) error {
 	log.Printf("🎯 Создаю меню выбора типа: аудио=%d, видео=%d", audioCount, videoCount)
@@ -857,8 +1707,8 @@ func (b *AsyncLocalBot) SendVideoFormatsOnly(chatID int64, text string, formats
 	for _, format := range formats {
 		icon := "🎥"
 		
-		buttonText := fmt.Sprintf("%s %s / %s", icon, format.Resolution, format.FileSize)
-		if format.FileSize == "" {
+		buttonText := fmt.Sprintf("%s %s / %s", icon, format.Resolution, format.SizeString())
+		if format.FileSize == 0 {
 			buttonText = fmt.Sprintf("%s %s / ~?", icon, format.Resolution)
 		}
 		
@@ -876,12 +1726,9 @@ func (b *AsyncLocalBot) SendVideoFormatsOnly(chatID int64, text string, formats
 	// Проверяем, есть ли видео в кэше для мгновенного скачивания
 	videoURL, exists := b.getVideoURLCache(chatID)
 	if exists && videoURL != "" {
-		// Извлекаем videoID из URL
-		videoID := b.extractVideoID(videoURL)
+		// ID видео и пространство кэша - по реестру платформ
+		videoID, platform := cacheKey(videoURL)
 		if videoID != "" {
-			// Получаем платформу из кэша
-			platform := "youtube" // По умолчанию YouTube
-			
 			// Проверяем, есть ли видео в кэше
 			if inCache, cachedFormats, err := b.isVideoInCache(videoID, platform); err == nil && inCache {
 				log.Printf("⚡ Видео найдено в кэше (%d форматов), добавляю кнопку мгновенного скачивания", len(cachedFormats))
@@ -891,7 +1738,7 @@ func (b *AsyncLocalBot) SendVideoFormatsOnly(chatID int64, text string, formats
 				var maxSize int64 = 0
 				
 				for i := range cachedFormats {
-					size := b.parseFileSize(cachedFormats[i].FileSize)
+					size := cachedFormats[i].FileSize
 					if size > maxSize {
 						maxSize = size
 						largestFormat = &cachedFormats[i]
@@ -902,7 +1749,7 @@ func (b *AsyncLocalBot) SendVideoFormatsOnly(chatID int64, text string, formats
 				buttonText := "⚡ Скачать мгновенно (из кэша)"
 				if largestFormat != nil {
 					buttonText = fmt.Sprintf("⚡ Скачать мгновенно (%s / %s)", 
-						largestFormat.Resolution, largestFormat.FileSize)
+						largestFormat.Resolution, formatFileSize(largestFormat.FileSize))
 				}
 				
 				// Добавляем кнопку "Скачать мгновенно" с информацией о формате
@@ -961,8 +1808,8 @@ func (b *AsyncLocalBot) SendAudioFormatsOnly(chatID int64, text string, formats
 	for _, format := range formats {
 		icon := "🎵"
 		
-		buttonText := fmt.Sprintf("%s %s / %s", icon, format.Resolution, format.FileSize)
-		if format.FileSize == "" {
+		buttonText := fmt.Sprintf("%s %s / %s", icon, format.Resolution, format.SizeString())
+		if format.FileSize == 0 {
 			buttonText = fmt.Sprintf("%s %s / ~?", icon, format.Resolution)
 		}
 		
@@ -1050,14 +1897,45 @@ type Update struct {
 type CallbackQuery struct {
 	ID   string  `json:"id"`
 	Data string  `json:"data"`
+	From User    `json:"from"`
 	Message *Message `json:"message"`
 }
 
+// User представляет пользователя Telegram
+type User struct {
+	ID        int64 `json:"id"`
+	IsPremium bool  `json:"is_premium,omitempty"`
+}
+
 // Message представляет сообщение от Telegram
 type Message struct {
-	MessageID int64  `json:"message_id"`
-	Text      string `json:"text"`
-	Chat      Chat   `json:"chat"`
+	MessageID       int64           `json:"message_id"`
+	Text            string          `json:"text"`
+	Caption         string          `json:"caption,omitempty"`
+	Entities        []MessageEntity `json:"entities,omitempty"`
+	CaptionEntities []MessageEntity `json:"caption_entities,omitempty"`
+	Chat            Chat            `json:"chat"`
+	From            User            `json:"from"`
+}
+
+// MessageEntity представляет разметку в тексте сообщения (нужны только скрытые ссылки text_link)
+type MessageEntity struct {
+	Type string `json:"type"`
+	URL  string `json:"url,omitempty"`
+}
+
+// links находит ссылки в тексте, подписи к медиа и скрытых ссылках сообщения
+// (в том числе пересланного)
+func (m *Message) links() []services.Link {
+	var entityURLs []string
+	for _, entities := range [][]MessageEntity{m.Entities, m.CaptionEntities} {
+		for _, entity := range entities {
+			if entity.Type == "text_link" && entity.URL != "" {
+				entityURLs = append(entityURLs, entity.URL)
+			}
+		}
+	}
+	return services.FindLinks(m.Text+"\n"+m.Caption, entityURLs)
 }
 
 // Chat представляет чат в Telegram
@@ -1085,6 +1963,8 @@ func main() {
 		log.Fatalf("❌ %v", err)
 	}
 	fmt.Println("✅ yt-dlp доступен")
+	// Задачи с других платформ (TikTok, Vimeo...) очередь скачивает через универсальный сервис
+	universalService := services.NewUniversalService(cfg.DownloadDir)
 
 	// Создаем сервис для кэширования (20 ГБ)
 	cacheService, err := services.NewCacheService("../cache", 20)
@@ -1092,14 +1972,40 @@ func main() {
 		log.Fatalf("❌ Ошибка создания кэш-сервиса: %v", err)
 	}
 	defer cacheService.Close()
+	if cfg.EvictUploadedFiles {
+		// Файлы, уже загруженные в Telegram, отправляются по file_id - локальная копия не нужна
+		cacheService.SetEvictUploaded(true)
+		log.Printf("📤 Включено вытеснение загруженных в Telegram файлов")
+	}
 	
 	// Создаем очередь загрузок с 3 воркерами
-	downloadQueue := services.NewDownloadQueue(3, youtubeService, cacheService)
+	downloadQueue := services.NewDownloadQueue(3, youtubeService, universalService, cacheService)
+	
+	// Задачи очереди хранятся рядом с кэшем и переживают перезапуск
+	jobStore, err := services.NewJobStore("../cache")
+	if err != nil {
+		log.Fatalf("❌ Ошибка создания хранилища очереди: %v", err)
+	}
+	defer jobStore.Close()
+	downloadQueue.SetJobStore(jobStore)
+	downloadQueue.SetUserLimits(services.UserLimits{
+		MaxConcurrent: cfg.UserMaxConcurrent,
+		MaxQueued:     cfg.UserMaxQueued,
+	})
 	downloadQueue.Start()
 	defer downloadQueue.Stop()
 	
 	// Создаем асинхронного бота
-	bot := NewAsyncLocalBot(cfg.TelegramToken, cfg.TelegramAPI, time.Duration(cfg.HTTPTimeout)*time.Second, youtubeService, cacheService, downloadQueue)
+	bot := NewAsyncLocalBot(cfg.TelegramToken, cfg.TelegramAPI, time.Duration(cfg.HTTPTimeout)*time.Second, youtubeService, cacheService, downloadQueue, cfg.AdminIDs)
+
+	// Подписки на каналы хранятся рядом с кэшем; каждый канал проверяется один раз на всех подписчиков
+	subscriptionStore, err := services.NewSubscriptionStore("../cache")
+	if err != nil {
+		log.Fatalf("❌ Ошибка создания хранилища подписок: %v", err)
+	}
+	defer subscriptionStore.Close()
+	bot.subscriptionStore = subscriptionStore
+	bot.subscriptions = services.NewSubscriptionPoller(subscriptionStore, youtubeService, time.Duration(cfg.SubscriptionPollMinutes)*time.Minute, bot.handleSubscriptionVideo)
 
 	// Проверяем подключение к локальному серверу Telegram API
 	if err := bot.GetMe(); err != nil {
@@ -1109,6 +2015,14 @@ func main() {
 	fmt.Printf("✅ Бот успешно подключен: @%s (%s)\n", bot.Username, bot.FirstName)
 	fmt.Printf("🌐 Используется локальный сервер: %s\n", cfg.TelegramAPI)
 
+	// Возвращаем в очередь задачи, не завершенные до перезапуска
+	bot.restoreJobs()
+
+	if cfg.SubscriptionPollMinutes > 0 {
+		bot.subscriptions.Start()
+		defer bot.subscriptions.Stop()
+	}
+
 	// Проверяем сетевое подключение
 	if err := youtubeService.CheckNetwork(); err != nil {
 		log.Printf("⚠️ %v", err)
@@ -1155,9 +2069,32 @@ func main() {
 					if message.Text == "/start" {
 						// Отправляем приветственное сообщение с изображениями
 						bot.SendWelcomeMessageWithImages(message.Chat.ID)
-					} else if len(message.Text) > 10 && (strings.Contains(message.Text, "youtube.com") || strings.Contains(message.Text, "youtu.be")) {
-						// YouTube ссылка - обрабатываем асинхронно
-						bot.handleYouTubeLink(message.Chat.ID, message.Text)
+					} else if message.Text == "/cancel" {
+						// Отменяем текущую задачу чата (останавливает yt-dlp)
+						userID := message.From.ID
+						if userID == 0 {
+							userID = message.Chat.ID
+						}
+						if cancelled := bot.cancelUserJobs(userID); cancelled == 0 {
+							bot.SendMessage(message.Chat.ID, "ℹ️ Нет активных задач для отмены")
+						}
+					} else if message.Text == "/subscribe" || strings.HasPrefix(message.Text, "/subscribe ") {
+						// Подписка на новые видео канала
+						userID := message.From.ID
+						if userID == 0 {
+							userID = message.Chat.ID
+						}
+						bot.handleSubscribe(message.Chat.ID, userID, strings.TrimPrefix(message.Text, "/subscribe"))
+					} else if message.Text == "/unsubscribe" || strings.HasPrefix(message.Text, "/unsubscribe ") {
+						userID := message.From.ID
+						if userID == 0 {
+							userID = message.Chat.ID
+						}
+						bot.handleUnsubscribe(message.Chat.ID, userID)
+					} else if links := message.links(); len(links) > 0 {
+						// Ссылки из текста, подписи или пересланного сообщения - короткие ссылки
+						// раскрываются по сети, поэтому разбор идет в горутине
+						go bot.handleLinks(message.Chat.ID, message.From, links)
 					} else {
 						bot.SendMessage(message.Chat.ID, "Отправьте ссылку на YouTube видео для скачивания.")
 					}
@@ -1166,7 +2103,33 @@ func main() {
 					callback := update.CallbackQuery
 					log.Printf("🎯 Получен callback: %s", callback.Data)
 					
-					if callback.Data == "type_audio" {
+					if strings.HasPrefix(callback.Data, "cancel_") {
+						// Кнопка "✖ Отмена" под статусным сообщением задачи
+						bot.AnswerCallbackQuery(callback.ID)
+						jobID := strings.TrimPrefix(callback.Data, "cancel_")
+						if err := bot.downloadQueue.CancelJob(jobID); err != nil {
+							log.Printf("ℹ️ Не удалось отменить задачу %s: %v", jobID, err)
+						}
+					} else if strings.HasPrefix(callback.Data, "batchcancel_") {
+						// Кнопка "✖ Отменить все" под статусом пакета
+						bot.AnswerCallbackQuery(callback.ID)
+						batchID := strings.TrimPrefix(callback.Data, "batchcancel_")
+						if !bot.cancelBatch(batchID) {
+							log.Printf("ℹ️ Пакет %s уже завершен", batchID)
+						}
+					} else if strings.HasPrefix(callback.Data, "unsub_") {
+						// Кнопка отписки от канала
+						bot.AnswerCallbackQuery(callback.ID)
+						userID := callback.From.ID
+						if userID == 0 {
+							userID = callback.Message.Chat.ID
+						}
+						bot.unsubscribe(callback.Message.Chat.ID, callback.Message.MessageID, userID, callback.Data)
+					} else if strings.HasPrefix(callback.Data, "pl_") {
+						// Кнопки списка видео плейлиста или канала
+						bot.AnswerCallbackQuery(callback.ID)
+						bot.handlePlaylistCallback(callback.Message.Chat.ID, callback.Message.MessageID, callback.From, callback.Data)
+					} else if callback.Data == "type_audio" {
 						// Пользователь выбрал аудио форматы
 						log.Printf("🎵 Пользователь выбрал аудио форматы")
 						bot.AnswerCallbackQuery(callback.ID)
@@ -1178,7 +2141,7 @@ func main() {
 						
 						var audioFormats []services.VideoFormat
 						for _, format := range formats {
-							if format.Extension == "audio" {
+							if format.IsAudioOnly() {
 								audioFormats = append(audioFormats, format)
 							}
 						}
@@ -1203,7 +2166,7 @@ func main() {
 						resolutionGroups := make(map[string][]services.VideoFormat)
 						
 						for _, format := range formats {
-							if format.Extension != "audio" {
+							if !format.IsAudioOnly() {
 								resolutionGroups[format.Resolution] = append(resolutionGroups[format.Resolution], format)
 							}
 						}
@@ -1217,8 +2180,8 @@ func main() {
 							
 							// Сортируем форматы по размеру файла
 							sort.Slice(formatList, func(i, j int) bool {
-								sizeI := parseFileSize(formatList[i].FileSize)
-								sizeJ := parseFileSize(formatList[j].FileSize)
+								sizeI := formatList[i].FileSize
+								sizeJ := formatList[j].FileSize
 								return sizeI < sizeJ
 							})
 							
@@ -1259,7 +2222,7 @@ func main() {
 							bot.AnswerCallbackQuery(callback.ID)
 							
 							// Обрабатываем выбор формата асинхронно
-							bot.handleFormatSelection(callback.Message.Chat.ID, formatID)
+							bot.handleFormatSelection(callback.Message.Chat.ID, callback.From, formatID)
 						}
 					}
 				}
@@ -1271,41 +2234,12 @@ func main() {
 	}
 }
 
-// parseFileSize парсит размер файла в байты
-func parseFileSize(fileSize string) int64 {
-	if fileSize == "" {
-		return 0
-	}
-	
-	fileSize = strings.TrimSpace(fileSize)
-	
-	var multiplier float64 = 1
-	var sizeStr string
-	
-	if strings.HasSuffix(fileSize, "GiB") {
-		multiplier = 1024 * 1024 * 1024
-		sizeStr = strings.TrimSuffix(fileSize, "GiB")
-	} else if strings.HasSuffix(fileSize, "MiB") {
-		multiplier = 1024 * 1024
-		sizeStr = strings.TrimSuffix(fileSize, "MiB")
-	} else if strings.HasSuffix(fileSize, "KiB") {
-		multiplier = 1024
-		sizeStr = strings.TrimSuffix(fileSize, "KiB")
-	} else if strings.HasSuffix(fileSize, "B") {
-		multiplier = 1
-		sizeStr = strings.TrimSuffix(fileSize, "B")
-	} else {
-		if size, err := strconv.ParseFloat(fileSize, 64); err == nil {
-			return int64(size)
-		}
-		return 0
+// formatFileSize форматирует размер файла в человеко-читаемый вид
+func formatFileSize(size int64) string {
+	if size <= 0 {
+		return "~?"
 	}
-	
-	if size, err := strconv.ParseFloat(sizeStr, 64); err == nil {
-		return int64(size * multiplier)
-	}
-	
-	return 0
+	return services.VideoFormat{FileSize: size}.SizeString()
 }
 
 // sortVideoFormatsByResolution сортирует видео форматы по разрешению
@@ -1329,26 +2263,6 @@ func extractResolutionNumber(resolution string) int {
 	return 0
 }
 
-// extractVideoID извлекает ID видео из YouTube URL
-func extractVideoID(url string) string {
-	// Поддерживаем разные форматы YouTube URL
-	patterns := []string{
-		`youtube\.com/watch\?v=([a-zA-Z0-9_-]+)`,
-		`youtu\.be/([a-zA-Z0-9_-]+)`,
-		`youtube\.com/embed/([a-zA-Z0-9_-]+)`,
-	}
-
-	for _, pattern := range patterns {
-		re := regexp.MustCompile(pattern)
-		matches := re.FindStringSubmatch(url)
-		if len(matches) > 1 {
-			return matches[1]
-		}
-	}
-
-	return ""
-}
-
 // getVideoURLCache получает URL видео из кэша
 func (b *AsyncLocalBot) getVideoURLCache(chatID int64) (string, bool) {
 	b.videoURLCacheMux.RLock()
@@ -1357,16 +2271,6 @@ func (b *AsyncLocalBot) getVideoURLCache(chatID int64) (string, bool) {
 	return url, exists
 }
 
-// extractVideoID извлекает ID видео из YouTube URL (метод для AsyncLocalBot)
-func (b *AsyncLocalBot) extractVideoID(url string) string {
-	return extractVideoID(url)
-}
-
-// parseFileSize парсит размер файла в байты (метод для AsyncLocalBot)
-func (b *AsyncLocalBot) parseFileSize(fileSize string) int64 {
-	return parseFileSize(fileSize)
-}
-
 // isVideoInCache проверяет, есть ли видео в кэше (метод для AsyncLocalBot)
 func (b *AsyncLocalBot) isVideoInCache(videoID, platform string) (bool, []services.VideoCache, error) {
 	// Получаем все форматы для этого видео из кэша
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -13,6 +14,32 @@ type Config struct {
 	DownloadDir   string
 	MaxFileSize   int64 // Максимальный размер файла в байтах (0 = без ограничений)
 	Proxy         *ProxyConfig // Настройки прокси
+	AdminIDs      []int64      // ID администраторов (ADMIN_IDS через запятую)
+
+	// Лимиты загрузок на одного пользователя (0 = без ограничений)
+	UserMaxConcurrent int // Одновременных загрузок (USER_MAX_CONCURRENT)
+	UserMaxQueued     int // Загрузок в очереди (USER_MAX_QUEUED)
+
+	// Удалять локальный файл, когда Telegram вернул для него file_id (EVICT_UPLOADED_FILES=true)
+	EvictUploadedFiles bool
+
+	// Резать видео больше лимита Telegram на части (SPLIT_LARGE_VIDEOS=true)
+	SplitLargeVideos bool
+	MaxPartSize      int64 // Максимальный размер части в байтах (MAX_PART_SIZE_MB, по умолчанию 2000)
+
+	// Наибольший размер в меню сжатия "до N МБ", меньше него предлагаются 10 и 25 МБ
+	// (COMPRESS_TARGET_MB, 0 = кнопка не показывается)
+	CompressTargetMB int
+
+	// Как часто проверять каналы из подписок на новые видео (SUBSCRIPTION_POLL_MINUTES)
+	SubscriptionPollMinutes int
+
+	// Универсальное извлечение через yt-dlp для сайтов не из списка платформ (GENERIC_EXTRACTOR=true).
+	// Домены разрешают и запрещают администраторы командой /generic; начальные списки -
+	// GENERIC_ALLOW_DOMAINS и GENERIC_DENY_DOMAINS через запятую ("*" - все домены).
+	GenericExtractor    bool
+	GenericAllowDomains []string
+	GenericDenyDomains  []string
 }
 
 // Load загружает конфигурацию из файла и переменных окружения
@@ -29,6 +56,23 @@ func Load(filename string) (*Config, error) {
 		DownloadDir:   "./downloads",
 		MaxFileSize:   0, // 0 = без ограничений
 		Proxy:         LoadProxyConfig(), // Загружаем настройки прокси
+		AdminIDs:      parseIDList(os.Getenv("ADMIN_IDS")),
+
+		UserMaxConcurrent: getEnvIntOrDefault("USER_MAX_CONCURRENT", 2),
+		UserMaxQueued:     getEnvIntOrDefault("USER_MAX_QUEUED", 5),
+
+		EvictUploadedFiles: strings.ToLower(os.Getenv("EVICT_UPLOADED_FILES")) == "true",
+
+		SplitLargeVideos: strings.ToLower(os.Getenv("SPLIT_LARGE_VIDEOS")) == "true",
+		MaxPartSize:      int64(getEnvIntOrDefault("MAX_PART_SIZE_MB", 2000)) * 1024 * 1024,
+
+		CompressTargetMB: getEnvIntOrDefault("COMPRESS_TARGET_MB", 50),
+
+		SubscriptionPollMinutes: getEnvIntOrDefault("SUBSCRIPTION_POLL_MINUTES", 30),
+
+		GenericExtractor:    strings.ToLower(os.Getenv("GENERIC_EXTRACTOR")) == "true",
+		GenericAllowDomains: parseList(os.Getenv("GENERIC_ALLOW_DOMAINS")),
+		GenericDenyDomains:  parseList(os.Getenv("GENERIC_DENY_DOMAINS")),
 	}
 
 	return config, nil
@@ -42,6 +86,37 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvIntOrDefault возвращает числовое значение переменной окружения или значение по умолчанию
+func getEnvIntOrDefault(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value >= 0 {
+		return value
+	}
+	return defaultValue
+}
+
+// parseIDList разбирает список ID через запятую, пропуская некорректные значения
+func parseIDList(value string) []int64 {
+	var ids []int64
+	for _, part := range strings.Split(value, ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// parseList разбирает список значений через запятую, пропуская пустые
+func parseList(value string) []string {
+	var items []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			items = append(items, part)
+		}
+	}
+	return items
+}
+
 // loadEnvFile загружает переменные окружения из файла
 func loadEnvFile(filename string) error {
 	content, err := os.ReadFile(filename)
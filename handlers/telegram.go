@@ -210,8 +210,8 @@ func (h *TelegramHandler) showFormatSelection(chatID int64, url string, formats
 			buttonText += " 🔇"
 		}
 
-		if format.FileSize != "" {
-			buttonText += fmt.Sprintf(" (%s)", format.FileSize)
+		if format.FileSize > 0 {
+			buttonText += fmt.Sprintf(" (%s)", format.SizeString())
 		}
 
 		// Создаем callback data
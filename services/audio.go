@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// audioFormatIDs - ID аудиоформатов YouTube (m4a и opus)
+var audioFormatIDs = map[string]bool{
+	"139": true, "140": true, "141": true,
+	"249": true, "250": true, "251": true,
+	"599": true, "600": true,
+}
+
+// DefaultAudioOutput - формат звука по умолчанию: MP3 с лучшим VBR, как было до выбора формата
+const DefaultAudioOutput = "mp3"
+
+// AudioOutput - формат, в который сохраняется звук
+type AudioOutput struct {
+	Key     string // Ключ для callback_data и ID формата в кэше (без "_")
+	Label   string // Подпись кнопки
+	Codec   string // Значение --audio-format
+	Quality string // Значение --audio-quality ("0" - лучшее качество)
+	Prefer  string // Фильтр исходного формата, при котором звук копируется без перекодирования
+}
+
+// AudioOutputs - форматы звука в порядке показа в меню
+var AudioOutputs = []AudioOutput{
+	{Key: "mp3", Label: "MP3 (лучшее VBR)", Codec: "mp3", Quality: "0"},
+	{Key: "mp3-128", Label: "MP3 128 kbps", Codec: "mp3", Quality: "128K"},
+	{Key: "mp3-192", Label: "MP3 192 kbps", Codec: "mp3", Quality: "192K"},
+	{Key: "mp3-320", Label: "MP3 320 kbps", Codec: "mp3", Quality: "320K"},
+	{Key: "m4a", Label: "M4A/AAC без перекодирования", Codec: "m4a", Quality: "0", Prefer: "[ext=m4a]"},
+	{Key: "opus", Label: "Opus", Codec: "opus", Quality: "0", Prefer: "[acodec=opus]"},
+	{Key: "flac", Label: "FLAC (без потерь)", Codec: "flac", Quality: "0"},
+	{Key: "wav", Label: "WAV (без сжатия)", Codec: "wav", Quality: "0"},
+}
+
+// AudioOutputByKey возвращает формат звука по ключу; неизвестный ключ - формат по умолчанию
+func AudioOutputByKey(key string) AudioOutput {
+	for _, output := range AudioOutputs {
+		if output.Key == key {
+			return output
+		}
+	}
+	return AudioOutputs[0]
+}
+
+// FormatID возвращает ID, под которым звук из formatID хранится на диске и в кэше.
+// Для формата по умолчанию ID не меняется, чтобы старые записи кэша оставались действительными.
+func (o AudioOutput) FormatID(formatID string) string {
+	if o.Key == DefaultAudioOutput {
+		return formatID
+	}
+	return formatID + "-" + o.Key
+}
+
+// Bitrate возвращает битрейт для ffmpeg при ручной конвертации в MP3
+func (o AudioOutput) Bitrate() string {
+	if o.Codec == "mp3" && o.Quality != "0" {
+		return strings.ToLower(o.Quality)
+	}
+	return "192k"
+}
+
+// formatSelector возвращает --format: сначала исходный поток, который можно скопировать как есть
+func (o AudioOutput) formatSelector(formatID string) string {
+	if o.Prefer == "" {
+		return formatID + "/bestaudio/best"
+	}
+	return formatID + o.Prefer + "/bestaudio" + o.Prefer + "/" + formatID + "/bestaudio/best"
+}
+
+// args возвращает аргументы yt-dlp для извлечения звука в этом формате
+func (o AudioOutput) args() []string {
+	return []string{"--extract-audio", "--audio-format", o.Codec, "--audio-quality", o.Quality}
+}
+
+// IsAudioExtension проверяет, что расширение файла (".mp3") относится к аудио
+func IsAudioExtension(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".mp3", ".m4a", ".ogg", ".opus", ".flac", ".wav":
+		return true
+	}
+	return false
+}
+
+// AudioTags - теги, которые записываются в аудиофайл
+type AudioTags struct {
+	Title  string
+	Artist string
+	Album  string
+	Year   string
+}
+
+// IsAudioFormatID угадывает аудиоформат по одному ID. Нужен только там, где
+// сам формат неизвестен (очередь, старые вызовы); бот передает DownloadOptions.Audio явно.
+func IsAudioFormatID(formatID string) bool {
+	if audioFormatIDs[strings.SplitN(formatID, "-", 2)[0]] {
+		return true
+	}
+	return strings.Contains(formatID, "audio") || strings.Contains(formatID, "drc")
+}
+
+// AudioTagsFromMetadata собирает теги из метаданных видео. Для музыкальных видео
+// используются трек и исполнитель от yt-dlp, иначе - название видео и канал.
+func AudioTagsFromMetadata(metadata *VideoMetadata) AudioTags {
+	if metadata == nil {
+		return AudioTags{}
+	}
+	tags := AudioTags{
+		Title:  metadata.Track,
+		Artist: metadata.Artist,
+		Album:  metadata.Album,
+		Year:   metadata.Year,
+	}
+	if tags.Title == "" {
+		tags.Title = metadata.Title
+	}
+	if tags.Artist == "" {
+		// Автоматические каналы YouTube Music называются "Исполнитель - Topic"
+		tags.Artist = strings.TrimSuffix(metadata.Author, " - Topic")
+	}
+	return tags
+}
+
+// canTagAudio проверяет, что в файл с таким расширением можно записать теги
+func canTagAudio(ext string) bool {
+	return ext == ".mp3" || ext == ".m4a" || ext == ".flac" || ext == ".opus"
+}
+
+// canEmbedCover проверяет, что контейнер поддерживает обложку как attached_pic
+func canEmbedCover(ext string) bool {
+	return ext == ".mp3" || ext == ".m4a" || ext == ".flac"
+}
+
+// TagAudio записывает теги в MP3, M4A, FLAC или Opus, а обложку (если coverURL не пустой
+// и скачалась) - в MP3, M4A и FLAC. Файл перезаписывается на месте без перекодирования звука.
+func TagAudio(ctx context.Context, audioPath string, tags AudioTags, coverURL string) error {
+	ext := strings.ToLower(filepath.Ext(audioPath))
+	if !canTagAudio(ext) {
+		return fmt.Errorf("теги не поддерживаются для %s", audioPath)
+	}
+
+	base := strings.TrimSuffix(audioPath, filepath.Ext(audioPath))
+	taggedPath := base + ".tagged" + ext
+	coverPath := base + ".cover.jpg"
+	defer os.Remove(coverPath)
+
+	hasCover := false
+	if coverURL != "" && canEmbedCover(ext) {
+		if err := downloadCover(ctx, coverURL, coverPath); err != nil {
+			log.Printf("⚠️ Не удалось скачать обложку: %v", err)
+		} else {
+			hasCover = true
+		}
+	}
+
+	args := []string{"-i", audioPath}
+	if hasCover {
+		args = append(args, "-i", coverPath, "-map", "0:a", "-map", "1:v", "-disposition:v", "attached_pic")
+	} else {
+		args = append(args, "-map", "0:a")
+	}
+	args = append(args, "-c", "copy", "-map_metadata", "-1")
+	if ext == ".mp3" {
+		args = append(args, "-id3v2_version", "3")
+		if hasCover {
+			args = append(args, "-metadata:s:v", "title=Album cover", "-metadata:s:v", "comment=Cover (front)")
+		}
+	}
+	for _, tag := range [][2]string{{"title", tags.Title}, {"artist", tags.Artist}, {"album", tags.Album}, {"date", tags.Year}} {
+		if tag[1] != "" {
+			args = append(args, "-metadata", tag[0]+"="+tag[1])
+		}
+	}
+	args = append(args, "-y", taggedPath)
+
+	output, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput()
+	if err != nil {
+		os.Remove(taggedPath)
+		if ctx.Err() != nil {
+			return ErrCancelled
+		}
+		log.Printf("❌ Ошибка записи тегов: %s", string(output))
+		return fmt.Errorf("ошибка записи тегов: %v", err)
+	}
+	if err := os.Rename(taggedPath, audioPath); err != nil {
+		os.Remove(taggedPath)
+		return fmt.Errorf("ошибка замены файла с тегами: %v", err)
+	}
+
+	log.Printf("🏷️ Теги записаны: %s - %s (обложка: %t)", tags.Artist, tags.Title, hasCover)
+	return nil
+}
+
+// downloadCover скачивает миниатюру и сохраняет ее в JPEG (YouTube часто отдает WebP)
+func downloadCover(ctx context.Context, coverURL, coverPath string) error {
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-i", coverURL, "-frames:v", "1", "-q:v", "2", "-y", coverPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		debugf("ffmpeg cover: %s", string(output))
+		return fmt.Errorf("ошибка получения обложки: %v", err)
+	}
+	return nil
+}
+
+// ReadAudioTags читает название и исполнителя из тегов аудиофайла
+func ReadAudioTags(ctx context.Context, audioPath string) (AudioTags, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "quiet", "-show_entries", "format_tags", "-of", "json", audioPath)
+	output, err := cmd.Output()
+	if err != nil {
+		return AudioTags{}, fmt.Errorf("ошибка чтения тегов: %v", err)
+	}
+
+	var probe struct {
+		Format struct {
+			Tags map[string]string `json:"tags"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return AudioTags{}, fmt.Errorf("ошибка разбора тегов: %v", err)
+	}
+
+	// Регистр ключей зависит от контейнера (TITLE в ogg, title в mp3/m4a)
+	var tags AudioTags
+	for key, value := range probe.Format.Tags {
+		switch strings.ToLower(key) {
+		case "title":
+			tags.Title = value
+		case "artist":
+			tags.Artist = value
+		case "album":
+			tags.Album = value
+		case "date":
+			tags.Year = value
+		}
+	}
+	return tags, nil
+}
+
+// ExtractAudioCover сохраняет встроенную обложку как миниатюру для Telegram
+// (JPEG не больше 320x320). Возвращает ошибку, если обложки в файле нет.
+func ExtractAudioCover(ctx context.Context, audioPath, thumbnailPath string) error {
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-i", audioPath,
+		"-an",
+		"-frames:v", "1",
+		"-vf", "scale=320:320:force_original_aspect_ratio=decrease",
+		"-q:v", "4",
+		"-y", thumbnailPath,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(thumbnailPath)
+		debugf("ffmpeg cover extract: %s", string(output))
+		return fmt.Errorf("обложка не найдена: %v", err)
+	}
+	if info, err := os.Stat(thumbnailPath); err != nil || info.Size() == 0 {
+		os.Remove(thumbnailPath)
+		return fmt.Errorf("обложка не найдена")
+	}
+	return nil
+}
+
+// tagDownloadedAudio записывает теги в скачанное аудио. Ошибка не мешает отправке:
+// файл просто останется без тегов и обложки.
+func tagDownloadedAudio(ctx context.Context, audioPath string, metadata *VideoMetadata) {
+	if metadata == nil || !canTagAudio(strings.ToLower(filepath.Ext(audioPath))) {
+		return
+	}
+	if err := TagAudio(ctx, audioPath, AudioTagsFromMetadata(metadata), metadata.Thumbnail); err != nil {
+		log.Printf("⚠️ Не удалось записать теги в %s: %v", audioPath, err)
+	}
+}
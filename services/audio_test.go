@@ -0,0 +1,146 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAudioOutputByKey(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, output := range AudioOutputs {
+		if got := AudioOutputByKey(output.Key); got != output {
+			t.Errorf("AudioOutputByKey(%s) = %+v", output.Key, got)
+		}
+		// Ключ идет в callback_data и ID формата, которые разбираются по "_"
+		if strings.Contains(output.Key, "_") || seen[output.Key] {
+			t.Errorf("bad or duplicate key %q", output.Key)
+		}
+		seen[output.Key] = true
+	}
+	for _, key := range []string{"", "unknown", "MP3"} {
+		if got := AudioOutputByKey(key); got.Key != DefaultAudioOutput {
+			t.Errorf("AudioOutputByKey(%q) = %s, want default %s", key, got.Key, DefaultAudioOutput)
+		}
+	}
+}
+
+func TestAudioOutputMapping(t *testing.T) {
+	tests := []struct {
+		key      string
+		formatID string
+		selector string
+		args     []string
+		bitrate  string
+	}{
+		{"mp3", "140", "140/bestaudio/best", []string{"--extract-audio", "--audio-format", "mp3", "--audio-quality", "0"}, "192k"},
+		{"mp3-128", "140", "140/bestaudio/best", []string{"--extract-audio", "--audio-format", "mp3", "--audio-quality", "128K"}, "128k"},
+		{"mp3-320", "251", "251/bestaudio/best", []string{"--extract-audio", "--audio-format", "mp3", "--audio-quality", "320K"}, "320k"},
+		{"m4a", "140", "140[ext=m4a]/bestaudio[ext=m4a]/140/bestaudio/best", []string{"--extract-audio", "--audio-format", "m4a", "--audio-quality", "0"}, "192k"},
+		{"opus", "251", "251[acodec=opus]/bestaudio[acodec=opus]/251/bestaudio/best", []string{"--extract-audio", "--audio-format", "opus", "--audio-quality", "0"}, "192k"},
+		{"flac", "bestaudio", "bestaudio/bestaudio/best", []string{"--extract-audio", "--audio-format", "flac", "--audio-quality", "0"}, "192k"},
+		{"wav", "140", "140/bestaudio/best", []string{"--extract-audio", "--audio-format", "wav", "--audio-quality", "0"}, "192k"},
+	}
+	for _, tt := range tests {
+		output := AudioOutputByKey(tt.key)
+		if got := output.formatSelector(tt.formatID); got != tt.selector {
+			t.Errorf("%s: formatSelector = %s, want %s", tt.key, got, tt.selector)
+		}
+		if got := output.args(); !reflect.DeepEqual(got, tt.args) {
+			t.Errorf("%s: args = %q, want %q", tt.key, got, tt.args)
+		}
+		if got := output.Bitrate(); got != tt.bitrate {
+			t.Errorf("%s: Bitrate = %s, want %s", tt.key, got, tt.bitrate)
+		}
+	}
+}
+
+func TestAudioFileFormatID(t *testing.T) {
+	clip := &TimeRange{Start: 80, End: 165}
+	tests := []struct {
+		opts     DownloadOptions
+		formatID string
+		want     string
+	}{
+		// Формат по умолчанию не меняет ID, чтобы старый кэш оставался действительным
+		{DownloadOptions{Audio: true}, "140", "140"},
+		{DownloadOptions{Audio: true, AudioFormat: "mp3"}, "140", "140"},
+		{DownloadOptions{Audio: true, AudioFormat: "flac"}, "140", "140-flac"},
+		{DownloadOptions{Audio: true, AudioFormat: "mp3-320"}, "251", "251-mp3-320"},
+		{DownloadOptions{Audio: true, AudioFormat: "opus", Clip: clip}, "251", "251-opus-clip80-165"},
+		// Для видео формат звука не учитывается
+		{DownloadOptions{AudioFormat: "flac"}, "18", "18"},
+		{DownloadOptions{AudioFormat: "flac", Clip: clip}, "18", "18-clip80-165"},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.FileFormatID(tt.formatID); got != tt.want {
+			t.Errorf("%+v: FileFormatID(%s) = %s, want %s", tt.opts, tt.formatID, got, tt.want)
+		}
+	}
+}
+
+func TestIsAudioFormatID(t *testing.T) {
+	tests := []struct {
+		formatID string
+		want     bool
+	}{
+		{"140", true},
+		{"251", true},
+		{"140-flac", true},
+		{"251-opus-clip80-165", true},
+		{"audio_only", true},
+		{"140-drc", true},
+		{"18", false},
+		{"137", false},
+		{"1400", false},
+		{"hls-720p", false},
+	}
+	for _, tt := range tests {
+		if got := IsAudioFormatID(tt.formatID); got != tt.want {
+			t.Errorf("IsAudioFormatID(%s) = %v, want %v", tt.formatID, got, tt.want)
+		}
+	}
+}
+
+func TestIsAudioExtension(t *testing.T) {
+	for _, ext := range []string{".mp3", ".M4A", ".ogg", ".opus", ".flac", ".wav"} {
+		if !IsAudioExtension(ext) {
+			t.Errorf("IsAudioExtension(%s) = false", ext)
+		}
+	}
+	for _, ext := range []string{".mp4", ".webm", ".mkv", ""} {
+		if IsAudioExtension(ext) {
+			t.Errorf("IsAudioExtension(%s) = true", ext)
+		}
+	}
+}
+
+func TestAudioTagsFromMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata *VideoMetadata
+		want     AudioTags
+	}{
+		{"no metadata", nil, AudioTags{}},
+		{
+			name:     "music video",
+			metadata: &VideoMetadata{Title: "Rick Astley - Never Gonna Give You Up (Official Music Video)", Author: "Rick Astley", Track: "Never Gonna Give You Up", Artist: "Rick Astley", Album: "Whenever You Need Somebody", Year: "1987"},
+			want:     AudioTags{Title: "Never Gonna Give You Up", Artist: "Rick Astley", Album: "Whenever You Need Somebody", Year: "1987"},
+		},
+		{
+			name:     "ordinary video",
+			metadata: &VideoMetadata{Title: "Лекция", Author: "Канал", Year: "2023"},
+			want:     AudioTags{Title: "Лекция", Artist: "Канал", Year: "2023"},
+		},
+		{
+			name:     "topic channel",
+			metadata: &VideoMetadata{Title: "Song", Author: "Artist - Topic"},
+			want:     AudioTags{Title: "Song", Artist: "Artist"},
+		},
+	}
+	for _, tt := range tests {
+		if got := AudioTagsFromMetadata(tt.metadata); got != tt.want {
+			t.Errorf("%s: tags = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
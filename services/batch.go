@@ -0,0 +1,137 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// NewBatchID возвращает ID для пакета задач (плейлист, канал)
+func (q *DownloadQueue) NewBatchID() string {
+	q.jobCounterMux.Lock()
+	defer q.jobCounterMux.Unlock()
+	q.jobCounter++
+	return fmt.Sprintf("batch_%d_%d", time.Now().UnixMilli(), q.jobCounter)
+}
+
+// AddBatchJob добавляет в очередь задачу пакета batchID. Лимиты пользователя действуют
+// как для AddJob: получив *UserLimitError, остальные видео пакета добавляют позже,
+// когда задачи пакета начнут завершаться.
+func (q *DownloadQueue) AddBatchJob(batchID string, userID, chatID int64, videoURL, formatID string, priority int) (string, error) {
+	return q.addJob(userID, chatID, videoURL, formatID, "", priority, batchID)
+}
+
+// CancelBatch отменяет незавершенные задачи пакета и возвращает их количество
+func (q *DownloadQueue) CancelBatch(batchID string) int {
+	q.activeJobsMux.RLock()
+	var jobIDs []string
+	for _, job := range q.activeJobs {
+		if job.BatchID == batchID && (job.Status == JobStatusPending || job.Status == JobStatusProcessing) {
+			jobIDs = append(jobIDs, job.ID)
+		}
+	}
+	q.activeJobsMux.RUnlock()
+
+	cancelled := 0
+	for _, jobID := range jobIDs {
+		if err := q.CancelJob(jobID); err == nil {
+			cancelled++
+		}
+	}
+	log.Printf("❌ Пакет %s: отменено задач: %d", batchID, cancelled)
+	return cancelled
+}
+
+// BatchProgress - сводный прогресс пакета задач. Собирается из событий задач пакета
+// одним получателем и не защищен мьютексом.
+type BatchProgress struct {
+	ID        string
+	Title     string
+	Total     int // Всего видео в пакете, включая еще не поставленные в очередь
+	Completed int
+	Failed    int
+	Cancelled int
+
+	percents map[string]float64 // Прогресс скачиваемых сейчас задач
+}
+
+// NewBatchProgress создает сводный прогресс для пакета из total видео
+func NewBatchProgress(id, title string, total int) *BatchProgress {
+	return &BatchProgress{
+		ID:       id,
+		Title:    title,
+		Total:    total,
+		percents: make(map[string]float64),
+	}
+}
+
+// Update учитывает событие задачи пакета и возвращает true, если задача завершилась
+func (p *BatchProgress) Update(event JobEvent) bool {
+	switch event.Type {
+	case JobEventProgress:
+		if event.Progress.Percent >= 0 {
+			p.percents[event.JobID] = event.Progress.Percent
+		}
+	case JobEventDone:
+		delete(p.percents, event.JobID)
+		switch event.Status {
+		case JobStatusCompleted:
+			p.Completed++
+		case JobStatusCancelled:
+			p.Cancelled++
+		default:
+			p.Failed++
+		}
+		return true
+	}
+	return false
+}
+
+// Fail учитывает видео, которое не удалось поставить в очередь
+func (p *BatchProgress) Fail() {
+	p.Failed++
+}
+
+// Finished возвращает количество завершенных видео (успешно или нет)
+func (p *BatchProgress) Finished() int {
+	return p.Completed + p.Failed + p.Cancelled
+}
+
+// Done проверяет, что все видео пакета завершены
+func (p *BatchProgress) Done() bool {
+	return p.Finished() >= p.Total
+}
+
+// Percent возвращает общий процент пакета с учетом скачиваемых сейчас видео
+func (p *BatchProgress) Percent() float64 {
+	if p.Total == 0 {
+		return 100
+	}
+	done := float64(p.Finished())
+	for _, percent := range p.percents {
+		done += percent / 100
+	}
+	return done / float64(p.Total) * 100
+}
+
+// Text формирует текст статусного сообщения пакета
+func (p *BatchProgress) Text() string {
+	var b strings.Builder
+	if p.Done() {
+		fmt.Fprintf(&b, "🏁 %s\n", p.Title)
+	} else {
+		fmt.Fprintf(&b, "📦 %s\n", p.Title)
+	}
+	fmt.Fprintf(&b, "✅ Готово: %d из %d", p.Completed, p.Total)
+	if p.Failed > 0 {
+		fmt.Fprintf(&b, "\n❌ Ошибок: %d", p.Failed)
+	}
+	if p.Cancelled > 0 {
+		fmt.Fprintf(&b, "\n✖ Отменено: %d", p.Cancelled)
+	}
+	if !p.Done() {
+		fmt.Fprintf(&b, "\n%s %.0f%%", ProgressBar(p.Percent(), 10), p.Percent())
+	}
+	return b.String()
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAddBatchJobUserLimits(t *testing.T) {
+	dir := t.TempDir()
+	writePlaylistFixture(t, dir, "PLbatchPlaylist", 10, 10)
+	fake := NewFakeDownloader(dir)
+	// Очередь не запущена - задачи остаются в ожидании
+	queue, _ := newTestQueue(t, fake, 1)
+	queue.SetUserLimits(UserLimits{MaxConcurrent: 1, MaxQueued: 3})
+
+	playlist, err := NewYouTubeServiceWithDownloader(t.TempDir(), fake).GetPlaylist("https://www.youtube.com/playlist?list=PLbatchPlaylist")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Пакет раскрывается в задачи, пока не упрется в MaxQueued пользователя
+	batchID := queue.NewBatchID()
+	var added []string
+	var limitErr *UserLimitError
+	for _, entry := range playlist.Entries {
+		jobID, err := queue.AddBatchJob(batchID, 1, 1, entry.URL, BatchVideoFormat, PriorityNormal)
+		if errors.As(err, &limitErr) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		added = append(added, jobID)
+	}
+	if len(added) != 3 || limitErr == nil || limitErr.Limit != 3 {
+		t.Fatalf("added %d jobs before the limit, err %v", len(added), limitErr)
+	}
+	for i, jobID := range added {
+		job, ok := queue.GetJobStatus(jobID)
+		if !ok || job.BatchID != batchID || job.VideoURL != playlist.Entries[i].URL {
+			t.Errorf("job %d = %+v", i, job)
+		}
+	}
+
+	// Лимит одного пользователя не мешает другому
+	if _, err := queue.AddBatchJob(queue.NewBatchID(), 2, 2, playlist.Entries[0].URL, BatchVideoFormat, PriorityNormal); err != nil {
+		t.Errorf("other user: %v", err)
+	}
+
+	// Отмена пакета затрагивает только его задачи
+	other, err := queue.AddJob(2, 2, playlist.Entries[1].URL, BatchVideoFormat, "", PriorityNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled := queue.CancelBatch(batchID); cancelled != len(added) {
+		t.Errorf("CancelBatch = %d, want %d", cancelled, len(added))
+	}
+	if job, _ := queue.GetJobStatus(other); job.Status != JobStatusPending {
+		t.Errorf("job outside the batch: status %s", job.Status)
+	}
+	// После отмены место в очереди пользователя освобождается
+	if _, err := queue.AddBatchJob(batchID, 1, 1, playlist.Entries[3].URL, BatchVideoFormat, PriorityNormal); err != nil {
+		t.Errorf("after cancel: %v", err)
+	}
+}
+
+func TestBatchProgress(t *testing.T) {
+	progress := NewBatchProgress("batch_1", "Плейлист", 4)
+	progress.Update(JobEvent{JobID: "a", Type: JobEventProgress, Progress: DownloadProgress{Percent: 50}})
+	// Неизвестный процент не учитывается
+	progress.Update(JobEvent{JobID: "b", Type: JobEventProgress, Progress: DownloadProgress{Percent: -1}})
+	if percent := progress.Percent(); percent != 12.5 {
+		t.Errorf("percent = %v, want 12.5", percent)
+	}
+
+	if !progress.Update(JobEvent{JobID: "a", Type: JobEventDone, Status: JobStatusCompleted}) {
+		t.Error("done event not reported as finished")
+	}
+	progress.Update(JobEvent{JobID: "b", Type: JobEventDone, Status: JobStatusCancelled})
+	progress.Update(JobEvent{JobID: "c", Type: JobEventDone, Status: JobStatusFailed})
+	if progress.Done() || progress.Percent() != 75 {
+		t.Errorf("after 3 of 4: done %v, percent %v", progress.Done(), progress.Percent())
+	}
+	text := progress.Text()
+	for _, want := range []string{"📦 Плейлист", "Готово: 1 из 4", "Ошибок: 1", "Отменено: 1", "75%"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text %q does not contain %q", text, want)
+		}
+	}
+
+	// Видео, которое не удалось поставить в очередь, тоже завершает пакет
+	progress.Fail()
+	if !progress.Done() || progress.Finished() != 4 {
+		t.Errorf("after Fail: done %v, finished %d", progress.Done(), progress.Finished())
+	}
+	if text := progress.Text(); !strings.HasPrefix(text, "🏁") || strings.Contains(text, "%") {
+		t.Errorf("finished text = %q", text)
+	}
+}
@@ -33,6 +33,7 @@ type CacheService struct {
 	cacheDir    string
 	maxCacheSize int64 // Максимальный размер кэша в байтах (20-30 ГБ)
 	mutex       sync.RWMutex // Защита от race conditions
+	evictUploaded bool // Удалять локальный файл после получения file_id
 }
 
 // NewCacheService создает новый сервис кэширования
@@ -145,6 +146,69 @@ func createCacheTable(db *sql.DB) error {
 		}
 	}
 	
+	// file_id отправленных файлов. file_id действителен только для бота, который его получил,
+	// поэтому храним его для каждого бота отдельно
+	fileIDsQuery := `
+	CREATE TABLE IF NOT EXISTS telegram_files (
+		video_id TEXT NOT NULL,
+		platform TEXT NOT NULL,
+		format_id TEXT NOT NULL,
+		bot_id TEXT NOT NULL,
+		file_id TEXT NOT NULL,
+		is_audio INTEGER NOT NULL DEFAULT 0,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (video_id, platform, format_id, bot_id)
+	);
+	`
+	if _, err = db.Exec(fileIDsQuery); err != nil {
+		return fmt.Errorf("ошибка создания таблицы telegram_files: %v", err)
+	}
+	
+	// Части видео, разрезанного под лимит Telegram. Группа частей хранится целиком
+	// под ID формата исходного видео, file_id каждой части - под PartFormatID
+	partsQuery := `
+	CREATE TABLE IF NOT EXISTS video_parts (
+		video_id TEXT NOT NULL,
+		platform TEXT NOT NULL,
+		format_id TEXT NOT NULL,
+		part_index INTEGER NOT NULL,
+		part_count INTEGER NOT NULL,
+		part_format_id TEXT NOT NULL,
+		file_path TEXT NOT NULL,
+		file_size INTEGER NOT NULL,
+		duration INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (video_id, platform, format_id, part_index)
+	);
+	`
+	if _, err = db.Exec(partsQuery); err != nil {
+		return fmt.Errorf("ошибка создания таблицы video_parts: %v", err)
+	}
+	
+	// Настройки пользователей (выбранный формат звука и т.п.)
+	settingsQuery := `
+	CREATE TABLE IF NOT EXISTS user_settings (
+		user_id INTEGER PRIMARY KEY,
+		audio_format TEXT NOT NULL DEFAULT '',
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	if _, err = db.Exec(settingsQuery); err != nil {
+		return fmt.Errorf("ошибка создания таблицы user_settings: %v", err)
+	}
+	
+	// Домены универсального извлечения, разрешенные или запрещенные администратором
+	genericDomainsQuery := `
+	CREATE TABLE IF NOT EXISTS generic_domains (
+		domain TEXT PRIMARY KEY,
+		allowed INTEGER NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	if _, err = db.Exec(genericDomainsQuery); err != nil {
+		return fmt.Errorf("ошибка создания таблицы generic_domains: %v", err)
+	}
+	
 	// Создаем индексы
 	indexQueries := []string{
 		`CREATE INDEX IF NOT EXISTS idx_video_id ON video_cache(video_id)`,
@@ -186,6 +250,11 @@ func (cs *CacheService) IsVideoCached(videoID, platform, formatID string) (bool,
 		return false, nil, fmt.Errorf("ошибка проверки кэша: %v", err)
 	}
 
+	// Локальная копия вытеснена после загрузки в Telegram - файл доступен только по file_id
+	if cache.FilePath == "" {
+		return false, nil, nil
+	}
+
 	// Проверяем, существует ли файл
 	if _, err := os.Stat(cache.FilePath); os.IsNotExist(err) {
 		// Файл удален, удаляем запись из БД (с проверкой ошибки)
@@ -344,11 +413,291 @@ func (cs *CacheService) IncrementDownloadCount(videoID, platform, formatID strin
 }
 
 
+// AddPartsToCache сохраняет группу частей видео, заменяя прежнюю группу того же формата
+func (cs *CacheService) AddPartsToCache(videoID, platform, formatID string, parts []VideoPart) error {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	
+	var totalSize int64
+	for _, part := range parts {
+		totalSize += part.FileSize
+	}
+	if err := cs.ensureCacheSize(totalSize); err != nil {
+		return fmt.Errorf("ошибка очистки кэша: %v", err)
+	}
+	
+	tx, err := cs.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+	
+	if _, err := tx.Exec(`DELETE FROM video_parts WHERE video_id = ? AND platform = ? AND format_id = ?`, videoID, platform, formatID); err != nil {
+		return fmt.Errorf("ошибка удаления старых частей: %v", err)
+	}
+	insertQuery := `
+	INSERT INTO video_parts (video_id, platform, format_id, part_index, part_count, part_format_id, file_path, file_size, duration)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	for _, part := range parts {
+		partFormatID := PartFormatID(formatID, part.Index, part.Count)
+		if _, err := tx.Exec(insertQuery, videoID, platform, formatID, part.Index, part.Count, partFormatID, part.FilePath, part.FileSize, part.Duration); err != nil {
+			return fmt.Errorf("ошибка добавления части в кэш: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка сохранения частей: %v", err)
+	}
+	
+	log.Printf("💾 Видео из %d частей добавлено в кэш: %s - %s [%s]", len(parts), videoID, formatID, platform)
+	return nil
+}
+
+// GetCachedParts возвращает группу частей видео (nil если формат не резался на части).
+// Если файл какой-то части пропал с диска, группа считается неполной и удаляется.
+// У вытесненных частей FilePath пустой - они отправляются по file_id.
+func (cs *CacheService) GetCachedParts(videoID, platform, formatID string) ([]VideoPart, error) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	
+	query := `SELECT part_index, part_count, file_path, file_size, duration FROM video_parts
+			  WHERE video_id = ? AND platform = ? AND format_id = ? ORDER BY part_index`
+	rows, err := cs.db.Query(query, videoID, platform, formatID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения частей видео: %v", err)
+	}
+	
+	var parts []VideoPart
+	complete := true
+	for rows.Next() {
+		var part VideoPart
+		if err := rows.Scan(&part.Index, &part.Count, &part.FilePath, &part.FileSize, &part.Duration); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка чтения части видео: %v", err)
+		}
+		if part.FilePath != "" {
+			if _, err := os.Stat(part.FilePath); os.IsNotExist(err) {
+				complete = false
+			}
+		}
+		parts = append(parts, part)
+	}
+	rows.Close()
+	
+	if len(parts) == 0 {
+		return nil, nil
+	}
+	if !complete || parts[0].Count != len(parts) {
+		log.Printf("⚠️ Группа частей %s (%s) неполная, удаляю из кэша", videoID, formatID)
+		for _, part := range parts {
+			if part.FilePath != "" {
+				os.Remove(part.FilePath)
+			}
+		}
+		if _, err := cs.db.Exec(`DELETE FROM video_parts WHERE video_id = ? AND platform = ? AND format_id = ?`, videoID, platform, formatID); err != nil {
+			log.Printf("⚠️ Ошибка удаления записи из БД: %v", err)
+		}
+		return nil, nil
+	}
+	return parts, nil
+}
+
+// SetEvictUploaded включает удаление локальных файлов, для которых сохранен file_id.
+// Такие файлы дальше отправляются только по file_id.
+func (cs *CacheService) SetEvictUploaded(evict bool) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.evictUploaded = evict
+}
+
+// GetFileID возвращает сохраненный file_id файла для бота botID ("" если его нет)
+// и признак того, что файл был отправлен как аудио
+func (cs *CacheService) GetFileID(videoID, platform, formatID, botID string) (string, bool, error) {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+	
+	query := `SELECT file_id, is_audio FROM telegram_files WHERE video_id = ? AND platform = ? AND format_id = ? AND bot_id = ?`
+	var fileID string
+	var isAudio bool
+	err := cs.db.QueryRow(query, videoID, platform, formatID, botID).Scan(&fileID, &isAudio)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("ошибка получения file_id: %v", err)
+	}
+	return fileID, isAudio, nil
+}
+
+// SaveFileID сохраняет file_id, который Telegram вернул боту botID после загрузки файла.
+// Если включено вытеснение, локальный файл удаляется, а запись кэша остается.
+func (cs *CacheService) SaveFileID(videoID, platform, formatID, botID, fileID string, isAudio bool) error {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	
+	query := `
+	INSERT INTO telegram_files (video_id, platform, format_id, bot_id, file_id, is_audio, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(video_id, platform, format_id, bot_id) DO UPDATE SET
+		file_id = excluded.file_id, is_audio = excluded.is_audio, updated_at = CURRENT_TIMESTAMP
+	`
+	if _, err := cs.db.Exec(query, videoID, platform, formatID, botID, fileID, isAudio); err != nil {
+		return fmt.Errorf("ошибка сохранения file_id: %v", err)
+	}
+	log.Printf("📎 Сохранен file_id для %s (%s) [%s]", videoID, formatID, platform)
+	
+	if cs.evictUploaded {
+		cs.evictLocalFile(videoID, platform, formatID)
+	}
+	return nil
+}
+
+// DeleteFileID удаляет file_id, который Telegram больше не принимает
+func (cs *CacheService) DeleteFileID(videoID, platform, formatID, botID string) error {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	
+	query := `DELETE FROM telegram_files WHERE video_id = ? AND platform = ? AND format_id = ? AND bot_id = ?`
+	if _, err := cs.db.Exec(query, videoID, platform, formatID, botID); err != nil {
+		return fmt.Errorf("ошибка удаления file_id: %v", err)
+	}
+	return nil
+}
+
+// GetUserAudioFormat возвращает выбранный пользователем формат звука ("" если не выбран)
+func (cs *CacheService) GetUserAudioFormat(userID int64) (string, error) {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+	
+	var audioFormat string
+	err := cs.db.QueryRow(`SELECT audio_format FROM user_settings WHERE user_id = ?`, userID).Scan(&audioFormat)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка получения настроек пользователя: %v", err)
+	}
+	return audioFormat, nil
+}
+
+// SetUserAudioFormat запоминает выбранный пользователем формат звука
+func (cs *CacheService) SetUserAudioFormat(userID int64, audioFormat string) error {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	
+	query := `
+	INSERT INTO user_settings (user_id, audio_format, updated_at)
+	VALUES (?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(user_id) DO UPDATE SET audio_format = excluded.audio_format, updated_at = CURRENT_TIMESTAMP
+	`
+	if _, err := cs.db.Exec(query, userID, audioFormat); err != nil {
+		return fmt.Errorf("ошибка сохранения настроек пользователя: %v", err)
+	}
+	return nil
+}
+
+// GetGenericDomains возвращает домены универсального извлечения: домен -> разрешен ли он
+func (cs *CacheService) GetGenericDomains() (map[string]bool, error) {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+	
+	rows, err := cs.db.Query(`SELECT domain, allowed FROM generic_domains`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки доменов: %v", err)
+	}
+	defer rows.Close()
+	
+	domains := make(map[string]bool)
+	for rows.Next() {
+		var domain string
+		var allowed bool
+		if err := rows.Scan(&domain, &allowed); err != nil {
+			return nil, fmt.Errorf("ошибка чтения домена: %v", err)
+		}
+		domains[domain] = allowed
+	}
+	return domains, rows.Err()
+}
+
+// SetGenericDomain разрешает или запрещает домен для универсального извлечения
+func (cs *CacheService) SetGenericDomain(domain string, allowed bool) error {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	
+	query := `
+	INSERT INTO generic_domains (domain, allowed, updated_at)
+	VALUES (?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(domain) DO UPDATE SET allowed = excluded.allowed, updated_at = CURRENT_TIMESTAMP
+	`
+	if _, err := cs.db.Exec(query, domain, allowed); err != nil {
+		return fmt.Errorf("ошибка сохранения домена: %v", err)
+	}
+	return nil
+}
+
+// DeleteGenericDomain удаляет домен из списков; false - домена в списках не было
+func (cs *CacheService) DeleteGenericDomain(domain string) (bool, error) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	
+	result, err := cs.db.Exec(`DELETE FROM generic_domains WHERE domain = ?`, domain)
+	if err != nil {
+		return false, fmt.Errorf("ошибка удаления домена: %v", err)
+	}
+	deleted, _ := result.RowsAffected()
+	return deleted > 0, nil
+}
+
+// evictLocalFile удаляет локальную копию файла, оставляя запись в кэше (вызывается под mutex)
+func (cs *CacheService) evictLocalFile(videoID, platform, formatID string) {
+	var filePath string
+	query := `SELECT file_path FROM video_cache WHERE video_id = ? AND platform = ? AND format_id = ?`
+	if err := cs.db.QueryRow(query, videoID, platform, formatID).Scan(&filePath); err == sql.ErrNoRows {
+		cs.evictLocalPart(videoID, platform, formatID)
+		return
+	} else if err != nil || filePath == "" {
+		return
+	}
+	
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		log.Printf("⚠️ Не удалось вытеснить файл %s: %v", filePath, err)
+		return
+	}
+	
+	updateQuery := `UPDATE video_cache SET file_path = '', file_size = 0 WHERE video_id = ? AND platform = ? AND format_id = ?`
+	if _, err := cs.db.Exec(updateQuery, videoID, platform, formatID); err != nil {
+		log.Printf("⚠️ Ошибка обновления записи после вытеснения: %v", err)
+		return
+	}
+	log.Printf("📤 Локальный файл вытеснен, дальше отправляем по file_id: %s", filePath)
+}
+
+// evictLocalPart удаляет локальную копию части видео с ID формата partFormatID (вызывается под mutex)
+func (cs *CacheService) evictLocalPart(videoID, platform, partFormatID string) {
+	var filePath string
+	query := `SELECT file_path FROM video_parts WHERE video_id = ? AND platform = ? AND part_format_id = ?`
+	if err := cs.db.QueryRow(query, videoID, platform, partFormatID).Scan(&filePath); err != nil || filePath == "" {
+		return
+	}
+	
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		log.Printf("⚠️ Не удалось вытеснить файл %s: %v", filePath, err)
+		return
+	}
+	
+	updateQuery := `UPDATE video_parts SET file_path = '', file_size = 0 WHERE video_id = ? AND platform = ? AND part_format_id = ?`
+	if _, err := cs.db.Exec(updateQuery, videoID, platform, partFormatID); err != nil {
+		log.Printf("⚠️ Ошибка обновления записи после вытеснения: %v", err)
+		return
+	}
+	log.Printf("📤 Локальный файл части вытеснен, дальше отправляем по file_id: %s", filePath)
+}
+
 // ensureCacheSize проверяет размер кэша и очищает старые файлы если нужно
 func (cs *CacheService) ensureCacheSize(newFileSize int64) error {
 	// Получаем текущий размер кэша
 	var totalSize int64
-	query := `SELECT COALESCE(SUM(file_size), 0) FROM video_cache`
+	query := `SELECT (SELECT COALESCE(SUM(file_size), 0) FROM video_cache) + (SELECT COALESCE(SUM(file_size), 0) FROM video_parts)`
 	err := cs.db.QueryRow(query).Scan(&totalSize)
 	if err != nil {
 		return fmt.Errorf("ошибка подсчета размера кэша: %v", err)
@@ -422,8 +771,8 @@ func (cs *CacheService) cleanupOldFiles() error {
 			continue
 		}
 
-		// Удаляем файл
-		if err := os.Remove(filePath); err != nil {
+		// Удаляем файл (у вытесненных записей локального файла уже нет)
+		if err := os.Remove(filePath); err != nil && filePath != "" {
 			log.Printf("⚠️ Не удалось удалить старый файл %s: %v", filePath, err)
 			continue
 		}
@@ -435,6 +784,36 @@ func (cs *CacheService) cleanupOldFiles() error {
 		log.Printf("🗑️ Удален старый файл: %s", filePath)
 	}
 
+	return cs.cleanupOldParts()
+}
+
+// cleanupOldParts удаляет части видео старше 7 дней
+func (cs *CacheService) cleanupOldParts() error {
+	query := `SELECT file_path FROM video_parts WHERE created_at < datetime('now', '-7 days')`
+	rows, err := cs.db.Query(query)
+	if err != nil {
+		return fmt.Errorf("ошибка получения старых частей: %v", err)
+	}
+	var paths []string
+	for rows.Next() {
+		var filePath string
+		if err := rows.Scan(&filePath); err == nil && filePath != "" {
+			paths = append(paths, filePath)
+		}
+	}
+	rows.Close()
+
+	for _, filePath := range paths {
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("⚠️ Не удалось удалить старую часть %s: %v", filePath, err)
+		}
+	}
+	if _, err := cs.db.Exec(`DELETE FROM video_parts WHERE created_at < datetime('now', '-7 days')`); err != nil {
+		return fmt.Errorf("ошибка удаления старых частей: %v", err)
+	}
+	if len(paths) > 0 {
+		log.Printf("🗑️ Удалено %d старых частей видео", len(paths))
+	}
 	return nil
 }
 
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MaxMediaGroupSize - сколько файлов Telegram принимает в одной медиагруппе
+const MaxMediaGroupSize = 10
+
+// Chapter - глава видео (время в секундах)
+type Chapter struct {
+	Title string
+	Start float64
+	End   float64
+}
+
+// ChapterTrack - отдельный трек, вырезанный из аудио по главе
+type ChapterTrack struct {
+	Index    int // Номер трека, с 1
+	Count    int // Всего треков
+	Title    string
+	FilePath string
+	FileSize int64
+	Duration int // Длительность в секундах
+}
+
+// unsafeFileChars - символы, недопустимые в именах файлов внутри ZIP
+var unsafeFileChars = regexp.MustCompile(`[\\/:*?"<>|\x00-\x1f]+`)
+
+// FileName возвращает имя трека для архива: "01 - Название.mp3"
+func (t ChapterTrack) FileName() string {
+	title := strings.TrimSpace(unsafeFileChars.ReplaceAllString(t.Title, " "))
+	if title == "" {
+		title = fmt.Sprintf("Track %d", t.Index)
+	}
+	return fmt.Sprintf("%02d - %s%s", t.Index, title, filepath.Ext(t.FilePath))
+}
+
+// SplitAudioByChapters режет аудио по границам глав без перекодирования. Каждый трек получает
+// номер и название главы; остальные теги и обложка копируются из исходного файла,
+// а название исходного видео становится альбомом. Исходный файл не удаляется.
+func SplitAudioByChapters(ctx context.Context, audioPath string, chapters []Chapter, album string) ([]ChapterTrack, error) {
+	if len(chapters) == 0 {
+		return nil, fmt.Errorf("у видео нет глав")
+	}
+
+	planned := planChapterTracks(audioPath, chapters)
+	tracks := make([]ChapterTrack, 0, len(planned))
+
+	for i, track := range planned {
+		args := chapterTrackArgs(audioPath, chapters[i], track, album)
+
+		output, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput()
+		if err != nil {
+			RemoveChapterTracks(append(tracks, track))
+			if ctx.Err() != nil {
+				return nil, ErrCancelled
+			}
+			log.Printf("❌ Ошибка нарезки главы %d: %s", track.Index, string(output))
+			return nil, fmt.Errorf("ошибка нарезки главы %d: %v", track.Index, err)
+		}
+
+		info, err := os.Stat(track.FilePath)
+		if err != nil {
+			RemoveChapterTracks(append(tracks, track))
+			return nil, fmt.Errorf("ffmpeg не создал трек %d: %v", track.Index, err)
+		}
+		track.FileSize = info.Size()
+		tracks = append(tracks, track)
+	}
+
+	log.Printf("🎼 Аудио разрезано на %d треков по главам", len(tracks))
+	return tracks, nil
+}
+
+// planChapterTracks описывает треки, на которые режется audioPath: номер, название и файл
+// "<имя>_chNN<расширение>" для каждой главы. Глава без названия получает "Глава N".
+func planChapterTracks(audioPath string, chapters []Chapter) []ChapterTrack {
+	ext := filepath.Ext(audioPath)
+	base := strings.TrimSuffix(audioPath, ext)
+	tracks := make([]ChapterTrack, 0, len(chapters))
+	for i, chapter := range chapters {
+		track := ChapterTrack{
+			Index:    i + 1,
+			Count:    len(chapters),
+			Title:    chapter.Title,
+			FilePath: fmt.Sprintf("%s_ch%02d%s", base, i+1, ext),
+			Duration: int(chapter.End - chapter.Start),
+		}
+		if track.Title == "" {
+			track.Title = fmt.Sprintf("Глава %d", track.Index)
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks
+}
+
+// chapterTrackArgs возвращает аргументы ffmpeg, вырезающие главу в файл трека
+func chapterTrackArgs(audioPath string, chapter Chapter, track ChapterTrack, album string) []string {
+	args := []string{
+		"-ss", strconv.FormatFloat(chapter.Start, 'f', 3, 64),
+		"-to", strconv.FormatFloat(chapter.End, 'f', 3, 64),
+		"-i", audioPath,
+		"-map", "0",
+		"-c", "copy",
+		"-map_chapters", "-1",
+		"-metadata", "title=" + track.Title,
+		"-metadata", fmt.Sprintf("track=%d/%d", track.Index, track.Count),
+	}
+	if album != "" {
+		args = append(args, "-metadata", "album="+album)
+	}
+	if strings.EqualFold(filepath.Ext(audioPath), ".mp3") {
+		args = append(args, "-id3v2_version", "3")
+	}
+	return append(args, "-y", track.FilePath)
+}
+
+// ZipChapterTracks упаковывает треки в ZIP (без сжатия - аудио уже сжато)
+func ZipChapterTracks(tracks []ChapterTrack, zipPath string) error {
+	file, err := os.Create(zipPath)
+	if err != nil {
+		return fmt.Errorf("ошибка создания архива: %v", err)
+	}
+
+	archive := zip.NewWriter(file)
+	for _, track := range tracks {
+		if err := addFileToZip(archive, track.FilePath, track.FileName()); err != nil {
+			archive.Close()
+			file.Close()
+			os.Remove(zipPath)
+			return err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		file.Close()
+		os.Remove(zipPath)
+		return fmt.Errorf("ошибка записи архива: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(zipPath)
+		return fmt.Errorf("ошибка записи архива: %v", err)
+	}
+	return nil
+}
+
+// addFileToZip добавляет файл в архив под именем name
+func addFileToZip(archive *zip.Writer, path, name string) error {
+	source, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("ошибка открытия трека: %v", err)
+	}
+	defer source.Close()
+
+	writer, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+	if err != nil {
+		return fmt.Errorf("ошибка добавления в архив: %v", err)
+	}
+	if _, err := io.Copy(writer, source); err != nil {
+		return fmt.Errorf("ошибка добавления в архив: %v", err)
+	}
+	return nil
+}
+
+// RemoveChapterTracks удаляет файлы треков, игнорируя ошибки
+func RemoveChapterTracks(tracks []ChapterTrack) {
+	for _, track := range tracks {
+		os.Remove(track.FilePath)
+	}
+}
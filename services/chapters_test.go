@@ -0,0 +1,145 @@
+package services
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseChapters(t *testing.T) {
+	data := []byte(`{
+		"id": "abc",
+		"title": "Album",
+		"duration": 600,
+		"chapters": [
+			{"title": "Intro", "start_time": 0, "end_time": 62.5},
+			{"title": "", "start_time": 62.5, "end_time": 300},
+			{"title": "Empty", "start_time": 300, "end_time": 300},
+			{"title": "Reversed", "start_time": 400, "end_time": 350},
+			{"title": "Outro", "start_time": 300, "end_time": 600}
+		]
+	}`)
+	info, err := parseYtDlpInfo(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Главы нулевой и отрицательной длины пропускаются
+	want := []Chapter{
+		{Title: "Intro", Start: 0, End: 62.5},
+		{Title: "", Start: 62.5, End: 300},
+		{Title: "Outro", Start: 300, End: 600},
+	}
+	if got := info.metadata().Chapters; !reflect.DeepEqual(got, want) {
+		t.Errorf("chapters = %+v, want %+v", got, want)
+	}
+
+	info, err = parseYtDlpInfo([]byte(`{"id": "abc", "chapters": null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chapters := info.metadata().Chapters; chapters != nil {
+		t.Errorf("no chapters: got %+v", chapters)
+	}
+}
+
+func TestPlanChapterTracks(t *testing.T) {
+	chapters := []Chapter{
+		{Title: "Intro", Start: 0, End: 62.5},
+		{Title: "", Start: 62.5, End: 300},
+		{Title: "Outro", Start: 300, End: 600.75},
+	}
+	tracks := planChapterTracks("/tmp/dl/abc_140.mp3", chapters)
+	want := []ChapterTrack{
+		{Index: 1, Count: 3, Title: "Intro", FilePath: "/tmp/dl/abc_140_ch01.mp3", Duration: 62},
+		{Index: 2, Count: 3, Title: "Глава 2", FilePath: "/tmp/dl/abc_140_ch02.mp3", Duration: 237},
+		{Index: 3, Count: 3, Title: "Outro", FilePath: "/tmp/dl/abc_140_ch03.mp3", Duration: 300},
+	}
+	if !reflect.DeepEqual(tracks, want) {
+		t.Fatalf("tracks = %+v\nwant %+v", tracks, want)
+	}
+
+	// Границы главы передаются ffmpeg как -ss/-to с точностью до миллисекунды
+	args := chapterTrackArgs("/tmp/dl/abc_140.mp3", chapters[2], tracks[2], "Album")
+	wantArgs := []string{
+		"-ss", "300.000", "-to", "600.750", "-i", "/tmp/dl/abc_140.mp3",
+		"-map", "0", "-c", "copy", "-map_chapters", "-1",
+		"-metadata", "title=Outro", "-metadata", "track=3/3", "-metadata", "album=Album",
+		"-id3v2_version", "3",
+		"-y", "/tmp/dl/abc_140_ch03.mp3",
+	}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("args = %q\nwant %q", args, wantArgs)
+	}
+
+	// Без альбома и не в MP3 - без лишних тегов
+	args = chapterTrackArgs("/tmp/dl/abc_251.opus", chapters[0], planChapterTracks("/tmp/dl/abc_251.opus", chapters)[0], "")
+	for _, arg := range args {
+		if arg == "-id3v2_version" || arg == "album=" {
+			t.Errorf("unexpected %s in %q", arg, args)
+		}
+	}
+}
+
+func TestChapterTrackFileName(t *testing.T) {
+	tests := []struct {
+		track ChapterTrack
+		want  string
+	}{
+		{ChapterTrack{Index: 1, Title: "Intro", FilePath: "a_ch01.mp3"}, "01 - Intro.mp3"},
+		{ChapterTrack{Index: 12, Title: "AC/DC - Back in Black?", FilePath: "a_ch12.m4a"}, "12 - AC DC - Back in Black.m4a"},
+		{ChapterTrack{Index: 3, Title: " \"<>|\" ", FilePath: "a_ch03.opus"}, "03 - Track 3.opus"},
+	}
+	for _, tt := range tests {
+		if got := tt.track.FileName(); got != tt.want {
+			t.Errorf("FileName(%q) = %q, want %q", tt.track.Title, got, tt.want)
+		}
+	}
+}
+
+func TestZipChapterTracks(t *testing.T) {
+	dir := t.TempDir()
+	var tracks []ChapterTrack
+	for i, title := range []string{"Intro", "Outro"} {
+		track := ChapterTrack{Index: i + 1, Count: 2, Title: title, FilePath: filepath.Join(dir, title+".mp3")}
+		if err := os.WriteFile(track.FilePath, []byte("audio "+title), 0644); err != nil {
+			t.Fatal(err)
+		}
+		tracks = append(tracks, track)
+	}
+
+	zipPath := filepath.Join(dir, "tracks.zip")
+	if err := ZipChapterTracks(tracks, zipPath); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.OpenReader(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	got := make(map[string]string)
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(reader)
+		reader.Close()
+		got[file.Name] = string(data)
+	}
+	want := map[string]string{"01 - Intro.mp3": "audio Intro", "02 - Outro.mp3": "audio Outro"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("archive = %v, want %v", got, want)
+	}
+
+	// Пропавший трек - ошибка, недописанный архив удаляется
+	tracks = append(tracks, ChapterTrack{Index: 3, Title: "Missing", FilePath: filepath.Join(dir, "missing.mp3")})
+	if err := ZipChapterTracks(tracks, zipPath); err == nil {
+		t.Error("zip with a missing track succeeded")
+	}
+	if _, err := os.Stat(zipPath); !os.IsNotExist(err) {
+		t.Errorf("partial archive left: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package services
+
+import "fmt"
+
+// compressPresets - стандартные размеры (байты), до которых можно сжать видео,
+// помимо настроенного наибольшего
+var compressPresets = []int64{10 << 20, 25 << 20}
+
+// CompressTargets возвращает размеры (байты) для меню сжатия по возрастанию: стандартные
+// варианты и limit, не больше limit и меньше файла. fileSize <= 0 - размер файла неизвестен.
+func CompressTargets(fileSize, limit int64) []int64 {
+	if limit <= 0 {
+		return nil
+	}
+	var targets []int64
+	for _, target := range append(append([]int64{}, compressPresets...), limit) {
+		if target > limit || (fileSize > 0 && target >= fileSize) {
+			continue
+		}
+		if len(targets) > 0 && targets[len(targets)-1] >= target {
+			continue
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// FitEncodingParams рассчитывает битрейты (кбит/с) и максимальную высоту кадра,
+// чтобы видео длительностью duration секунд уложилось в targetSize байт
+func FitEncodingParams(duration float64, targetSize int64) (videoKbps, audioKbps, maxHeight int, err error) {
+	if duration <= 0 {
+		return 0, 0, 0, fmt.Errorf("неизвестная длительность видео")
+	}
+
+	// 4% оставляем на контейнер MP4
+	totalKbps := int(float64(targetSize) * 8 * 0.96 / duration / 1000)
+	switch {
+	case totalKbps >= 1000:
+		audioKbps = 128
+	case totalKbps >= 400:
+		audioKbps = 96
+	default:
+		audioKbps = 64
+	}
+	if totalKbps < audioKbps {
+		return 0, 0, 0, fmt.Errorf("видео слишком длинное для %s: не помещается даже звук", formatBytes(targetSize))
+	}
+
+	videoKbps = totalKbps - audioKbps
+	if videoKbps < 100 {
+		return 0, 0, 0, fmt.Errorf("видео слишком длинное для %s", formatBytes(targetSize))
+	}
+
+	// Чем ниже битрейт, тем меньше разрешение, иначе картинка рассыпается на блоки
+	switch {
+	case videoKbps >= 4000:
+		maxHeight = 1080
+	case videoKbps >= 2000:
+		maxHeight = 720
+	case videoKbps >= 1000:
+		maxHeight = 480
+	case videoKbps >= 500:
+		maxHeight = 360
+	default:
+		maxHeight = 240
+	}
+	return videoKbps, audioKbps, maxHeight, nil
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFitEncodingParams(t *testing.T) {
+	const mb = 1 << 20
+	tests := []struct {
+		name       string
+		duration   float64
+		targetSize int64
+		video      int
+		audio      int
+		height     int
+		err        string
+	}{
+		// 50 МБ на минуту: ~6710 кбит/с всего
+		{name: "short video keeps 1080p", duration: 60, targetSize: 50 * mb, video: 6582, audio: 128, height: 1080},
+		// 50 МБ на 3 минуты: ~2236 кбит/с
+		{name: "720p tier", duration: 180, targetSize: 50 * mb, video: 2108, audio: 128, height: 720},
+		// 25 МБ на 3 минуты: ~1118 кбит/с
+		{name: "360p tier", duration: 180, targetSize: 25 * mb, video: 990, audio: 128, height: 360},
+		// 10 МБ на 2 минуты: ~671 кбит/с - звук 96 кбит/с
+		{name: "medium budget lowers audio", duration: 120, targetSize: 10 * mb, video: 575, audio: 96, height: 360},
+		// 10 МБ на 5 минут: ~268 кбит/с - звук 64 кбит/с
+		{name: "small budget", duration: 300, targetSize: 10 * mb, video: 204, audio: 64, height: 240},
+		// 10 МБ на 15 минут: ~89 кбит/с - на видео остается меньше 100
+		{name: "video bitrate too low", duration: 900, targetSize: 10 * mb, err: "слишком длинное"},
+		// 10 МБ на 30 минут: ~44 кбит/с - меньше одного звука
+		{name: "audio alone exceeds budget", duration: 1800, targetSize: 10 * mb, err: "не помещается даже звук"},
+		{name: "unknown duration", duration: 0, targetSize: 50 * mb, err: "неизвестная длительность"},
+	}
+	for _, tt := range tests {
+		video, audio, height, err := FitEncodingParams(tt.duration, tt.targetSize)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: err = %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if video != tt.video || audio != tt.audio || height != tt.height {
+			t.Errorf("%s: got %d/%d kbps %dp, want %d/%d kbps %dp", tt.name, video, audio, height, tt.video, tt.audio, tt.height)
+		}
+		// Видео и звук вместе укладываются в размер за вычетом запаса на контейнер
+		if size := float64(video+audio) * 1000 / 8 * tt.duration; size > float64(tt.targetSize)*0.96 {
+			t.Errorf("%s: %.0f bytes of streams exceed %d", tt.name, size, tt.targetSize)
+		}
+	}
+}
+
+func TestCompressTargets(t *testing.T) {
+	const mb = 1 << 20
+	tests := []struct {
+		name     string
+		fileSize int64
+		limit    int64
+		want     []int64
+	}{
+		{"all presets below the file", 300 * mb, 50 * mb, []int64{10 * mb, 25 * mb, 50 * mb}},
+		{"only smaller than the file", 30 * mb, 50 * mb, []int64{10 * mb, 25 * mb}},
+		{"limit below the presets", 300 * mb, 20 * mb, []int64{10 * mb, 20 * mb}},
+		{"limit equal to a preset", 300 * mb, 25 * mb, []int64{10 * mb, 25 * mb}},
+		{"unknown file size", 0, 50 * mb, []int64{10 * mb, 25 * mb, 50 * mb}},
+		{"file already small", 8 * mb, 50 * mb, nil},
+		{"compression disabled", 300 * mb, 0, nil},
+	}
+	for _, tt := range tests {
+		if got := CompressTargets(tt.fileSize, tt.limit); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: CompressTargets = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
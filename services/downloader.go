@@ -0,0 +1,310 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"youtubeBot/utils"
+)
+
+// ErrCancelled возвращается, если скачивание или обработка были отменены
+var ErrCancelled = errors.New("загрузка отменена")
+
+// Downloader абстрагирует работу с yt-dlp: анализ видео и скачивание.
+// Позволяет подменить yt-dlp фейком и проверять сервисы без сети.
+type Downloader interface {
+	// Probe получает метаданные и все форматы видео одним вызовом
+	Probe(ctx context.Context, url string, args ...string) (*VideoInfo, error)
+	// ListFormats возвращает все форматы видео (без фильтрации под Telegram)
+	ListFormats(ctx context.Context, url string) ([]VideoFormat, error)
+	// Metadata возвращает метаданные видео
+	Metadata(ctx context.Context, url string) (*VideoMetadata, error)
+	// Download скачивает видео и возвращает путь к итоговому файлу
+	Download(ctx context.Context, req DownloadRequest) (string, error)
+	// Playlist возвращает до limit видео плейлиста или канала без их анализа
+	Playlist(ctx context.Context, url string, limit int) (*Playlist, error)
+}
+
+// DownloadRequest описывает параметры скачивания
+type DownloadRequest struct {
+	URL        string
+	Format     string       // Значение --format (например "137+bestaudio/best")
+	OutputDir  string       // Папка для файла
+	FilePrefix string       // Имя файла без расширения (например "<videoID>_<formatID>")
+	Args       []string     // Дополнительные аргументы yt-dlp
+	Progress   ProgressFunc // Получает события прогресса (может быть nil)
+}
+
+// DownloadOptions - параметры скачивания помимо ID формата
+type DownloadOptions struct {
+	Clip        *TimeRange     // Только фрагмент (nil - все видео)
+	Audio       bool           // Извлечь только звук с тегами и обложкой
+	AudioFormat string         // Ключ AudioOutput ("" - DefaultAudioOutput)
+	Metadata    *VideoMetadata // Источник тегов для аудио (может быть nil)
+}
+
+// FileFormatID возвращает ID формата, под которым результат хранится на диске и в кэше
+func (o DownloadOptions) FileFormatID(formatID string) string {
+	if o.Audio {
+		formatID = o.AudioOutput().FormatID(formatID)
+	}
+	if o.Clip != nil {
+		return ClipFormatID(formatID, *o.Clip)
+	}
+	return formatID
+}
+
+// AudioOutput возвращает выбранный формат звука
+func (o DownloadOptions) AudioOutput() AudioOutput {
+	return AudioOutputByKey(o.AudioFormat)
+}
+
+// OutputTemplate возвращает шаблон --output для запроса
+func (r DownloadRequest) OutputTemplate() string {
+	return filepath.Join(r.OutputDir, r.FilePrefix+".%(ext)s")
+}
+
+// YtDlpDownloader - реализация Downloader поверх бинарника yt-dlp
+type YtDlpDownloader struct{}
+
+// NewYtDlpDownloader создает Downloader, использующий yt-dlp
+func NewYtDlpDownloader() *YtDlpDownloader {
+	return &YtDlpDownloader{}
+}
+
+// Probe выполняет yt-dlp --dump-single-json
+func (d *YtDlpDownloader) Probe(ctx context.Context, url string, args ...string) (*VideoInfo, error) {
+	allArgs := []string{
+		"--dump-single-json",
+		"--no-playlist",
+		"--no-check-certificates",
+		"--no-warnings",
+	}
+	allArgs = append(allArgs, args...)
+	allArgs = append(allArgs, getProxyArgs()...)
+	allArgs = append(allArgs, url)
+
+	cmd := exec.CommandContext(ctx, getYtDlpPath(), allArgs...)
+	debugf("🚀 Выполняю команду: %s", strings.Join(cmd.Args, " "))
+
+	// JSON читаем только из stdout, stderr нужен для текста ошибки
+	output, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("таймаут получения информации о видео")
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			stderr := strings.TrimSpace(string(exitErr.Stderr))
+			log.Printf("❌ yt-dlp ошибка: %s", stderr)
+			return nil, fmt.Errorf("ошибка yt-dlp: %v: %s", err, stderr)
+		}
+		return nil, fmt.Errorf("ошибка yt-dlp: %v", err)
+	}
+
+	raw, err := parseYtDlpInfo(output)
+	if err != nil {
+		return nil, err
+	}
+	return raw.videoInfo(url), nil
+}
+
+// ListFormats возвращает все форматы видео
+func (d *YtDlpDownloader) ListFormats(ctx context.Context, url string) ([]VideoFormat, error) {
+	info, err := d.Probe(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return info.AllFormats, nil
+}
+
+// Metadata возвращает метаданные видео
+func (d *YtDlpDownloader) Metadata(ctx context.Context, url string) (*VideoMetadata, error) {
+	info, err := d.Probe(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return info.Metadata, nil
+}
+
+// Download запускает yt-dlp и ищет скачанный файл по FilePrefix
+func (d *YtDlpDownloader) Download(ctx context.Context, req DownloadRequest) (string, error) {
+	if err := os.MkdirAll(req.OutputDir, 0755); err != nil {
+		return "", fmt.Errorf("не удалось создать папку для загрузок: %v", err)
+	}
+
+	var args []string
+	if req.Format != "" {
+		args = append(args, "--format", req.Format)
+	}
+	args = append(args, "--output", req.OutputTemplate())
+	args = append(args, req.Args...)
+	if req.Progress != nil {
+		args = append(args, progressArgs()...)
+	}
+	args = append(args, getProxyArgs()...)
+	args = append(args, req.URL)
+
+	cmd := exec.CommandContext(ctx, getYtDlpPath(), args...)
+	killProcessGroup(cmd)
+	// Не ждем закрытия вывода дочерними процессами дольше 5 секунд после отмены
+	cmd.WaitDelay = 5 * time.Second
+	log.Printf("🚀 Выполняю команду: %s", strings.Join(cmd.Args, " "))
+
+	output, err := runWithProgress(cmd, req.Progress)
+	if err != nil {
+		if ctx.Err() == context.Canceled {
+			log.Printf("✖️ Скачивание %s отменено, удаляю недокачанные файлы", req.FilePrefix)
+			removeOutputFiles(req.OutputDir, req.FilePrefix)
+			return "", ErrCancelled
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("таймаут скачивания (timeout)")
+		}
+		log.Printf("❌ Ошибка yt-dlp: %s", string(output))
+		return "", fmt.Errorf("ошибка yt-dlp: %v", err)
+	}
+
+	debugf("✅ yt-dlp выполнен успешно: %s", string(output))
+	return findOutputFile(req.OutputDir, req.FilePrefix)
+}
+
+// runWithProgress запускает команду, передавая строки прогресса в onProgress.
+// Возвращает остальной вывод (stdout и stderr) для логов и ошибок.
+func runWithProgress(cmd *exec.Cmd, onProgress ProgressFunc) ([]byte, error) {
+	if onProgress == nil {
+		return cmd.CombinedOutput()
+	}
+
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	var output bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(pr)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if progress, ok := parseProgressLine(line); ok {
+				onProgress(progress)
+				continue
+			}
+			output.WriteString(line)
+			output.WriteByte('\n')
+		}
+		// Если сканер остановился на слишком длинной строке - дочитываем вывод, чтобы не блокировать процесс
+		io.Copy(io.Discard, pr)
+	}()
+
+	err := cmd.Wait()
+	pw.Close()
+	<-done
+	return output.Bytes(), err
+}
+
+// intermediateFile совпадает с промежуточными файлами yt-dlp (video.f137.mp4, video.temp.mp4)
+var intermediateFile = regexp.MustCompile(`\.(f\d+[^.]*|temp)\.[^.]+$`)
+
+// findOutputFile ищет итоговый файл с заданным префиксом, пропуская служебные файлы yt-dlp
+func findOutputFile(dir, prefix string) (string, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("не удалось прочитать папку загрузок: %v", err)
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, prefix+".") {
+			continue
+		}
+		if isPartialFile(name) || intermediateFile.MatchString(name) {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".webp", ".jpg", ".png", ".json":
+			continue
+		}
+		log.Printf("🎯 Найден файл %s: %s", prefix, name)
+		return filepath.Join(dir, name), nil
+	}
+
+	return "", fmt.Errorf("не найден скачанный файл %s", prefix)
+}
+
+// downloadAttemptTimeout - время на одну попытку скачивания, если большие форматы не режутся на части
+const downloadAttemptTimeout = 3 * time.Minute
+
+// downloadRetryDelay - базовая задержка перед повторной попыткой скачивания
+var downloadRetryDelay = 5 * time.Second
+
+// downloadWithRetry скачивает req с повторной попыткой. Если limitAttempt, каждая попытка
+// ограничена downloadAttemptTimeout; файлы больше лимита Telegram (их режут на части) качаются
+// дольше любого разумного лимита - их останавливает только отмена задачи. При отмене ctx
+// возвращает ErrCancelled и убирает остатки попыток.
+func downloadWithRetry(ctx context.Context, downloader Downloader, req DownloadRequest, limitAttempt bool) (string, error) {
+	var videoFile string
+	err := utils.RetryWithBackoffContext(ctx, func() error {
+		attemptCtx := ctx
+		if limitAttempt {
+			var cancel context.CancelFunc
+			attemptCtx, cancel = context.WithTimeout(ctx, downloadAttemptTimeout)
+			defer cancel()
+		}
+
+		foundFile, err := downloader.Download(attemptCtx, req)
+		if err != nil {
+			return err
+		}
+		videoFile = foundFile
+		return nil
+	}, 2, downloadRetryDelay) // 2 повторные попытки
+
+	if err != nil && ctx.Err() != nil {
+		// Отмена могла прийти между попытками - убираем остатки предыдущей попытки
+		removeOutputFiles(req.OutputDir, req.FilePrefix)
+		return "", ErrCancelled
+	}
+	return videoFile, err
+}
+
+// removeOutputFiles удаляет все файлы с заданным префиксом (итоговые, .part, фрагменты)
+func removeOutputFiles(dir, prefix string) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasPrefix(file.Name(), prefix+".") {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		if err := os.Remove(path); err != nil {
+			log.Printf("⚠️ Не удалось удалить %s: %v", path, err)
+		} else {
+			debugf("🗑️ Удален файл: %s", path)
+		}
+	}
+}
+
+// isPartialFile проверяет, является ли файл недокачанным (.part, .ytdl)
+func isPartialFile(name string) bool {
+	return strings.HasSuffix(name, ".part") || strings.HasSuffix(name, ".ytdl") ||
+		strings.Contains(name, ".part-Frag")
+}
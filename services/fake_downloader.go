@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// FakeDownloader - фейковая реализация Downloader для проверок без сети.
+// Ответы берутся из каталога с фикстурами:
+//
+//	<name>.json              - ответ yt-dlp --dump-single-json
+//	<name>_<formatID>.<ext>  - медиафайл для конкретного формата
+//	<name>.<ext>             - медиафайл для любого формата
+//
+// где <name> - ID видео (плейлиста, канала) из URL по реестру платформ или последний сегмент пути.
+type FakeDownloader struct {
+	FixtureDir string
+
+	// Errors позволяет заставить метод вернуть ошибку: ключи "probe", "download", "playlist"
+	Errors map[string]error
+
+	mu    sync.Mutex
+	calls []string
+}
+
+// NewFakeDownloader создает фейковый Downloader с фикстурами из fixtureDir
+func NewFakeDownloader(fixtureDir string) *FakeDownloader {
+	return &FakeDownloader{
+		FixtureDir: fixtureDir,
+		Errors:     make(map[string]error),
+	}
+}
+
+// Calls возвращает журнал вызовов в виде "метод url"
+func (f *FakeDownloader) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// record записывает вызов и возвращает заданную для метода ошибку
+func (f *FakeDownloader) record(method, url string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, method+" "+url)
+	return f.Errors[method]
+}
+
+// Probe читает <name>.json из каталога фикстур
+func (f *FakeDownloader) Probe(ctx context.Context, url string, args ...string) (*VideoInfo, error) {
+	if err := f.record("probe", url); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(f.FixtureDir, fixtureName(url)+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("фикстура для %s не найдена: %v", url, err)
+	}
+	raw, err := parseYtDlpInfo(data)
+	if err != nil {
+		return nil, err
+	}
+	return raw.videoInfo(url), nil
+}
+
+// ListFormats возвращает все форматы из фикстуры
+func (f *FakeDownloader) ListFormats(ctx context.Context, url string) ([]VideoFormat, error) {
+	info, err := f.Probe(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return info.AllFormats, nil
+}
+
+// Metadata возвращает метаданные из фикстуры
+func (f *FakeDownloader) Metadata(ctx context.Context, url string) (*VideoMetadata, error) {
+	info, err := f.Probe(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return info.Metadata, nil
+}
+
+// Playlist читает <name>.json с записями плейлиста (entries) из каталога фикстур
+func (f *FakeDownloader) Playlist(ctx context.Context, url string, limit int) (*Playlist, error) {
+	if err := f.record("playlist", url); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(f.FixtureDir, fixtureName(url)+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("фикстура для %s не найдена: %v", url, err)
+	}
+	raw, err := parseYtDlpInfo(data)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(raw.Entries) > limit {
+		raw.Entries = raw.Entries[:limit]
+	}
+	return raw.playlist(url), nil
+}
+
+// Download копирует медиафикстуру в OutputDir под именем FilePrefix.<ext>
+func (f *FakeDownloader) Download(ctx context.Context, req DownloadRequest) (string, error) {
+	if err := f.record("download", req.URL); err != nil {
+		return "", err
+	}
+	if ctx.Err() != nil {
+		return "", ErrCancelled
+	}
+
+	source, err := f.findMedia(fixtureName(req.URL), req.FilePrefix)
+	if err != nil {
+		return "", err
+	}
+
+	if req.Progress != nil {
+		if stat, err := os.Stat(source); err == nil {
+			req.Progress(DownloadProgress{Status: ProgressDownloading, TotalBytes: stat.Size()})
+			req.Progress(DownloadProgress{Status: ProgressFinished, Percent: 100, DownloadedBytes: stat.Size(), TotalBytes: stat.Size()})
+		}
+	}
+
+	if err := os.MkdirAll(req.OutputDir, 0755); err != nil {
+		return "", fmt.Errorf("не удалось создать папку для загрузок: %v", err)
+	}
+	target := filepath.Join(req.OutputDir, req.FilePrefix+filepath.Ext(source))
+	if err := copyFile(source, target); err != nil {
+		return "", fmt.Errorf("ошибка копирования фикстуры: %v", err)
+	}
+
+	log.Printf("🧪 Фейковое скачивание %s -> %s", req.URL, target)
+	return target, nil
+}
+
+// findMedia ищет медиафикстуру сначала для формата, затем общую для видео
+func (f *FakeDownloader) findMedia(name, prefix string) (string, error) {
+	for _, pattern := range []string{prefix + ".*", name + ".*"} {
+		matches, _ := filepath.Glob(filepath.Join(f.FixtureDir, pattern))
+		for _, match := range matches {
+			if filepath.Ext(match) != ".json" {
+				return match, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("медиафикстура для %s не найдена", name)
+}
+
+// fixtureNamePattern оставляет в имени фикстуры только безопасные символы
+var fixtureNamePattern = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// fixtureName определяет имя фикстуры по URL
+func fixtureName(url string) string {
+	if videoID := extractVideoID(url); videoID != "" {
+		return videoID
+	}
+	if info := NewPlatformDetector().DetectPlatform(url); info.Supported {
+		return fixtureNamePattern.ReplaceAllString(info.VideoID, "_")
+	}
+	url = strings.TrimRight(strings.SplitN(url, "?", 2)[0], "/")
+	return fixtureNamePattern.ReplaceAllString(url[strings.LastIndex(url, "/")+1:], "_")
+}
+
+// copyFile копирует файл src в dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,322 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	neturl "net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PlatformGeneric - сайт не из реестра платформ: платформу и ID видео определяет yt-dlp
+const PlatformGeneric PlatformType = "generic"
+
+// genericResolvedLimit - сколько разобранных через yt-dlp ссылок помнит UniversalService
+const genericResolvedLimit = 1000
+
+// genericExtractorArgs запрещает yt-dlp универсальный экстрактор "Generic": ссылки
+// с произвольных сайтов разбирают только экстракторы конкретных сайтов
+var genericExtractorArgs = []string{"--use-extractors", "default,-generic"}
+
+// genericIDPattern оставляет в ID от yt-dlp только символы, безопасные для имени файла
+var genericIDPattern = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// DomainList - списки доменов для универсального извлечения, которыми управляет администратор.
+// Запрет важнее разрешения, поддомены наследуют правило домена, "*" среди разрешенных
+// открывает все домены, кроме запрещенных.
+type DomainList struct {
+	mu    sync.RWMutex
+	allow map[string]bool
+	deny  map[string]bool
+	cache *CacheService // Хранилище правил администратора (nil - только в памяти)
+}
+
+// NewDomainList создает списки доменов: allow и deny из конфигурации, поверх них - правила
+// администратора из cache
+func NewDomainList(cache *CacheService, allow, deny []string) (*DomainList, error) {
+	l := &DomainList{
+		allow: make(map[string]bool),
+		deny:  make(map[string]bool),
+		cache: cache,
+	}
+	for _, domain := range allow {
+		if domain = NormalizeDomain(domain); domain != "" {
+			l.allow[domain] = true
+		}
+	}
+	for _, domain := range deny {
+		if domain = NormalizeDomain(domain); domain != "" {
+			l.deny[domain] = true
+		}
+	}
+
+	if cache != nil {
+		domains, err := cache.GetGenericDomains()
+		if err != nil {
+			return nil, err
+		}
+		for domain, allowed := range domains {
+			l.set(domain, allowed)
+		}
+	}
+	return l, nil
+}
+
+// set переносит домен в список разрешенных или запрещенных (вызывается под mu или при создании)
+func (l *DomainList) set(domain string, allowed bool) {
+	delete(l.allow, domain)
+	delete(l.deny, domain)
+	if allowed {
+		l.allow[domain] = true
+	} else {
+		l.deny[domain] = true
+	}
+}
+
+// Allow разрешает домен (и его поддомены)
+func (l *DomainList) Allow(domain string) error {
+	return l.update(domain, true)
+}
+
+// Deny запрещает домен (и его поддомены)
+func (l *DomainList) Deny(domain string) error {
+	return l.update(domain, false)
+}
+
+// update сохраняет правило для домена
+func (l *DomainList) update(domain string, allowed bool) error {
+	normalized := NormalizeDomain(domain)
+	if normalized == "" || (normalized == "*" && !allowed) {
+		return fmt.Errorf("некорректный домен: %s", domain)
+	}
+	if l.cache != nil {
+		if err := l.cache.SetGenericDomain(normalized, allowed); err != nil {
+			return err
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.set(normalized, allowed)
+	return nil
+}
+
+// Remove убирает домен из обоих списков; false - домена в списках не было.
+// Домены из конфигурации вернутся после перезапуска.
+func (l *DomainList) Remove(domain string) (bool, error) {
+	normalized := NormalizeDomain(domain)
+	if normalized == "" {
+		return false, fmt.Errorf("некорректный домен: %s", domain)
+	}
+	removed := false
+	if l.cache != nil {
+		deleted, err := l.cache.DeleteGenericDomain(normalized)
+		if err != nil {
+			return false, err
+		}
+		removed = deleted
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.allow[normalized] || l.deny[normalized] {
+		removed = true
+	}
+	delete(l.allow, normalized)
+	delete(l.deny, normalized)
+	return removed, nil
+}
+
+// Allowed проверяет, можно ли отдавать yt-dlp ссылки с хоста host. Хост, который указывает
+// на саму машину или внутреннюю сеть (в том числе через DNS), не разрешается никогда.
+func (l *DomainList) Allowed(host string) bool {
+	domain := NormalizeDomain(host)
+	if domain == "" || domain == "*" {
+		return false
+	}
+
+	l.mu.RLock()
+	allowed := !matchDomain(l.deny, domain) && (l.allow["*"] || matchDomain(l.allow, domain))
+	l.mu.RUnlock()
+
+	// Адреса проверяем только у разрешенных доменов, чтобы не ходить в DNS зря
+	return allowed && !isPrivateHost(strings.ToLower(strings.Trim(host, "[]")))
+}
+
+// Domains возвращает отсортированные списки разрешенных и запрещенных доменов
+func (l *DomainList) Domains() (allow, deny []string) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for domain := range l.allow {
+		allow = append(allow, domain)
+	}
+	for domain := range l.deny {
+		deny = append(deny, domain)
+	}
+	sort.Strings(allow)
+	sort.Strings(deny)
+	return allow, deny
+}
+
+// matchDomain проверяет, что host или один из его родительских доменов есть в domains
+func matchDomain(domains map[string]bool, host string) bool {
+	for {
+		if domains[host] {
+			return true
+		}
+		dot := strings.Index(host, ".")
+		if dot < 0 {
+			return false
+		}
+		host = host[dot+1:]
+	}
+}
+
+// NormalizeDomain приводит домен, хост или ссылку к виду "example.com": без схемы, пути,
+// порта и "www."; "" - если это не похоже на домен
+func NormalizeDomain(input string) string {
+	domain := strings.ToLower(strings.TrimSpace(input))
+	if domain == "*" {
+		return domain
+	}
+	if i := strings.Index(domain, "://"); i >= 0 {
+		domain = domain[i+3:]
+	}
+	if i := strings.IndexAny(domain, "/?#"); i >= 0 {
+		domain = domain[:i]
+	}
+	if host, _, err := net.SplitHostPort(domain); err == nil {
+		domain = host
+	}
+	domain = strings.TrimPrefix(domain, "*.")
+	domain = strings.TrimPrefix(domain, "www.")
+	domain = strings.Trim(domain, ".[]")
+	if domain == "" || strings.ContainsAny(domain, " @\t") {
+		return ""
+	}
+	return domain
+}
+
+// hostLookupTimeout - сколько ждем DNS при проверке адресов хоста
+const hostLookupTimeout = 5 * time.Second
+
+// lookupHostIPs возвращает адреса хоста (переменная - чтобы подменять DNS в проверках)
+var lookupHostIPs = func(host string) ([]net.IP, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), hostLookupTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+	}
+	return ips, nil
+}
+
+// isPrivateHost проверяет, что хост указывает на саму машину или внутреннюю сеть: по имени,
+// по IP в ссылке или по любому из адресов в DNS. Хост, который не удалось разрешить, тоже
+// считается внутренним - проверить его адрес нельзя.
+func isPrivateHost(host string) bool {
+	if host == "" || host == "localhost" || strings.HasSuffix(host, ".localhost") || strings.HasSuffix(host, ".local") || strings.HasSuffix(host, ".internal") {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return isPrivateIP(ip)
+	}
+
+	ips, err := lookupHostIPs(host)
+	if err != nil || len(ips) == 0 {
+		debugf("⚠️ Не удалось разрешить %s: %v", host, err)
+		return true
+	}
+	for _, ip := range ips {
+		if isPrivateIP(ip) {
+			log.Printf("🚫 Хост %s указывает на внутренний адрес %s", host, ip)
+			return true
+		}
+	}
+	return false
+}
+
+// isPrivateIP проверяет, что адрес - loopback, внутренняя сеть, link-local (в том числе
+// 169.254.169.254 облачных метаданных) или неуказанный адрес
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
+
+// linkHost возвращает хост http(s) ссылки или "" для остальных ссылок
+func linkHost(url string) string {
+	parsed, err := neturl.Parse(strings.TrimSpace(url))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return ""
+	}
+	return parsed.Hostname()
+}
+
+// genericPlatform - платформа ссылки, разобранной через yt-dlp: название - ключ экстрактора,
+// пространство кэша - ключ экстрактора в нижнем регистре
+type genericPlatform struct {
+	regexPlatform
+	namespace string
+	url       string
+}
+
+// CanonicalURL возвращает исходную ссылку: шаблона ссылок для произвольного сайта нет
+func (p *genericPlatform) CanonicalURL(string) string { return p.url }
+
+// CacheNamespace возвращает пространство кэша экстрактора
+func (p *genericPlatform) CacheNamespace() string { return p.namespace }
+
+// newGenericPlatformInfo описывает ссылку, которую yt-dlp еще не разбирал: ID неизвестен
+func newGenericPlatformInfo(url, host string) *PlatformInfo {
+	platform := &genericPlatform{
+		regexPlatform: regexPlatform{platformType: PlatformGeneric, displayName: host, icon: "🌐", ytDlpArgs: genericExtractorArgs},
+		namespace:     string(PlatformGeneric),
+		url:           url,
+	}
+	return &PlatformInfo{
+		Type:           PlatformGeneric,
+		DisplayName:    host,
+		Icon:           "🌐",
+		Supported:      true,
+		Platform:       platform,
+		CacheNamespace: platform.namespace,
+	}
+}
+
+// resolvedGenericPlatformInfo описывает ссылку по ответу yt-dlp. Подходят только сайты
+// со своим экстрактором: универсальный экстрактор "Generic" скачал бы любой медиафайл
+// со страницы, поэтому такие ссылки отклоняются.
+func resolvedGenericPlatformInfo(url string, info *VideoInfo) (*PlatformInfo, error) {
+	extractor := info.ExtractorKey
+	if extractor == "" || strings.EqualFold(extractor, "Generic") {
+		return nil, fmt.Errorf("для этого сайта нет экстрактора yt-dlp")
+	}
+	videoID := genericIDPattern.ReplaceAllString(info.ID, "_")
+	if videoID == "" {
+		return nil, fmt.Errorf("yt-dlp не вернул ID видео")
+	}
+	namespace := strings.ToLower(extractor)
+
+	platform := &genericPlatform{
+		regexPlatform: regexPlatform{platformType: PlatformGeneric, displayName: extractor, icon: "🌐", ytDlpArgs: genericExtractorArgs},
+		namespace:     namespace,
+		url:           url,
+	}
+	return &PlatformInfo{
+		Type:           PlatformGeneric,
+		VideoID:        videoID,
+		DisplayName:    extractor,
+		Icon:           "🌐",
+		Supported:      true,
+		Platform:       platform,
+		CacheNamespace: namespace,
+	}, nil
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// stubDNS подменяет DNS на таблицу адресов до конца теста
+func stubDNS(t *testing.T, table map[string]string) {
+	t.Helper()
+	original := lookupHostIPs
+	lookupHostIPs = func(host string) ([]net.IP, error) {
+		if addr, ok := table[host]; ok {
+			return []net.IP{net.ParseIP(addr)}, nil
+		}
+		return nil, fmt.Errorf("no such host %s", host)
+	}
+	t.Cleanup(func() { lookupHostIPs = original })
+}
+
+func TestIsPrivateHost(t *testing.T) {
+	stubDNS(t, map[string]string{
+		"public.example":   "93.184.216.34",
+		"loopback.example": "127.0.0.1",
+		"intranet.example": "10.1.2.3",
+		"metadata.example": "169.254.169.254",
+	})
+
+	tests := map[string]bool{
+		"public.example":   false,
+		"93.184.216.34":    false,
+		"loopback.example": true,
+		"intranet.example": true,
+		"metadata.example": true,
+		"unknown.example":  true,
+		"localhost":        true,
+		"printer.local":    true,
+		"127.0.0.1":        true,
+		"192.168.1.1":      true,
+		"169.254.169.254":  true,
+		"::1":              true,
+		"0.0.0.0":          true,
+	}
+	for host, want := range tests {
+		if got := isPrivateHost(host); got != want {
+			t.Errorf("isPrivateHost(%s) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestDomainListAllowed(t *testing.T) {
+	stubDNS(t, map[string]string{
+		"example.com":      "93.184.216.34",
+		"www.example.com":  "93.184.216.34",
+		"cdn.example.com":  "93.184.216.35",
+		"bad.example.com":  "93.184.216.36",
+		"other.org":        "93.184.216.37",
+		"rebind.other.org": "127.0.0.1",
+	})
+
+	list, err := NewDomainList(nil, []string{"example.com"}, []string{"bad.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"example.com":      true,
+		"www.example.com":  true,
+		"cdn.example.com":  true,
+		"bad.example.com":  false,
+		"other.org":        false,
+		"rebind.other.org": false,
+	}
+	for host, want := range tests {
+		if got := list.Allowed(host); got != want {
+			t.Errorf("Allowed(%s) = %v, want %v", host, got, want)
+		}
+	}
+
+	// "*" открывает все домены, но не внутренние адреса
+	if err := list.Allow("*"); err != nil {
+		t.Fatal(err)
+	}
+	if !list.Allowed("other.org") {
+		t.Error("other.org should be allowed by *")
+	}
+	if list.Allowed("rebind.other.org") {
+		t.Error("host resolving to 127.0.0.1 must stay blocked with *")
+	}
+	if list.Allowed("bad.example.com") {
+		t.Error("deny must win over *")
+	}
+}
+
+func TestResolvedGenericRejectsGenericExtractor(t *testing.T) {
+	url := "https://www.dailymotion.com/video/x8abcde"
+	for _, extractor := range []string{"", "Generic", "generic"} {
+		if _, err := resolvedGenericPlatformInfo(url, &VideoInfo{ID: "x8abcde", ExtractorKey: extractor}); err == nil {
+			t.Errorf("extractor %q: expected error", extractor)
+		}
+	}
+
+	info, err := resolvedGenericPlatformInfo(url, &VideoInfo{ID: "x8abcde", ExtractorKey: "Dailymotion"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.CacheNamespace != "dailymotion" || info.VideoID != "x8abcde" || info.DisplayName != "Dailymotion" {
+		t.Errorf("info = %+v", info)
+	}
+	if got := info.Platform.YtDlpArgs(); !reflect.DeepEqual(got, genericExtractorArgs) {
+		t.Errorf("yt-dlp args = %v, want %v", got, genericExtractorArgs)
+	}
+}
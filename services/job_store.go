@@ -0,0 +1,186 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// maxJobAttempts - сколько раз задача может быть прервана перезапуском, прежде чем считаться проваленной
+const maxJobAttempts = 2
+
+// finishedJobsRetention - сколько хранятся записи о завершенных задачах
+const finishedJobsRetention = 7 * 24 * time.Hour
+
+// JobStore хранит задачи очереди загрузок в SQLite, чтобы они переживали перезапуск бота
+type JobStore struct {
+	db *sql.DB
+}
+
+// NewJobStore открывает (или создает) download_queue.db в каталоге dir - рядом с video_cache.db
+func NewJobStore(dir string) (*JobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("ошибка создания директории очереди: %v", err)
+	}
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "download_queue.db"))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия БД очереди: %v", err)
+	}
+	// SQLite не любит параллельные записи - используем одно соединение
+	db.SetMaxOpenConns(1)
+
+	if err := createJobsTable(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ошибка создания таблицы очереди: %v", err)
+	}
+
+	store := &JobStore{db: db}
+	if removed, err := store.pruneFinished(time.Now().Add(-finishedJobsRetention)); err != nil {
+		log.Printf("⚠️ Не удалось очистить старые задачи: %v", err)
+	} else if removed > 0 {
+		log.Printf("🧹 Удалено старых задач из истории очереди: %d", removed)
+	}
+
+	return store, nil
+}
+
+// createJobsTable создает таблицу задач
+func createJobsTable(db *sql.DB) error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS download_jobs (
+		id TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		chat_id INTEGER NOT NULL,
+		video_url TEXT NOT NULL,
+		format_id TEXT NOT NULL,
+		resolution TEXT NOT NULL DEFAULT '',
+		priority INTEGER NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		result TEXT NOT NULL DEFAULT '',
+		error TEXT NOT NULL DEFAULT '',
+		batch_id TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_download_jobs_status ON download_jobs(status);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Колонка batch_id появилась вместе с пакетными загрузками, resolution - когда разрешение
+	// стали передавать с выбором формата. Добавляем их в старые базы
+	for _, column := range []string{"batch_id", "resolution"} {
+		var count int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('download_jobs') WHERE name=?`, column).Scan(&count); err != nil {
+			return fmt.Errorf("ошибка проверки колонки %s: %v", column, err)
+		}
+		if count == 0 {
+			if _, err := db.Exec(`ALTER TABLE download_jobs ADD COLUMN ` + column + ` TEXT NOT NULL DEFAULT ''`); err != nil {
+				return fmt.Errorf("ошибка добавления колонки %s: %v", column, err)
+			}
+			log.Printf("✅ Колонка %s добавлена в таблицу очереди", column)
+		}
+	}
+	return nil
+}
+
+// Save сохраняет новую задачу
+func (js *JobStore) Save(job *DownloadJob) error {
+	_, err := js.db.Exec(`
+	INSERT INTO download_jobs (id, user_id, chat_id, video_url, format_id, resolution, priority, status, attempts, batch_id, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, job.ID, job.UserID, job.ChatID, job.VideoURL, job.FormatID, job.Resolution, job.Priority, string(job.Status), job.Attempts, job.BatchID, job.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения задачи %s: %v", job.ID, err)
+	}
+	return nil
+}
+
+// MarkStarted отмечает, что воркер взял задачу, и увеличивает счетчик попыток
+func (js *JobStore) MarkStarted(jobID string) error {
+	_, err := js.db.Exec(`
+	UPDATE download_jobs SET status = ?, attempts = attempts + 1, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`, string(JobStatusProcessing), jobID)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления задачи %s: %v", jobID, err)
+	}
+	return nil
+}
+
+// UpdateStatus сохраняет новый статус задачи вместе с результатом или ошибкой
+func (js *JobStore) UpdateStatus(jobID string, status JobStatus, result string, jobErr error) error {
+	var errText string
+	if jobErr != nil {
+		errText = jobErr.Error()
+	}
+	_, err := js.db.Exec(`
+	UPDATE download_jobs SET status = ?, result = ?, error = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`, string(status), result, errText, jobID)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления задачи %s: %v", jobID, err)
+	}
+	return nil
+}
+
+// Delete удаляет задачу (например, не попавшую в очередь)
+func (js *JobStore) Delete(jobID string) error {
+	if _, err := js.db.Exec(`DELETE FROM download_jobs WHERE id = ?`, jobID); err != nil {
+		return fmt.Errorf("ошибка удаления задачи %s: %v", jobID, err)
+	}
+	return nil
+}
+
+// LoadUnfinished возвращает задачи, которые ждали или выполнялись при остановке бота
+func (js *JobStore) LoadUnfinished() ([]*DownloadJob, error) {
+	rows, err := js.db.Query(`
+	SELECT id, user_id, chat_id, video_url, format_id, resolution, priority, status, attempts, result, error, batch_id, created_at
+	FROM download_jobs WHERE status IN (?, ?) ORDER BY created_at
+	`, string(JobStatusPending), string(JobStatusProcessing))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки задач: %v", err)
+	}
+	defer rows.Close()
+
+	var jobs []*DownloadJob
+	for rows.Next() {
+		var job DownloadJob
+		var status, errText string
+		if err := rows.Scan(&job.ID, &job.UserID, &job.ChatID, &job.VideoURL, &job.FormatID, &job.Resolution, &job.Priority,
+			&status, &job.Attempts, &job.Result, &errText, &job.BatchID, &job.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения задачи: %v", err)
+		}
+		job.Status = JobStatus(status)
+		if errText != "" {
+			job.Error = errors.New(errText)
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, rows.Err()
+}
+
+// pruneFinished удаляет завершенные задачи, обновленные раньше before
+func (js *JobStore) pruneFinished(before time.Time) (int64, error) {
+	result, err := js.db.Exec(`
+	DELETE FROM download_jobs WHERE status NOT IN (?, ?) AND updated_at < ?
+	`, string(JobStatusPending), string(JobStatusProcessing), before.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Close закрывает базу данных
+func (js *JobStore) Close() error {
+	return js.db.Close()
+}
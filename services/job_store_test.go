@@ -0,0 +1,198 @@
+package services
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// seedJob сохраняет задачу в хранилище в заданном статусе и с заданным числом попыток
+func seedJob(t *testing.T, store *JobStore, id string, status JobStatus, attempts int) {
+	t.Helper()
+	job := &DownloadJob{
+		ID:        id,
+		UserID:    1,
+		ChatID:    1,
+		VideoURL:  "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+		FormatID:  "18",
+		Priority:  PriorityNormal,
+		CreatedAt: time.Now(),
+		Status:    JobStatusPending,
+	}
+	if err := store.Save(job); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < attempts; i++ {
+		if err := store.MarkStarted(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if status != JobStatusProcessing && status != JobStatusPending {
+		if err := store.UpdateStatus(id, status, "", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// unfinishedIDs возвращает ID незавершенных задач хранилища
+func unfinishedIDs(t *testing.T, store *JobStore) []string {
+	t.Helper()
+	jobs, err := store.LoadUnfinished()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, job := range jobs {
+		ids = append(ids, job.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestJobStoreRoundTrip(t *testing.T) {
+	store, err := NewJobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	job := &DownloadJob{
+		ID:         "job_1",
+		UserID:     7,
+		ChatID:     8,
+		VideoURL:   "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+		FormatID:   "137",
+		Resolution: "1920x1080",
+		Priority:   8,
+		CreatedAt:  time.Now(),
+		Status:     JobStatusPending,
+		BatchID:    "batch_1",
+	}
+	if err := store.Save(job); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.MarkStarted(job.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := store.LoadUnfinished()
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("LoadUnfinished = %v, %v", jobs, err)
+	}
+	got := jobs[0]
+	if got.UserID != 7 || got.ChatID != 8 || got.VideoURL != job.VideoURL || got.FormatID != "137" ||
+		got.Resolution != "1920x1080" || got.Priority != 8 || got.BatchID != "batch_1" {
+		t.Errorf("loaded job = %+v", got)
+	}
+	if got.Status != JobStatusProcessing || got.Attempts != 1 {
+		t.Errorf("after MarkStarted: status %s, attempts %d", got.Status, got.Attempts)
+	}
+
+	if err := store.UpdateStatus(job.ID, JobStatusCompleted, "/tmp/video.mp4", nil); err != nil {
+		t.Fatal(err)
+	}
+	if ids := unfinishedIDs(t, store); len(ids) != 0 {
+		t.Errorf("completed job reloaded: %v", ids)
+	}
+}
+
+func TestDownloadQueueRestore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewJobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seedJob(t, store, "pending", JobStatusPending, 0)
+	seedJob(t, store, "interrupted", JobStatusProcessing, 1)
+	seedJob(t, store, "exhausted", JobStatusProcessing, maxJobAttempts)
+	seedJob(t, store, "completed", JobStatusCompleted, 1)
+	seedJob(t, store, "failed", JobStatusFailed, 1)
+	seedJob(t, store, "cancelled", JobStatusCancelled, 0)
+
+	queue, _ := newTestQueue(t, NewFakeDownloader(fixtureDir), 1)
+	queue.SetJobStore(store)
+	resumed, failed, err := queue.Restore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var resumedIDs, failedIDs []string
+	for _, job := range resumed {
+		resumedIDs = append(resumedIDs, job.ID)
+		if queue.JobPosition(job.ID) == 0 {
+			t.Errorf("resumed job %s is not queued", job.ID)
+		}
+	}
+	for _, job := range failed {
+		failedIDs = append(failedIDs, job.ID)
+		if job.Status != JobStatusFailed || job.Error == nil {
+			t.Errorf("dropped job %s: status %s, error %v", job.ID, job.Status, job.Error)
+		}
+	}
+	sort.Strings(resumedIDs)
+	if want := []string{"interrupted", "pending"}; !reflect.DeepEqual(resumedIDs, want) {
+		t.Errorf("resumed %v, want %v", resumedIDs, want)
+	}
+	if want := []string{"exhausted"}; !reflect.DeepEqual(failedIDs, want) {
+		t.Errorf("failed %v, want %v", failedIDs, want)
+	}
+
+	// Отброшенная задача записана проваленной и после следующего перезапуска не вернется
+	store.Close()
+	store, err = NewJobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if ids, want := unfinishedIDs(t, store), []string{"interrupted", "pending"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("unfinished after restart %v, want %v", ids, want)
+	}
+}
+
+func TestDownloadQueueResumesJobInterruptedByStop(t *testing.T) {
+	dir := t.TempDir()
+	media := mediaFixtureDir(t, "dQw4w9WgXcQ")
+
+	// Первый запуск: задача прерывается остановкой посреди скачивания
+	store, err := NewJobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	downloader := &gateDownloader{FakeDownloader: NewFakeDownloader(media), release: make(chan struct{})}
+	queue, _ := newTestQueue(t, downloader, 1)
+	queue.SetJobStore(store)
+	queue.Start()
+	jobID, err := queue.AddJob(1, 1, "https://www.youtube.com/watch?v=dQw4w9WgXcQ", "18", "", PriorityNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitWaiters(t, downloadKey{platform: "youtube", videoID: "dQw4w9WgXcQ", formatID: "18"}, 1)
+	queue.Stop()
+	store.Close()
+
+	// Второй запуск: задача возвращается в очередь и выполняется
+	store, err = NewJobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	queue, _ = newTestQueue(t, NewFakeDownloader(media), 1)
+	queue.SetJobStore(store)
+	resumed, failed, err := queue.Restore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resumed) != 1 || resumed[0].ID != jobID || resumed[0].Attempts != 1 || len(failed) != 0 {
+		t.Fatalf("resumed %v, failed %v", resumed, failed)
+	}
+	queue.Start()
+	defer queue.Stop()
+
+	if event := waitJob(t, queue, jobID); event.Status != JobStatusCompleted {
+		t.Fatalf("resumed job: status %s, error %v", event.Status, event.Error)
+	}
+	if ids := unfinishedIDs(t, store); len(ids) != 0 {
+		t.Errorf("completed job still unfinished in the store: %v", ids)
+	}
+}
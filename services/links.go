@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// MaxMessageLinks - сколько ссылок из одного сообщения берем в работу
+const MaxMessageLinks = 10
+
+// Link - ссылка, найденная в сообщении, и фрагмент, заданный для нее
+type Link struct {
+	URL  string
+	Clip *TimeRange // nil - видео целиком
+}
+
+// messageLinkPattern находит ссылки в тексте: со схемой или без нее ("youtu.be/ID"),
+// во втором случае - только с путем, чтобы не принимать за ссылку "file.txt"
+var messageLinkPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"'«»]+|\b(?:[a-z0-9-]+\.)+[a-z]{2,}/[^\s<>"'«»]+`)
+
+// trackingParams - параметры ссылок, которые нужны только для статистики площадок
+var trackingParams = map[string]bool{
+	"si":             true,
+	"feature":        true,
+	"pp":             true,
+	"fbclid":         true,
+	"gclid":          true,
+	"igsh":           true,
+	"igshid":         true,
+	"is_from_webapp": true,
+	"sender_device":  true,
+	"ref_src":        true,
+	"ref_url":        true,
+	"_r":             true,
+	"_t":             true,
+}
+
+// shortLinkHosts - сервисы коротких ссылок: настоящий адрес узнаем по редиректу
+var shortLinkHosts = map[string]bool{
+	"vm.tiktok.com":     true,
+	"vt.tiktok.com":     true,
+	"on.soundcloud.com": true,
+	"t.co":              true,
+	"bit.ly":            true,
+	"tinyurl.com":       true,
+	"clck.ru":           true,
+	"vk.cc":             true,
+	"redd.it":           true,
+	"goo.gl":            true,
+}
+
+// shortLinkPaths - короткие ссылки на адресах самих платформ: "Поделиться" Reddit
+// (/r/sub/s/code) и TikTok (/t/code) ведут на видео редиректом
+var shortLinkPaths = joinPatterns(
+	compilePatterns([]string{"reddit.com"}, `^/r/[^/]+/s/`),
+	compilePatterns([]string{"tiktok.com"}, `^/t/`),
+)
+
+// shortLinkClient переходит по редиректам коротких ссылок, но не во внутреннюю сеть:
+// адрес проверяется и у каждого редиректа, и при самом подключении (после DNS).
+// Подключение прямое, без прокси: иначе проверялся бы адрес прокси. Не раскрытую
+// короткую ссылку yt-dlp раскроет сам.
+var shortLinkClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network, address string, c syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+					return fmt.Errorf("подключение к внутреннему адресу %s запрещено", host)
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 || isPrivateHost(strings.ToLower(req.URL.Hostname())) {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	},
+}
+
+// FindLinks находит ссылки в тексте сообщения (или подписи к медиа) и в скрытых ссылках
+// entityURLs (text_link). Пересланное сообщение приходит с тем же текстом и entities,
+// поэтому разбирается так же. Фрагмент задается текстом сразу после ссылки
+// ("https://youtu.be/ID 01:20-02:45"). Сеть не используется: короткие ссылки
+// раскрывает ResolveLinks.
+func FindLinks(text string, entityURLs []string) []Link {
+	var links []Link
+	seen := make(map[string]bool)
+	add := func(raw string, clip *TimeRange) {
+		link := withScheme(trimLinkPunctuation(raw))
+		if link == "" || seen[link] || len(links) >= MaxMessageLinks {
+			return
+		}
+		seen[link] = true
+		links = append(links, Link{URL: link, Clip: clip})
+	}
+
+	matches := messageLinkPattern.FindAllStringIndex(text, -1)
+	for i, match := range matches {
+		tailEnd := len(text)
+		if i+1 < len(matches) {
+			tailEnd = matches[i+1][0]
+		}
+		add(text[match[0]:match[1]], clipAfterLink(text[match[1]:tailEnd]))
+	}
+	for _, link := range entityURLs {
+		add(link, nil)
+	}
+	return links
+}
+
+// clipAfterLink разбирает фрагмент в тексте между ссылкой и следующей ссылкой:
+// весь текст ("01:20 - 02:45") или первое слово ("01:20-02:45 вот отсюда")
+func clipAfterLink(tail string) *TimeRange {
+	if clip, ok := ParseTimeRange(tail); ok {
+		return clip
+	}
+	if fields := strings.Fields(tail); len(fields) > 1 {
+		if clip, ok := ParseTimeRange(fields[0]); ok {
+			return clip
+		}
+	}
+	return nil
+}
+
+// trimLinkPunctuation убирает знаки препинания, которые прилипли к ссылке в тексте,
+// не трогая закрывающую скобку, если открывающая есть в самой ссылке
+func trimLinkPunctuation(link string) string {
+	for link != "" {
+		last := link[len(link)-1]
+		switch {
+		case strings.IndexByte(".,;:!?", last) >= 0:
+			link = link[:len(link)-1]
+		case last == ')' && strings.Count(link, "(") < strings.Count(link, ")"):
+			link = link[:len(link)-1]
+		case strings.HasSuffix(link, "…"):
+			link = strings.TrimSuffix(link, "…")
+		default:
+			return link
+		}
+	}
+	return link
+}
+
+// withScheme дополняет ссылку без схемы до https://
+func withScheme(link string) string {
+	if link == "" {
+		return ""
+	}
+	lower := strings.ToLower(link)
+	if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+		return link
+	}
+	if strings.Contains(link, "://") {
+		return ""
+	}
+	return "https://" + link
+}
+
+// ResolveLinks приводит найденные ссылки к каноническому виду (CanonicalizeLink), выносит
+// фрагмент из параметров t=, start=, end= и оставляет только ссылки, которые принимает
+// accept. Одно и то же видео, присланное разными ссылками, остается один раз.
+func ResolveLinks(ctx context.Context, links []Link, accept func(url string) bool) []Link {
+	var resolved []Link
+	seen := make(map[string]bool)
+	for _, link := range links {
+		url := ResolveShortLink(ctx, link.URL)
+		url, clip := stripRangeParams(url)
+		if link.Clip != nil {
+			// Фрагмент из текста важнее параметров ссылки
+			clip = link.Clip
+		}
+		url = CanonicalizeLink(url)
+		if seen[url] || (accept != nil && !accept(url)) {
+			continue
+		}
+		seen[url] = true
+		resolved = append(resolved, Link{URL: url, Clip: clip})
+	}
+	return resolved
+}
+
+// CanonicalizeLink убирает параметры отслеживания (si=, feature=, utm_*) и приводит ссылку
+// зарегистрированной платформы к ее канонической ссылке (m., music., embed, Shorts -
+// один адрес на видео), если та строится по ID
+func CanonicalizeLink(url string) string {
+	url = stripTrackingParams(url)
+	if p, id, ok := defaultRegistry.Detect(url); ok {
+		if canonical := p.CanonicalURL(id); canonical != "" {
+			return canonical
+		}
+	}
+	return url
+}
+
+// stripTrackingParams удаляет из ссылки параметры отслеживания
+func stripTrackingParams(url string) string {
+	parsed, err := neturl.Parse(url)
+	if err != nil || parsed.RawQuery == "" {
+		return url
+	}
+
+	query := parsed.Query()
+	removed := false
+	for key := range query {
+		if trackingParams[strings.ToLower(key)] || strings.HasPrefix(strings.ToLower(key), "utm_") {
+			query.Del(key)
+			removed = true
+		}
+	}
+	if !removed {
+		return url
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// isShortLink проверяет, что ссылка ведет на сервис коротких ссылок
+func isShortLink(url string) bool {
+	host, target, ok := splitLink(url)
+	if !ok {
+		return false
+	}
+	if shortLinkHosts[NormalizeDomain(host)] {
+		return true
+	}
+	for _, pattern := range shortLinkPaths {
+		if hostInDomains(host, pattern.domains) && pattern.path.MatchString(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveShortLink раскрывает короткую ссылку по редиректам. Остальные ссылки, а также
+// короткие, которые не удалось раскрыть, возвращаются без изменений.
+func ResolveShortLink(ctx context.Context, url string) string {
+	if !isShortLink(url) {
+		return url
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return url
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; youtubeBot)")
+	resp, err := shortLinkClient.Do(req)
+	if err != nil {
+		debugf("⚠️ Не удалось раскрыть короткую ссылку %s: %v", url, err)
+		return url
+	}
+	resp.Body.Close()
+
+	final := resp.Request.URL.String()
+	if final != url {
+		debugf("🔗 Короткая ссылка %s -> %s", url, final)
+	}
+	return final
+}
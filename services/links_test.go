@@ -0,0 +1,219 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindLinks(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		entities []string
+		want     []string
+		clips    []string // Фрагменты по порядку ссылок, "" - видео целиком
+	}{
+		{
+			name: "scheme, no scheme and trailing punctuation",
+			text: "Смотри https://youtu.be/dQw4w9WgXcQ, и еще vimeo.com/76979871.",
+			want: []string{"https://youtu.be/dQw4w9WgXcQ", "https://vimeo.com/76979871"},
+		},
+		{
+			name: "parentheses",
+			text: "(https://en.wikipedia.org/wiki/Go_(programming_language)) и (https://vimeo.com/76979871)",
+			want: []string{"https://en.wikipedia.org/wiki/Go_(programming_language)", "https://vimeo.com/76979871"},
+		},
+		{
+			name: "file names and addresses without a path are not links",
+			text: "file.txt example.com mailto:user@example.com",
+		},
+		{
+			name:  "clip after each link",
+			text:  "https://youtu.be/dQw4w9WgXcQ 01:20-02:45 вот отсюда\nhttps://vimeo.com/76979871 10 - 20",
+			want:  []string{"https://youtu.be/dQw4w9WgXcQ", "https://vimeo.com/76979871"},
+			clips: []string{"80-165", "10-20"},
+		},
+		{
+			name:     "entities and duplicates",
+			text:     "https://vimeo.com/76979871 https://vimeo.com/76979871",
+			entities: []string{"https://vimeo.com/76979871", "https://x.com/i/status/1723456789012345678"},
+			want:     []string{"https://vimeo.com/76979871", "https://x.com/i/status/1723456789012345678"},
+		},
+	}
+	for _, tt := range tests {
+		links := FindLinks(tt.text, tt.entities)
+		var got, clips []string
+		for _, link := range links {
+			got = append(got, link.URL)
+			clip := ""
+			if link.Clip != nil {
+				clip = link.Clip.Key()
+			}
+			clips = append(clips, clip)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: links %q, want %q", tt.name, got, tt.want)
+		}
+		if tt.clips != nil && !reflect.DeepEqual(clips, tt.clips) {
+			t.Errorf("%s: clips %q, want %q", tt.name, clips, tt.clips)
+		}
+	}
+}
+
+func TestFindLinksLimit(t *testing.T) {
+	var text []string
+	for i := 0; i < MaxMessageLinks+5; i++ {
+		text = append(text, fmt.Sprintf("https://vimeo.com/%d", 1000+i))
+	}
+	if links := FindLinks(strings.Join(text, " "), nil); len(links) != MaxMessageLinks {
+		t.Errorf("%d links, want %d", len(links), MaxMessageLinks)
+	}
+}
+
+func TestCanonicalizeLink(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://youtu.be/dQw4w9WgXcQ?si=abc", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"https://m.youtube.com/watch?v=dQw4w9WgXcQ&feature=share", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"https://www.youtube.com/shorts/abcdefghijk", "https://www.youtube.com/watch?v=abcdefghijk"},
+		{"https://www.youtube.com/playlist?list=PL123&si=abc", "https://www.youtube.com/playlist?list=PL123"},
+		{"https://www.instagram.com/reel/C0abcDEFghi/?igsh=xyz", "https://www.instagram.com/p/C0abcDEFghi/"},
+		{"https://twitter.com/NASA/status/1723456789012345678?s=20", "https://x.com/i/status/1723456789012345678"},
+		{"https://player.vimeo.com/video/76979871", "https://vimeo.com/76979871"},
+		{"https://www.reddit.com/r/aww/comments/17xyzab/dog/", "https://www.reddit.com/comments/17xyzab/"},
+		{"https://www.tiktok.com/@user/video/7301234567890123456?is_from_webapp=1", "https://www.tiktok.com/@/video/7301234567890123456"},
+		// Нераскрытую короткую ссылку оставляем как есть
+		{"https://vm.tiktok.com/ZMabc123/", "https://vm.tiktok.com/ZMabc123/"},
+		// Незарегистрированный сайт: только параметры отслеживания
+		{"https://example.com/video?id=1&utm_source=tg&fbclid=abc", "https://example.com/video?id=1"},
+		{"https://example.com/video?id=1", "https://example.com/video?id=1"},
+	}
+	for _, tt := range tests {
+		if got := CanonicalizeLink(tt.url); got != tt.want {
+			t.Errorf("CanonicalizeLink(%s) = %s, want %s", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestCanonicalizeLinkKeepsPlatformAndID(t *testing.T) {
+	// Каноническая ссылка любой платформы распознается той же платформой с тем же ID
+	for _, url := range []string{
+		"https://music.youtube.com/watch?v=dQw4w9WgXcQ&list=RD1",
+		"https://www.youtube.com/@natgeo/shorts",
+		"https://www.tiktok.com/@user/video/7301234567890123456",
+		"https://www.instagram.com/natgeo/p/C0abcDEFghi/",
+		"https://mobile.twitter.com/NASA/status/1723456789012345678",
+		"https://v.redd.it/b8w2k4z1yq0c1",
+		"https://soundcloud.com/artist/track-name?in=artist/sets/album",
+		"https://on.soundcloud.com/AbC12",
+		"https://www.twitch.tv/videos/1987654321",
+		"https://clips.twitch.tv/embed?parent=a.example&clip=FunnyClipName-abc",
+		"https://vk.com/videos-12345?z=video-12345_67890",
+		"https://vkvideo.ru/video123_456",
+	} {
+		detector := NewPlatformDetector()
+		want := detector.DetectPlatform(url)
+		if !want.Supported {
+			t.Fatalf("%s: not detected", url)
+		}
+		canonical := CanonicalizeLink(url)
+		got := detector.DetectPlatform(canonical)
+		if got.CacheNamespace != want.CacheNamespace || got.VideoID != want.VideoID {
+			t.Errorf("%s -> %s: detected %s/%s, want %s/%s", url, canonical, got.CacheNamespace, got.VideoID, want.CacheNamespace, want.VideoID)
+		}
+	}
+}
+
+func TestResolveLinks(t *testing.T) {
+	links := []Link{
+		{URL: "https://youtu.be/dQw4w9WgXcQ?si=abc&t=90"},
+		// То же видео другим адресом - остается одно
+		{URL: "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{URL: "https://vimeo.com/76979871", Clip: &TimeRange{Start: 10, End: 20}},
+		{URL: "https://example.com/page"},
+	}
+	accept := func(url string) bool { return !strings.Contains(url, "example.com") }
+
+	resolved := ResolveLinks(context.Background(), links, accept)
+	var got []string
+	for _, link := range resolved {
+		clip := "-"
+		if link.Clip != nil {
+			clip = link.Clip.Key()
+		}
+		got = append(got, link.URL+" "+clip)
+	}
+	want := []string{
+		"https://www.youtube.com/watch?v=dQw4w9WgXcQ 90-end",
+		"https://vimeo.com/76979871 10-20",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ResolveLinks = %q, want %q", got, want)
+	}
+}
+
+func TestIsShortLink(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://vm.tiktok.com/ZMabc123/", true},
+		{"https://www.tiktok.com/t/ZT8abc/", true},
+		{"https://www.reddit.com/r/aww/s/AbC123", true},
+		{"https://bit.ly/3abc", true},
+		{"https://www.bit.ly/3abc", true},
+		{"t.co/abc", true},
+		{"https://www.tiktok.com/@user/video/7301234567890123456", false},
+		{"https://www.reddit.com/r/aww/comments/17xyzab/dog/", false},
+		// Адрес платформы не в хосте ссылки
+		{"https://evil.example/www.tiktok.com/t/ZT8abc/", false},
+		{"https://evil.example/?u=reddit.com/r/aww/s/AbC123", false},
+		{"https://nottiktok.com/t/ZT8abc/", false},
+		{"https://reddit.com.evil.example/r/aww/s/AbC123", false},
+		{"https://bit.ly.evil.example/3abc", false},
+	}
+	for _, tt := range tests {
+		if got := isShortLink(tt.url); got != tt.want {
+			t.Errorf("isShortLink(%s) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestShortLinkClientRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// Подключение к 127.0.0.1 запрещено при самом соединении
+	resp, err := shortLinkClient.Get(server.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("request to a loopback server succeeded")
+	}
+	if !strings.Contains(err.Error(), "запрещено") {
+		t.Errorf("err = %v, want the private address guard", err)
+	}
+
+	// По редиректу во внутреннюю сеть клиент не идет, а во внешнюю - идет
+	stubDNS(t, map[string]string{"public.example": "93.184.216.34", "intranet.example": "10.0.0.5"})
+	for host, want := range map[string]error{
+		"127.0.0.1":        http.ErrUseLastResponse,
+		"localhost":        http.ErrUseLastResponse,
+		"intranet.example": http.ErrUseLastResponse,
+		"public.example":   nil,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "http://"+host+"/video", nil)
+		if err := shortLinkClient.CheckRedirect(req, nil); !errors.Is(err, want) && err != want {
+			t.Errorf("redirect to %s: err = %v, want %v", host, err, want)
+		}
+	}
+}
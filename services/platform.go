@@ -0,0 +1,285 @@
+package services
+
+import (
+	"fmt"
+	neturl "net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Platform описывает видеоплатформу: как узнать ее ссылку и как с нее скачивать.
+// Новая платформа - отдельный файл platform_<name>.go с реализацией Platform
+// и вызовом RegisterPlatform в init; детектор, валидация ссылок и скачивание
+// берут все сведения о платформе из реестра.
+type Platform interface {
+	// Type возвращает идентификатор платформы
+	Type() PlatformType
+	// DisplayName возвращает название платформы для пользователя
+	DisplayName() string
+	// Icon возвращает иконку платформы
+	Icon() string
+	// Match извлекает ID видео из ссылки; ok=false, если ссылка не этой платформы.
+	// Ссылка должна вести на хост платформы: адрес платформы в параметрах чужой ссылки не в счет
+	Match(url string) (id string, ok bool)
+	// CanonicalURL возвращает каноническую ссылку по ID видео ("" - по ID ее не построить)
+	CanonicalURL(id string) string
+	// YtDlpArgs возвращает дополнительные аргументы yt-dlp для скачивания (без --format)
+	YtDlpArgs() []string
+	// DefaultFormat возвращает --format, если пользователь не выбрал формат
+	DefaultFormat() string
+	// MaxFileSize возвращает максимальный размер скачиваемого файла в байтах
+	MaxFileSize() int64
+}
+
+// collectionPlatform реализуют платформы-списки (плейлист, канал): Match возвращает
+// ID списка, а не видео
+type collectionPlatform interface {
+	Collection() bool
+}
+
+// IsCollection проверяет, что платформа - список видео, а не одно видео
+func IsCollection(p Platform) bool {
+	collection, ok := p.(collectionPlatform)
+	return ok && collection.Collection()
+}
+
+// cacheNamespacer реализуют платформы, которые делят кэш с другой платформой
+// (например, Shorts хранятся вместе с обычными видео YouTube)
+type cacheNamespacer interface {
+	CacheNamespace() string
+}
+
+// CacheNamespace возвращает значение video_cache.platform для платформы (по умолчанию - ее тип)
+func CacheNamespace(p Platform) string {
+	if namespacer, ok := p.(cacheNamespacer); ok {
+		return namespacer.CacheNamespace()
+	}
+	return string(p.Type())
+}
+
+// audioOnlyPlatform реализуют платформы, с которых скачивается только звук (SoundCloud)
+type audioOnlyPlatform interface {
+	AudioOnly() bool
+}
+
+// IsAudioOnly проверяет, что у платформы нет видео и ссылку нужно сразу скачивать как аудио
+func IsAudioOnly(p Platform) bool {
+	audio, ok := p.(audioOnlyPlatform)
+	return ok && audio.AudioOnly()
+}
+
+// formatFilter реализуют платформы, которым нужно скрыть часть форматов из меню
+// (например, TikTok с водяным знаком)
+type formatFilter interface {
+	FilterFormats(formats []VideoFormat) []VideoFormat
+}
+
+// formatSelector реализуют платформы, которым нужен особый --format для выбранного
+// формата (например, Reddit отдает видео и звук отдельными потоками)
+type formatSelector interface {
+	FormatSelector(formatID string) string
+}
+
+// filterPlatformFormats применяет фильтр форматов платформы, если он есть
+func filterPlatformFormats(p Platform, formats []VideoFormat) []VideoFormat {
+	if filter, ok := p.(formatFilter); ok {
+		return filter.FilterFormats(formats)
+	}
+	return formats
+}
+
+// platformFormatSelector возвращает --format для выбранного видеоформата
+func platformFormatSelector(p Platform, formatID string) string {
+	if selector, ok := p.(formatSelector); ok {
+		return selector.FormatSelector(formatID)
+	}
+	return formatID
+}
+
+// PlatformRegistry - реестр платформ. Платформы проверяются в порядке регистрации.
+type PlatformRegistry struct {
+	mu        sync.RWMutex
+	platforms []Platform
+	byType    map[PlatformType]Platform
+}
+
+// NewPlatformRegistry создает пустой реестр платформ
+func NewPlatformRegistry() *PlatformRegistry {
+	return &PlatformRegistry{byType: make(map[PlatformType]Platform)}
+}
+
+// defaultRegistry - реестр, в который платформы регистрируются из init
+var defaultRegistry = NewPlatformRegistry()
+
+// RegisterPlatform добавляет платформу в общий реестр. Повторная регистрация типа - ошибка программы.
+func RegisterPlatform(p Platform) {
+	defaultRegistry.Register(p)
+}
+
+// Register добавляет платформу в реестр
+func (r *PlatformRegistry) Register(p Platform) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.byType[p.Type()]; exists {
+		panic(fmt.Sprintf("платформа %s уже зарегистрирована", p.Type()))
+	}
+	r.platforms = append(r.platforms, p)
+	r.byType[p.Type()] = p
+}
+
+// Detect находит платформу ссылки и ID видео (или списка)
+func (r *PlatformRegistry) Detect(url string) (Platform, string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, p := range r.platforms {
+		if id, ok := p.Match(url); ok {
+			return p, id, true
+		}
+	}
+	return nil, "", false
+}
+
+// Get возвращает платформу по типу
+func (r *PlatformRegistry) Get(platformType PlatformType) (Platform, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.byType[platformType]
+	return p, ok
+}
+
+// All возвращает зарегистрированные платформы в порядке регистрации
+func (r *PlatformRegistry) All() []Platform {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Platform(nil), r.platforms...)
+}
+
+// regexPlatform - платформа, ссылки которой распознаются шаблонами urlPattern
+// (ID видео - первая группа). Подходит большинству платформ; особое поведение
+// добавляется встраиванием regexPlatform в свой тип.
+type regexPlatform struct {
+	platformType  PlatformType
+	displayName   string
+	icon          string
+	patterns      []urlPattern
+	canonical     string   // Шаблон канонической ссылки с %s на месте ID
+	ytDlpArgs     []string // Дополнительные аргументы yt-dlp
+	defaultFormat string
+	maxFileSize   int64 // 0 - defaultMaxFileSize
+}
+
+// urlPattern - шаблон ссылки платформы: домены, на которых он действует, и регулярное
+// выражение для пути с параметрами ("/watch?v=ID")
+type urlPattern struct {
+	domains []string // Хост - сам домен или его поддомен
+	path    *regexp.Regexp
+}
+
+// defaultMaxFileSize - лимит размера файла по умолчанию (2 ГБ, --max-filesize 2G)
+const defaultMaxFileSize = 2 * 1024 * 1024 * 1024
+
+// Type возвращает идентификатор платформы
+func (p *regexPlatform) Type() PlatformType { return p.platformType }
+
+// DisplayName возвращает название платформы
+func (p *regexPlatform) DisplayName() string { return p.displayName }
+
+// Icon возвращает иконку платформы
+func (p *regexPlatform) Icon() string { return p.icon }
+
+// Match извлекает ID по первому шаблону, домен которого совпал с хостом ссылки
+func (p *regexPlatform) Match(url string) (string, bool) {
+	host, target, ok := splitLink(url)
+	if !ok {
+		return "", false
+	}
+	for _, pattern := range p.patterns {
+		if !hostInDomains(host, pattern.domains) {
+			continue
+		}
+		if matches := pattern.path.FindStringSubmatch(target); len(matches) > 1 && matches[1] != "" {
+			return matches[1], true
+		}
+	}
+	return "", false
+}
+
+// splitLink разбирает http(s) ссылку (схему можно не указывать) на хост в нижнем регистре
+// и путь с параметрами - то, по чему шаблоны платформ ищут ID
+func splitLink(url string) (host, target string, ok bool) {
+	parsed, err := neturl.Parse(withScheme(strings.TrimSpace(url)))
+	if err != nil || parsed.Host == "" {
+		return "", "", false
+	}
+	target = parsed.Path
+	if parsed.RawQuery != "" {
+		target += "?" + parsed.RawQuery
+	}
+	return strings.ToLower(parsed.Hostname()), target, true
+}
+
+// hostInDomains проверяет, что хост - один из доменов или их поддомен
+func hostInDomains(host string, domains []string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanonicalURL подставляет ID в шаблон канонической ссылки
+func (p *regexPlatform) CanonicalURL(id string) string {
+	return fmt.Sprintf(p.canonical, id)
+}
+
+// YtDlpArgs возвращает дополнительные аргументы yt-dlp
+func (p *regexPlatform) YtDlpArgs() []string {
+	return append([]string(nil), p.ytDlpArgs...)
+}
+
+// DefaultFormat возвращает --format по умолчанию
+func (p *regexPlatform) DefaultFormat() string {
+	if p.defaultFormat == "" {
+		return "best"
+	}
+	return p.defaultFormat
+}
+
+// MaxFileSize возвращает лимит размера файла
+func (p *regexPlatform) MaxFileSize() int64 {
+	if p.maxFileSize == 0 {
+		return defaultMaxFileSize
+	}
+	return p.maxFileSize
+}
+
+// compilePatterns компилирует шаблоны путей, которые действуют на доменах domains
+func compilePatterns(domains []string, patterns ...string) []urlPattern {
+	compiled := make([]urlPattern, len(patterns))
+	for i, pattern := range patterns {
+		compiled[i] = urlPattern{domains: domains, path: regexp.MustCompile(pattern)}
+	}
+	return compiled
+}
+
+// joinPatterns объединяет шаблоны разных доменов одной платформы
+func joinPatterns(groups ...[]urlPattern) []urlPattern {
+	var joined []urlPattern
+	for _, group := range groups {
+		joined = append(joined, group...)
+	}
+	return joined
+}
+
+// muxedAudioPlatform - платформа с раздельными потоками видео и звука (DASH): к выбранному
+// видеоформату докачивается лучший звук и склеивается в MP4
+type muxedAudioPlatform struct {
+	regexPlatform
+}
+
+// FormatSelector добавляет лучший звук, только если в выбранном формате его нет
+func (p *muxedAudioPlatform) FormatSelector(formatID string) string {
+	return formatID + "[acodec=none]+bestaudio/" + formatID
+}
@@ -0,0 +1,18 @@
+package services
+
+// PlatformInstagram - Reels и видео из постов Instagram
+const PlatformInstagram PlatformType = "instagram"
+
+func init() {
+	// Instagram отдает видео и звук отдельными DASH потоками
+	RegisterPlatform(&muxedAudioPlatform{regexPlatform{
+		platformType: PlatformInstagram,
+		displayName:  "Instagram",
+		icon:         "📸",
+		patterns: compilePatterns([]string{"instagram.com"},
+			`^/(?:[a-zA-Z0-9_.]+/)?(?:reels?|p|tv)/([a-zA-Z0-9_-]+)`,
+		),
+		canonical:     "https://www.instagram.com/p/%s/",
+		defaultFormat: "bestvideo+bestaudio/best",
+	}})
+}
@@ -0,0 +1,41 @@
+package services
+
+import "fmt"
+
+// PlatformReddit - видео Reddit (v.redd.it)
+const PlatformReddit PlatformType = "reddit"
+
+// redditPostIDMaxLen - ID поста Reddit (base36) короче ID ролика v.redd.it
+const redditPostIDMaxLen = 8
+
+// redditPlatform - Reddit: ID бывает ID поста или ID ролика v.redd.it
+type redditPlatform struct {
+	muxedAudioPlatform
+}
+
+// CanonicalURL возвращает ссылку на пост или на ролик v.redd.it
+func (p *redditPlatform) CanonicalURL(id string) string {
+	if len(id) <= redditPostIDMaxLen {
+		return fmt.Sprintf("https://www.reddit.com/comments/%s/", id)
+	}
+	return "https://v.redd.it/" + id
+}
+
+func init() {
+	// v.redd.it хранит видео без звука, звук - отдельная DASH дорожка
+	RegisterPlatform(&redditPlatform{muxedAudioPlatform{regexPlatform{
+		platformType: PlatformReddit,
+		displayName:  "Reddit",
+		icon:         "👽",
+		patterns: joinPatterns(
+			compilePatterns([]string{"reddit.com"},
+				`^/r/[^/]+/comments/([a-z0-9]+)`,
+				`^/comments/([a-z0-9]+)`,
+			),
+			compilePatterns([]string{"v.redd.it"},
+				`^/([a-zA-Z0-9]+)`,
+			),
+		),
+		defaultFormat: "bestvideo+bestaudio/best",
+	}}})
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+)
+
+// PlatformSoundCloud - треки SoundCloud (только звук)
+const PlatformSoundCloud PlatformType = "soundcloud"
+
+var (
+	// soundcloudTrackPattern - путь трека: /<автор>/<трек>
+	soundcloudTrackPattern = regexp.MustCompile(`^/([a-zA-Z0-9_-]+)/([a-zA-Z0-9_-]+)`)
+	// soundcloudShortPattern - путь короткой ссылки из приложения (on.soundcloud.com)
+	soundcloudShortPattern = regexp.MustCompile(`^/([a-zA-Z0-9]+)`)
+)
+
+// soundcloudPages - вторые сегменты пути, которые ведут не на трек, а на страницы автора
+var soundcloudPages = map[string]bool{
+	"sets": true, "albums": true, "tracks": true, "popular-tracks": true, "reposts": true,
+	"likes": true, "followers": true, "following": true, "comments": true, "spotlight": true,
+}
+
+// soundcloudPlatform - SoundCloud: ID трека - "<автор>.<трек>" (точки в именах не бывает,
+// а "/" в ID попал бы в путь файла)
+type soundcloudPlatform struct {
+	regexPlatform
+}
+
+// Match извлекает ID трека, пропуская плейлисты и страницы автора
+func (p *soundcloudPlatform) Match(url string) (string, bool) {
+	host, target, ok := splitLink(url)
+	if !ok {
+		return "", false
+	}
+	if host == "on.soundcloud.com" {
+		if matches := soundcloudShortPattern.FindStringSubmatch(target); matches != nil {
+			return matches[1], true
+		}
+		return "", false
+	}
+	if !hostInDomains(host, []string{"soundcloud.com"}) {
+		return "", false
+	}
+	matches := soundcloudTrackPattern.FindStringSubmatch(target)
+	if matches == nil || soundcloudPages[matches[2]] {
+		return "", false
+	}
+	return matches[1] + "." + matches[2], true
+}
+
+// CanonicalURL возвращает ссылку на трек (или короткую ссылку)
+func (p *soundcloudPlatform) CanonicalURL(id string) string {
+	if user, track, ok := strings.Cut(id, "."); ok {
+		return "https://soundcloud.com/" + user + "/" + track
+	}
+	return "https://on.soundcloud.com/" + id
+}
+
+// AudioOnly - на SoundCloud нет видео
+func (p *soundcloudPlatform) AudioOnly() bool { return true }
+
+func init() {
+	RegisterPlatform(&soundcloudPlatform{regexPlatform{
+		platformType:  PlatformSoundCloud,
+		displayName:   "SoundCloud",
+		icon:          "🎧",
+		defaultFormat: "bestaudio/best",
+	}})
+}
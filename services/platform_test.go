@@ -0,0 +1,193 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlatformMatchAndCanonicalURL(t *testing.T) {
+	tests := []struct {
+		url       string
+		platform  PlatformType
+		id        string
+		canonical string
+	}{
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", PlatformYouTube, "dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"https://m.youtube.com/watch?feature=share&v=dQw4w9WgXcQ", PlatformYouTube, "dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"https://youtu.be/dQw4w9WgXcQ?si=abc", PlatformYouTube, "dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"youtu.be/dQw4w9WgXcQ", PlatformYouTube, "dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"https://music.youtube.com/watch?v=dQw4w9WgXcQ&list=RD1", PlatformYouTube, "dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"HTTPS://WWW.YOUTUBE.COM/watch?v=dQw4w9WgXcQ", PlatformYouTube, "dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ", PlatformYouTube, "dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"https://www.youtube.com/live/dQw4w9WgXcQ", PlatformYouTube, "dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"https://www.youtube.com/shorts/abcdefghijk", PlatformYouTubeShorts, "abcdefghijk", "https://www.youtube.com/watch?v=abcdefghijk"},
+		{"https://www.youtube.com/playlist?list=PL123", PlatformYouTubePlaylist, "PL123", "https://www.youtube.com/playlist?list=PL123"},
+		{"https://www.youtube.com/@natgeo", PlatformYouTubeChannel, "@natgeo", "https://www.youtube.com/@natgeo/videos"},
+		{"https://www.youtube.com/channel/UCabc", PlatformYouTubeChannel, "UCabc", "https://www.youtube.com/channel/UCabc/videos"},
+		{"https://www.tiktok.com/@user/video/7301234567890123456", PlatformTikTok, "7301234567890123456", "https://www.tiktok.com/@/video/7301234567890123456"},
+		{"https://www.tiktok.com/@/video/7301234567890123456", PlatformTikTok, "7301234567890123456", "https://www.tiktok.com/@/video/7301234567890123456"},
+		// По коду короткой ссылки адрес видео не построить
+		{"https://vm.tiktok.com/ZMabc123/", PlatformTikTok, "ZMabc123", ""},
+		{"https://vt.tiktok.com/ZSabc123/", PlatformTikTok, "ZSabc123", ""},
+		{"https://www.tiktok.com/t/ZT8abc123/", PlatformTikTok, "ZT8abc123", ""},
+		{"https://www.instagram.com/reel/C0abcDEFghi/", PlatformInstagram, "C0abcDEFghi", "https://www.instagram.com/p/C0abcDEFghi/"},
+		{"https://www.instagram.com/natgeo/p/C0abcDEFghi/", PlatformInstagram, "C0abcDEFghi", "https://www.instagram.com/p/C0abcDEFghi/"},
+		{"https://x.com/NASA/status/1723456789012345678", PlatformTwitter, "1723456789012345678", "https://x.com/i/status/1723456789012345678"},
+		{"https://twitter.com/i/web/status/1723456789012345678", PlatformTwitter, "1723456789012345678", "https://x.com/i/status/1723456789012345678"},
+		{"https://mobile.twitter.com/NASA/status/1723456789012345678", PlatformTwitter, "1723456789012345678", "https://x.com/i/status/1723456789012345678"},
+		{"https://www.reddit.com/r/aww/comments/17xyzab/dog/", PlatformReddit, "17xyzab", "https://www.reddit.com/comments/17xyzab/"},
+		{"https://v.redd.it/b8w2k4z1yq0c1", PlatformReddit, "b8w2k4z1yq0c1", "https://v.redd.it/b8w2k4z1yq0c1"},
+		{"https://vimeo.com/76979871", PlatformVimeo, "76979871", "https://vimeo.com/76979871"},
+		{"https://player.vimeo.com/video/76979871", PlatformVimeo, "76979871", "https://vimeo.com/76979871"},
+		{"https://soundcloud.com/artist/track-name", PlatformSoundCloud, "artist.track-name", "https://soundcloud.com/artist/track-name"},
+		{"https://on.soundcloud.com/AbC12", PlatformSoundCloud, "AbC12", "https://on.soundcloud.com/AbC12"},
+		{"https://www.twitch.tv/videos/1987654321", PlatformTwitchVOD, "1987654321", "https://www.twitch.tv/videos/1987654321"},
+		{"https://clips.twitch.tv/FunnyClipName-abc", PlatformTwitchClip, "FunnyClipName-abc", "https://clips.twitch.tv/FunnyClipName-abc"},
+		{"https://vk.com/video-12345_67890", PlatformVK, "-12345_67890", "https://vk.com/video-12345_67890"},
+		{"https://vkvideo.ru/video123_456", PlatformVK, "123_456", "https://vk.com/video123_456"},
+		{"https://vk.com/videos-12345?z=video-12345_67890", PlatformVK, "-12345_67890", "https://vk.com/video-12345_67890"},
+		{"https://clips.twitch.tv/embed?parent=a.example&clip=FunnyClipName-abc", PlatformTwitchClip, "FunnyClipName-abc", "https://clips.twitch.tv/FunnyClipName-abc"},
+	}
+
+	for _, tt := range tests {
+		p, id, ok := defaultRegistry.Detect(tt.url)
+		if !ok {
+			t.Errorf("%s: not detected", tt.url)
+			continue
+		}
+		if p.Type() != tt.platform || id != tt.id {
+			t.Errorf("%s: got %s/%s, want %s/%s", tt.url, p.Type(), id, tt.platform, tt.id)
+		}
+		if got := p.CanonicalURL(id); got != tt.canonical {
+			t.Errorf("%s: CanonicalURL = %s, want %s", tt.url, got, tt.canonical)
+		}
+	}
+}
+
+func TestPlatformRejectsForeignURLs(t *testing.T) {
+	for _, url := range []string{
+		"https://soundcloud.com/artist/sets/album",
+		"https://soundcloud.com/artist/likes",
+		"https://www.youtube.com/watch?v=short",
+		"https://example.com/video/123",
+		// Похожие хосты
+		"https://nottiktok.com/@u/video/7301234567890123456",
+		"https://tiktok.com.evil.example/@u/video/7301234567890123456",
+		"https://fakeyoutube.com/watch?v=dQw4w9WgXcQ",
+		"https://youtu.be.evil.example/dQw4w9WgXcQ",
+		"https://myvimeo.com/76979871",
+		"https://notreddit.com/r/aww/comments/17xyzab/dog/",
+		"https://evilx.com/NASA/status/1723456789012345678",
+		"https://xsoundcloud.com/artist/track-name",
+		// Ссылка платформы в параметрах или пути чужой ссылки
+		"https://evil.example/?u=tiktok.com/@u/video/7301234567890123456",
+		"https://evil.example/redirect?to=https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+		"https://evil.example/vimeo.com/76979871",
+		"https://evil.example/#v.redd.it/b8w2k4z1yq0c1",
+		"https://evil.example/?z=vk.com/video-12345_67890",
+		"https://evil.example/www.twitch.tv/videos/1987654321",
+		"https://evil.example/?next=soundcloud.com/artist/track-name",
+		"https://evil.example/instagram.com/reel/C0abcDEFghi/",
+		// Не http(s)
+		"ftp://www.youtube.com/watch?v=dQw4w9WgXcQ",
+	} {
+		if p, id, ok := defaultRegistry.Detect(url); ok {
+			t.Errorf("%s: unexpectedly detected as %s/%s", url, p.Type(), id)
+		}
+	}
+}
+
+func TestPlatformCacheNamespace(t *testing.T) {
+	tests := map[string]string{
+		"https://www.youtube.com/shorts/abcdefghijk":       "youtube",
+		"https://www.twitch.tv/videos/1987654321":          "twitch",
+		"https://clips.twitch.tv/FunnyClipName-abc":        "twitch",
+		"https://vimeo.com/76979871":                       "vimeo",
+		"https://soundcloud.com/artist/track-name":         "soundcloud",
+		"https://www.reddit.com/r/aww/comments/17xyzab/x/": "reddit",
+	}
+	for url, want := range tests {
+		if got := NewPlatformDetector().DetectPlatform(url).CacheNamespace; got != want {
+			t.Errorf("%s: CacheNamespace = %s, want %s", url, got, want)
+		}
+	}
+}
+
+func TestPlatformFormatSelector(t *testing.T) {
+	tests := []struct {
+		platform PlatformType
+		formatID string
+		want     string
+	}{
+		{PlatformYouTube, "18", "18"},
+		{PlatformTikTok, "play_addr-0", "play_addr-0"},
+		{PlatformInstagram, "dash-699474565491011v", "dash-699474565491011v[acodec=none]+bestaudio/dash-699474565491011v"},
+		{PlatformReddit, "dash-video_720", "dash-video_720[acodec=none]+bestaudio/dash-video_720"},
+		{PlatformVimeo, "http-1080p", "http-1080p[acodec=none]+bestaudio/http-1080p"},
+	}
+	for _, tt := range tests {
+		p, ok := defaultRegistry.Get(tt.platform)
+		if !ok {
+			t.Fatalf("platform %s is not registered", tt.platform)
+		}
+		if got := platformFormatSelector(p, tt.formatID); got != tt.want {
+			t.Errorf("%s: selector(%s) = %s, want %s", tt.platform, tt.formatID, got, tt.want)
+		}
+	}
+}
+
+func TestPlatformFilterFormats(t *testing.T) {
+	tiktok, _ := defaultRegistry.Get(PlatformTikTok)
+	youtube, _ := defaultRegistry.Get(PlatformYouTube)
+
+	mixed := []VideoFormat{
+		{ID: "download_addr-0", Note: "watermarked"},
+		{ID: "play_addr-0", Note: "Direct video"},
+	}
+	onlyWatermarked := []VideoFormat{{ID: "download_addr-0", Note: "Watermarked"}}
+
+	tests := []struct {
+		name     string
+		platform Platform
+		formats  []VideoFormat
+		want     []string
+	}{
+		{"tiktok drops watermark", tiktok, mixed, []string{"play_addr-0"}},
+		{"tiktok keeps watermark if nothing else", tiktok, onlyWatermarked, []string{"download_addr-0"}},
+		{"youtube keeps everything", youtube, mixed, []string{"download_addr-0", "play_addr-0"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, format := range filterPlatformFormats(tt.platform, tt.formats) {
+			got = append(got, format.ID)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPlatformYtDlpArgs(t *testing.T) {
+	vod, _ := defaultRegistry.Get(PlatformTwitchVOD)
+	if got := vod.YtDlpArgs(); !reflect.DeepEqual(got, twitchVODArgs) {
+		t.Errorf("twitch VOD args = %v, want %v", got, twitchVODArgs)
+	}
+	if got := vod.DefaultFormat(); got != "best[height<=720]/best" {
+		t.Errorf("twitch VOD default format = %s", got)
+	}
+	clip, _ := defaultRegistry.Get(PlatformTwitchClip)
+	if got := clip.YtDlpArgs(); len(got) != 0 {
+		t.Errorf("twitch clip args = %v, want none", got)
+	}
+}
+
+func TestDownloadFilePrefixIncludesNamespace(t *testing.T) {
+	a := &PlatformInfo{VideoID: "video", CacheNamespace: "dailymotion"}
+	b := &PlatformInfo{VideoID: "video", CacheNamespace: "rutube"}
+	if downloadFilePrefix(a, "best") == downloadFilePrefix(b, "best") {
+		t.Fatalf("prefixes of different sites collide: %s", downloadFilePrefix(a, "best"))
+	}
+	if got := downloadFilePrefix(a, "best"); got != "dailymotion_video_best" {
+		t.Errorf("prefix = %s", got)
+	}
+}
@@ -0,0 +1,63 @@
+package services
+
+import "strings"
+
+// PlatformTikTok - видео TikTok
+const PlatformTikTok PlatformType = "tiktok"
+
+// tiktokFormat - лучший формат без водяного знака, иначе любой лучший
+const tiktokFormat = "best[format_note!*=watermark]/best"
+
+// tiktokPlatform - TikTok: скрывает форматы с водяным знаком
+type tiktokPlatform struct {
+	regexPlatform
+}
+
+// CanonicalURL возвращает ссылку на видео по числовому ID. У коротких ссылок ID - код,
+// из которого адрес видео не восстановить, поэтому канонической ссылки нет (""),
+// и ссылка остается как есть
+func (p *tiktokPlatform) CanonicalURL(id string) string {
+	for _, r := range id {
+		if r < '0' || r > '9' {
+			return ""
+		}
+	}
+	return p.regexPlatform.CanonicalURL(id)
+}
+
+// FilterFormats убирает форматы с водяным знаком, если есть хотя бы один без него
+func (p *tiktokPlatform) FilterFormats(formats []VideoFormat) []VideoFormat {
+	var clean []VideoFormat
+	for _, format := range formats {
+		if !strings.Contains(strings.ToLower(format.Note), "watermark") {
+			clean = append(clean, format)
+		}
+	}
+	if len(clean) == 0 {
+		return formats
+	}
+	return clean
+}
+
+func init() {
+	// Короткие ссылки vm.tiktok.com, vt.tiktok.com и tiktok.com/t/ yt-dlp раскрывает сам;
+	// до раскрытия ID видео - код короткой ссылки. Имя автора в ссылке на видео необязательно:
+	// каноническая ссылка его не содержит
+	RegisterPlatform(&tiktokPlatform{regexPlatform{
+		platformType: PlatformTikTok,
+		displayName:  "TikTok",
+		icon:         "🎵",
+		patterns: joinPatterns(
+			compilePatterns([]string{"vm.tiktok.com", "vt.tiktok.com"},
+				`^/([a-zA-Z0-9]+)`,
+			),
+			compilePatterns([]string{"tiktok.com"},
+				`^/@[^/]*/video/(\d+)`,
+				`^/(?:v|embed(?:/v2)?)/(\d+)`,
+				`^/t/([a-zA-Z0-9]+)`,
+			),
+		),
+		canonical:     "https://www.tiktok.com/@/video/%s",
+		defaultFormat: tiktokFormat,
+	}})
+}
@@ -0,0 +1,58 @@
+package services
+
+// Платформы Twitch: записи трансляций (VOD) и клипы. ID записей и клипов не пересекаются,
+// поэтому в кэше у них общее пространство "twitch".
+const (
+	PlatformTwitchVOD  PlatformType = "twitch_vod"
+	PlatformTwitchClip PlatformType = "twitch_clip"
+)
+
+// twitchNamespace - пространство кэша Twitch
+const twitchNamespace = "twitch"
+
+// twitchVODArgs - записи трансляций идут часами и качаются тысячами HLS фрагментов:
+// качаем фрагменты параллельно и терпим обрывы отдельных фрагментов на медленном CDN
+// (--socket-timeout общий для всех платформ)
+var twitchVODArgs = []string{
+	"--concurrent-fragments", "4",
+	"--fragment-retries", "20",
+}
+
+// twitchPlatform - VOD или клип Twitch
+type twitchPlatform struct {
+	regexPlatform
+}
+
+// CacheNamespace возвращает общее пространство кэша Twitch
+func (p *twitchPlatform) CacheNamespace() string { return twitchNamespace }
+
+func init() {
+	// По умолчанию запись берется не выше 720p: многочасовой VOD в исходнике не влезет в Telegram
+	RegisterPlatform(&twitchPlatform{regexPlatform{
+		platformType: PlatformTwitchVOD,
+		displayName:  "Twitch VOD",
+		icon:         "🟣",
+		patterns: compilePatterns([]string{"twitch.tv"},
+			`^/videos/(\d+)`,
+			`^/[a-zA-Z0-9_]+/v/(\d+)`,
+		),
+		canonical:     "https://www.twitch.tv/videos/%s",
+		ytDlpArgs:     twitchVODArgs,
+		defaultFormat: "best[height<=720]/best",
+	}})
+
+	RegisterPlatform(&twitchPlatform{regexPlatform{
+		platformType: PlatformTwitchClip,
+		displayName:  "Twitch Clip",
+		icon:         "🟣",
+		patterns: joinPatterns(
+			compilePatterns([]string{"clips.twitch.tv"},
+				`^/(?:embed\?(?:.*&)?clip=)?([a-zA-Z0-9_-]+)`,
+			),
+			compilePatterns([]string{"twitch.tv"},
+				`^/[a-zA-Z0-9_]+/clip/([a-zA-Z0-9_-]+)`,
+			),
+		),
+		canonical: "https://clips.twitch.tv/%s",
+	}})
+}
@@ -0,0 +1,18 @@
+package services
+
+// PlatformTwitter - видео из твитов X/Twitter
+const PlatformTwitter PlatformType = "twitter"
+
+func init() {
+	RegisterPlatform(&regexPlatform{
+		platformType: PlatformTwitter,
+		displayName:  "X (Twitter)",
+		icon:         "🐦",
+		patterns: compilePatterns([]string{"twitter.com", "x.com"},
+			`^/(?:[a-zA-Z0-9_]+|i/web)/status/(\d+)`,
+		),
+		canonical: "https://x.com/i/status/%s",
+		// HTTP форматы - готовые MP4 со звуком, HLS - запасной вариант
+		defaultFormat: "best[ext=mp4]/bestvideo+bestaudio/best",
+	})
+}
@@ -0,0 +1,23 @@
+package services
+
+// PlatformVimeo - видео Vimeo
+const PlatformVimeo PlatformType = "vimeo"
+
+func init() {
+	// Vimeo отдает DASH потоки видео без звука вместе с готовыми HTTP/HLS форматами
+	RegisterPlatform(&muxedAudioPlatform{regexPlatform{
+		platformType: PlatformVimeo,
+		displayName:  "Vimeo",
+		icon:         "🔷",
+		patterns: joinPatterns(
+			compilePatterns([]string{"player.vimeo.com"},
+				`^/video/(\d+)`,
+			),
+			compilePatterns([]string{"vimeo.com"},
+				`^/(?:channels/[^/]+/|groups/[^/]+/videos/|album/\d+/video/|showcase/\d+/video/)?(\d+)`,
+			),
+		),
+		canonical:     "https://vimeo.com/%s",
+		defaultFormat: "bestvideo[ext=mp4]+bestaudio[ext=m4a]/best[ext=mp4]/best",
+	}})
+}
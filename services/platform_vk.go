@@ -0,0 +1,17 @@
+package services
+
+// PlatformVK - VK Видео (vk.com и vkvideo.ru). ID - "<владелец>_<видео>", у групп владелец отрицательный.
+const PlatformVK PlatformType = "vk"
+
+func init() {
+	RegisterPlatform(&regexPlatform{
+		platformType: PlatformVK,
+		displayName:  "VK Видео",
+		icon:         "🔵",
+		patterns: compilePatterns([]string{"vk.com", "vk.ru", "vkvideo.ru"},
+			`^/(?:[^?]*[?&]z=)?(?:video|clip)(-?\d+_\d+)`,
+		),
+		canonical:     "https://vk.com/video%s",
+		defaultFormat: "best[ext=mp4]/bestvideo+bestaudio/best",
+	})
+}
@@ -0,0 +1,118 @@
+package services
+
+import "strings"
+
+// Платформы YouTube: обычные видео, Shorts, плейлисты и каналы
+
+// youtubeFormat - формат по умолчанию: MP4 с M4A, чтобы не перекодировать для Telegram
+const youtubeFormat = "best[ext=mp4]+bestaudio[ext=m4a]/best[ext=mp4]+bestaudio/best"
+
+// youtubeDomains - домены YouTube (www., m. и music. - поддомены)
+var youtubeDomains = []string{"youtube.com"}
+
+// youtubeWatchURL - каноническая ссылка на видео YouTube
+const youtubeWatchURL = "https://www.youtube.com/watch?v=%s"
+
+// youtubeVideo - обычное видео YouTube (также m., music., embed и трансляции)
+type youtubeVideo struct {
+	regexPlatform
+}
+
+// youtubeShorts - YouTube Shorts: тот же ID, что у обычного видео, поэтому и кэш общий
+type youtubeShorts struct {
+	regexPlatform
+}
+
+// CacheNamespace возвращает пространство кэша обычных видео YouTube
+func (p *youtubeShorts) CacheNamespace() string { return string(PlatformYouTube) }
+
+// youtubeCollection - плейлист или канал YouTube
+type youtubeCollection struct {
+	regexPlatform
+}
+
+// Collection отмечает платформу как список видео
+func (p *youtubeCollection) Collection() bool { return true }
+
+// youtubePlaylist - плейлист YouTube
+type youtubePlaylist struct {
+	youtubeCollection
+}
+
+// youtubeChannel - канал YouTube: ID - "@handle", "UC..." или имя из /c/ и /user/
+type youtubeChannel struct {
+	youtubeCollection
+}
+
+// CanonicalURL возвращает ссылку на вкладку "Видео" канала
+func (p *youtubeChannel) CanonicalURL(id string) string {
+	switch {
+	case strings.HasPrefix(id, "@"):
+		return "https://www.youtube.com/" + id + "/videos"
+	case strings.HasPrefix(id, "UC"):
+		return "https://www.youtube.com/channel/" + id + "/videos"
+	}
+	return "https://www.youtube.com/c/" + id + "/videos"
+}
+
+func init() {
+	RegisterPlatform(&youtubeVideo{regexPlatform{
+		platformType: PlatformYouTube,
+		displayName:  "YouTube",
+		icon:         "🎬",
+		patterns: joinPatterns(
+			compilePatterns(youtubeDomains,
+				`^/watch\?(?:.*&)?v=([a-zA-Z0-9_-]{11})`,
+				`^/v/([a-zA-Z0-9_-]{11})`,
+				`^/live/([a-zA-Z0-9_-]{11})`,
+			),
+			compilePatterns([]string{"youtube.com", "youtube-nocookie.com"},
+				`^/embed/([a-zA-Z0-9_-]{11})`,
+			),
+			compilePatterns([]string{"youtu.be"},
+				`^/([a-zA-Z0-9_-]{11})`,
+			),
+		),
+		canonical:     youtubeWatchURL,
+		defaultFormat: youtubeFormat,
+	}})
+
+	RegisterPlatform(&youtubeShorts{regexPlatform{
+		platformType: PlatformYouTubeShorts,
+		displayName:  "YouTube Shorts",
+		icon:         "🎬",
+		patterns: compilePatterns(youtubeDomains,
+			`^/shorts/([a-zA-Z0-9_-]{11})`,
+		),
+		canonical:     youtubeWatchURL, // ID и кэш у Shorts общие с обычным видео
+		defaultFormat: youtubeFormat,
+	}})
+
+	// Плейлист только по адресу /playlist: ссылка на видео с list= остается ссылкой на видео
+	RegisterPlatform(&youtubePlaylist{youtubeCollection{regexPlatform{
+		platformType: PlatformYouTubePlaylist,
+		displayName:  "YouTube плейлист",
+		icon:         "📃",
+		patterns: compilePatterns(youtubeDomains,
+			`^/playlist\?(?:.*&)?list=([a-zA-Z0-9_-]+)`,
+		),
+		canonical: "https://www.youtube.com/playlist?list=%s",
+	}}})
+
+	RegisterPlatform(&youtubeChannel{youtubeCollection{regexPlatform{
+		platformType: PlatformYouTubeChannel,
+		displayName:  "YouTube канал",
+		icon:         "📺",
+		patterns: compilePatterns(youtubeDomains,
+			`^/(@[a-zA-Z0-9_.-]+)`,
+			`^/channel/(UC[a-zA-Z0-9_-]+)`,
+			`^/(?:c|user)/([^/?]+)`,
+		),
+	}}})
+}
+
+// IsYouTubeVideoURL проверяет, что ссылка ведет на видео или Shorts YouTube
+func IsYouTubeVideoURL(url string) bool {
+	info := NewPlatformDetector().DetectPlatform(url)
+	return info.Type == PlatformYouTube || info.Type == PlatformYouTubeShorts
+}
@@ -3,7 +3,6 @@ package services
 import (
 	"fmt"
 	"log"
-	"regexp"
 	"strings"
 )
 
@@ -13,6 +12,8 @@ type PlatformType string
 const (
 	PlatformYouTube     PlatformType = "youtube"
 	PlatformYouTubeShorts PlatformType = "youtube_shorts"
+	PlatformYouTubePlaylist PlatformType = "youtube_playlist"
+	PlatformYouTubeChannel  PlatformType = "youtube_channel"
 	PlatformUnknown     PlatformType = "unknown"
 )
 
@@ -23,110 +24,86 @@ type PlatformInfo struct {
 	DisplayName string
 	Icon        string
 	Supported   bool
+	Collection  bool // Плейлист или канал: VideoID содержит ID списка или канала
+	Platform    Platform // Платформа из реестра (nil для неизвестной)
+	CacheNamespace string // Значение video_cache.platform
+	AudioOnly   bool   // Платформа только со звуком: меню видео не нужно
 }
 
-// PlatformDetector определяет платформу по URL
+// PlatformDetector определяет платформу по URL с помощью реестра платформ
 type PlatformDetector struct {
-	patterns map[PlatformType][]string
+	registry *PlatformRegistry
 }
 
-// NewPlatformDetector создает новый детектор платформ
+// NewPlatformDetector создает новый детектор платформ на общем реестре
 func NewPlatformDetector() *PlatformDetector {
 	return &PlatformDetector{
-		patterns: map[PlatformType][]string{
-			PlatformYouTube: {
-				`youtube\.com/watch\?v=([a-zA-Z0-9_-]{11})`,
-				`youtube\.com/embed/([a-zA-Z0-9_-]{11})`,
-				`youtube\.com/v/([a-zA-Z0-9_-]{11})`,
-				`youtu\.be/([a-zA-Z0-9_-]{11})`,
-			},
-			PlatformYouTubeShorts: {
-				`youtube\.com/shorts/([a-zA-Z0-9_-]{11})`,
-			},
-		},
+		registry: defaultRegistry,
 	}
 }
 
 // DetectPlatform определяет платформу по URL
 func (pd *PlatformDetector) DetectPlatform(url string) *PlatformInfo {
 	url = strings.TrimSpace(url)
-	
-	// Проверяем каждую платформу
-	for platformType, patterns := range pd.patterns {
-		for _, pattern := range patterns {
-			re := regexp.MustCompile(pattern)
-			matches := re.FindStringSubmatch(url)
-			if len(matches) > 1 {
-				videoID := matches[1]
-				return &PlatformInfo{
-					Type:        platformType,
-					VideoID:     videoID,
-					DisplayName: pd.getDisplayName(platformType),
-					Icon:        pd.getIcon(platformType),
-					Supported:   pd.isSupported(platformType),
-				}
-			}
+
+	if platform, videoID, ok := pd.registry.Detect(url); ok {
+		return &PlatformInfo{
+			Type:        platform.Type(),
+			VideoID:     videoID,
+			DisplayName: platform.DisplayName(),
+			Icon:        platform.Icon(),
+			Supported:   true,
+			Collection:  IsCollection(platform),
+			Platform:    platform,
+			CacheNamespace: CacheNamespace(platform),
+			AudioOnly:   IsAudioOnly(platform),
 		}
 	}
-	
+
 	return &PlatformInfo{
 		Type:        PlatformUnknown,
 		VideoID:     "",
 		DisplayName: "Неизвестная платформа",
 		Icon:        "❓",
 		Supported:   false,
+		CacheNamespace: string(PlatformUnknown),
 	}
 }
 
-// getDisplayName возвращает отображаемое имя платформы
-func (pd *PlatformDetector) getDisplayName(platformType PlatformType) string {
-	names := map[PlatformType]string{
-		PlatformYouTube:       "YouTube",
-		PlatformYouTubeShorts: "YouTube Shorts",
-		PlatformUnknown:       "Неизвестная платформа",
-	}
-	return names[platformType]
-}
-
-// getIcon возвращает иконку платформы
-func (pd *PlatformDetector) getIcon(platformType PlatformType) string {
-	icons := map[PlatformType]string{
-		PlatformYouTube:       "🎬",
-		PlatformYouTubeShorts: "🎬",
-		PlatformUnknown:       "❓",
-	}
-	return icons[platformType]
+// isCollectionPlatform проверяет, что тип обозначает список видео, а не одно видео
+func isCollectionPlatform(platformType PlatformType) bool {
+	platform, ok := defaultRegistry.Get(platformType)
+	return ok && IsCollection(platform)
 }
 
-// isSupported проверяет, поддерживается ли платформа
-func (pd *PlatformDetector) isSupported(platformType PlatformType) bool {
-	supported := map[PlatformType]bool{
-		PlatformYouTube:       true,
-		PlatformYouTubeShorts: true,
-		PlatformUnknown:       false,
-	}
-	return supported[platformType]
+// IsValidURL проверяет, является ли URL ссылкой на видео любой поддерживаемой платформы
+func (pd *PlatformDetector) IsValidURL(url string) bool {
+	info := pd.DetectPlatform(url)
+	return info.Supported && info.VideoID != "" && !info.Collection
 }
 
-// IsValidURL проверяет, является ли URL валидным для любой поддерживаемой платформы
-func (pd *PlatformDetector) IsValidURL(url string) bool {
+// IsCollectionURL проверяет, является ли URL ссылкой на плейлист или канал
+func (pd *PlatformDetector) IsCollectionURL(url string) bool {
 	info := pd.DetectPlatform(url)
-	return info.Supported && info.VideoID != ""
+	return info.Supported && info.Collection
 }
 
-// GetSupportedPlatforms возвращает список поддерживаемых платформ
+// GetSupportedPlatforms возвращает список поддерживаемых платформ в порядке регистрации
 func (pd *PlatformDetector) GetSupportedPlatforms() []PlatformInfo {
 	var platforms []PlatformInfo
-	for platformType := range pd.patterns {
-		if pd.isSupported(platformType) {
-			platforms = append(platforms, PlatformInfo{
-				Type:        platformType,
-				VideoID:     "",
-				DisplayName: pd.getDisplayName(platformType),
-				Icon:        pd.getIcon(platformType),
-				Supported:   true,
-			})
+	for _, platform := range pd.registry.All() {
+		// Плейлисты и каналы - не отдельные платформы
+		if IsCollection(platform) {
+			continue
 		}
+		platforms = append(platforms, PlatformInfo{
+			Type:        platform.Type(),
+			VideoID:     "",
+			DisplayName: platform.DisplayName(),
+			Icon:        platform.Icon(),
+			Supported:   true,
+			Platform:    platform,
+		})
 	}
 	return platforms
 }
@@ -136,32 +113,27 @@ func (pd *PlatformDetector) GetYtDlpArgs(platformType PlatformType) []string {
 	args := []string{
 		"--no-playlist",
 		"--no-check-certificates",
-		"--max-filesize", "2G",
 		"--socket-timeout", "60",
 		"--retries", "5",
 	}
-	
-	switch platformType {
-	case PlatformYouTube, PlatformYouTubeShorts:
-		// Стандартные аргументы для YouTube
-		args = append(args, "--format", "best[ext=mp4]+bestaudio[ext=m4a]/best[ext=mp4]+bestaudio/best")
-		
-	default:
+
+	platform, ok := pd.registry.Get(platformType)
+	if !ok {
 		// Универсальные аргументы
-		args = append(args, "--format", "best")
+		return append(args, "--max-filesize", "2G", "--format", "best")
 	}
-	
-	return args
+
+	args = append(args, "--max-filesize", fmt.Sprintf("%d", platform.MaxFileSize()))
+	args = append(args, platform.YtDlpArgs()...)
+	return append(args, "--format", platform.DefaultFormat())
 }
 
 // GetVideoTitle возвращает заголовок видео для кэша
 func (pd *PlatformDetector) GetVideoTitle(platformType PlatformType, videoID string) string {
-	titles := map[PlatformType]string{
-		PlatformYouTube:       fmt.Sprintf("YouTube Video %s", videoID),
-		PlatformYouTubeShorts: fmt.Sprintf("YouTube Short %s", videoID),
-		PlatformUnknown:       fmt.Sprintf("Video %s", videoID),
+	if platform, ok := pd.registry.Get(platformType); ok {
+		return fmt.Sprintf("%s %s", platform.DisplayName(), videoID)
 	}
-	return titles[platformType]
+	return fmt.Sprintf("Video %s", videoID)
 }
 
 // LogPlatformInfo логирует информацию о платформе
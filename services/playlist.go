@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"youtubeBot/utils"
+)
+
+// MaxPlaylistEntries - сколько видео плейлиста или канала показываем и ставим в очередь
+const MaxPlaylistEntries = 200
+
+// Форматы пакетной загрузки: видео до 720p (с лучшим аудио) и аудио m4a
+// (извлекается в DefaultAudioOutput, как и одиночное аудио)
+const (
+	BatchVideoFormat = "136"
+	BatchAudioFormat = "140"
+)
+
+// DefaultVideoFormat - ID формата для загрузки без выбора в меню на платформах, кроме YouTube:
+// --format берется из DefaultFormat платформы
+const DefaultVideoFormat = "default"
+
+// PlaylistEntry - видео плейлиста или канала
+type PlaylistEntry struct {
+	ID       string
+	Title    string
+	URL      string
+	Duration int // Длительность в секундах (0 - неизвестна)
+}
+
+// Playlist - плейлист или вкладка канала с видео
+type Playlist struct {
+	ID       string
+	Title    string
+	Uploader string
+	URL      string
+	Total    int // Всего видео по данным YouTube (может быть больше len(Entries))
+	Entries  []PlaylistEntry
+}
+
+// channelURLPattern выделяет адрес канала и вкладку ("/videos", "/shorts")
+var channelURLPattern = regexp.MustCompile(`^(https?://(?:www\.|m\.)?youtube\.com/(?:@[^/?#]+|channel/[^/?#]+|c/[^/?#]+|user/[^/?#]+))(/[^?#]*)?`)
+
+// IsPlaylistURL проверяет, что ссылка ведет на плейлист или канал YouTube
+func IsPlaylistURL(url string) bool {
+	return NewPlatformDetector().IsCollectionURL(url)
+}
+
+// PlaylistURL приводит ссылку на канал к вкладке "Видео": главная страница канала
+// отдает в yt-dlp список вкладок, а не список роликов. Ссылки на плейлисты не меняются.
+func PlaylistURL(url string) string {
+	url = strings.TrimSpace(url)
+	matches := channelURLPattern.FindStringSubmatch(url)
+	if matches == nil {
+		return url
+	}
+	switch strings.Trim(matches[2], "/") {
+	case "", "featured":
+		return matches[1] + "/videos"
+	}
+	return url
+}
+
+// playlist собирает Playlist из ответа yt-dlp --flat-playlist, пропуская
+// удаленные и приватные видео и вложенные плейлисты
+func (info *ytDlpInfo) playlist(url string) *Playlist {
+	playlist := &Playlist{
+		ID:       info.ID,
+		Title:    info.Title,
+		Uploader: info.Uploader,
+		URL:      url,
+		Total:    info.PlaylistCount,
+	}
+	if playlist.Uploader == "" {
+		playlist.Uploader = info.Channel
+	}
+
+	for _, entry := range info.Entries {
+		if entry.ID == "" || entry.IEKey == "YoutubeTab" {
+			continue
+		}
+		if entry.Title == "[Private video]" || entry.Title == "[Deleted video]" {
+			continue
+		}
+		item := PlaylistEntry{
+			ID:       entry.ID,
+			Title:    entry.Title,
+			URL:      entry.URL,
+			Duration: int(entry.Duration),
+		}
+		if !strings.HasPrefix(item.URL, "http") {
+			item.URL = "https://www.youtube.com/watch?v=" + entry.ID
+		}
+		playlist.Entries = append(playlist.Entries, item)
+	}
+
+	if playlist.Total < len(playlist.Entries) {
+		playlist.Total = len(playlist.Entries)
+	}
+	return playlist
+}
+
+// Playlist выполняет yt-dlp --flat-playlist: список видео без анализа каждого из них
+func (d *YtDlpDownloader) Playlist(ctx context.Context, url string, limit int) (*Playlist, error) {
+	args := []string{
+		"--flat-playlist",
+		"--dump-single-json",
+		"--no-check-certificates",
+		"--no-warnings",
+	}
+	if limit > 0 {
+		args = append(args, "--playlist-end", fmt.Sprintf("%d", limit))
+	}
+	args = append(args, getProxyArgs()...)
+	args = append(args, url)
+
+	cmd := exec.CommandContext(ctx, getYtDlpPath(), args...)
+	debugf("🚀 Выполняю команду: %s", strings.Join(cmd.Args, " "))
+
+	output, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("таймаут получения списка видео")
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			stderr := strings.TrimSpace(string(exitErr.Stderr))
+			log.Printf("❌ yt-dlp ошибка: %s", stderr)
+			return nil, fmt.Errorf("ошибка yt-dlp: %v: %s", err, stderr)
+		}
+		return nil, fmt.Errorf("ошибка yt-dlp: %v", err)
+	}
+
+	raw, err := parseYtDlpInfo(output)
+	if err != nil {
+		return nil, err
+	}
+	return raw.playlist(url), nil
+}
+
+// GetPlaylist получает список видео плейлиста или канала (не больше MaxPlaylistEntries)
+func (s *YouTubeService) GetPlaylist(url string) (*Playlist, error) {
+	url = PlaylistURL(url)
+	log.Printf("📃 Получение списка видео: %s", url)
+
+	var playlist *Playlist
+	err := utils.RetryWithBackoff(func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+		defer cancel()
+
+		result, err := s.downloader.Playlist(ctx, url, MaxPlaylistEntries)
+		if err != nil {
+			return err
+		}
+		playlist = result
+		return nil
+	}, 3, 2*time.Second)
+	if err != nil {
+		log.Printf("💥 Не удалось получить список видео после всех попыток: %v", err)
+		return nil, err
+	}
+	if len(playlist.Entries) == 0 {
+		return nil, fmt.Errorf("в списке нет доступных видео")
+	}
+
+	log.Printf("✅ Список получен: %s (%d из %d видео)", playlist.Title, len(playlist.Entries), playlist.Total)
+	return playlist, nil
+}
+
+// GetLatestVideos получает последние limit видео канала или плейлиста одним вызовом yt-dlp
+func (s *YouTubeService) GetLatestVideos(ctx context.Context, url string, limit int) (*Playlist, error) {
+	playlist, err := s.downloader.Playlist(ctx, url, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(playlist.Entries) == 0 {
+		return nil, fmt.Errorf("в списке нет доступных видео")
+	}
+	return playlist, nil
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writePlaylistFixture записывает в dir фикстуру плейлиста id из count видео.
+// playlistCount - сколько видео в плейлисте по данным YouTube.
+func writePlaylistFixture(t *testing.T, dir, id string, count, playlistCount int) {
+	t.Helper()
+	var entries []map[string]interface{}
+	for i := 0; i < count; i++ {
+		videoID := fmt.Sprintf("vid%08d", i)
+		entries = append(entries, map[string]interface{}{
+			"_type": "url", "ie_key": "Youtube", "id": videoID,
+			"url":   "https://www.youtube.com/watch?v=" + videoID,
+			"title": fmt.Sprintf("Video %d", i), "duration": 60,
+		})
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"_type": "playlist", "id": id, "title": "Big Playlist", "channel": "Channel",
+		"playlist_count": playlistCount, "entries": entries,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, id+".json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetPlaylistFixture(t *testing.T) {
+	service := NewYouTubeServiceWithDownloader(t.TempDir(), NewFakeDownloader(fixtureDir))
+	playlist, err := service.GetPlaylist("https://www.youtube.com/playlist?list=PLfixturePlaylist01")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Приватное видео пропущено, запись без url получает ссылку на просмотр
+	want := []PlaylistEntry{
+		{ID: "dQw4w9WgXcQ", Title: "Rick Astley - Never Gonna Give You Up (Official Music Video)", URL: "https://www.youtube.com/watch?v=dQw4w9WgXcQ", Duration: 212},
+		{ID: "yPYZpwSpKmA", Title: "Rick Astley - Together Forever (Official Music Video)", URL: "https://www.youtube.com/watch?v=yPYZpwSpKmA", Duration: 205},
+		{ID: "BBBBBBBBBBB", Title: "Entry without url", URL: "https://www.youtube.com/watch?v=BBBBBBBBBBB", Duration: 61},
+	}
+	if len(playlist.Entries) != len(want) {
+		t.Fatalf("entries = %+v", playlist.Entries)
+	}
+	for i, entry := range playlist.Entries {
+		if entry != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, entry, want[i])
+		}
+	}
+	if playlist.Total != 4 || playlist.Uploader != "Rick Astley" {
+		t.Errorf("total %d, uploader %q", playlist.Total, playlist.Uploader)
+	}
+}
+
+func TestGetPlaylistLimits(t *testing.T) {
+	dir := t.TempDir()
+	writePlaylistFixture(t, dir, "PLbigPlaylist", MaxPlaylistEntries+50, 1000)
+	writePlaylistFixture(t, dir, "PLemptyPlaylist", 0, 0)
+	service := NewYouTubeServiceWithDownloader(t.TempDir(), NewFakeDownloader(dir))
+
+	// Список обрезается до MaxPlaylistEntries, а Total остается полным
+	playlist, err := service.GetPlaylist("https://www.youtube.com/playlist?list=PLbigPlaylist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(playlist.Entries) != MaxPlaylistEntries || playlist.Total != 1000 {
+		t.Errorf("got %d of %d entries, want %d of 1000", len(playlist.Entries), playlist.Total, MaxPlaylistEntries)
+	}
+
+	latest, err := service.GetLatestVideos(context.Background(), "https://www.youtube.com/playlist?list=PLbigPlaylist", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(latest.Entries) != 3 || latest.Entries[0].ID != "vid00000000" || latest.Entries[2].ID != "vid00000002" {
+		t.Errorf("latest videos = %+v", latest.Entries)
+	}
+
+	if _, err := service.GetPlaylist("https://www.youtube.com/playlist?list=PLemptyPlaylist"); err == nil {
+		t.Error("empty playlist should fail")
+	}
+	if _, err := service.GetLatestVideos(context.Background(), "https://www.youtube.com/playlist?list=PLemptyPlaylist", 3); err == nil {
+		t.Error("empty latest videos should fail")
+	}
+}
+
+func TestPlaylistURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://www.youtube.com/@natgeo", "https://www.youtube.com/@natgeo/videos"},
+		{"https://www.youtube.com/@natgeo/featured", "https://www.youtube.com/@natgeo/videos"},
+		{"https://youtube.com/channel/UC123/", "https://youtube.com/channel/UC123/videos"},
+		{"https://www.youtube.com/@natgeo/shorts", "https://www.youtube.com/@natgeo/shorts"},
+		{"https://www.youtube.com/@natgeo/videos", "https://www.youtube.com/@natgeo/videos"},
+		{"https://www.youtube.com/playlist?list=PL123", "https://www.youtube.com/playlist?list=PL123"},
+	}
+	for _, tt := range tests {
+		if got := PlaylistURL(tt.url); got != tt.want {
+			t.Errorf("PlaylistURL(%s) = %s, want %s", tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package services
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessGroup запускает команду в отдельной группе процессов и при отмене
+// контекста завершает всю группу: yt-dlp запускает ffmpeg дочерним процессом,
+// и без этого ffmpeg продолжил бы работу после отмены
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package services
+
+import "os/exec"
+
+// killProcessGroup на Windows не поддерживается: при отмене завершается только сам процесс
+func killProcessGroup(cmd *exec.Cmd) {}
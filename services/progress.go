@@ -0,0 +1,212 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Статусы прогресса скачивания
+const (
+	ProgressDownloading    = "downloading"
+	ProgressFinished       = "finished"
+	ProgressPostprocessing = "postprocessing"
+	ProgressUploading      = "uploading" // Загрузка готового файла в Telegram
+)
+
+// DownloadProgress - событие прогресса скачивания, разобранное из вывода yt-dlp
+type DownloadProgress struct {
+	Status          string
+	Percent         float64 // 0-100, -1 если неизвестно
+	DownloadedBytes int64
+	TotalBytes      int64   // Точный или оценочный размер, 0 если неизвестен
+	Speed           float64 // байт/с
+	ETA             time.Duration
+	FragmentIndex   int
+	FragmentCount   int
+	Postprocessor   string // Имя постпроцессора yt-dlp (Merger, FFmpegExtractAudio...)
+}
+
+// ProgressFunc получает события прогресса скачивания
+type ProgressFunc func(DownloadProgress)
+
+// Префиксы машиночитаемых строк прогресса в выводе yt-dlp
+const (
+	progressLinePrefix    = "[bot-progress]"
+	postprocessLinePrefix = "[bot-postprocess]"
+)
+
+// progressArgs возвращает аргументы yt-dlp для вывода машиночитаемого прогресса
+func progressArgs() []string {
+	return []string{
+		"--newline",
+		"--progress",
+		"--progress-template", "download:" + progressLinePrefix +
+			"%(progress.status)s|%(progress.downloaded_bytes)s|%(progress.total_bytes)s|" +
+			"%(progress.total_bytes_estimate)s|%(progress.speed)s|%(progress.eta)s|" +
+			"%(progress.fragment_index)s|%(progress.fragment_count)s",
+		"--progress-template", "postprocess:" + postprocessLinePrefix +
+			"%(progress.postprocessor)s|%(progress.status)s",
+	}
+}
+
+// parseProgressLine разбирает строку прогресса yt-dlp, ok=false для остальных строк
+func parseProgressLine(line string) (DownloadProgress, bool) {
+	line = strings.TrimSpace(line)
+
+	if strings.HasPrefix(line, postprocessLinePrefix) {
+		fields := strings.Split(strings.TrimPrefix(line, postprocessLinePrefix), "|")
+		progress := DownloadProgress{Status: ProgressPostprocessing, Percent: 100}
+		if len(fields) > 0 && fields[0] != "NA" {
+			progress.Postprocessor = fields[0]
+		}
+		return progress, true
+	}
+
+	if !strings.HasPrefix(line, progressLinePrefix) {
+		return DownloadProgress{}, false
+	}
+
+	fields := strings.Split(strings.TrimPrefix(line, progressLinePrefix), "|")
+	if len(fields) < 8 {
+		return DownloadProgress{}, false
+	}
+
+	progress := DownloadProgress{
+		Status:          fields[0],
+		DownloadedBytes: int64(parseProgressNumber(fields[1])),
+		TotalBytes:      int64(parseProgressNumber(fields[2])),
+		Speed:           parseProgressNumber(fields[4]),
+		ETA:             time.Duration(parseProgressNumber(fields[5])) * time.Second,
+		FragmentIndex:   int(parseProgressNumber(fields[6])),
+		FragmentCount:   int(parseProgressNumber(fields[7])),
+		Percent:         -1,
+	}
+	if progress.TotalBytes == 0 {
+		progress.TotalBytes = int64(parseProgressNumber(fields[3]))
+	}
+
+	switch {
+	case progress.Status == ProgressFinished:
+		progress.Percent = 100
+	case progress.TotalBytes > 0:
+		progress.Percent = float64(progress.DownloadedBytes) * 100 / float64(progress.TotalBytes)
+	case progress.FragmentCount > 0:
+		progress.Percent = float64(progress.FragmentIndex) * 100 / float64(progress.FragmentCount)
+	}
+	if progress.Percent > 100 {
+		progress.Percent = 100
+	}
+
+	return progress, true
+}
+
+// parseProgressNumber парсит число из шаблона yt-dlp ("NA" и пустые значения дают 0)
+func parseProgressNumber(value string) float64 {
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0
+	}
+	return number
+}
+
+// String возвращает краткое описание прогресса для логов
+func (p DownloadProgress) String() string {
+	if p.Status == ProgressPostprocessing {
+		return fmt.Sprintf("обработка (%s)", p.Postprocessor)
+	}
+	return fmt.Sprintf("%.1f%% (%s/%s, %s/с, ETA %s)", p.Percent,
+		formatBytes(p.DownloadedBytes), formatBytes(p.TotalBytes), formatBytes(int64(p.Speed)), p.ETA)
+}
+
+// ProgressBar рисует полосу прогресса вида [██████░░░░]
+func ProgressBar(percent float64, width int) string {
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	filled := int(percent / 100 * float64(width))
+	return "[" + strings.Repeat("█", filled) + strings.Repeat("░", width-filled) + "]"
+}
+
+// FormatProgressMessage формирует текст статусного сообщения для Telegram
+func FormatProgressMessage(p DownloadProgress) string {
+	if p.Status == ProgressPostprocessing {
+		return "🔄 Обработка файла..."
+	}
+	if p.Status == ProgressUploading {
+		text := fmt.Sprintf("⬆️ Загружаю в Telegram %s %.0f%%", ProgressBar(p.Percent, 10), p.Percent)
+		if p.TotalBytes > 0 {
+			text += fmt.Sprintf("\n📦 %s / %s", formatBytes(p.DownloadedBytes), formatBytes(p.TotalBytes))
+		}
+		return text
+	}
+	if p.Percent < 0 {
+		text := "📥 Скачиваю..."
+		if p.DownloadedBytes > 0 {
+			text += fmt.Sprintf("\n📦 %s", formatBytes(p.DownloadedBytes))
+		}
+		return text
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "📥 Скачиваю... %s %.0f%%", ProgressBar(p.Percent, 10), p.Percent)
+	if p.TotalBytes > 0 {
+		fmt.Fprintf(&b, "\n📦 %s / %s", formatBytes(p.DownloadedBytes), formatBytes(p.TotalBytes))
+	}
+	if p.Speed > 0 {
+		fmt.Fprintf(&b, "\n🚀 %s/с", formatBytes(int64(p.Speed)))
+	}
+	if p.ETA > 0 && p.Status != ProgressFinished {
+		fmt.Fprintf(&b, "\n⏱️ Осталось ~%s", formatDuration(int(p.ETA.Seconds())))
+	}
+	if p.FragmentCount > 0 {
+		fmt.Fprintf(&b, "\n🧩 Фрагмент %d/%d", p.FragmentIndex, p.FragmentCount)
+	}
+	return b.String()
+}
+
+// ProgressReporter превращает события прогресса в текст статуса и передает его
+// в update не чаще одного раза за interval (смена статуса передается сразу).
+// Нужен, чтобы не упираться в лимиты Telegram на редактирование сообщений.
+type ProgressReporter struct {
+	interval time.Duration
+	update   func(text string)
+
+	mu         sync.Mutex
+	lastText   string
+	lastStatus string
+	lastSent   time.Time
+}
+
+// NewProgressReporter создает ProgressReporter
+func NewProgressReporter(interval time.Duration, update func(text string)) *ProgressReporter {
+	return &ProgressReporter{
+		interval: interval,
+		update:   update,
+	}
+}
+
+// Report принимает событие прогресса (подходит как ProgressFunc)
+func (r *ProgressReporter) Report(p DownloadProgress) {
+	text := FormatProgressMessage(p)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if text == r.lastText {
+		return
+	}
+	if p.Status == r.lastStatus && time.Since(r.lastSent) < r.interval {
+		return
+	}
+
+	r.lastText = text
+	r.lastStatus = p.Status
+	r.lastSent = time.Now()
+	r.update(text)
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseProgressLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		ok   bool
+		want DownloadProgress
+	}{
+		{
+			name: "known total size",
+			line: "[bot-progress]downloading|1048576|4194304|NA|524288.5|6|NA|NA",
+			ok:   true,
+			want: DownloadProgress{Status: ProgressDownloading, Percent: 25, DownloadedBytes: 1048576,
+				TotalBytes: 4194304, Speed: 524288.5, ETA: 6 * time.Second},
+		},
+		{
+			name: "estimated total size",
+			line: "  [bot-progress]downloading|500|NA|2000|NA|NA|NA|NA\n",
+			ok:   true,
+			want: DownloadProgress{Status: ProgressDownloading, Percent: 25, DownloadedBytes: 500, TotalBytes: 2000},
+		},
+		{
+			name: "no total size, fragments only",
+			line: "[bot-progress]downloading|300|NA|NA|100|NA|3|12",
+			ok:   true,
+			want: DownloadProgress{Status: ProgressDownloading, Percent: 25, DownloadedBytes: 300, Speed: 100,
+				FragmentIndex: 3, FragmentCount: 12},
+		},
+		{
+			name: "no total size at all",
+			line: "[bot-progress]downloading|300|NA|NA|NA|NA|NA|NA",
+			ok:   true,
+			want: DownloadProgress{Status: ProgressDownloading, Percent: -1, DownloadedBytes: 300},
+		},
+		{
+			name: "downloaded more than the estimate",
+			line: "[bot-progress]downloading|3000|NA|2000|NA|NA|NA|NA",
+			ok:   true,
+			want: DownloadProgress{Status: ProgressDownloading, Percent: 100, DownloadedBytes: 3000, TotalBytes: 2000},
+		},
+		{
+			name: "finished without sizes",
+			line: "[bot-progress]finished|NA|NA|NA|NA|NA|NA|NA",
+			ok:   true,
+			want: DownloadProgress{Status: ProgressFinished, Percent: 100},
+		},
+		{
+			name: "garbage numbers count as unknown",
+			line: "[bot-progress]downloading|abc||-|x|y|z|w",
+			ok:   true,
+			want: DownloadProgress{Status: ProgressDownloading, Percent: -1},
+		},
+		{
+			name: "postprocessor",
+			line: "[bot-postprocess]Merger|started",
+			ok:   true,
+			want: DownloadProgress{Status: ProgressPostprocessing, Percent: 100, Postprocessor: "Merger"},
+		},
+		{
+			name: "postprocessor unknown",
+			line: "[bot-postprocess]NA|started",
+			ok:   true,
+			want: DownloadProgress{Status: ProgressPostprocessing, Percent: 100},
+		},
+		{name: "too few fields", line: "[bot-progress]downloading|1|2|3", ok: false},
+		{name: "ordinary yt-dlp output", line: "[youtube] dQw4w9WgXcQ: Downloading webpage", ok: false},
+		{name: "default progress line", line: "[download]  25.0% of 4.00MiB at 512.00KiB/s ETA 00:06", ok: false},
+		{name: "empty line", line: "", ok: false},
+	}
+	for _, tt := range tests {
+		got, ok := parseProgressLine(tt.line)
+		if ok != tt.ok {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.ok)
+			continue
+		}
+		if ok && got != tt.want {
+			t.Errorf("%s:\n got %+v\nwant %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFormatProgressMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		progress DownloadProgress
+		contains []string
+		absent   []string
+	}{
+		{
+			name:     "unknown percent",
+			progress: DownloadProgress{Status: ProgressDownloading, Percent: -1, DownloadedBytes: 2048},
+			contains: []string{"📥 Скачиваю...", "📦"},
+			absent:   []string{"%", "["},
+		},
+		{
+			name:     "known size with fragments",
+			progress: DownloadProgress{Status: ProgressDownloading, Percent: 50, DownloadedBytes: 1024, TotalBytes: 2048, Speed: 1024, ETA: time.Second, FragmentIndex: 1, FragmentCount: 2},
+			contains: []string{"[█████░░░░░] 50%", "🚀", "⏱️", "🧩 Фрагмент 1/2"},
+		},
+		{
+			name:     "finished hides ETA",
+			progress: DownloadProgress{Status: ProgressFinished, Percent: 100, ETA: time.Second},
+			contains: []string{"100%"},
+			absent:   []string{"⏱️"},
+		},
+		{
+			name:     "postprocessing",
+			progress: DownloadProgress{Status: ProgressPostprocessing, Percent: 100},
+			contains: []string{"🔄 Обработка файла..."},
+		},
+		{
+			name:     "uploading",
+			progress: DownloadProgress{Status: ProgressUploading, Percent: 30, DownloadedBytes: 300, TotalBytes: 1000},
+			contains: []string{"⬆️ Загружаю в Telegram", "30%"},
+		},
+	}
+	for _, tt := range tests {
+		text := FormatProgressMessage(tt.progress)
+		for _, want := range tt.contains {
+			if !strings.Contains(text, want) {
+				t.Errorf("%s: %q does not contain %q", tt.name, text, want)
+			}
+		}
+		for _, unwanted := range tt.absent {
+			if strings.Contains(text, unwanted) {
+				t.Errorf("%s: %q contains %q", tt.name, text, unwanted)
+			}
+		}
+	}
+}
+
+func TestProgressBar(t *testing.T) {
+	tests := []struct {
+		percent float64
+		want    string
+	}{
+		{-1, "[░░░░░░░░░░]"},
+		{0, "[░░░░░░░░░░]"},
+		{49, "[████░░░░░░]"},
+		{100, "[██████████]"},
+		{150, "[██████████]"},
+	}
+	for _, tt := range tests {
+		if got := ProgressBar(tt.percent, 10); got != tt.want {
+			t.Errorf("ProgressBar(%v) = %s, want %s", tt.percent, got, tt.want)
+		}
+	}
+}
+
+func TestProgressReporterThrottling(t *testing.T) {
+	var sent []string
+	reporter := NewProgressReporter(time.Hour, func(text string) { sent = append(sent, text) })
+	downloading := func(percent float64) DownloadProgress {
+		return DownloadProgress{Status: ProgressDownloading, Percent: percent, TotalBytes: 100, DownloadedBytes: int64(percent)}
+	}
+
+	reporter.Report(downloading(10))
+	// Тот же статус внутри интервала - не отправляем
+	reporter.Report(downloading(20))
+	reporter.Report(downloading(30))
+	// Смена статуса отправляется сразу
+	reporter.Report(DownloadProgress{Status: ProgressPostprocessing, Percent: 100})
+	// Тот же текст не повторяем
+	reporter.Report(DownloadProgress{Status: ProgressPostprocessing, Percent: 100, Postprocessor: "Merger"})
+	reporter.Report(DownloadProgress{Status: ProgressFinished, Percent: 100})
+
+	if len(sent) != 3 {
+		t.Fatalf("sent %d updates, want 3: %q", len(sent), sent)
+	}
+	if !strings.Contains(sent[0], "10%") || !strings.Contains(sent[1], "Обработка") || !strings.Contains(sent[2], "100%") {
+		t.Errorf("updates = %q", sent)
+	}
+
+	// После интервала тот же статус снова проходит
+	sent = nil
+	reporter = NewProgressReporter(0, func(text string) { sent = append(sent, text) })
+	for _, percent := range []float64{10, 20, 20, 30} {
+		reporter.Report(downloading(percent))
+	}
+	if len(sent) != 3 {
+		t.Errorf("without throttling sent %d updates, want 3 (duplicates dropped): %q", len(sent), sent)
+	}
+}
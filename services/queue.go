@@ -18,11 +18,19 @@ type DownloadJob struct {
 	ChatID    int64     // ID чата
 	VideoURL  string    // URL видео
 	FormatID  string    // ID формата
+	Resolution string   // Разрешение выбранного формата ("" - неизвестно)
 	Priority  int       // Приоритет (1-10, где 10 - высший)
 	CreatedAt time.Time // Время создания
 	Status    JobStatus // Статус задачи
 	Error     error     // Ошибка если есть
 	Result    string    // Результат (путь к файлу)
+	Progress  DownloadProgress // Последний прогресс скачивания
+	Attempts  int       // Сколько раз воркер брал задачу (растет после перезапусков)
+	BatchID   string    // ID пакета (плейлист, канал), "" - одиночная задача
+
+	ctx        context.Context    // Контекст задачи, передается во все подпроцессы
+	cancel     context.CancelFunc // Отмена задачи (останавливает yt-dlp)
+	finishedAt time.Time          // Время завершения (для срока хранения результата)
 }
 
 // JobStatus представляет статус задачи
@@ -46,10 +54,13 @@ type JobResult struct {
 
 // DownloadQueue управляет очередью загрузок
 type DownloadQueue struct {
-	jobs           chan DownloadJob
+	scheduler      *jobScheduler // Ожидающие задачи по приоритету
 	results        chan JobResult
 	workers        int
 	activeJobs     map[string]*DownloadJob
+	finishedJobs   map[string]*DownloadJob     // Завершенные задачи, хранятся retention
+	subscribers    map[string][]*jobSubscriber // Подписчики на события задач
+	retention      time.Duration
 	activeJobsMux  sync.RWMutex
 	jobCounter     int64
 	jobCounterMux  sync.Mutex
@@ -57,25 +68,121 @@ type DownloadQueue struct {
 	cancel         context.CancelFunc
 	wg             sync.WaitGroup
 	youtubeService *YouTubeService
+	universalService *UniversalService // Остальные платформы (nil - очередь только для YouTube)
 	cacheService   *CacheService
+	store          *JobStore // Хранилище задач (nil - очередь живет только в памяти)
 }
 
 // NewDownloadQueue создает новую очередь загрузок
-func NewDownloadQueue(workers int, youtubeService *YouTubeService, cacheService *CacheService) *DownloadQueue {
+func NewDownloadQueue(workers int, youtubeService *YouTubeService, universalService *UniversalService, cacheService *CacheService) *DownloadQueue {
 	ctx, cancel := context.WithCancel(context.Background())
 	
 	return &DownloadQueue{
-		jobs:           make(chan DownloadJob, 1000), // Буфер на 1000 задач
+		scheduler:      newJobScheduler(1000, defaultAgingInterval), // До 1000 ожидающих задач
 		results:        make(chan JobResult, 1000),
 		workers:        workers,
 		activeJobs:     make(map[string]*DownloadJob),
+		finishedJobs:   make(map[string]*DownloadJob),
+		subscribers:    make(map[string][]*jobSubscriber),
+		retention:      defaultResultRetention,
 		ctx:            ctx,
 		cancel:         cancel,
 		youtubeService: youtubeService,
+		universalService: universalService,
 		cacheService:   cacheService,
 	}
 }
 
+// SetUserLimits задает ограничения на задачи одного пользователя: сверх MaxConcurrent
+// задачи ждут, сверх MaxQueued AddJob возвращает *UserLimitError
+func (q *DownloadQueue) SetUserLimits(limits UserLimits) {
+	q.scheduler.setLimits(limits)
+	log.Printf("⚖️ Лимиты на пользователя: %d одновременно, %d в очереди", limits.MaxConcurrent, limits.MaxQueued)
+}
+
+// SetJobStore включает сохранение задач и их статусов в SQLite.
+// Вызывается до Start и Restore.
+func (q *DownloadQueue) SetJobStore(store *JobStore) {
+	q.store = store
+}
+
+// Restore возвращает в очередь задачи, оставшиеся в хранилище после остановки бота.
+// Ожидавшие задачи продолжают ждать, прерванные в процессе загрузки ставятся заново,
+// пока не исчерпан лимит попыток. Возвращает восстановленные и проваленные задачи,
+// чтобы бот мог уведомить их чаты.
+func (q *DownloadQueue) Restore() (resumed, failed []*DownloadJob, err error) {
+	if q.store == nil {
+		return nil, nil, nil
+	}
+	
+	jobs, err := q.store.LoadUnfinished()
+	if err != nil {
+		return nil, nil, err
+	}
+	
+	for _, job := range jobs {
+		interrupted := job.Status == JobStatusProcessing
+		if interrupted && job.Attempts >= maxJobAttempts {
+			job.Status = JobStatusFailed
+			job.Error = fmt.Errorf("загрузка %d раз прерывалась перезапуском бота", job.Attempts)
+			q.saveStatus(job)
+			log.Printf("💀 Задача %s провалена после %d прерываний", job.ID, job.Attempts)
+			failed = append(failed, job)
+			continue
+		}
+		
+		job.Status = JobStatusPending
+		job.ctx, job.cancel = context.WithCancel(q.ctx)
+		q.activeJobsMux.Lock()
+		q.activeJobs[job.ID] = job
+		q.activeJobsMux.Unlock()
+		
+		if err := q.scheduler.restore(job); err != nil {
+			job.cancel()
+			q.activeJobsMux.Lock()
+			delete(q.activeJobs, job.ID)
+			q.activeJobsMux.Unlock()
+			job.Status = JobStatusFailed
+			job.Error = err
+			q.saveStatus(job)
+			log.Printf("❌ Не удалось восстановить задачу %s: %v", job.ID, err)
+			failed = append(failed, job)
+			continue
+		}
+		
+		if interrupted {
+			q.saveStatus(job)
+			log.Printf("🔁 Прерванная задача %s поставлена заново (попытка %d)", job.ID, job.Attempts+1)
+		} else {
+			log.Printf("♻️ Задача %s восстановлена в очереди", job.ID)
+		}
+		resumed = append(resumed, job)
+	}
+	
+	log.Printf("📦 Восстановление очереди: %d задач возвращено, %d провалено", len(resumed), len(failed))
+	return resumed, failed, nil
+}
+
+// saveStatus сохраняет текущий статус задачи в хранилище
+func (q *DownloadQueue) saveStatus(job *DownloadJob) {
+	if q.store == nil {
+		return
+	}
+	if err := q.store.UpdateStatus(job.ID, job.Status, job.Result, job.Error); err != nil {
+		log.Printf("⚠️ %v", err)
+	}
+}
+
+// JobPosition возвращает позицию ожидающей задачи в очереди (с 1), 0 если задача уже не ждет
+func (q *DownloadQueue) JobPosition(jobID string) int {
+	return q.scheduler.position(jobID)
+}
+
+// QueuedJobs возвращает количество ожидающих задач пользователя
+func (q *DownloadQueue) QueuedJobs(userID int64) int {
+	return q.scheduler.queuedFor(userID)
+}
+
 // Start запускает воркеры очереди
 func (q *DownloadQueue) Start() {
 	log.Printf("🚀 Запуск очереди загрузок с %d воркерами", q.workers)
@@ -90,6 +197,10 @@ func (q *DownloadQueue) Start() {
 	q.wg.Add(1)
 	go q.resultHandler()
 	
+	// Запускаем очистку результатов с истекшим сроком хранения
+	q.wg.Add(1)
+	go q.retentionCleaner()
+	
 	log.Printf("✅ Очередь загрузок запущена")
 }
 
@@ -97,48 +208,93 @@ func (q *DownloadQueue) Start() {
 func (q *DownloadQueue) Stop() {
 	log.Printf("🛑 Остановка очереди загрузок...")
 	q.cancel()
-	close(q.jobs)
-	close(q.results)
+	q.scheduler.close()
+	q.closeSubscribers()
+	// Канал результатов закрываем, только когда воркеры завершились и больше в него не пишут
 	q.wg.Wait()
+	close(q.results)
 	log.Printf("✅ Очередь загрузок остановлена")
 }
 
-// AddJob добавляет задачу в очередь
-func (q *DownloadQueue) AddJob(userID, chatID int64, videoURL, formatID string, priority int) (string, error) {
+// AddJob добавляет задачу в очередь. Задачи выбираются по приоритету (1-10, см. JobPriority),
+// а ожидание постепенно повышает приоритет, чтобы задачи не голодали. resolution - разрешение
+// выбранного формата из списка, показанного пользователю ("" - неизвестно), оно попадает в кэш.
+func (q *DownloadQueue) AddJob(userID, chatID int64, videoURL, formatID, resolution string, priority int) (string, error) {
+	return q.addJob(userID, chatID, videoURL, formatID, resolution, priority, "")
+}
+
+// addJob создает задачу и ставит ее в очередь
+func (q *DownloadQueue) addJob(userID, chatID int64, videoURL, formatID, resolution string, priority int, batchID string) (string, error) {
 	q.jobCounterMux.Lock()
 	q.jobCounter++
-	jobID := fmt.Sprintf("job_%d_%d", time.Now().Unix(), q.jobCounter)
+	// Миллисекунды в ID не дают задачам после перезапуска совпасть с сохраненными
+	jobID := fmt.Sprintf("job_%d_%d", time.Now().UnixMilli(), q.jobCounter)
 	q.jobCounterMux.Unlock()
 	
-	job := DownloadJob{
+	priority = clampPriority(priority)
+	jobCtx, jobCancel := context.WithCancel(q.ctx)
+	job := &DownloadJob{
 		ID:        jobID,
 		UserID:    userID,
 		ChatID:    chatID,
 		VideoURL:  videoURL,
 		FormatID:  formatID,
+		Resolution: resolution,
 		Priority:  priority,
 		CreatedAt: time.Now(),
 		Status:    JobStatusPending,
+		BatchID:   batchID,
+		ctx:       jobCtx,
+		cancel:    jobCancel,
 	}
 	
-	select {
-	case q.jobs <- job:
-		log.Printf("📝 Задача добавлена в очередь: %s (пользователь: %d, приоритет: %d)", 
-			jobID, userID, priority)
-		return jobID, nil
-	case <-q.ctx.Done():
-		return "", fmt.Errorf("очередь остановлена")
-	default:
-		return "", fmt.Errorf("очередь переполнена")
+	// Регистрируем задачу сразу, чтобы ее можно было найти и отменить, пока она ждет воркера
+	q.activeJobsMux.Lock()
+	q.activeJobs[jobID] = job
+	q.activeJobsMux.Unlock()
+	
+	// Сохраняем до постановки в очередь, чтобы воркер не обогнал запись
+	if q.store != nil {
+		if err := q.store.Save(job); err != nil {
+			log.Printf("⚠️ %v", err)
+		}
+	}
+	
+	if err := q.scheduler.push(job); err != nil {
+		q.dropJob(job)
+		return "", err
+	}
+	
+	log.Printf("📝 Задача добавлена в очередь: %s (пользователь: %d, приоритет: %d)", 
+		jobID, userID, priority)
+	// Новая задача может обогнать ожидающие
+	q.publishPositions()
+	return jobID, nil
+}
+
+// dropJob удаляет задачу, которая не попала в очередь
+func (q *DownloadQueue) dropJob(job *DownloadJob) {
+	job.cancel()
+	q.activeJobsMux.Lock()
+	delete(q.activeJobs, job.ID)
+	q.activeJobsMux.Unlock()
+	
+	if q.store != nil {
+		if err := q.store.Delete(job.ID); err != nil {
+			log.Printf("⚠️ %v", err)
+		}
 	}
 }
 
-// GetJobStatus возвращает статус задачи
+// GetJobStatus возвращает статус задачи, в том числе завершенной в пределах срока хранения результата
 func (q *DownloadQueue) GetJobStatus(jobID string) (*DownloadJob, bool) {
 	q.activeJobsMux.RLock()
 	defer q.activeJobsMux.RUnlock()
 	
-	job, exists := q.activeJobs[jobID]
+	if job, exists := q.activeJobs[jobID]; exists {
+		return job, true
+	}
+	job, exists := q.finishedJobs[jobID]
 	return job, exists
 }
 
@@ -157,22 +313,49 @@ func (q *DownloadQueue) GetUserJobs(userID int64) []*DownloadJob {
 	return userJobs
 }
 
-// CancelJob отменяет задачу
+// CancelJob отменяет задачу: ожидающая задача не будет запущена,
+// у выполняющейся отменяется контекст, что останавливает yt-dlp
 func (q *DownloadQueue) CancelJob(jobID string) error {
 	q.activeJobsMux.Lock()
-	defer q.activeJobsMux.Unlock()
 	
 	job, exists := q.activeJobs[jobID]
 	if !exists {
+		_, finished := q.finishedJobs[jobID]
+		q.activeJobsMux.Unlock()
+		if finished {
+			return fmt.Errorf("задача уже завершена")
+		}
 		return fmt.Errorf("задача не найдена")
 	}
 	
 	if job.Status == JobStatusCompleted || job.Status == JobStatusFailed {
+		q.activeJobsMux.Unlock()
 		return fmt.Errorf("задача уже завершена")
 	}
+	if job.Status == JobStatusCancelled {
+		q.activeJobsMux.Unlock()
+		return nil
+	}
 	
+	wasPending := job.Status == JobStatusPending
 	job.Status = JobStatusCancelled
+	job.cancel()
+	q.saveStatus(job)
 	log.Printf("❌ Задача отменена: %s", jobID)
+	
+	// Ожидающая задача не дойдет до resultHandler - завершаем ее сами.
+	// Выполняющаяся завершится в resultHandler, когда остановится yt-dlp.
+	if wasPending {
+		q.scheduler.remove(jobID)
+		q.finishJob(job)
+	} else {
+		q.publishStatus(job)
+	}
+	q.activeJobsMux.Unlock()
+	
+	if wasPending {
+		q.publishPositions()
+	}
 	return nil
 }
 
@@ -183,29 +366,42 @@ func (q *DownloadQueue) worker(workerID int) {
 	log.Printf("👷 Воркер %d запущен", workerID)
 	
 	for {
-		select {
-		case job := <-q.jobs:
-			if job.Status == JobStatusCancelled {
-				continue
-			}
-			
-			// Добавляем задачу в активные
-			q.activeJobsMux.Lock()
-			q.activeJobs[job.ID] = &job
-			q.activeJobsMux.Unlock()
-			
-			// Обрабатываем задачу
-			q.processJob(workerID, &job)
-			
-			// НЕ удаляем задачу из активных сразу - пусть resultHandler это сделает
-			// q.activeJobsMux.Lock()
-			// delete(q.activeJobs, job.ID)
-			// q.activeJobsMux.Unlock()
-			
-		case <-q.ctx.Done():
+		job, ok := q.scheduler.pop()
+		if !ok {
 			log.Printf("👷 Воркер %d остановлен", workerID)
 			return
 		}
+		
+		// Переводим задачу в обработку, если ее не отменили, пока она ждала
+		q.activeJobsMux.Lock()
+		cancelled := job.Status == JobStatusCancelled
+		if !cancelled {
+			job.Status = JobStatusProcessing
+			job.Attempts++
+			q.publishStatus(job)
+		}
+		q.activeJobsMux.Unlock()
+		// Задача покинула очередь - остальные продвинулись
+		q.publishPositions()
+		if !cancelled && q.store != nil {
+			if err := q.store.MarkStarted(job.ID); err != nil {
+				log.Printf("⚠️ %v", err)
+			}
+		}
+		if cancelled {
+			log.Printf("⏭️ Воркер %d пропускает отмененную задачу %s", workerID, job.ID)
+			q.scheduler.finish(job.UserID)
+			continue
+		}
+		
+		log.Printf("🎯 Воркер %d взял задачу %s (приоритет %d, ожидание %v)",
+			workerID, job.ID, job.Priority, time.Since(job.CreatedAt).Round(time.Second))
+		
+		// Обрабатываем задачу
+		q.processJob(workerID, job)
+		q.scheduler.finish(job.UserID)
+		
+		// НЕ удаляем задачу из активных сразу - пусть resultHandler это сделает
 	}
 }
 
@@ -213,14 +409,10 @@ func (q *DownloadQueue) worker(workerID int) {
 func (q *DownloadQueue) processJob(workerID int, job *DownloadJob) {
 	log.Printf("🔄 Воркер %d обрабатывает задачу %s: %s", workerID, job.ID, job.VideoURL)
 	
-	// Обновляем статус
-	job.Status = JobStatusProcessing
-	
-	// Проверяем кэш
-	videoID := extractVideoID(job.VideoURL)
+	// Проверяем кэш: ID и пространство кэша берем из реестра платформ
+	platformInfo := q.platformInfo(job.VideoURL)
+	videoID, platform := platformInfo.VideoID, platformInfo.CacheNamespace
 	if videoID != "" {
-		// Определяем платформу для кэша (по умолчанию YouTube)
-		platform := "youtube"
 		if isCached, cachedVideo, err := q.cacheService.IsVideoCached(videoID, platform, job.FormatID); err == nil && isCached {
 			// Видео в кэше - отправляем результат
 			log.Printf("⚡ Задача %s: видео найдено в кэше", job.ID)
@@ -229,59 +421,135 @@ func (q *DownloadQueue) processJob(workerID int, job *DownloadJob) {
 			q.cacheService.IncrementDownloadCount(videoID, platform, job.FormatID)
 			
 			// Отправляем результат в канал
-			select {
-			case q.results <- JobResult{
+			if q.sendResult(JobResult{
 				JobID:  job.ID,
 				Status: JobStatusCompleted,
 				Result: cachedVideo.FilePath,
-			}:
+			}) {
 				log.Printf("✅ Задача %s: результат кэша отправлен в канал", job.ID)
-			case <-q.ctx.Done():
-				log.Printf("⚠️ Задача %s: контекст отменен при отправке результата кэша", job.ID)
-				return
 			}
 			return
 		}
 	}
 	
-	// Скачиваем видео
-	log.Printf("📥 Задача %s: скачиваю видео...", job.ID)
-	videoPath, err := q.youtubeService.DownloadVideoWithFormat(job.VideoURL, job.FormatID)
+	// Скачиваем видео сервисом платформы
+	service, formatID, err := q.jobService(platformInfo, job.FormatID)
+	if err != nil {
+		log.Printf("❌ Задача %s: %v", job.ID, err)
+		q.sendResult(JobResult{
+			JobID:  job.ID,
+			Status: JobStatusFailed,
+			Error:  err,
+		})
+		return
+	}
+	log.Printf("📥 Задача %s: скачиваю видео %s...", job.ID, platformInfo.DisplayName)
+	videoPath, err := service.DownloadVideoWithProgress(job.ctx, job.VideoURL, formatID, func(progress DownloadProgress) {
+		q.activeJobsMux.Lock()
+		job.Progress = progress
+		q.publish(JobEvent{JobID: job.ID, Type: JobEventProgress, Status: job.Status, Progress: progress})
+		q.activeJobsMux.Unlock()
+	})
+	if err != nil && q.ctx.Err() != nil {
+		// Бот останавливается: задача остается "processing" в хранилище и будет поставлена заново
+		log.Printf("⏸️ Задача %s прервана остановкой очереди", job.ID)
+		return
+	}
+	if err != nil && job.ctx.Err() != nil {
+		log.Printf("✖️ Задача %s: загрузка прервана отменой", job.ID)
+		q.sendResult(JobResult{
+			JobID:  job.ID,
+			Status: JobStatusCancelled,
+			Error:  ErrCancelled,
+		})
+		return
+	}
 	if err != nil {
 		log.Printf("❌ Задача %s: ошибка загрузки: %v", job.ID, err)
-		q.results <- JobResult{
+		q.sendResult(JobResult{
 			JobID:  job.ID,
 			Status: JobStatusFailed,
 			Error:  err,
-		}
+		})
 		return
 	}
 	
-	// Сохраняем в кэш (только для видео, не для аудио)
+	if videoID == "" && platformInfo.Type == PlatformGeneric {
+		// ID ссылки с произвольного сайта известен только после ответа yt-dlp
+		platformInfo = q.platformInfo(job.VideoURL)
+		videoID, platform = platformInfo.VideoID, platformInfo.CacheNamespace
+	}
+	
+	// Сохраняем в кэш (только для видео, не для аудио). Одинаковые задачи, скачанные вместе,
+	// получают личные копии файла - в кэш попадает копия первой из них, а остальные вместо
+	// своих копий отдают закэшированный файл
 	if videoID != "" && !isAudioFile(videoPath) {
-		if fileInfo, err := os.Stat(videoPath); err == nil {
-			// Находим разрешение для формата
-			formats, _ := q.youtubeService.GetVideoFormats(job.VideoURL)
-			var resolution string
-			for _, f := range formats {
-				if f.ID == job.FormatID {
-					resolution = f.Resolution
-					break
+		if isCached, cachedVideo, err := q.cacheService.IsVideoCached(videoID, platform, job.FormatID); err == nil && isCached {
+			if cachedVideo.FilePath != videoPath {
+				log.Printf("💾 Задача %s: файл уже добавлен в кэш другой задачей, удаляю свою копию", job.ID)
+				if err := os.Remove(videoPath); err != nil {
+					log.Printf("⚠️ Задача %s: не удалось удалить копию %s: %v", job.ID, videoPath, err)
 				}
+				videoPath = cachedVideo.FilePath
 			}
-			
-			// Добавляем в кэш
-			if err := q.cacheService.AddToCache(videoID, "youtube", job.VideoURL, "YouTube Video", job.FormatID, resolution, videoPath, fileInfo.Size()); err != nil {
+		} else if fileInfo, err := os.Stat(videoPath); err == nil {
+			// Разрешение известно с выбора формата - повторно yt-dlp не спрашиваем
+			if err := q.cacheService.AddToCache(videoID, platform, job.VideoURL, platformInfo.DisplayName+" Video", job.FormatID, job.Resolution, videoPath, fileInfo.Size()); err != nil {
 				log.Printf("⚠️ Задача %s: не удалось добавить в кэш: %v", job.ID, err)
 			}
 		}
 	}
 	
 	log.Printf("✅ Задача %s: загрузка завершена: %s", job.ID, videoPath)
-	q.results <- JobResult{
+	q.sendResult(JobResult{
 		JobID:  job.ID,
 		Status: JobStatusCompleted,
 		Result: videoPath,
+	})
+}
+
+// platformInfo определяет платформу ссылки задачи; ссылки с произвольных сайтов
+// понимает только UniversalService
+func (q *DownloadQueue) platformInfo(url string) *PlatformInfo {
+	if q.universalService != nil {
+		return q.universalService.GetPlatformInfo(url)
+	}
+	return NewPlatformDetector().DetectPlatform(url)
+}
+
+// jobDownloader - сервис, который скачивает видео задачи: YouTubeService или UniversalService
+type jobDownloader interface {
+	DownloadVideoWithProgress(ctx context.Context, url, formatID string, onProgress ProgressFunc) (string, error)
+}
+
+// jobService выбирает сервис для платформы задачи. Форматы пакетных загрузок - ID форматов
+// YouTube, на других платформах вместо них берется формат платформы по умолчанию и лучший звук.
+func (q *DownloadQueue) jobService(platformInfo *PlatformInfo, formatID string) (jobDownloader, string, error) {
+	if platformInfo.Type == PlatformYouTube || platformInfo.Type == PlatformYouTubeShorts {
+		return q.youtubeService, formatID, nil
+	}
+	if q.universalService == nil || !platformInfo.Supported || platformInfo.Collection {
+		return nil, "", fmt.Errorf("платформа %s не поддерживается очередью", platformInfo.DisplayName)
+	}
+	switch formatID {
+	case BatchVideoFormat:
+		formatID = DefaultVideoFormat
+	case BatchAudioFormat:
+		formatID = "bestaudio"
+	}
+	return q.universalService, formatID, nil
+}
+
+// sendResult передает результат задачи обработчику. После остановки очереди обработчик
+// результатов уже не читает канал, поэтому результат отбрасывается: задача остается
+// "processing" в хранилище и будет поставлена заново при следующем запуске
+func (q *DownloadQueue) sendResult(result JobResult) bool {
+	select {
+	case q.results <- result:
+		return true
+	case <-q.ctx.Done():
+		log.Printf("⚠️ Задача %s: очередь остановлена, результат не отправлен", result.JobID)
+		return false
 	}
 }
 
@@ -299,19 +567,18 @@ func (q *DownloadQueue) resultHandler() {
 			// Обновляем статус задачи в активных задачах
 			q.activeJobsMux.Lock()
 			if job, exists := q.activeJobs[result.JobID]; exists {
-				job.Status = result.Status
-				job.Result = result.Result
-				job.Error = result.Error
-				log.Printf("✅ Обновлен статус задачи %s: %s", result.JobID, result.Status)
+				// Отмененная задача остается отмененной, даже если загрузка успела завершиться
+				if job.Status != JobStatusCancelled {
+					job.Status = result.Status
+					job.Result = result.Result
+					job.Error = result.Error
+				}
+				job.cancel()
+				q.saveStatus(job)
+				log.Printf("✅ Обновлен статус задачи %s: %s", result.JobID, job.Status)
 				
-				// Даем время monitorJob обработать завершенную задачу
-				go func(jobID string) {
-					time.Sleep(5 * time.Second) // Ждем 5 секунд
-					q.activeJobsMux.Lock()
-					delete(q.activeJobs, jobID)
-					log.Printf("🗑️ Задача %s удалена из активных после обработки результата", jobID)
-					q.activeJobsMux.Unlock()
-				}(result.JobID)
+				// Результат остается доступен подписчикам и GetJobStatus в течение retention
+				q.finishJob(job)
 			} else {
 				log.Printf("⚠️ Задача %s не найдена в активных при обработке результата", result.JobID)
 			}
@@ -332,7 +599,7 @@ func (q *DownloadQueue) GetQueueStats() map[string]interface{} {
 	stats := map[string]interface{}{
 		"workers":        q.workers,
 		"active_jobs":    len(q.activeJobs),
-		"queue_length":   len(q.jobs),
+		"queue_length":   q.scheduler.len(),
 		"results_buffer": len(q.results),
 	}
 	
@@ -349,5 +616,5 @@ func (q *DownloadQueue) GetQueueStats() map[string]interface{} {
 // isAudioFile проверяет, является ли файл аудио
 func isAudioFile(filePath string) bool {
 	ext := strings.ToLower(filepath.Ext(filePath))
-	return ext == ".mp3" || ext == ".m4a" || ext == ".webm" || ext == ".ogg"
+	return ext == ".webm" || IsAudioExtension(ext)
 }
\ No newline at end of file
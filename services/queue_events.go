@@ -0,0 +1,304 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// defaultResultRetention - сколько результат завершенной задачи доступен после завершения
+const defaultResultRetention = 10 * time.Minute
+
+// JobEventType - тип события задачи
+type JobEventType string
+
+const (
+	JobEventStatus   JobEventType = "status"   // Сменился статус задачи
+	JobEventPosition JobEventType = "position" // Сменилась позиция ожидающей задачи
+	JobEventProgress JobEventType = "progress" // Новый прогресс скачивания
+	JobEventDone     JobEventType = "done"     // Итоговый результат, последнее событие подписки
+)
+
+// JobEvent - событие задачи, доставляемое подписчикам
+type JobEvent struct {
+	JobID    string
+	Type     JobEventType
+	Status   JobStatus
+	Position int              // Позиция в очереди (для JobEventPosition)
+	Queued   int              // Сколько задач пользователя ждет (для JobEventPosition)
+	Progress DownloadProgress // Прогресс (для JobEventProgress)
+	Result   string           // Путь к файлу (для JobEventDone)
+	Error    error            // Ошибка (для JobEventDone)
+}
+
+// jobSubscriber доставляет события одному подписчику через собственную горутину,
+// чтобы медленный получатель не тормозил очередь. Смена статуса и итог не теряются,
+// а прогресс схлопывается до последнего значения.
+type jobSubscriber struct {
+	out  chan JobEvent
+	wake chan struct{}
+	quit chan struct{}
+	once sync.Once
+
+	mu           sync.Mutex
+	events       []JobEvent
+	progress     *JobEvent
+	lastPosition int
+	closed       bool // Итог отправлен в очередь доставки или подписка отменена
+}
+
+// newJobSubscriber создает подписчика и запускает доставку событий
+func newJobSubscriber() *jobSubscriber {
+	s := &jobSubscriber{
+		out:  make(chan JobEvent),
+		wake: make(chan struct{}, 1),
+		quit: make(chan struct{}),
+	}
+	go s.pump()
+	return s
+}
+
+// push ставит событие в очередь доставки, никогда не блокируясь
+func (s *jobSubscriber) push(event JobEvent) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	if event.Type == JobEventProgress {
+		s.progress = &event
+	} else {
+		// Отложенный прогресс доставляем раньше события, пришедшего после него
+		if s.progress != nil {
+			s.events = append(s.events, *s.progress)
+			s.progress = nil
+		}
+		s.events = append(s.events, event)
+		if event.Type == JobEventDone {
+			s.closed = true
+		}
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// pump отправляет события в out и закрывает его после итогового события
+func (s *jobSubscriber) pump() {
+	defer close(s.out)
+	for {
+		s.mu.Lock()
+		var event *JobEvent
+		if len(s.events) > 0 {
+			next := s.events[0]
+			s.events = s.events[1:]
+			event = &next
+		} else if s.progress != nil {
+			event = s.progress
+			s.progress = nil
+		}
+		finished := s.closed && event == nil
+		s.mu.Unlock()
+
+		if finished {
+			return
+		}
+		if event == nil {
+			select {
+			case <-s.wake:
+				continue
+			case <-s.quit:
+				return
+			}
+		}
+
+		select {
+		case s.out <- *event:
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// stop прекращает доставку и закрывает канал событий
+func (s *jobSubscriber) stop() {
+	s.once.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+		close(s.quit)
+	})
+}
+
+// SetResultRetention задает, сколько результат завершенной задачи доступен через
+// GetJobStatus и Subscribe после завершения
+func (q *DownloadQueue) SetResultRetention(retention time.Duration) {
+	q.activeJobsMux.Lock()
+	q.retention = retention
+	q.activeJobsMux.Unlock()
+}
+
+// Subscribe подписывается на события задачи: смену статуса, позицию в очереди, прогресс и итог.
+// Первым приходит текущее состояние задачи. Итоговое событие JobEventDone доставляется
+// ровно один раз, после него канал закрывается. Для уже завершенной задачи (в пределах
+// срока хранения результата) сразу приходит JobEventDone. unsubscribe закрывает канал досрочно.
+func (q *DownloadQueue) Subscribe(jobID string) (events <-chan JobEvent, unsubscribe func(), err error) {
+	q.activeJobsMux.Lock()
+	defer q.activeJobsMux.Unlock()
+
+	sub := newJobSubscriber()
+	unsubscribe = func() {
+		sub.stop()
+		q.activeJobsMux.Lock()
+		q.removeSubscriber(jobID, sub)
+		q.activeJobsMux.Unlock()
+	}
+
+	if job, exists := q.finishedJobs[jobID]; exists {
+		sub.push(doneEvent(job))
+		return sub.out, unsubscribe, nil
+	}
+
+	job, exists := q.activeJobs[jobID]
+	if !exists {
+		sub.stop()
+		return nil, nil, fmt.Errorf("задача не найдена")
+	}
+
+	sub.push(JobEvent{JobID: jobID, Type: JobEventStatus, Status: job.Status})
+	switch job.Status {
+	case JobStatusPending:
+		if position := q.scheduler.position(jobID); position > 0 {
+			sub.lastPosition = position
+			sub.push(JobEvent{JobID: jobID, Type: JobEventPosition, Status: job.Status,
+				Position: position, Queued: q.scheduler.queuedFor(job.UserID)})
+		}
+	case JobStatusProcessing:
+		if job.Progress.Status != "" {
+			sub.push(JobEvent{JobID: jobID, Type: JobEventProgress, Status: job.Status, Progress: job.Progress})
+		}
+	}
+
+	q.subscribers[jobID] = append(q.subscribers[jobID], sub)
+	return sub.out, unsubscribe, nil
+}
+
+// removeSubscriber удаляет подписчика задачи (вызывается под activeJobsMux)
+func (q *DownloadQueue) removeSubscriber(jobID string, sub *jobSubscriber) {
+	subs := q.subscribers[jobID]
+	for i, s := range subs {
+		if s == sub {
+			subs = append(subs[:i], subs[i+1:]...)
+			break
+		}
+	}
+	if len(subs) == 0 {
+		delete(q.subscribers, jobID)
+	} else {
+		q.subscribers[jobID] = subs
+	}
+}
+
+// publish рассылает событие подписчикам задачи (вызывается под activeJobsMux)
+func (q *DownloadQueue) publish(event JobEvent) {
+	for _, sub := range q.subscribers[event.JobID] {
+		sub.push(event)
+	}
+}
+
+// publishStatus рассылает текущий статус задачи (вызывается под activeJobsMux)
+func (q *DownloadQueue) publishStatus(job *DownloadJob) {
+	q.publish(JobEvent{JobID: job.ID, Type: JobEventStatus, Status: job.Status})
+}
+
+// publishPositions рассылает новые позиции ожидающих задач, на которые есть подписчики
+func (q *DownloadQueue) publishPositions() {
+	q.activeJobsMux.Lock()
+	defer q.activeJobsMux.Unlock()
+
+	for jobID, subs := range q.subscribers {
+		job, exists := q.activeJobs[jobID]
+		if !exists || job.Status != JobStatusPending {
+			continue
+		}
+		position := q.scheduler.position(jobID)
+		if position == 0 {
+			continue
+		}
+		event := JobEvent{JobID: jobID, Type: JobEventPosition, Status: job.Status,
+			Position: position, Queued: q.scheduler.queuedFor(job.UserID)}
+		for _, sub := range subs {
+			if sub.lastPosition != position {
+				sub.lastPosition = position
+				sub.push(event)
+			}
+		}
+	}
+}
+
+// finishJob переносит задачу в завершенные и рассылает итог (вызывается под activeJobsMux).
+// Повторные вызовы для той же задачи ничего не делают.
+func (q *DownloadQueue) finishJob(job *DownloadJob) {
+	if _, exists := q.activeJobs[job.ID]; !exists {
+		return
+	}
+	delete(q.activeJobs, job.ID)
+	job.finishedAt = time.Now()
+	q.finishedJobs[job.ID] = job
+
+	q.publish(doneEvent(job))
+	delete(q.subscribers, job.ID)
+}
+
+// doneEvent формирует итоговое событие задачи
+func doneEvent(job *DownloadJob) JobEvent {
+	return JobEvent{
+		JobID:  job.ID,
+		Type:   JobEventDone,
+		Status: job.Status,
+		Result: job.Result,
+		Error:  job.Error,
+	}
+}
+
+// closeSubscribers закрывает все подписки (при остановке очереди)
+func (q *DownloadQueue) closeSubscribers() {
+	q.activeJobsMux.Lock()
+	defer q.activeJobsMux.Unlock()
+
+	for jobID, subs := range q.subscribers {
+		for _, sub := range subs {
+			sub.stop()
+		}
+		delete(q.subscribers, jobID)
+	}
+}
+
+// retentionCleaner удаляет результаты задач, срок хранения которых истек
+func (q *DownloadQueue) retentionCleaner() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			q.activeJobsMux.Lock()
+			for jobID, job := range q.finishedJobs {
+				if time.Since(job.finishedAt) > q.retention {
+					delete(q.finishedJobs, jobID)
+					log.Printf("🗑️ Результат задачи %s удален по истечении срока хранения", jobID)
+				}
+			}
+			q.activeJobsMux.Unlock()
+
+		case <-q.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// drainEvents читает события до закрытия канала
+func drainEvents(t *testing.T, events <-chan JobEvent) []JobEvent {
+	t.Helper()
+	var got []JobEvent
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return got
+			}
+			got = append(got, event)
+		case <-timeout:
+			t.Fatalf("events channel not closed, got %+v", got)
+		}
+	}
+}
+
+func TestJobSubscriberDeliveryOrder(t *testing.T) {
+	sub := newJobSubscriber()
+	progress := func(percent float64) JobEvent {
+		return JobEvent{Type: JobEventProgress, Progress: DownloadProgress{Percent: percent}}
+	}
+
+	// Никто не читает: прогресс схлопывается до последнего значения, но остается
+	// перед событием, пришедшим после него
+	sub.push(JobEvent{Type: JobEventStatus, Status: JobStatusProcessing})
+	sub.push(progress(10))
+	sub.push(progress(20))
+	sub.push(progress(30))
+	sub.push(JobEvent{Type: JobEventStatus, Status: JobStatusCompleted})
+	sub.push(JobEvent{Type: JobEventDone, Status: JobStatusCompleted, Result: "video.mp4"})
+	// После итога события не доставляются
+	sub.push(progress(40))
+	sub.push(JobEvent{Type: JobEventDone, Status: JobStatusFailed})
+
+	var got []string
+	for _, event := range drainEvents(t, sub.out) {
+		switch event.Type {
+		case JobEventProgress:
+			got = append(got, fmt.Sprintf("progress %.0f", event.Progress.Percent))
+		default:
+			got = append(got, string(event.Type)+" "+string(event.Status))
+		}
+	}
+	want := []string{"status processing", "progress 30", "status completed", "done completed"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events %v, want %v", got, want)
+	}
+}
+
+func TestJobSubscriberSlowReaderDoesNotBlockPush(t *testing.T) {
+	sub := newJobSubscriber()
+	defer sub.stop()
+
+	pushed := make(chan struct{})
+	go func() {
+		for i := 0; i < 10000; i++ {
+			sub.push(JobEvent{Type: JobEventProgress, Progress: DownloadProgress{Percent: float64(i % 100)}})
+			if i%1000 == 0 {
+				sub.push(JobEvent{Type: JobEventPosition, Position: i/1000 + 1})
+			}
+		}
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("push blocked on a subscriber that does not read")
+	}
+
+	// Позиции не теряются, а прогресс между ними схлопывается до одного события
+	sub.push(JobEvent{Type: JobEventDone})
+	events := drainEvents(t, sub.out)
+	var positions []int
+	progress := 0
+	for _, event := range events {
+		switch event.Type {
+		case JobEventPosition:
+			positions = append(positions, event.Position)
+		case JobEventProgress:
+			progress++
+		}
+	}
+	if want := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}; !reflect.DeepEqual(positions, want) {
+		t.Errorf("positions %v, want %v", positions, want)
+	}
+	if progress > 12 {
+		t.Errorf("%d progress events delivered, want them collapsed", progress)
+	}
+	if last := events[len(events)-1]; last.Type != JobEventDone {
+		t.Errorf("last event %+v, want done", last)
+	}
+}
+
+func TestDownloadQueueUnsubscribeCleansUp(t *testing.T) {
+	queue, _ := newTestQueue(t, NewFakeDownloader(fixtureDir), 1)
+	jobID, err := queue.AddJob(1, 1, "https://www.youtube.com/watch?v=dQw4w9WgXcQ", "18", "", PriorityNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, unsubscribeFirst, err := queue.Subscribe(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, unsubscribeSecond, err := queue.Subscribe(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscribers := func() int {
+		queue.activeJobsMux.Lock()
+		defer queue.activeJobsMux.Unlock()
+		return len(queue.subscribers[jobID])
+	}
+	if n := subscribers(); n != 2 {
+		t.Fatalf("%d subscribers, want 2", n)
+	}
+
+	// Отписка закрывает канал и убирает подписчика; второй продолжает получать события
+	unsubscribeFirst()
+	drainEvents(t, first)
+	if n := subscribers(); n != 1 {
+		t.Errorf("after first unsubscribe: %d subscribers, want 1", n)
+	}
+	unsubscribeFirst()
+
+	initial := <-second
+	if initial.Type != JobEventStatus || initial.Status != JobStatusPending {
+		t.Errorf("first event %+v, want pending status", initial)
+	}
+	if event := <-second; event.Type != JobEventPosition || event.Position != 1 {
+		t.Errorf("second event %+v, want position 1", event)
+	}
+
+	unsubscribeSecond()
+	drainEvents(t, second)
+	queue.activeJobsMux.Lock()
+	_, exists := queue.subscribers[jobID]
+	queue.activeJobsMux.Unlock()
+	if exists {
+		t.Error("job subscribers not removed after the last unsubscribe")
+	}
+
+	if _, _, err := queue.Subscribe("missing"); err == nil {
+		t.Error("Subscribe to an unknown job should fail")
+	}
+}
+
+func TestDownloadQueueSubscribeFinishedJob(t *testing.T) {
+	queue, _ := newTestQueue(t, NewFakeDownloader(mediaFixtureDir(t, "dQw4w9WgXcQ")), 1)
+	queue.Start()
+	defer queue.Stop()
+
+	jobID, err := queue.AddJob(1, 1, "https://www.youtube.com/watch?v=dQw4w9WgXcQ", "18", "", PriorityNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := waitJob(t, queue, jobID)
+
+	// Завершенная задача в пределах срока хранения сразу отдает итог, и только его
+	events, unsubscribe, err := queue.Subscribe(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe()
+	got := drainEvents(t, events)
+	if len(got) != 1 || got[0].Type != JobEventDone || got[0].Result != done.Result {
+		t.Errorf("events for finished job: %+v", got)
+	}
+}
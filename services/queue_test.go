@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mediaFixtureDir копирует фикстуры yt-dlp во временный каталог и добавляет
+// медиафайлы <name>.mp4 для перечисленных видео
+func mediaFixtureDir(t *testing.T, names ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	entries, err := os.ReadDir(fixtureDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if err := copyFile(filepath.Join(fixtureDir, entry.Name()), filepath.Join(dir, entry.Name())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name+".mp4"), []byte("fake video "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// newTestQueue создает очередь на фейковом Downloader с кэшем во временном каталоге
+func newTestQueue(t *testing.T, fake Downloader, workers int) (*DownloadQueue, *CacheService) {
+	t.Helper()
+	cache, err := NewCacheService(t.TempDir(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cache.Close() })
+	downloadDir := t.TempDir()
+	queue := NewDownloadQueue(workers, NewYouTubeServiceWithDownloader(downloadDir, fake),
+		NewUniversalServiceWithDownloader(downloadDir, fake), cache)
+	return queue, cache
+}
+
+// waitJob ждет итогового события задачи
+func waitJob(t *testing.T, queue *DownloadQueue, jobID string) JobEvent {
+	t.Helper()
+	events, unsubscribe, err := queue.Subscribe(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe()
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatalf("job %s: events closed before done", jobID)
+			}
+			if event.Type == JobEventDone {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("job %s did not finish", jobID)
+		}
+	}
+}
+
+func TestDownloadQueueDispatchesByPlatform(t *testing.T) {
+	fake := NewFakeDownloader(mediaFixtureDir(t, "dQw4w9WgXcQ", "7301234567890123456"))
+	queue, cache := newTestQueue(t, fake, 2)
+	queue.Start()
+	defer queue.Stop()
+
+	tests := []struct {
+		url        string
+		formatID   string
+		resolution string
+		namespace  string
+		videoID    string
+	}{
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", "18", "640x360", "youtube", "dQw4w9WgXcQ"},
+		{"https://www.tiktok.com/@user/video/7301234567890123456", BatchVideoFormat, "", "tiktok", "7301234567890123456"},
+	}
+	for _, tt := range tests {
+		jobID, err := queue.AddJob(1, 1, tt.url, tt.formatID, tt.resolution, JobPriority(PriorityHints{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		event := waitJob(t, queue, jobID)
+		if event.Status != JobStatusCompleted || event.Error != nil {
+			t.Fatalf("%s: status %s, error %v", tt.url, event.Status, event.Error)
+		}
+		cached, video, err := cache.IsVideoCached(tt.videoID, tt.namespace, tt.formatID)
+		if err != nil || !cached {
+			t.Fatalf("%s: not cached under %s/%s: %v", tt.url, tt.namespace, tt.videoID, err)
+		}
+		if video.Resolution != tt.resolution {
+			t.Errorf("%s: cached resolution %q, want %q", tt.url, video.Resolution, tt.resolution)
+		}
+	}
+	// Разрешение берется из задачи - yt-dlp повторно не опрашивается
+	for _, call := range fake.Calls() {
+		if strings.HasPrefix(call, "probe ") {
+			t.Errorf("unexpected probe after download: %s", call)
+		}
+	}
+}
+
+// gateDownloader держит скачивания, пока не закрыт release
+type gateDownloader struct {
+	*FakeDownloader
+	release chan struct{}
+}
+
+func (d *gateDownloader) Download(ctx context.Context, req DownloadRequest) (string, error) {
+	select {
+	case <-d.release:
+	case <-ctx.Done():
+		return "", ErrCancelled
+	}
+	return d.FakeDownloader.Download(ctx, req)
+}
+
+// waitWaiters ждет, пока к скачиванию key присоединятся n задач
+func waitWaiters(t *testing.T, key downloadKey, n int) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		inflightDownloads.mu.Lock()
+		joined := 0
+		if call := inflightDownloads.calls[key]; call != nil {
+			joined = len(call.waiters)
+		}
+		inflightDownloads.mu.Unlock()
+		if joined == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d waiters on %+v, want %d", joined, key, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDownloadQueueSharedDownloadLeavesOnlyCachedFile(t *testing.T) {
+	downloader := &gateDownloader{FakeDownloader: NewFakeDownloader(mediaFixtureDir(t, "dQw4w9WgXcQ")), release: make(chan struct{})}
+	queue, cache := newTestQueue(t, downloader, 2)
+	queue.Start()
+	defer queue.Stop()
+
+	url := "https://www.youtube.com/watch?v=dQw4w9WgXcQ"
+	var jobIDs []string
+	for userID := int64(1); userID <= 2; userID++ {
+		jobID, err := queue.AddJob(userID, userID, url, "18", "", JobPriority(PriorityHints{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobIDs = append(jobIDs, jobID)
+	}
+
+	// Ждем, пока обе задачи присоединятся к одному скачиванию
+	waitWaiters(t, downloadKey{platform: "youtube", videoID: "dQw4w9WgXcQ", formatID: "18"}, 2)
+	close(downloader.release)
+
+	var results []string
+	for _, jobID := range jobIDs {
+		event := waitJob(t, queue, jobID)
+		if event.Status != JobStatusCompleted || event.Error != nil {
+			t.Fatalf("job %s: status %s, error %v", jobID, event.Status, event.Error)
+		}
+		results = append(results, event.Result)
+	}
+
+	_, cached, err := cache.IsVideoCached("dQw4w9WgXcQ", "youtube", "18")
+	if err != nil || cached == nil {
+		t.Fatalf("video not cached: %v", err)
+	}
+	for i, result := range results {
+		if result != cached.FilePath {
+			t.Errorf("job %d result = %s, want cached file %s", i, result, cached.FilePath)
+		}
+	}
+	files, _ := filepath.Glob(filepath.Join(filepath.Dir(cached.FilePath), "dQw4w9WgXcQ_18*"))
+	if len(files) != 1 {
+		t.Errorf("files left after shared download: %v", files)
+	}
+}
+
+func TestDownloadQueueStopWithRunningJobs(t *testing.T) {
+	queue, _ := newTestQueue(t, NewFakeDownloader(mediaFixtureDir(t, "dQw4w9WgXcQ")), 4)
+	queue.Start()
+	for i := 0; i < 20; i++ {
+		if _, err := queue.AddJob(int64(i), int64(i), "https://www.youtube.com/watch?v=dQw4w9WgXcQ", "18", "", JobPriority(PriorityHints{})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Останавливаем очередь, пока воркеры еще отправляют результаты:
+	// запись в закрытый канал результатов уронила бы тест
+	stopped := make(chan struct{})
+	go func() {
+		queue.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Stop did not return")
+	}
+
+	for range queue.results {
+	}
+}
@@ -0,0 +1,464 @@
+package services
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Приоритеты задач загрузки (1-10, где 10 - высший)
+const (
+	PriorityMin    = 1
+	PriorityNormal = 5
+	PriorityMax    = 10
+)
+
+// defaultAgingInterval - за это время ожидания эффективный приоритет задачи растет на 1,
+// поэтому задачи с низким приоритетом не голодают под потоком высокоприоритетных
+const defaultAgingInterval = 30 * time.Second
+
+// tinyAudioSize - аудио до этого размера скачивается за секунды и получает бонус к приоритету
+const tinyAudioSize = 10 * 1024 * 1024
+
+// PriorityHints - признаки задачи, от которых зависит ее приоритет
+type PriorityHints struct {
+	IsAdmin   bool
+	IsPremium bool  // Пользователь с Telegram Premium
+	IsAudio   bool  // Выбран аудио формат
+	FileSize  int64 // Ожидаемый размер файла, 0 если неизвестен
+	Cached    bool  // Файл уже есть в кэше
+}
+
+// JobPriority вычисляет приоритет задачи для AddJob
+func JobPriority(hints PriorityHints) int {
+	if hints.IsAdmin {
+		return PriorityMax
+	}
+
+	priority := PriorityNormal
+	if hints.IsPremium {
+		priority += 3
+	}
+	// Маленькое аудио не из кэша освобождает воркер почти сразу - пропускаем его вперед
+	if hints.IsAudio && !hints.Cached && hints.FileSize > 0 && hints.FileSize <= tinyAudioSize {
+		priority += 2
+	}
+	return clampPriority(priority)
+}
+
+// clampPriority приводит приоритет к диапазону PriorityMin..PriorityMax
+func clampPriority(priority int) int {
+	if priority < PriorityMin {
+		return PriorityMin
+	}
+	if priority > PriorityMax {
+		return PriorityMax
+	}
+	return priority
+}
+
+// jobBefore сравнивает эффективные приоритеты: Priority + время ожидания / aging.
+// Все задачи стареют с одинаковой скоростью, поэтому разница эффективных
+// приоритетов не зависит от текущего времени и порядок в куче остается корректным.
+func jobBefore(a, b *DownloadJob, aging time.Duration) bool {
+	diff := float64(a.Priority-b.Priority) + float64(b.CreatedAt.Sub(a.CreatedAt))/float64(aging)
+	if diff != 0 {
+		return diff > 0
+	}
+	return a.CreatedAt.Before(b.CreatedAt)
+}
+
+// scheduledJob - элемент кучи задач
+type scheduledJob struct {
+	job   *DownloadJob
+	index int
+}
+
+// jobHeap - куча задач, упорядоченная по эффективному приоритету, затем по возрасту
+type jobHeap struct {
+	items []*scheduledJob
+	aging time.Duration
+}
+
+func (h *jobHeap) Len() int { return len(h.items) }
+
+func (h *jobHeap) Less(i, j int) bool {
+	return jobBefore(h.items[i].job, h.items[j].job, h.aging)
+}
+
+func (h *jobHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].index = i
+	h.items[j].index = j
+}
+
+func (h *jobHeap) Push(x interface{}) {
+	item := x.(*scheduledJob)
+	item.index = len(h.items)
+	h.items = append(h.items, item)
+}
+
+func (h *jobHeap) Pop() interface{} {
+	old := h.items
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	h.items = old[:len(old)-1]
+	item.index = -1
+	return item
+}
+
+// UserLimits - ограничения на задачи одного пользователя (0 - без ограничения)
+type UserLimits struct {
+	MaxConcurrent int // Сколько задач пользователя могут выполняться одновременно
+	MaxQueued     int // Сколько задач пользователя могут ждать в очереди
+}
+
+// UserLimitError возвращается, когда у пользователя слишком много задач в очереди
+type UserLimitError struct {
+	Queued   int // Сколько задач пользователя уже ждут
+	Limit    int
+	Position int // Позиция ближайшей задачи пользователя в общей очереди (с 1)
+}
+
+func (e *UserLimitError) Error() string {
+	return fmt.Sprintf("у пользователя уже %d задач в очереди (лимит %d), ближайшая на позиции %d",
+		e.Queued, e.Limit, e.Position)
+}
+
+// jobCost - сколько "кредита" DRR стоит запуск одной задачи
+const jobCost = PriorityMax
+
+// userQueue - ожидающие задачи одного пользователя
+type userQueue struct {
+	jobs    jobHeap
+	deficit int // Накопленный кредит deficit round-robin
+	running int // Сколько задач пользователя сейчас выполняется
+}
+
+// jobScheduler - очередь задач с честным разделением между пользователями.
+// Пользователи обслуживаются по кругу (deficit round-robin): при каждом проходе
+// пользователь получает кредит, равный эффективному приоритету его лучшей задачи,
+// а запуск задачи стоит jobCost. Так один пользователь с 30 ссылками не занимает
+// все воркеры, а задачи с высоким приоритетом все равно запускаются чаще.
+// Внутри пользователя задачи упорядочены по эффективному приоритету и возрасту.
+type jobScheduler struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	users    map[int64]*userQueue
+	ring     []int64 // Пользователи с ожидающими задачами, порядок обхода
+	cursor   int
+	byID     map[string]*scheduledJob
+	size     int
+	capacity int
+	limits   UserLimits
+	aging    time.Duration
+	closed   bool
+}
+
+// newJobScheduler создает планировщик на capacity ожидающих задач
+func newJobScheduler(capacity int, aging time.Duration) *jobScheduler {
+	s := &jobScheduler{
+		users:    make(map[int64]*userQueue),
+		byID:     make(map[string]*scheduledJob),
+		capacity: capacity,
+		aging:    aging,
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// setLimits задает ограничения на задачи одного пользователя
+func (s *jobScheduler) setLimits(limits UserLimits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limits = limits
+	s.cond.Broadcast()
+}
+
+// user возвращает очередь пользователя, создавая ее при необходимости
+func (s *jobScheduler) user(userID int64) *userQueue {
+	u, exists := s.users[userID]
+	if !exists {
+		u = &userQueue{jobs: jobHeap{aging: s.aging}}
+		s.users[userID] = u
+	}
+	return u
+}
+
+// forgetUser удаляет очередь пользователя без задач
+func (s *jobScheduler) forgetUser(userID int64) {
+	if u, exists := s.users[userID]; exists && u.jobs.Len() == 0 && u.running == 0 {
+		delete(s.users, userID)
+	}
+}
+
+// removeFromRing убирает пользователя из обхода, сохраняя позицию курсора
+func (s *jobScheduler) removeFromRing(userID int64) {
+	for i, id := range s.ring {
+		if id != userID {
+			continue
+		}
+		s.ring = append(s.ring[:i], s.ring[i+1:]...)
+		if i < s.cursor {
+			s.cursor--
+		}
+		if s.cursor >= len(s.ring) {
+			s.cursor = 0
+		}
+		return
+	}
+}
+
+// push добавляет задачу в очередь
+func (s *jobScheduler) push(job *DownloadJob) error {
+	return s.add(job, true)
+}
+
+// restore возвращает в очередь задачу, восстановленную после перезапуска.
+// Лимит MaxQueued не применяется: пользователь уже однажды поставил эти задачи.
+func (s *jobScheduler) restore(job *DownloadJob) error {
+	return s.add(job, false)
+}
+
+// add добавляет задачу, проверяя лимит MaxQueued, если checkLimits
+func (s *jobScheduler) add(job *DownloadJob, checkLimits bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("очередь остановлена")
+	}
+	if s.size >= s.capacity {
+		return fmt.Errorf("очередь переполнена")
+	}
+
+	u := s.user(job.UserID)
+	if checkLimits && s.limits.MaxQueued > 0 && u.jobs.Len() >= s.limits.MaxQueued {
+		limitErr := &UserLimitError{Queued: u.jobs.Len(), Limit: s.limits.MaxQueued}
+		if len(u.jobs.items) > 0 {
+			limitErr.Position = s.positionLocked(u.jobs.items[0].job.ID)
+		}
+		return limitErr
+	}
+
+	if u.jobs.Len() == 0 {
+		s.ring = append(s.ring, job.UserID)
+	}
+	item := &scheduledJob{job: job}
+	heap.Push(&u.jobs, item)
+	s.byID[job.ID] = item
+	s.size++
+	s.cond.Signal()
+	return nil
+}
+
+// quantum возвращает кредит DRR для задачи - ее эффективный приоритет на момент now
+func (s *jobScheduler) quantum(job *DownloadJob, now time.Time) int {
+	quantum := job.Priority + int(now.Sub(job.CreatedAt)/s.aging)
+	if quantum < 1 {
+		quantum = 1
+	}
+	return quantum
+}
+
+// next выбирает пользователя, чья задача запускается следующей (-1, если все упираются в лимит).
+// Вызывается под s.mu.
+func (s *jobScheduler) next(now time.Time) int {
+	available := 0
+	for _, userID := range s.ring {
+		if !s.atConcurrencyLimit(s.users[userID]) {
+			available++
+		}
+	}
+	if available == 0 {
+		return -1
+	}
+
+	for {
+		userID := s.ring[s.cursor]
+		u := s.users[userID]
+		if s.atConcurrencyLimit(u) {
+			s.cursor = (s.cursor + 1) % len(s.ring)
+			continue
+		}
+		if u.deficit >= jobCost {
+			return s.cursor
+		}
+		u.deficit += s.quantum(u.jobs.items[0].job, now)
+		if u.deficit >= jobCost {
+			return s.cursor
+		}
+		s.cursor = (s.cursor + 1) % len(s.ring)
+	}
+}
+
+// atConcurrencyLimit проверяет, выполняет ли пользователь максимум задач
+func (s *jobScheduler) atConcurrencyLimit(u *userQueue) bool {
+	return s.limits.MaxConcurrent > 0 && u.running >= s.limits.MaxConcurrent
+}
+
+// pop ждет и возвращает следующую задачу. Возвращает false, если планировщик закрыт.
+// После выполнения задачи нужно вызвать finish.
+func (s *jobScheduler) pop() (*DownloadJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		if s.closed {
+			return nil, false
+		}
+		if s.size > 0 {
+			if index := s.next(time.Now()); index >= 0 {
+				return s.take(index), true
+			}
+		}
+		s.cond.Wait()
+	}
+}
+
+// take извлекает лучшую задачу пользователя из ring[index]. Вызывается под s.mu.
+func (s *jobScheduler) take(index int) *DownloadJob {
+	userID := s.ring[index]
+	u := s.users[userID]
+
+	item := heap.Pop(&u.jobs).(*scheduledJob)
+	delete(s.byID, item.job.ID)
+	s.size--
+	u.deficit -= jobCost
+	u.running++
+
+	// Пользователь без ожидающих задач выходит из обхода и теряет накопленный кредит
+	if u.jobs.Len() == 0 {
+		u.deficit = 0
+		s.removeFromRing(userID)
+	} else if u.deficit < jobCost {
+		s.cursor = (index + 1) % len(s.ring)
+	}
+	return item.job
+}
+
+// finish отмечает завершение задачи пользователя, освобождая место под его следующую задачу
+func (s *jobScheduler) finish(userID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, exists := s.users[userID]; exists && u.running > 0 {
+		u.running--
+		s.forgetUser(userID)
+	}
+	s.cond.Broadcast()
+}
+
+// remove убирает ожидающую задачу из очереди
+func (s *jobScheduler) remove(jobID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, exists := s.byID[jobID]
+	if !exists {
+		return false
+	}
+	userID := item.job.UserID
+	u := s.users[userID]
+	heap.Remove(&u.jobs, item.index)
+	delete(s.byID, jobID)
+	s.size--
+	if u.jobs.Len() == 0 {
+		u.deficit = 0
+		s.removeFromRing(userID)
+		s.forgetUser(userID)
+	}
+	return true
+}
+
+// position возвращает позицию ожидающей задачи в очереди (с 1), 0 если задача не ждет
+func (s *jobScheduler) position(jobID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.positionLocked(jobID)
+}
+
+// positionLocked моделирует порядок выдачи задач (без учета лимита одновременных задач),
+// не меняя состояние планировщика. Вызывается под s.mu.
+func (s *jobScheduler) positionLocked(jobID string) int {
+	if _, exists := s.byID[jobID]; !exists {
+		return 0
+	}
+
+	// Копия состояния: отсортированные задачи и кредит каждого пользователя
+	type simUser struct {
+		jobs    []*DownloadJob
+		deficit int
+	}
+	ring := append([]int64(nil), s.ring...)
+	users := make(map[int64]*simUser, len(ring))
+	for _, userID := range ring {
+		u := s.users[userID]
+		sim := &simUser{deficit: u.deficit}
+		for _, item := range u.jobs.items {
+			sim.jobs = append(sim.jobs, item.job)
+		}
+		sort.Slice(sim.jobs, func(i, j int) bool {
+			return jobBefore(sim.jobs[i], sim.jobs[j], s.aging)
+		})
+		users[userID] = sim
+	}
+
+	now := time.Now()
+	cursor := s.cursor
+	for position := 1; len(ring) > 0; {
+		userID := ring[cursor]
+		u := users[userID]
+		if u.deficit < jobCost {
+			u.deficit += s.quantum(u.jobs[0], now)
+		}
+		if u.deficit < jobCost {
+			cursor = (cursor + 1) % len(ring)
+			continue
+		}
+
+		job := u.jobs[0]
+		if job.ID == jobID {
+			return position
+		}
+		position++
+		u.jobs = u.jobs[1:]
+		u.deficit -= jobCost
+		if len(u.jobs) == 0 {
+			ring = append(ring[:cursor], ring[cursor+1:]...)
+			if cursor >= len(ring) {
+				cursor = 0
+			}
+		} else if u.deficit < jobCost {
+			cursor = (cursor + 1) % len(ring)
+		}
+	}
+	return 0
+}
+
+// queuedFor возвращает количество ожидающих задач пользователя
+func (s *jobScheduler) queuedFor(userID int64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, exists := s.users[userID]; exists {
+		return u.jobs.Len()
+	}
+	return 0
+}
+
+// len возвращает количество ожидающих задач
+func (s *jobScheduler) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// close будит всех ожидающих воркеров и запрещает новые задачи
+func (s *jobScheduler) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.cond.Broadcast()
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// schedJob описывает задачу для планировщика: ID, пользователь, приоритет и сколько она уже ждет
+type schedJob struct {
+	id       string
+	userID   int64
+	priority int
+	waited   time.Duration
+}
+
+// newTestScheduler создает планировщик и кладет в него задачи в заданном порядке
+func newTestScheduler(t *testing.T, aging time.Duration, jobs []schedJob) *jobScheduler {
+	t.Helper()
+	s := newJobScheduler(100, aging)
+	now := time.Now()
+	for i, j := range jobs {
+		job := &DownloadJob{
+			ID:       j.id,
+			UserID:   j.userID,
+			Priority: j.priority,
+			// Наносекунда на задачу сохраняет порядок добавления среди равных
+			CreatedAt: now.Add(-j.waited).Add(time.Duration(i)),
+		}
+		if err := s.push(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+// popAll выдает все задачи, сразу завершая каждую
+func popAll(t *testing.T, s *jobScheduler) []string {
+	t.Helper()
+	var order []string
+	for s.len() > 0 {
+		job, ok := s.pop()
+		if !ok {
+			t.Fatal("scheduler closed")
+		}
+		order = append(order, job.ID)
+		s.finish(job.UserID)
+	}
+	return order
+}
+
+func TestJobPriority(t *testing.T) {
+	tests := []struct {
+		name  string
+		hints PriorityHints
+		want  int
+	}{
+		{"default", PriorityHints{}, PriorityNormal},
+		{"admin", PriorityHints{IsAdmin: true, IsAudio: true, FileSize: 1}, PriorityMax},
+		{"premium", PriorityHints{IsPremium: true}, 8},
+		{"tiny audio", PriorityHints{IsAudio: true, FileSize: 5 << 20}, 7},
+		{"premium tiny audio", PriorityHints{IsPremium: true, IsAudio: true, FileSize: tinyAudioSize}, PriorityMax},
+		{"cached tiny audio", PriorityHints{IsAudio: true, FileSize: 5 << 20, Cached: true}, PriorityNormal},
+		{"large audio", PriorityHints{IsAudio: true, FileSize: tinyAudioSize + 1}, PriorityNormal},
+		{"audio of unknown size", PriorityHints{IsAudio: true}, PriorityNormal},
+		{"tiny video", PriorityHints{FileSize: 1 << 20}, PriorityNormal},
+	}
+	for _, tt := range tests {
+		if got := JobPriority(tt.hints); got != tt.want {
+			t.Errorf("%s: JobPriority = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestJobSchedulerOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		aging time.Duration
+		jobs  []schedJob
+		want  []string
+	}{
+		{
+			name:  "priority within a user",
+			aging: time.Hour,
+			jobs:  []schedJob{{"low", 1, 2, 0}, {"high", 1, 9, 0}, {"normal", 1, 5, 0}},
+			want:  []string{"high", "normal", "low"},
+		},
+		{
+			name:  "equal priority keeps insertion order",
+			aging: time.Hour,
+			jobs:  []schedJob{{"a", 1, 5, 0}, {"b", 1, 5, 0}, {"c", 1, 5, 0}},
+			want:  []string{"a", "b", "c"},
+		},
+		{
+			name:  "users take turns",
+			aging: time.Hour,
+			jobs: []schedJob{
+				{"a1", 1, 5, 0}, {"a2", 1, 5, 0}, {"a3", 1, 5, 0}, {"a4", 1, 5, 0},
+				{"b1", 2, 5, 0}, {"b2", 2, 5, 0},
+			},
+			want: []string{"a1", "b1", "a2", "b2", "a3", "a4"},
+		},
+		{
+			name:  "higher priority user runs more often",
+			aging: time.Hour,
+			jobs: []schedJob{
+				{"a1", 1, 10, 0}, {"a2", 1, 10, 0}, {"a3", 1, 10, 0}, {"a4", 1, 10, 0},
+				{"b1", 2, 5, 0}, {"b2", 2, 5, 0},
+			},
+			want: []string{"a1", "a2", "b1", "a3", "a4", "b2"},
+		},
+		{
+			name:  "aging promotes a long waiting job",
+			aging: time.Minute,
+			jobs:  []schedJob{{"fresh", 1, 9, 0}, {"old", 1, 1, 10 * time.Minute}},
+			want:  []string{"old", "fresh"},
+		},
+		{
+			name:  "aging is not enough yet",
+			aging: time.Minute,
+			jobs:  []schedJob{{"fresh", 1, 9, 0}, {"old", 1, 1, 5 * time.Minute}},
+			want:  []string{"fresh", "old"},
+		},
+	}
+	for _, tt := range tests {
+		s := newTestScheduler(t, tt.aging, tt.jobs)
+		if got := popAll(t, s); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: order %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestJobSchedulerFairnessAcrossUsers(t *testing.T) {
+	// Пользователь с 30 ссылками не должен задерживать единственную задачу другого
+	var jobs []schedJob
+	for i := 0; i < 30; i++ {
+		jobs = append(jobs, schedJob{id: fmt.Sprintf("flood%d", i), userID: 1, priority: PriorityNormal})
+	}
+	jobs = append(jobs, schedJob{id: "single", userID: 2, priority: PriorityNormal})
+
+	s := newTestScheduler(t, time.Hour, jobs)
+	order := popAll(t, s)
+	for i, id := range order {
+		if id == "single" {
+			if i > 1 {
+				t.Errorf("single job dequeued at %d behind the flood: %v", i+1, order)
+			}
+			return
+		}
+	}
+	t.Errorf("single job never dequeued: %v", order)
+}
+
+func TestJobSchedulerPosition(t *testing.T) {
+	s := newTestScheduler(t, time.Hour, []schedJob{
+		{"a1", 1, 5, 0}, {"a2", 1, 5, 0}, {"a3", 1, 5, 0},
+		{"b1", 2, 5, 0},
+		{"c1", 3, 10, 0},
+	})
+
+	// Первый проход дает каждому пользователю кредит по приоритету: только c1 сразу набирает
+	// стоимость запуска, a и b - на втором проходе
+	want := map[string]int{"c1": 1, "a1": 2, "b1": 3, "a2": 4, "a3": 5, "missing": 0}
+	for id, position := range want {
+		if got := s.position(id); got != position {
+			t.Errorf("position(%s) = %d, want %d", id, got, position)
+		}
+	}
+
+	// Отмена задачи сдвигает следующие за ней
+	if !s.remove("b1") {
+		t.Fatal("remove(b1) = false")
+	}
+	want = map[string]int{"c1": 1, "a1": 2, "a2": 3, "a3": 4, "b1": 0}
+	for id, position := range want {
+		if got := s.position(id); got != position {
+			t.Errorf("after remove: position(%s) = %d, want %d", id, got, position)
+		}
+	}
+}
+
+func TestJobSchedulerUserLimits(t *testing.T) {
+	s := newTestScheduler(t, time.Hour, []schedJob{{"a1", 1, 5, 0}, {"a2", 1, 5, 0}, {"b1", 2, 5, 0}})
+	s.setLimits(UserLimits{MaxConcurrent: 1, MaxQueued: 2})
+
+	// Третья ожидающая задача пользователя упирается в MaxQueued
+	err := s.push(&DownloadJob{ID: "a3", UserID: 1, Priority: PriorityNormal, CreatedAt: time.Now()})
+	var limitErr *UserLimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("push over MaxQueued: err = %v", err)
+	}
+	if limitErr.Queued != 2 || limitErr.Limit != 2 || limitErr.Position != 1 {
+		t.Errorf("limit error = %+v", limitErr)
+	}
+
+	// Пока задача пользователя выполняется, вторая его задача ждет
+	first, _ := s.pop()
+	second, _ := s.pop()
+	if first.ID != "a1" || second.ID != "b1" {
+		t.Fatalf("dequeued %s, %s; want a1, b1", first.ID, second.ID)
+	}
+	if index := s.next(time.Now()); index != -1 {
+		t.Errorf("user at MaxConcurrent got a job: next = %d", index)
+	}
+	s.finish(first.UserID)
+	if third, _ := s.pop(); third.ID != "a2" {
+		t.Errorf("after finish dequeued %s, want a2", third.ID)
+	}
+}
+
+func TestJobSchedulerPositionsMatchDequeueOrder(t *testing.T) {
+	// Смесь пользователей, приоритетов и возраста. Возраст - целые минуты плюс полминуты,
+	// чтобы старение не перешло границу между расчетом позиций и выдачей задач.
+	rng := rand.New(rand.NewSource(1))
+	var jobs []schedJob
+	for i := 0; i < 40; i++ {
+		jobs = append(jobs, schedJob{
+			id:       fmt.Sprintf("job%d", i),
+			userID:   int64(rng.Intn(4)),
+			priority: PriorityMin + rng.Intn(PriorityMax),
+			waited:   time.Duration(rng.Intn(6))*time.Minute + 30*time.Second,
+		})
+	}
+	s := newTestScheduler(t, time.Minute, jobs)
+
+	// Позиции, сообщенные до выдачи, - это весь порядок выдачи
+	initial := make(map[string]int)
+	for _, j := range jobs {
+		initial[j.id] = s.position(j.id)
+	}
+	var order []string
+
+	for s.len() > 0 {
+		// Позиции всех ожидающих задач должны совпасть с порядком, в котором их выдаст pop
+		positions := make(map[int]string)
+		for _, j := range jobs {
+			position := s.position(j.id)
+			if position == 0 {
+				continue
+			}
+			if other, taken := positions[position]; taken {
+				t.Fatalf("position %d reported for both %s and %s", position, other, j.id)
+			}
+			positions[position] = j.id
+		}
+		if len(positions) != s.len() {
+			t.Fatalf("%d positions for %d queued jobs", len(positions), s.len())
+		}
+
+		job, _ := s.pop()
+		if positions[1] != job.ID {
+			t.Fatalf("dequeued %s, but position 1 was reported for %s", job.ID, positions[1])
+		}
+		order = append(order, job.ID)
+		s.finish(job.UserID)
+	}
+
+	for i, id := range order {
+		if initial[id] != i+1 {
+			t.Errorf("%s dequeued %d-th, initially reported at position %d", id, i+1, initial[id])
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// downloadKey определяет итоговый файл: запросы с одинаковым ключом пишут в один и тот же путь
+type downloadKey struct {
+	platform string
+	videoID  string
+	formatID string
+}
+
+// inflightDownload - идущее скачивание, к которому присоединяются одинаковые запросы
+type inflightDownload struct {
+	done   chan struct{}
+	path   string
+	err    error
+	cancel context.CancelFunc
+
+	waiters   map[int]ProgressFunc // Ожидающие запросы и их получатели прогресса
+	last      *DownloadProgress    // Последнее событие - сразу отдаем присоединившимся
+	abandoned bool                 // Все ожидающие ушли, скачивание отменяется
+
+	// Личные копии результата, если его ждали несколько запросов: каждый обрабатывает
+	// и удаляет свой файл, не мешая остальным (nil - ожидающий был один)
+	copies map[int]waiterCopy
+}
+
+// waiterCopy - личная копия скачанного файла для одного ожидающего
+type waiterCopy struct {
+	path string
+	err  error
+}
+
+// downloadGroup объединяет одновременные скачивания одного и того же файла:
+// yt-dlp запускается один раз, а результат получают все ожидающие
+type downloadGroup struct {
+	mu         sync.Mutex
+	calls      map[downloadKey]*inflightDownload
+	nextWaiter int
+}
+
+// inflightDownloads общая для всех сервисов: они пишут в одну папку загрузок
+var inflightDownloads = newDownloadGroup()
+
+// newDownloadGroup создает пустую группу скачиваний
+func newDownloadGroup() *downloadGroup {
+	return &downloadGroup{
+		calls: make(map[downloadKey]*inflightDownload),
+	}
+}
+
+// do запускает fn для key или присоединяется к уже идущему скачиванию.
+// fn работает в собственном контексте: отмена ctx отсоединяет только этого ожидающего,
+// а само скачивание отменяется, когда уходят все ожидающие.
+func (g *downloadGroup) do(ctx context.Context, key downloadKey, onProgress ProgressFunc,
+	fn func(ctx context.Context, onProgress ProgressFunc) (string, error)) (string, error) {
+	for {
+		g.mu.Lock()
+		call := g.calls[key]
+
+		// Брошенное скачивание сейчас удаляет свои файлы - дожидаемся его и начинаем заново
+		if call != nil && call.abandoned {
+			g.mu.Unlock()
+			select {
+			case <-call.done:
+				continue
+			case <-ctx.Done():
+				return "", ErrCancelled
+			}
+		}
+
+		shared := call != nil
+		if !shared {
+			downloadCtx, cancel := context.WithCancel(context.Background())
+			call = &inflightDownload{
+				done:    make(chan struct{}),
+				cancel:  cancel,
+				waiters: make(map[int]ProgressFunc),
+			}
+			g.calls[key] = call
+			go g.run(downloadCtx, key, call, fn)
+		}
+
+		g.nextWaiter++
+		waiterID := g.nextWaiter
+		call.waiters[waiterID] = onProgress
+		var last *DownloadProgress
+		if call.last != nil {
+			progress := *call.last
+			last = &progress
+		}
+		g.mu.Unlock()
+
+		if shared {
+			log.Printf("🔗 Присоединяюсь к уже идущему скачиванию %s/%s (формат %s)", key.platform, key.videoID, key.formatID)
+			if last != nil && onProgress != nil {
+				onProgress(*last)
+			}
+		}
+
+		select {
+		case <-call.done:
+			if own, ok := call.copies[waiterID]; ok && call.err == nil {
+				return own.path, own.err
+			}
+			return call.path, call.err
+		case <-ctx.Done():
+			g.leave(call, waiterID)
+			return "", ErrCancelled
+		}
+	}
+}
+
+// run выполняет скачивание и раздает результат всем ожидающим. Если ожидающих несколько,
+// каждый получает свою копию файла, а общий файл удаляется.
+func (g *downloadGroup) run(ctx context.Context, key downloadKey, call *inflightDownload,
+	fn func(ctx context.Context, onProgress ProgressFunc) (string, error)) {
+	path, err := fn(ctx, func(progress DownloadProgress) {
+		g.broadcast(call, progress)
+	})
+
+	// Новые запросы больше не присоединяются к этому скачиванию
+	g.mu.Lock()
+	delete(g.calls, key)
+	var waiterIDs []int
+	for waiterID := range call.waiters {
+		waiterIDs = append(waiterIDs, waiterID)
+	}
+	g.mu.Unlock()
+
+	var copies map[int]waiterCopy
+	if err == nil && len(waiterIDs) > 1 {
+		copies = make(map[int]waiterCopy, len(waiterIDs))
+		for _, waiterID := range waiterIDs {
+			copyPath, copyErr := copyForWaiter(path, waiterID)
+			copies[waiterID] = waiterCopy{path: copyPath, err: copyErr}
+		}
+		if removeErr := os.Remove(path); removeErr != nil {
+			log.Printf("⚠️ Не удалось удалить общий файл %s: %v", path, removeErr)
+		}
+		log.Printf("🔗 Скачивание %s/%s отдано %d ожидающим", key.platform, key.videoID, len(waiterIDs))
+	}
+
+	g.mu.Lock()
+	call.path, call.err = path, err
+	call.copies = copies
+	// Ожидающие, ушедшие пока делались копии, свои файлы уже не заберут
+	for waiterID, own := range copies {
+		if _, waiting := call.waiters[waiterID]; !waiting && own.err == nil {
+			os.Remove(own.path)
+		}
+	}
+	g.mu.Unlock()
+
+	close(call.done)
+	call.cancel()
+}
+
+// copyForWaiter делает личную копию файла для ожидающего waiterID: жесткую ссылку
+// ("video_18_w3.mp4"), а если файловая система их не поддерживает - обычную копию
+func copyForWaiter(path string, waiterID int) (string, error) {
+	ext := filepath.Ext(path)
+	copyPath := fmt.Sprintf("%s_w%d%s", strings.TrimSuffix(path, ext), waiterID, ext)
+	os.Remove(copyPath)
+	if err := os.Link(path, copyPath); err == nil {
+		return copyPath, nil
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("ошибка копирования файла: %v", err)
+	}
+	defer src.Close()
+	dst, err := os.Create(copyPath)
+	if err != nil {
+		return "", fmt.Errorf("ошибка копирования файла: %v", err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(copyPath)
+		return "", fmt.Errorf("ошибка копирования файла: %v", err)
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(copyPath)
+		return "", fmt.Errorf("ошибка копирования файла: %v", err)
+	}
+	return copyPath, nil
+}
+
+// broadcast передает событие прогресса всем ожидающим
+func (g *downloadGroup) broadcast(call *inflightDownload, progress DownloadProgress) {
+	g.mu.Lock()
+	call.last = &progress
+	receivers := make([]ProgressFunc, 0, len(call.waiters))
+	for _, onProgress := range call.waiters {
+		if onProgress != nil {
+			receivers = append(receivers, onProgress)
+		}
+	}
+	g.mu.Unlock()
+
+	for _, onProgress := range receivers {
+		onProgress(progress)
+	}
+}
+
+// leave отсоединяет ожидающего; последний ушедший отменяет скачивание
+func (g *downloadGroup) leave(call *inflightDownload, waiterID int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(call.waiters, waiterID)
+	if own, ok := call.copies[waiterID]; ok && own.err == nil {
+		// Скачивание уже завершилось - личная копия ушедшему не нужна
+		os.Remove(own.path)
+	}
+	if len(call.waiters) == 0 && !call.abandoned {
+		call.abandoned = true
+		call.cancel()
+		log.Printf("✖️ Все ожидающие отменили скачивание - останавливаю yt-dlp")
+	}
+}
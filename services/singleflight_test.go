@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDownloadGroupGivesEachWaiterOwnFile(t *testing.T) {
+	dir := t.TempDir()
+	g := newDownloadGroup()
+	key := downloadKey{platform: "youtube", videoID: "abc", formatID: "18"}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fn := func(ctx context.Context, onProgress ProgressFunc) (string, error) {
+		close(started)
+		<-release
+		path := filepath.Join(dir, "abc_18.mp4")
+		return path, os.WriteFile(path, []byte("video"), 0644)
+	}
+
+	const waiters = 3
+	paths := make([]string, waiters)
+	errs := make([]error, waiters)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		paths[0], errs[0] = g.do(context.Background(), key, nil, fn)
+	}()
+	<-started
+	for i := 1; i < waiters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			paths[i], errs[i] = g.do(context.Background(), key, nil, fn)
+		}(i)
+	}
+	// Ждем, пока все присоединятся к скачиванию
+	for {
+		g.mu.Lock()
+		joined := len(g.calls[key].waiters)
+		g.mu.Unlock()
+		if joined == waiters {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for i := range paths {
+		if errs[i] != nil {
+			t.Fatalf("waiter %d: %v", i, errs[i])
+		}
+		if seen[paths[i]] {
+			t.Fatalf("waiter %d got shared path %s", i, paths[i])
+		}
+		seen[paths[i]] = true
+		data, err := os.ReadFile(paths[i])
+		if err != nil || string(data) != "video" {
+			t.Fatalf("waiter %d: read %s: %q, %v", i, paths[i], data, err)
+		}
+	}
+	// Удаление файла одним ожидающим не задевает остальных
+	if err := os.Remove(paths[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(paths[1]); err != nil {
+		t.Fatalf("copy of waiter 1 disappeared: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "abc_18.mp4")); !os.IsNotExist(err) {
+		t.Fatalf("shared file should be removed, stat err = %v", err)
+	}
+}
+
+func TestDownloadGroupSingleWaiterKeepsPath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "abc_18.mp4")
+	got, err := newDownloadGroup().do(context.Background(), downloadKey{videoID: "abc"}, nil,
+		func(ctx context.Context, onProgress ProgressFunc) (string, error) {
+			return path, os.WriteFile(path, []byte("video"), 0644)
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != path {
+		t.Fatalf("path = %s, want %s", got, path)
+	}
+}
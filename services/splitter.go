@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TelegramMaxFileSize - лимит размера файла локального сервера Telegram Bot API
+const TelegramMaxFileSize = 2000 * 1024 * 1024
+
+// maxSplitAttempts - сколько раз уменьшаем длину части, если ffmpeg выдал слишком большую
+const maxSplitAttempts = 4
+
+// VideoPart - часть видео, разрезанного на куски под лимит Telegram
+type VideoPart struct {
+	Index    int    // Номер части, с 1
+	Count    int    // Всего частей
+	FilePath string // Путь к файлу ("" если локальная копия вытеснена)
+	FileSize int64
+	Duration int // Длительность части в секундах
+}
+
+// PartFormatID возвращает ID формата, под которым хранится file_id части
+func PartFormatID(formatID string, index, count int) string {
+	return fmt.Sprintf("%s_part%dof%d", formatID, index, count)
+}
+
+// PartCaption возвращает подпись части: "Часть 1/3", у первой части - с исходной подписью
+func PartCaption(caption string, part VideoPart) string {
+	title := fmt.Sprintf("📼 Часть %d/%d", part.Index, part.Count)
+	if part.Index == 1 && caption != "" {
+		return title + "\n\n" + caption
+	}
+	return title
+}
+
+// SplitVideo режет видео на части не больше maxPartSize по ключевым кадрам, без перекодирования.
+// Длина части рассчитывается по среднему битрейту; если какая-то часть все равно вышла больше
+// лимита, нарезка повторяется с более короткими частями. После успешной нарезки исходный файл удаляется.
+func SplitVideo(ctx context.Context, videoPath string, maxPartSize int64) ([]VideoPart, error) {
+	info, err := os.Stat(videoPath)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения информации о файле: %v", err)
+	}
+	if maxPartSize <= 0 {
+		maxPartSize = TelegramMaxFileSize
+	}
+
+	duration, err := probeDuration(ctx, videoPath)
+	if err != nil {
+		return nil, err
+	}
+	if duration <= 0 {
+		return nil, fmt.Errorf("не удалось определить длительность видео")
+	}
+
+	segmentTime := segmentDuration(duration, info.Size(), maxPartSize)
+	pattern := strings.TrimSuffix(videoPath, filepath.Ext(videoPath)) + "_part%03d" + filepath.Ext(videoPath)
+
+	// Удаляем части, оставшиеся от прошлой нарезки этого же файла
+	removeFiles(partPaths(pattern))
+
+	for attempt := 1; attempt <= maxSplitAttempts; attempt++ {
+		log.Printf("✂️ Режу видео на части по %.0f сек (попытка %d): %s", segmentTime, attempt, videoPath)
+		paths, err := runSegmenter(ctx, videoPath, pattern, segmentTime)
+		if err != nil {
+			removeFiles(paths)
+			return nil, err
+		}
+
+		parts, fits := collectParts(ctx, paths, maxPartSize)
+		if fits {
+			if err := os.Remove(videoPath); err != nil {
+				log.Printf("⚠️ Не удалось удалить исходный файл после нарезки: %v", err)
+			}
+			log.Printf("✅ Видео разрезано на %d частей", len(parts))
+			return parts, nil
+		}
+
+		removeFiles(paths)
+		segmentTime *= 0.75
+	}
+
+	return nil, fmt.Errorf("не удалось разрезать видео на части до %d байт", maxPartSize)
+}
+
+// segmentDuration возвращает длину части в секундах, при которой части видео длительностью
+// duration секунд и размером fileSize байт укладываются в maxPartSize по среднему битрейту
+func segmentDuration(duration float64, fileSize, maxPartSize int64) float64 {
+	// Запас 10% на неравномерный битрейт и то, что части начинаются с ключевого кадра
+	return duration * float64(maxPartSize) / float64(fileSize) * 0.9
+}
+
+// runSegmenter запускает ffmpeg segment muxer и возвращает пути получившихся частей по порядку
+func runSegmenter(ctx context.Context, videoPath, pattern string, segmentTime float64) ([]string, error) {
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-i", videoPath,
+		"-map", "0",
+		"-c", "copy",
+		"-f", "segment",
+		"-segment_time", strconv.FormatFloat(segmentTime, 'f', 2, 64),
+		"-reset_timestamps", "1",
+		"-segment_format_options", "movflags=+faststart",
+		"-y",
+		pattern,
+	)
+	output, err := cmd.CombinedOutput()
+
+	// Собираем части даже при ошибке, чтобы вызывающий мог их удалить
+	paths := partPaths(pattern)
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return paths, ErrCancelled
+		}
+		log.Printf("❌ Ошибка нарезки видео: %s", string(output))
+		return paths, fmt.Errorf("ошибка нарезки видео: %v", err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("ffmpeg не создал ни одной части")
+	}
+	return paths, nil
+}
+
+// partPaths возвращает существующие файлы частей для шаблона ffmpeg по порядку
+func partPaths(pattern string) []string {
+	paths, _ := filepath.Glob(strings.Replace(pattern, "%03d", "[0-9][0-9][0-9]", 1))
+	sort.Strings(paths)
+	return paths
+}
+
+// collectParts описывает части и проверяет, что каждая укладывается в лимит
+func collectParts(ctx context.Context, paths []string, maxPartSize int64) ([]VideoPart, bool) {
+	parts := make([]VideoPart, 0, len(paths))
+	for i, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || info.Size() > maxPartSize {
+			return nil, false
+		}
+
+		part := VideoPart{Index: i + 1, Count: len(paths), FilePath: path, FileSize: info.Size()}
+		if duration, err := probeDuration(ctx, path); err == nil {
+			part.Duration = int(duration)
+		}
+		parts = append(parts, part)
+	}
+	return parts, true
+}
+
+// probeDuration возвращает длительность файла в секундах по данным ffprobe
+func probeDuration(ctx context.Context, path string) (float64, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "quiet", "-show_entries", "format=duration", "-of", "csv=p=0", path)
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения длительности: %v", err)
+	}
+	duration, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка разбора длительности: %v", err)
+	}
+	return duration, nil
+}
+
+// removeFiles удаляет файлы, игнорируя ошибки
+func removeFiles(paths []string) {
+	for _, path := range paths {
+		os.Remove(path)
+	}
+}
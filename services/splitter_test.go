@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSegmentDuration(t *testing.T) {
+	const mb = 1 << 20
+	tests := []struct {
+		name        string
+		duration    float64
+		fileSize    int64
+		maxPartSize int64
+		want        float64
+	}{
+		// 3 ГБ за час в части по 2000 МБ: половина с лишним видео минус запас 10%
+		{"two parts", 3600, 3000 * mb, 2000 * mb, 2160},
+		{"ten parts", 1000, 1000 * mb, 100 * mb, 90},
+		// Файл меньше части - длина больше самого видео, получится одна часть
+		{"single part", 600, 50 * mb, 100 * mb, 1080},
+	}
+	for _, tt := range tests {
+		got := segmentDuration(tt.duration, tt.fileSize, tt.maxPartSize)
+		if math.Abs(got-tt.want) > 1e-6 {
+			t.Errorf("%s: segmentDuration = %v, want %v", tt.name, got, tt.want)
+		}
+		// Часть такой длины по среднему битрейту не больше 90% лимита
+		if size := got * float64(tt.fileSize) / tt.duration; size > float64(tt.maxPartSize)*0.9+1 {
+			t.Errorf("%s: average part %.0f bytes exceeds the limit %d", tt.name, size, tt.maxPartSize)
+		}
+	}
+}
+
+func TestPartPathsAndCollectParts(t *testing.T) {
+	dir := t.TempDir()
+	pattern := filepath.Join(dir, "abc_18_part%03d.mp4")
+	sizes := map[string]int{"abc_18_part002.mp4": 30, "abc_18_part000.mp4": 10, "abc_18_part001.mp4": 20}
+	for name, size := range sizes {
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Чужие файлы в том же каталоге не считаются частями
+	for _, name := range []string{"abc_18.mp4", "abc_18_part1.mp4", "abc_137_part000.mp4"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths := partPaths(pattern)
+	want := []string{
+		filepath.Join(dir, "abc_18_part000.mp4"),
+		filepath.Join(dir, "abc_18_part001.mp4"),
+		filepath.Join(dir, "abc_18_part002.mp4"),
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("partPaths = %q, want %q", paths, want)
+	}
+
+	parts, fits := collectParts(context.Background(), paths, 30)
+	if !fits || len(parts) != 3 {
+		t.Fatalf("collectParts(30) = %d parts, fits %v", len(parts), fits)
+	}
+	for i, part := range parts {
+		if part.Index != i+1 || part.Count != 3 || part.FilePath != paths[i] || part.FileSize != int64(10*(i+1)) {
+			t.Errorf("part %d = %+v", i, part)
+		}
+	}
+	// Одна часть больше лимита - нарезку нужно повторить
+	if parts, fits := collectParts(context.Background(), paths, 29); fits || parts != nil {
+		t.Errorf("collectParts(29) = %+v, fits %v", parts, fits)
+	}
+}
+
+func TestPartCaptionAndFormatID(t *testing.T) {
+	first := VideoPart{Index: 1, Count: 3}
+	second := VideoPart{Index: 2, Count: 3}
+	if got := PartCaption("Видео", first); got != "📼 Часть 1/3\n\nВидео" {
+		t.Errorf("first caption = %q", got)
+	}
+	if got := PartCaption("Видео", second); got != "📼 Часть 2/3" {
+		t.Errorf("second caption = %q", got)
+	}
+	if got := PartCaption("", first); got != "📼 Часть 1/3" {
+		t.Errorf("caption without title = %q", got)
+	}
+	if got := PartFormatID("137", 2, 3); got != "137_part2of3" {
+		t.Errorf("PartFormatID = %q", got)
+	}
+}
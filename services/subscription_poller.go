@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// subscriptionPollEntries - сколько последних видео канала смотрим при каждой проверке
+const subscriptionPollEntries = 15
+
+// channelPollPause - пауза между проверками соседних каналов, чтобы не частить запросами к YouTube
+const channelPollPause = 2 * time.Second
+
+// NewVideoHandler получает новое видео канала для одного из подписчиков
+type NewVideoHandler func(sub Subscription, entry PlaylistEntry)
+
+// SubscriptionPoller периодически проверяет каналы из подписок через yt-dlp --flat-playlist.
+// Каждый канал запрашивается один раз за проверку, сколько бы у него ни было подписчиков.
+type SubscriptionPoller struct {
+	store          *SubscriptionStore
+	youtubeService *YouTubeService
+	interval       time.Duration
+	onNewVideo     NewVideoHandler
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewSubscriptionPoller создает планировщик проверки каналов с периодом interval
+func NewSubscriptionPoller(store *SubscriptionStore, youtubeService *YouTubeService, interval time.Duration, onNewVideo NewVideoHandler) *SubscriptionPoller {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &SubscriptionPoller{
+		store:          store,
+		youtubeService: youtubeService,
+		interval:       interval,
+		onNewVideo:     onNewVideo,
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+}
+
+// Start запускает периодическую проверку каналов
+func (p *SubscriptionPoller) Start() {
+	p.wg.Add(1)
+	go p.run()
+	log.Printf("🔔 Проверка подписок запущена (каждые %v)", p.interval)
+}
+
+// Stop останавливает проверку и дожидается завершения текущей
+func (p *SubscriptionPoller) Stop() {
+	p.cancel()
+	p.wg.Wait()
+	log.Printf("🔔 Проверка подписок остановлена")
+}
+
+// run проверяет все каналы раз в interval
+func (p *SubscriptionPoller) run() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.pollAll()
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+// pollAll проверяет каналы по очереди, начиная с давно не проверенных
+func (p *SubscriptionPoller) pollAll() {
+	channels, err := p.store.Channels()
+	if err != nil {
+		log.Printf("⚠️ %v", err)
+		return
+	}
+
+	for i, channel := range channels {
+		if i > 0 {
+			select {
+			case <-time.After(channelPollPause):
+			case <-p.ctx.Done():
+				return
+			}
+		}
+		if err := p.pollChannel(channel); err != nil {
+			log.Printf("⚠️ Не удалось проверить канал %s: %v", channel.URL, err)
+		}
+	}
+}
+
+// pollChannel получает последние видео канала и передает новые всем подписчикам
+func (p *SubscriptionPoller) pollChannel(channel Channel) error {
+	ctx, cancel := context.WithTimeout(p.ctx, 2*time.Minute)
+	defer cancel()
+
+	playlist, err := p.youtubeService.GetLatestVideos(ctx, channel.URL, subscriptionPollEntries)
+	if err != nil {
+		return err
+	}
+
+	entries := make(map[string]PlaylistEntry, len(playlist.Entries))
+	var videoIDs []string
+	// yt-dlp отдает канал от новых видео к старым - рассылаем в порядке выхода
+	for i := len(playlist.Entries) - 1; i >= 0; i-- {
+		entry := playlist.Entries[i]
+		entries[entry.ID] = entry
+		videoIDs = append(videoIDs, entry.ID)
+	}
+
+	fresh, err := p.store.MarkSeen(channel.URL, videoIDs)
+	if err != nil {
+		return err
+	}
+	if len(fresh) == 0 {
+		debugf("🔔 Канал %s: новых видео нет", channel.URL)
+		return nil
+	}
+
+	subscribers, err := p.store.ChannelSubscribers(channel.URL)
+	if err != nil {
+		return err
+	}
+	log.Printf("🔔 Канал %s: новых видео %d, подписчиков %d", channel.Title, len(fresh), len(subscribers))
+	for _, videoID := range fresh {
+		for _, sub := range subscribers {
+			p.onNewVideo(sub, entries[videoID])
+		}
+	}
+	return nil
+}
+
+// Subscribe подписывает пользователя на канал. channel - ссылка на канал или @handle.
+// Текущие видео канала запоминаются как уже вышедшие: присылаются только новые.
+func (p *SubscriptionPoller) Subscribe(userID, chatID int64, channel, format string) (Subscription, error) {
+	channelURL := ChannelURLFromInput(channel)
+	info := NewPlatformDetector().DetectPlatform(channelURL)
+	if info.Type != PlatformYouTubeChannel {
+		return Subscription{}, fmt.Errorf("это не ссылка на канал YouTube")
+	}
+
+	ctx, cancel := context.WithTimeout(p.ctx, 2*time.Minute)
+	defer cancel()
+	playlist, err := p.youtubeService.GetLatestVideos(ctx, PlaylistURL(channelURL), subscriptionPollEntries)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	sub := Subscription{
+		UserID:     userID,
+		ChatID:     chatID,
+		ChannelURL: PlaylistURL(channelURL),
+		Title:      playlist.Uploader,
+		Format:     format,
+	}
+	// Один канал доступен по @handle, /c/ и /channel/UC... - храним по ID канала,
+	// чтобы подписчики разных ссылок делили одну проверку
+	if strings.HasPrefix(playlist.ID, "UC") {
+		sub.ChannelURL = "https://www.youtube.com/channel/" + playlist.ID + "/videos"
+	}
+	if sub.Title == "" {
+		sub.Title = playlist.Title
+	}
+	if sub.Format != SubscriptionAudio {
+		sub.Format = SubscriptionVideo
+	}
+
+	var known []string
+	for _, entry := range playlist.Entries {
+		known = append(known, entry.ID)
+	}
+	if err := p.store.Subscribe(sub, known); err != nil {
+		return Subscription{}, err
+	}
+
+	log.Printf("🔔 Пользователь %d подписался на %s (%s)", userID, sub.Title, sub.ChannelURL)
+	return sub, nil
+}
+
+// ChannelURLFromInput превращает аргумент /subscribe в ссылку: "@handle" и
+// "youtube.com/@handle" дополняются до полного адреса
+func ChannelURLFromInput(input string) string {
+	input = strings.TrimSpace(input)
+	if strings.HasPrefix(input, "@") {
+		return "https://www.youtube.com/" + input
+	}
+	if !strings.HasPrefix(input, "http://") && !strings.HasPrefix(input, "https://") {
+		return "https://" + input
+	}
+	return input
+}
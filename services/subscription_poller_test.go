@@ -0,0 +1,193 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testChannelID = "UCfixtureChannel000000"
+
+// writeChannelFixture записывает последние видео канала (от новых к старым, как отдает yt-dlp)
+// под фикстурами всех перечисленных ссылок на канал
+func writeChannelFixture(t *testing.T, dir string, videoIDs []string, urls ...string) {
+	t.Helper()
+	var entries []map[string]interface{}
+	for _, videoID := range videoIDs {
+		entries = append(entries, map[string]interface{}{
+			"_type": "url", "ie_key": "Youtube", "id": videoID,
+			"url": "https://www.youtube.com/watch?v=" + videoID, "title": "Video " + videoID,
+		})
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"_type": "playlist", "id": testChannelID, "title": "Fixture Channel - Videos",
+		"uploader": "Fixture Channel", "entries": entries,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, url := range urls {
+		if err := os.WriteFile(filepath.Join(dir, fixtureName(url)+".json"), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newTestPoller создает проверку подписок на фейковом Downloader и хранилище во временном
+// каталоге. Новые видео записываются в delivered как "<пользователь>:<ID видео>".
+func newTestPoller(t *testing.T, fixtures string) (*SubscriptionPoller, *SubscriptionStore, *[]string) {
+	t.Helper()
+	store, err := NewSubscriptionStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	var delivered []string
+	service := NewYouTubeServiceWithDownloader(t.TempDir(), NewFakeDownloader(fixtures))
+	poller := NewSubscriptionPoller(store, service, time.Hour, func(sub Subscription, entry PlaylistEntry) {
+		delivered = append(delivered, fmt.Sprintf("%d:%s", sub.UserID, entry.ID))
+	})
+	t.Cleanup(poller.Stop)
+	return poller, store, &delivered
+}
+
+func TestSubscriptionPollerDeliversNewVideos(t *testing.T) {
+	fixtures := t.TempDir()
+	channelURL := "https://www.youtube.com/channel/" + testChannelID + "/videos"
+	handleURL := "https://www.youtube.com/@fixture/videos"
+	writeChannelFixture(t, fixtures, []string{"vid3", "vid2", "vid1"}, channelURL, handleURL)
+	poller, store, delivered := newTestPoller(t, fixtures)
+
+	// Подписки по @handle и по ID канала сводятся к одному каналу
+	first, err := poller.Subscribe(1, 10, "@fixture", SubscriptionVideo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := poller.Subscribe(2, 20, "youtube.com/channel/"+testChannelID, "unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ChannelURL != channelURL || second.ChannelURL != channelURL {
+		t.Fatalf("channel URLs %s, %s; want %s", first.ChannelURL, second.ChannelURL, channelURL)
+	}
+	if first.Title != "Fixture Channel" || second.Format != SubscriptionVideo {
+		t.Errorf("subscription = %+v", second)
+	}
+	if channels, err := store.Channels(); err != nil || len(channels) != 1 {
+		t.Fatalf("channels = %+v, %v", channels, err)
+	}
+
+	// Видео, вышедшие до подписки, не присылаются
+	poller.pollAll()
+	if len(*delivered) != 0 {
+		t.Fatalf("delivered before new videos: %v", *delivered)
+	}
+
+	// Новые видео приходят каждому подписчику в порядке выхода, и только один раз
+	writeChannelFixture(t, fixtures, []string{"vid5", "vid4", "vid3", "vid2", "vid1"}, channelURL)
+	poller.pollAll()
+	want := []string{"1:vid4", "2:vid4", "1:vid5", "2:vid5"}
+	if !reflect.DeepEqual(*delivered, want) {
+		t.Errorf("delivered %v, want %v", *delivered, want)
+	}
+	poller.pollAll()
+	if len(*delivered) != len(want) {
+		t.Errorf("videos delivered twice: %v", *delivered)
+	}
+
+	// После отписки видео получает только оставшийся подписчик
+	unsubscribe := func(userID int64) {
+		t.Helper()
+		subs, err := store.UserSubscriptions(userID)
+		if err != nil || len(subs) != 1 {
+			t.Fatalf("user %d subscriptions = %+v, %v", userID, subs, err)
+		}
+		if removed, err := store.Unsubscribe(userID, subs[0].ID); err != nil || !removed {
+			t.Fatalf("Unsubscribe = %v, %v", removed, err)
+		}
+	}
+	unsubscribe(1)
+	*delivered = nil
+	writeChannelFixture(t, fixtures, []string{"vid6", "vid5", "vid4", "vid3", "vid2", "vid1"}, channelURL)
+	poller.pollAll()
+	if !reflect.DeepEqual(*delivered, []string{"2:vid6"}) {
+		t.Errorf("after unsubscribe delivered %v", *delivered)
+	}
+
+	// Канал без подписчиков больше не проверяется
+	unsubscribe(2)
+	if channels, err := store.Channels(); err != nil || len(channels) != 0 {
+		t.Errorf("channels after last unsubscribe = %+v, %v", channels, err)
+	}
+}
+
+func TestSubscriptionPollerRejectsNonChannel(t *testing.T) {
+	poller, _, _ := newTestPoller(t, fixtureDir)
+	for _, input := range []string{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", "https://vimeo.com/76979871"} {
+		if _, err := poller.Subscribe(1, 1, input, SubscriptionVideo); err == nil {
+			t.Errorf("Subscribe(%s) succeeded", input)
+		}
+	}
+}
+
+func TestSubscriptionStoreMarkSeen(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewSubscriptionStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := Subscription{UserID: 1, ChatID: 1, ChannelURL: "https://www.youtube.com/channel/UC1/videos", Title: "Channel", Format: SubscriptionAudio}
+	if err := store.Subscribe(sub, []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := store.MarkSeen(sub.ChannelURL, []string{"a", "b", "c", "d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fresh, []string{"c", "d"}) {
+		t.Errorf("fresh = %v, want [c d]", fresh)
+	}
+	store.Close()
+
+	// Известные видео и подписки переживают перезапуск
+	store, err = NewSubscriptionStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if fresh, err := store.MarkSeen(sub.ChannelURL, []string{"a", "b", "c", "d"}); err != nil || len(fresh) != 0 {
+		t.Errorf("after reopen fresh = %v, %v", fresh, err)
+	}
+	subs, err := store.UserSubscriptions(1)
+	if err != nil || len(subs) != 1 {
+		t.Fatalf("subscriptions = %+v, %v", subs, err)
+	}
+	if subs[0].FormatID() != BatchAudioFormat || subs[0].Title != "Channel" {
+		t.Errorf("subscription = %+v", subs[0])
+	}
+	if removed, err := store.Unsubscribe(2, subs[0].ID); err != nil || removed {
+		t.Errorf("other user's unsubscribe = %v, %v", removed, err)
+	}
+}
+
+func TestChannelURLFromInput(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"@natgeo", "https://www.youtube.com/@natgeo"},
+		{" youtube.com/@natgeo ", "https://youtube.com/@natgeo"},
+		{"https://www.youtube.com/channel/UC123", "https://www.youtube.com/channel/UC123"},
+		{"http://youtube.com/c/natgeo", "http://youtube.com/c/natgeo"},
+	}
+	for _, tt := range tests {
+		if got := ChannelURLFromInput(tt.input); got != tt.want {
+			t.Errorf("ChannelURLFromInput(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
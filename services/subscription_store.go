@@ -0,0 +1,243 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Форматы, в которых подписчик получает новые видео канала
+const (
+	SubscriptionVideo = "video"
+	SubscriptionAudio = "audio"
+)
+
+// Subscription - подписка пользователя на канал
+type Subscription struct {
+	ID         int64
+	UserID     int64
+	ChatID     int64 // Чат, куда отправляются новые видео
+	ChannelURL string
+	Title      string // Название канала
+	Format     string // SubscriptionVideo или SubscriptionAudio
+	CreatedAt  time.Time
+}
+
+// FormatID возвращает ID формата задачи загрузки для подписки
+func (s Subscription) FormatID() string {
+	if s.Format == SubscriptionAudio {
+		return BatchAudioFormat
+	}
+	return BatchVideoFormat
+}
+
+// Channel - канал, на который есть хотя бы одна подписка
+type Channel struct {
+	URL         string
+	Title       string
+	LastChecked time.Time
+}
+
+// SubscriptionStore хранит подписки на каналы и уже известные видео каналов в SQLite
+type SubscriptionStore struct {
+	db *sql.DB
+}
+
+// NewSubscriptionStore открывает (или создает) subscriptions.db в каталоге dir
+func NewSubscriptionStore(dir string) (*SubscriptionStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("ошибка создания директории подписок: %v", err)
+	}
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "subscriptions.db"))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия БД подписок: %v", err)
+	}
+	// SQLite не любит параллельные записи - используем одно соединение
+	db.SetMaxOpenConns(1)
+
+	if err := createSubscriptionTables(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ошибка создания таблиц подписок: %v", err)
+	}
+	return &SubscriptionStore{db: db}, nil
+}
+
+// createSubscriptionTables создает таблицы каналов, подписок и известных видео
+func createSubscriptionTables(db *sql.DB) error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS channels (
+		url TEXT PRIMARY KEY,
+		title TEXT NOT NULL DEFAULT '',
+		last_checked DATETIME
+	);
+	CREATE TABLE IF NOT EXISTS subscriptions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		chat_id INTEGER NOT NULL,
+		channel_url TEXT NOT NULL,
+		format TEXT NOT NULL DEFAULT 'video',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(user_id, channel_url)
+	);
+	CREATE INDEX IF NOT EXISTS idx_subscriptions_channel ON subscriptions(channel_url);
+	CREATE TABLE IF NOT EXISTS channel_videos (
+		channel_url TEXT NOT NULL,
+		video_id TEXT NOT NULL,
+		seen_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (channel_url, video_id)
+	);
+	`)
+	return err
+}
+
+// Subscribe подписывает пользователя на канал (повторная подписка меняет чат и формат).
+// Видео из known считаются уже вышедшими, чтобы первая проверка не прислала весь канал.
+func (ss *SubscriptionStore) Subscribe(sub Subscription, known []string) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка подписки: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+	INSERT INTO channels (url, title, last_checked) VALUES (?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(url) DO UPDATE SET title = excluded.title
+	`, sub.ChannelURL, sub.Title); err != nil {
+		return fmt.Errorf("ошибка сохранения канала: %v", err)
+	}
+	if _, err := tx.Exec(`
+	INSERT INTO subscriptions (user_id, chat_id, channel_url, format) VALUES (?, ?, ?, ?)
+	ON CONFLICT(user_id, channel_url) DO UPDATE SET chat_id = excluded.chat_id, format = excluded.format
+	`, sub.UserID, sub.ChatID, sub.ChannelURL, sub.Format); err != nil {
+		return fmt.Errorf("ошибка сохранения подписки: %v", err)
+	}
+	for _, videoID := range known {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO channel_videos (channel_url, video_id) VALUES (?, ?)`, sub.ChannelURL, videoID); err != nil {
+			return fmt.Errorf("ошибка сохранения видео канала: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подписки: %v", err)
+	}
+	return nil
+}
+
+// Unsubscribe удаляет подписку пользователя. Канал без подписчиков удаляется вместе
+// с его видео. Возвращает false, если такой подписки не было.
+func (ss *SubscriptionStore) Unsubscribe(userID, subscriptionID int64) (bool, error) {
+	var channelURL string
+	err := ss.db.QueryRow(`SELECT channel_url FROM subscriptions WHERE id = ? AND user_id = ?`, subscriptionID, userID).Scan(&channelURL)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("ошибка поиска подписки: %v", err)
+	}
+
+	if _, err := ss.db.Exec(`DELETE FROM subscriptions WHERE id = ?`, subscriptionID); err != nil {
+		return false, fmt.Errorf("ошибка удаления подписки: %v", err)
+	}
+	if _, err := ss.db.Exec(`
+	DELETE FROM channels WHERE url = ? AND NOT EXISTS (SELECT 1 FROM subscriptions WHERE channel_url = ?)
+	`, channelURL, channelURL); err != nil {
+		return true, fmt.Errorf("ошибка удаления канала: %v", err)
+	}
+	if _, err := ss.db.Exec(`
+	DELETE FROM channel_videos WHERE channel_url = ? AND NOT EXISTS (SELECT 1 FROM channels WHERE url = ?)
+	`, channelURL, channelURL); err != nil {
+		return true, fmt.Errorf("ошибка удаления видео канала: %v", err)
+	}
+	return true, nil
+}
+
+// UserSubscriptions возвращает подписки пользователя
+func (ss *SubscriptionStore) UserSubscriptions(userID int64) ([]Subscription, error) {
+	return ss.querySubscriptions(`WHERE s.user_id = ? ORDER BY s.created_at`, userID)
+}
+
+// ChannelSubscribers возвращает подписчиков канала
+func (ss *SubscriptionStore) ChannelSubscribers(channelURL string) ([]Subscription, error) {
+	return ss.querySubscriptions(`WHERE s.channel_url = ? ORDER BY s.created_at`, channelURL)
+}
+
+// querySubscriptions выбирает подписки с названием канала по условию where
+func (ss *SubscriptionStore) querySubscriptions(where string, args ...interface{}) ([]Subscription, error) {
+	rows, err := ss.db.Query(`
+	SELECT s.id, s.user_id, s.chat_id, s.channel_url, c.title, s.format, s.created_at
+	FROM subscriptions s JOIN channels c ON c.url = s.channel_url `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки подписок: %v", err)
+	}
+	defer rows.Close()
+
+	var subs []Subscription
+	for rows.Next() {
+		var sub Subscription
+		if err := rows.Scan(&sub.ID, &sub.UserID, &sub.ChatID, &sub.ChannelURL, &sub.Title, &sub.Format, &sub.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения подписки: %v", err)
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// Channels возвращает каналы, на которые есть подписки, начиная с давно не проверенных
+func (ss *SubscriptionStore) Channels() ([]Channel, error) {
+	rows, err := ss.db.Query(`SELECT url, title, last_checked FROM channels ORDER BY last_checked`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки каналов: %v", err)
+	}
+	defer rows.Close()
+
+	var channels []Channel
+	for rows.Next() {
+		var channel Channel
+		var lastChecked sql.NullTime
+		if err := rows.Scan(&channel.URL, &channel.Title, &lastChecked); err != nil {
+			return nil, fmt.Errorf("ошибка чтения канала: %v", err)
+		}
+		channel.LastChecked = lastChecked.Time
+		channels = append(channels, channel)
+	}
+	return channels, rows.Err()
+}
+
+// MarkSeen запоминает видео канала и возвращает ID тех, которых раньше не было.
+// Заодно обновляет время проверки канала.
+func (ss *SubscriptionStore) MarkSeen(channelURL string, videoIDs []string) ([]string, error) {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка обновления видео канала: %v", err)
+	}
+	defer tx.Rollback()
+
+	var fresh []string
+	for _, videoID := range videoIDs {
+		result, err := tx.Exec(`INSERT OR IGNORE INTO channel_videos (channel_url, video_id) VALUES (?, ?)`, channelURL, videoID)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сохранения видео канала: %v", err)
+		}
+		if inserted, _ := result.RowsAffected(); inserted > 0 {
+			fresh = append(fresh, videoID)
+		}
+	}
+	if _, err := tx.Exec(`UPDATE channels SET last_checked = CURRENT_TIMESTAMP WHERE url = ?`, channelURL); err != nil {
+		return nil, fmt.Errorf("ошибка обновления канала: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка обновления видео канала: %v", err)
+	}
+	return fresh, nil
+}
+
+// Close закрывает базу данных
+func (ss *SubscriptionStore) Close() error {
+	return ss.db.Close()
+}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Форматы, в которых пользователь получает субтитры
+const (
+	SubtitleSRT        = "srt"
+	SubtitleVTT        = "vtt"
+	SubtitleTranscript = "txt"
+)
+
+// preferredAutoLanguages - автоматические субтитры, которые показываем помимо языка оригинала.
+// YouTube переводит автосубтитры на сотню языков, весь список в меню не нужен.
+var preferredAutoLanguages = map[string]bool{"ru": true, "en": true}
+
+// SubtitleTrack - дорожка субтитров видео
+type SubtitleTrack struct {
+	Language string // Код языка yt-dlp ("en", "ru", "en-orig")
+	Name     string // Название языка от yt-dlp ("English")
+	Auto     bool   // Автоматически созданные субтитры
+}
+
+// Label возвращает подпись дорожки для кнопки
+func (t SubtitleTrack) Label() string {
+	label := t.Name
+	if label == "" {
+		label = t.Language
+	}
+	if t.Auto {
+		return label + " (авто)"
+	}
+	return label
+}
+
+// Key возвращает идентификатор дорожки для ID формата в кэше (без "_")
+func (t SubtitleTrack) Key() string {
+	key := strings.ReplaceAll(t.Language, "_", "")
+	if t.Auto {
+		return key + "-auto"
+	}
+	return key
+}
+
+// SubtitleFormatID возвращает ID видео со вшитыми субтитрами, чтобы оно не пересекалось с обычным
+func SubtitleFormatID(formatID string, track SubtitleTrack) string {
+	return formatID + "-sub" + track.Key()
+}
+
+// Экранирование пути в фильтре ffmpeg: строка -vf разбирается дважды - сначала как граф
+// фильтров (разделители "[],;"), потом как параметры фильтра (разделитель ":").
+// На каждом уровне "\" и "'" тоже спецсимволы.
+var (
+	filterOptionEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`)
+	filterGraphEscaper  = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`)
+)
+
+// SubtitlesFilter возвращает фильтр ffmpeg, вшивающий субтитры из subtitlePath.
+// Имя параметра указано явно, чтобы "=" в пути не принимался за имя параметра.
+func SubtitlesFilter(subtitlePath string) string {
+	return "subtitles=filename=" + filterGraphEscaper.Replace(filterOptionEscaper.Replace(subtitlePath))
+}
+
+// subtitleTracks собирает дорожки из ответа yt-dlp: ручные все, автоматические - только
+// язык оригинала и предпочтительные языки
+func subtitleTracks(manual, automatic map[string][]ytDlpSubtitle) []SubtitleTrack {
+	var tracks []SubtitleTrack
+	for _, auto := range []bool{false, true} {
+		source := manual
+		if auto {
+			source = automatic
+		}
+
+		var languages []string
+		for language, variants := range source {
+			if len(variants) == 0 || language == "live_chat" {
+				continue
+			}
+			if auto && !strings.HasSuffix(language, "-orig") && !preferredAutoLanguages[language] {
+				continue
+			}
+			languages = append(languages, language)
+		}
+		sort.Strings(languages)
+
+		for _, language := range languages {
+			tracks = append(tracks, SubtitleTrack{Language: language, Name: source[language][0].Name, Auto: auto})
+		}
+	}
+	return tracks
+}
+
+// downloadSubtitles скачивает дорожку субтитров без видео и конвертирует ее в format (srt или vtt)
+func downloadSubtitles(ctx context.Context, downloader Downloader, outputDir, url, videoID string, track SubtitleTrack, format string) (string, error) {
+	writeArg := "--write-subs"
+	if track.Auto {
+		writeArg = "--write-auto-subs"
+	}
+
+	req := DownloadRequest{
+		URL:        url,
+		OutputDir:  outputDir,
+		FilePrefix: videoID + "_subs-" + track.Key(),
+		Args: []string{
+			"--skip-download",
+			"--no-playlist",
+			"--no-check-certificates",
+			writeArg,
+			"--sub-langs", track.Language,
+			"--sub-format", "vtt/srt/best",
+			"--convert-subs", format,
+		},
+	}
+	removeOutputFiles(outputDir, req.FilePrefix)
+
+	log.Printf("💬 Скачиваю субтитры %s (%s) для %s", track.Language, format, videoID)
+	path, err := downloader.Download(ctx, req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ErrCancelled
+		}
+		return "", fmt.Errorf("ошибка скачивания субтитров: %v", err)
+	}
+	return path, nil
+}
+
+// DownloadSubtitles скачивает субтитры видео YouTube в формате srt или vtt
+func (s *YouTubeService) DownloadSubtitles(ctx context.Context, videoURL string, track SubtitleTrack, format string) (string, error) {
+	videoID := extractVideoID(videoURL)
+	if videoID == "" {
+		return "", fmt.Errorf("не удалось извлечь ID видео из URL: %s", videoURL)
+	}
+	return downloadSubtitles(ctx, s.downloader, s.downloadDir, videoURL, videoID, track, format)
+}
+
+// DownloadSubtitles скачивает субтитры видео с любой поддерживаемой платформы в формате srt или vtt
+func (us *UniversalService) DownloadSubtitles(ctx context.Context, url string, track SubtitleTrack, format string) (string, error) {
+	platformInfo := us.platformDetector.DetectPlatform(url)
+	if !platformInfo.Supported || platformInfo.VideoID == "" {
+		return "", fmt.Errorf("платформа %s не поддерживается", platformInfo.DisplayName)
+	}
+	return downloadSubtitles(ctx, us.downloader, us.downloadDir, url, platformInfo.VideoID, track, format)
+}
+
+// subtitleTimingLine - строка с таймингом SRT/VTT ("00:00:01,000 --> 00:00:02,000 align:start")
+var subtitleTimingLine = regexp.MustCompile(`^\d{1,2}:\d{2}(:\d{2})?[.,]\d{3}\s+-->`)
+
+// subtitleTags - разметка внутри реплик (<c>, <i>, <00:00:01.000>)
+var subtitleTags = regexp.MustCompile(`<[^>]*>`)
+
+// SubtitlesToTranscript превращает SRT/VTT в сплошной текст: без номеров, таймингов и разметки.
+// Повторы строк, которые дают автоматические субтитры YouTube (реплика повторяется
+// в следующем кадре вместе с новой), убираются.
+func SubtitlesToTranscript(subtitlePath string) (string, error) {
+	file, err := os.Open(subtitlePath)
+	if err != nil {
+		return "", fmt.Errorf("ошибка открытия субтитров: %v", err)
+	}
+	defer file.Close()
+
+	var lines []string
+	inHeader := strings.EqualFold(filepath.Ext(subtitlePath), ".vtt")
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+
+		// Заголовок VTT (WEBVTT, Kind:, Language:) заканчивается первой пустой строкой
+		if inHeader {
+			if line == "" {
+				inHeader = false
+			}
+			continue
+		}
+		if line == "" || subtitleTimingLine.MatchString(line) || isSubtitleIndex(line) ||
+			strings.HasPrefix(line, "NOTE") || strings.HasPrefix(line, "STYLE") {
+			continue
+		}
+
+		text := strings.TrimSpace(subtitleTags.ReplaceAllString(line, ""))
+		text = strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">", "&nbsp;", " ").Replace(text)
+		if text == "" || isRecentLine(lines, text) {
+			continue
+		}
+		lines = append(lines, text)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("ошибка чтения субтитров: %v", err)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// isRecentLine проверяет, что строка совпадает с одной из двух последних
+func isRecentLine(lines []string, text string) bool {
+	for i := len(lines) - 1; i >= 0 && i >= len(lines)-2; i-- {
+		if lines[i] == text {
+			return true
+		}
+	}
+	return false
+}
+
+// isSubtitleIndex проверяет, что строка - номер реплики SRT
+func isSubtitleIndex(line string) bool {
+	for _, r := range line {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteTranscript сохраняет текст субтитров рядом с ними в .txt и возвращает путь
+func WriteTranscript(subtitlePath string) (string, error) {
+	text, err := SubtitlesToTranscript(subtitlePath)
+	if err != nil {
+		return "", err
+	}
+	if text == "" {
+		return "", fmt.Errorf("в субтитрах нет текста")
+	}
+	transcriptPath := strings.TrimSuffix(subtitlePath, filepath.Ext(subtitlePath)) + ".txt"
+	if err := os.WriteFile(transcriptPath, []byte(text+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("ошибка записи текста: %v", err)
+	}
+	return transcriptPath, nil
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSubtitleTracks(t *testing.T) {
+	variants := func(name string) []ytDlpSubtitle { return []ytDlpSubtitle{{Name: name}} }
+	manual := map[string][]ytDlpSubtitle{
+		"ru":        variants("Russian"),
+		"en":        variants("English"),
+		"live_chat": variants("Live chat"),
+		"de":        nil,
+	}
+	automatic := map[string][]ytDlpSubtitle{
+		"en-orig": variants("English (Original)"),
+		"en":      variants("English"),
+		"ru":      variants("Russian"),
+		"fr":      variants("French"),
+		"ja":      variants("Japanese"),
+	}
+
+	// Ручные - все, кроме чата и пустых; автоматические - оригинал и предпочтительные языки
+	want := []SubtitleTrack{
+		{Language: "en", Name: "English"},
+		{Language: "ru", Name: "Russian"},
+		{Language: "en", Name: "English", Auto: true},
+		{Language: "en-orig", Name: "English (Original)", Auto: true},
+		{Language: "ru", Name: "Russian", Auto: true},
+	}
+	if got := subtitleTracks(manual, automatic); !reflect.DeepEqual(got, want) {
+		t.Errorf("tracks = %+v\nwant %+v", got, want)
+	}
+	if got := subtitleTracks(nil, nil); got != nil {
+		t.Errorf("no subtitles: %+v", got)
+	}
+}
+
+func TestSubtitleTrackLabelAndKey(t *testing.T) {
+	tests := []struct {
+		track    SubtitleTrack
+		label    string
+		key      string
+		formatID string
+	}{
+		{SubtitleTrack{Language: "en", Name: "English"}, "English", "en", "18-suben"},
+		{SubtitleTrack{Language: "en-orig", Name: "English (Original)", Auto: true}, "English (Original) (авто)", "en-orig-auto", "18-suben-orig-auto"},
+		{SubtitleTrack{Language: "pt_BR"}, "pt_BR", "ptBR", "18-subptBR"},
+	}
+	for _, tt := range tests {
+		if got := tt.track.Label(); got != tt.label {
+			t.Errorf("%+v: Label = %q, want %q", tt.track, got, tt.label)
+		}
+		if got := tt.track.Key(); got != tt.key {
+			t.Errorf("%+v: Key = %q, want %q", tt.track, got, tt.key)
+		}
+		if got := SubtitleFormatID("18", tt.track); got != tt.formatID {
+			t.Errorf("%+v: SubtitleFormatID = %q, want %q", tt.track, got, tt.formatID)
+		}
+	}
+}
+
+// ffmpegToken повторяет av_get_token из libavutil, которым ffmpeg разбирает строку фильтров:
+// "\" экранирует следующий символ, '...' берется как есть, токен заканчивается на символе из term
+func ffmpegToken(buf, term string) (token, rest string) {
+	buf = strings.TrimLeft(buf, " \n\t\r")
+	var out []byte
+	end := 0 // Длина токена без пробелов в конце
+	i := 0
+	for i < len(buf) && !strings.ContainsRune(term, rune(buf[i])) {
+		c := buf[i]
+		i++
+		switch {
+		case c == '\\' && i < len(buf):
+			out = append(out, buf[i])
+			i++
+			end = len(out)
+		case c == '\'':
+			for i < len(buf) && buf[i] != '\'' {
+				out = append(out, buf[i])
+				i++
+			}
+			if i < len(buf) {
+				i++
+			}
+			end = len(out)
+		default:
+			out = append(out, c)
+			if !strings.ContainsRune(" \n\t\r", rune(c)) {
+				end = len(out)
+			}
+		}
+	}
+	return string(out[:end]), buf[i:]
+}
+
+func TestSubtitlesFilter(t *testing.T) {
+	for _, path := range []string{
+		"/tmp/downloads/dQw4w9WgXcQ_subs-en.srt",
+		"/tmp/My Video: Part 1/subs.srt",
+		"/tmp/it's/don't.srt",
+		`C:\Users\bot\subs.srt`,
+		"/tmp/a,b[1];c.srt",
+		"/tmp/key=value.srt",
+		`/tmp/\':[],;=.srt`,
+	} {
+		filter := SubtitlesFilter(path)
+
+		// Первый уровень: граф фильтров - один фильтр subtitles без лишних разделителей
+		name, args, _ := strings.Cut(filter, "=")
+		if name != "subtitles" {
+			t.Errorf("%s: filter name %q in %s", path, name, filter)
+			continue
+		}
+		options, rest := ffmpegToken(args, "[],;")
+		if rest != "" {
+			t.Errorf("%s: filter graph split at %q in %s", path, rest, filter)
+			continue
+		}
+
+		// Второй уровень: параметры фильтра - ровно один filename с исходным путем
+		value, ok := strings.CutPrefix(options, "filename=")
+		if !ok {
+			t.Errorf("%s: options %q", path, options)
+			continue
+		}
+		if got, rest := ffmpegToken(value, ":"); got != path || rest != "" {
+			t.Errorf("%s: ffmpeg reads filename %q (rest %q) from %s", path, got, rest, filter)
+		}
+	}
+}
+
+func TestSubtitlesToTranscript(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name: "subs.srt",
+			content: "\ufeff1\n00:00:01,000 --> 00:00:02,000\n<i>Привет</i> &amp; добро пожаловать\n\n" +
+				"2\n00:00:02,000 --> 00:00:04,000\nВторая реплика\n",
+			want: "Привет & добро пожаловать\nВторая реплика",
+		},
+		{
+			// Автосубтитры YouTube повторяют предыдущую строку в каждом кадре
+			name: "auto.vtt",
+			content: "WEBVTT\nKind: captions\nLanguage: en\n\n" +
+				"00:00:00.000 --> 00:00:01.000 align:start position:0%\nnever<00:00:00.500><c> gonna</c>\n\n" +
+				"00:00:01.000 --> 00:00:02.000 align:start position:0%\nnever gonna\ngive you up\n\n" +
+				"NOTE комментарий\n\n" +
+				"00:00:02.000 --> 00:00:03.000\ngive you up\n",
+			want: "never gonna\ngive you up",
+		},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := SubtitlesToTranscript(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: transcript %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// Субтитры без текста не превращаются в пустой файл
+	empty := filepath.Join(dir, "empty.srt")
+	if err := os.WriteFile(empty, []byte("1\n00:00:01,000 --> 00:00:02,000\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WriteTranscript(empty); err == nil {
+		t.Error("WriteTranscript of empty subtitles succeeded")
+	}
+}
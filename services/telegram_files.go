@@ -0,0 +1,48 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// BotIDFromToken возвращает ID бота из токена ("123456:ABC..." -> "123456").
+// file_id действителен только для бота, который его получил, поэтому кэш file_id
+// ведется по ID бота, а не по самому токену.
+func BotIDFromToken(token string) string {
+	return strings.SplitN(token, ":", 2)[0]
+}
+
+// sentFile - файл в ответе Telegram
+type sentFile struct {
+	FileID string `json:"file_id"`
+}
+
+// sentMessage - часть ответа sendVideo/sendAudio/sendDocument, содержащая file_id
+type sentMessage struct {
+	Result struct {
+		Video     *sentFile `json:"video"`
+		Audio     *sentFile `json:"audio"`
+		Document  *sentFile `json:"document"`
+		Animation *sentFile `json:"animation"`
+	} `json:"result"`
+}
+
+// ParseSentFileID достает file_id отправленного файла из ответа Telegram ("" если его нет).
+// Telegram может вернуть видео как document или animation, поэтому проверяем все варианты.
+func ParseSentFileID(body []byte) string {
+	var message sentMessage
+	if err := json.Unmarshal(body, &message); err != nil {
+		return ""
+	}
+	switch {
+	case message.Result.Video != nil:
+		return message.Result.Video.FileID
+	case message.Result.Audio != nil:
+		return message.Result.Audio.FileID
+	case message.Result.Document != nil:
+		return message.Result.Document.FileID
+	case message.Result.Animation != nil:
+		return message.Result.Animation.FileID
+	}
+	return ""
+}
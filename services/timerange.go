@@ -0,0 +1,177 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TimeRange - фрагмент видео в секундах. End == 0 означает "до конца видео"
+type TimeRange struct {
+	Start int
+	End   int
+}
+
+// timestampUnitsPattern - отметка времени в формате YouTube: 1h2m3s, 1m20s, 80s
+var timestampUnitsPattern = regexp.MustCompile(`^(?:(\d+)h)?(?:(\d+)m)?(?:(\d+)s)?$`)
+
+// rangeSeparators - разделители начала и конца фрагмента
+var rangeSeparators = []string{"—", "–", "-"}
+
+// String возвращает фрагмент в привычном виде: "01:20-02:45"
+func (r TimeRange) String() string {
+	if r.End == 0 {
+		return FormatTimestamp(r.Start) + "-конец"
+	}
+	return FormatTimestamp(r.Start) + "-" + FormatTimestamp(r.End)
+}
+
+// Key возвращает фрагмент для ключа кэша ("80-165", "80-end")
+func (r TimeRange) Key() string {
+	if r.End == 0 {
+		return fmt.Sprintf("%d-end", r.Start)
+	}
+	return fmt.Sprintf("%d-%d", r.Start, r.End)
+}
+
+// Section возвращает значение --download-sections для yt-dlp ("*80-165", "*80-inf")
+func (r TimeRange) Section() string {
+	if r.End == 0 {
+		return fmt.Sprintf("*%d-inf", r.Start)
+	}
+	return fmt.Sprintf("*%d-%d", r.Start, r.End)
+}
+
+// FitDuration подгоняет фрагмент под видео длительностью duration секунд: конец за пределами
+// видео заменяется на "до конца". false - фрагмент начинается после конца видео.
+// duration <= 0 - длительность неизвестна, фрагмент не меняется.
+func (r TimeRange) FitDuration(duration int) (TimeRange, bool) {
+	if duration <= 0 {
+		return r, true
+	}
+	if r.Start >= duration {
+		return r, false
+	}
+	if r.End >= duration {
+		r.End = 0
+	}
+	return r, true
+}
+
+// ClipFormatID возвращает ID формата, под которым фрагмент хранится в кэше и на диске,
+// чтобы он не пересекался с полным видео
+func ClipFormatID(formatID string, r TimeRange) string {
+	return formatID + "-clip" + r.Key()
+}
+
+// FormatTimestamp форматирует секунды как MM:SS или H:MM:SS
+func FormatTimestamp(seconds int) string {
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+	}
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
+
+// ParseTimestamp разбирает отметку времени: "80", "1:20", "01:02:03", "1m20s", "1h2m3s"
+func ParseTimestamp(value string) (int, bool) {
+	value = strings.TrimSpace(strings.ToLower(value))
+	if value == "" {
+		return 0, false
+	}
+
+	if strings.Contains(value, ":") {
+		parts := strings.Split(value, ":")
+		if len(parts) > 3 {
+			return 0, false
+		}
+		total := 0
+		for i, part := range parts {
+			n, err := strconv.Atoi(part)
+			if err != nil || n < 0 || (i > 0 && n >= 60) {
+				return 0, false
+			}
+			total = total*60 + n
+		}
+		return total, true
+	}
+
+	if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+		return n, true
+	}
+
+	matches := timestampUnitsPattern.FindStringSubmatch(value)
+	if matches == nil {
+		return 0, false
+	}
+	total := 0
+	for i, multiplier := range []int{3600, 60, 1} {
+		if matches[i+1] != "" {
+			n, _ := strconv.Atoi(matches[i+1])
+			total += n * multiplier
+		}
+	}
+	return total, true
+}
+
+// ParseTimeRange разбирает фрагмент вида "01:20-02:45" (также через "–" или "—")
+func ParseTimeRange(text string) (*TimeRange, bool) {
+	text = strings.TrimSpace(text)
+	for _, separator := range rangeSeparators {
+		parts := strings.SplitN(text, separator, 2)
+		if len(parts) != 2 {
+			continue
+		}
+		start, ok := ParseTimestamp(parts[0])
+		if !ok {
+			return nil, false
+		}
+		end, ok := ParseTimestamp(parts[1])
+		if !ok || end <= start {
+			return nil, false
+		}
+		return &TimeRange{Start: start, End: end}, true
+	}
+	return nil, false
+}
+
+// stripRangeParams достает фрагмент из параметров t=, start=, end= и убирает их из ссылки
+func stripRangeParams(link string) (string, *TimeRange) {
+	parsed, err := url.Parse(link)
+	if err != nil || parsed.RawQuery == "" {
+		return link, nil
+	}
+
+	query := parsed.Query()
+	var clip TimeRange
+	found := false
+	for _, key := range []string{"t", "start"} {
+		if value := query.Get(key); value != "" {
+			if seconds, ok := ParseTimestamp(value); ok {
+				clip.Start = seconds
+				found = true
+			}
+		}
+	}
+	if value := query.Get("end"); value != "" {
+		if seconds, ok := ParseTimestamp(value); ok && seconds > clip.Start {
+			clip.End = seconds
+			found = true
+		}
+	}
+	if !found {
+		return link, nil
+	}
+
+	query.Del("t")
+	query.Del("start")
+	query.Del("end")
+	parsed.RawQuery = query.Encode()
+
+	// t=0 без конца - это просто ссылка на начало видео
+	if clip.Start == 0 && clip.End == 0 {
+		return parsed.String(), nil
+	}
+	return parsed.String(), &clip
+}
@@ -0,0 +1,150 @@
+package services
+
+import "testing"
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+		ok    bool
+	}{
+		{"80", 80, true},
+		{"1:20", 80, true},
+		{"01:20", 80, true},
+		{"01:02:03", 3723, true},
+		{"1:02:03", 3723, true},
+		{"90:00", 5400, true},
+		{"1m20s", 80, true},
+		{"1h2m3s", 3723, true},
+		{"45S", 45, true},
+		{" 02:45 ", 165, true},
+		{"1:60", 0, false},
+		{"1:02:60", 0, false},
+		{"1:2:3:4", 0, false},
+		{"-5", 0, false},
+		{"1:-5", 0, false},
+		{"abc", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseTimestamp(tt.value)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("ParseTimestamp(%q) = %d, %v, want %d, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseTimeRange(t *testing.T) {
+	tests := []struct {
+		text string
+		want string // Key() фрагмента, "" - не фрагмент
+	}{
+		{"01:20-02:45", "80-165"},
+		{"1:02:03-1:10:00", "3723-4200"},
+		{"59:30-1:00:30", "3570-3630"},
+		{"01:20 – 02:45", "80-165"},
+		{"01:20—02:45", "80-165"},
+		{"10 - 20", "10-20"},
+		{"1m-1m30s", "60-90"},
+		// Конец раньше начала или совпадает с ним
+		{"02:45-01:20", ""},
+		{"01:20-01:20", ""},
+		{"1:00:00-59:59", ""},
+		{"01:20", ""},
+		{"01:20-", ""},
+		{"a-b", ""},
+		{"01:75-02:00", ""},
+	}
+	for _, tt := range tests {
+		clip, ok := ParseTimeRange(tt.text)
+		got := ""
+		if ok {
+			got = clip.Key()
+		}
+		if got != tt.want {
+			t.Errorf("ParseTimeRange(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTimeRangeFitDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		clip     TimeRange
+		duration int
+		want     string // Key() подогнанного фрагмента, "" - фрагмент вне видео
+	}{
+		{"inside the video", TimeRange{Start: 80, End: 165}, 600, "80-165"},
+		{"end past the duration", TimeRange{Start: 80, End: 900}, 600, "80-end"},
+		{"end at the duration", TimeRange{Start: 80, End: 600}, 600, "80-end"},
+		{"already to the end", TimeRange{Start: 80}, 600, "80-end"},
+		{"start past the duration", TimeRange{Start: 700, End: 800}, 600, ""},
+		{"start at the duration", TimeRange{Start: 600}, 600, ""},
+		{"unknown duration", TimeRange{Start: 700, End: 800}, 0, "700-800"},
+	}
+	for _, tt := range tests {
+		fitted, ok := tt.clip.FitDuration(tt.duration)
+		got := ""
+		if ok {
+			got = fitted.Key()
+		}
+		if got != tt.want {
+			t.Errorf("%s: FitDuration = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTimeRangeFormats(t *testing.T) {
+	tests := []struct {
+		clip    TimeRange
+		str     string
+		key     string
+		section string
+	}{
+		{TimeRange{Start: 80, End: 165}, "01:20-02:45", "80-165", "*80-165"},
+		{TimeRange{Start: 3723, End: 4200}, "1:02:03-1:10:00", "3723-4200", "*3723-4200"},
+		{TimeRange{Start: 90}, "01:30-конец", "90-end", "*90-inf"},
+	}
+	for _, tt := range tests {
+		if got := tt.clip.String(); got != tt.str {
+			t.Errorf("%+v: String = %q, want %q", tt.clip, got, tt.str)
+		}
+		if got := tt.clip.Key(); got != tt.key {
+			t.Errorf("%+v: Key = %q, want %q", tt.clip, got, tt.key)
+		}
+		if got := tt.clip.Section(); got != tt.section {
+			t.Errorf("%+v: Section = %q, want %q", tt.clip, got, tt.section)
+		}
+	}
+	if got := ClipFormatID("18", TimeRange{Start: 80, End: 165}); got != "18-clip80-165" {
+		t.Errorf("ClipFormatID = %q", got)
+	}
+}
+
+func TestStripRangeParams(t *testing.T) {
+	tests := []struct {
+		link string
+		want string
+		clip string // Key() фрагмента, "" - нет фрагмента
+	}{
+		{"https://youtu.be/dQw4w9WgXcQ?t=90", "https://youtu.be/dQw4w9WgXcQ", "90-end"},
+		{"https://youtu.be/dQw4w9WgXcQ?t=1m30s&si=abc", "https://youtu.be/dQw4w9WgXcQ?si=abc", "90-end"},
+		{"https://www.youtube.com/embed/dQw4w9WgXcQ?start=10&end=20", "https://www.youtube.com/embed/dQw4w9WgXcQ", "10-20"},
+		// Конец раньше начала игнорируется
+		{"https://www.youtube.com/embed/dQw4w9WgXcQ?start=30&end=20", "https://www.youtube.com/embed/dQw4w9WgXcQ", "30-end"},
+		// t=0 - просто начало видео
+		{"https://youtu.be/dQw4w9WgXcQ?t=0", "https://youtu.be/dQw4w9WgXcQ", ""},
+		{"https://youtu.be/dQw4w9WgXcQ?t=abc", "https://youtu.be/dQw4w9WgXcQ?t=abc", ""},
+		{"https://youtu.be/dQw4w9WgXcQ", "https://youtu.be/dQw4w9WgXcQ", ""},
+	}
+	for _, tt := range tests {
+		link, clip := stripRangeParams(tt.link)
+		key := ""
+		if clip != nil {
+			key = clip.Key()
+		}
+		if link != tt.want || key != tt.clip {
+			t.Errorf("stripRangeParams(%s) = %s, %q; want %s, %q", tt.link, link, key, tt.want, tt.clip)
+		}
+	}
+}
@@ -1,213 +1,257 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
-	"path/filepath"
-	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // UniversalService универсальный сервис для работы с разными платформами
 type UniversalService struct {
 	downloadDir    string
 	platformDetector *PlatformDetector
+	downloader     Downloader
+	splitOversized bool // Форматы больше 2GB не скрываются: после скачивания их режут на части
+
+	genericDomains *DomainList              // Универсальное извлечение для ссылок не из реестра (nil - выключено)
+	resolved       map[string]*PlatformInfo // Ссылки, платформу и ID которых определил yt-dlp
+	resolvedMux    sync.Mutex
 }
 
 // NewUniversalService создает новый универсальный сервис
 func NewUniversalService(downloadDir string) *UniversalService {
+	return NewUniversalServiceWithDownloader(downloadDir, NewYtDlpDownloader())
+}
+
+// NewUniversalServiceWithDownloader создает универсальный сервис с заданным Downloader
+func NewUniversalServiceWithDownloader(downloadDir string, downloader Downloader) *UniversalService {
 	return &UniversalService{
 		downloadDir:    downloadDir,
 		platformDetector: NewPlatformDetector(),
+		downloader:     downloader,
+		resolved:       make(map[string]*PlatformInfo),
 	}
 }
 
-// GetVideoFormats получает доступные форматы для любой платформы
-func (us *UniversalService) GetVideoFormats(url string) ([]VideoFormat, error) {
-	// Определяем платформу
+// SetSplitOversized разрешает форматы больше лимита Telegram (их режут на части после скачивания)
+func (us *UniversalService) SetSplitOversized(enabled bool) {
+	us.splitOversized = enabled
+}
+
+// SetGenericExtractor включает универсальное извлечение: ссылки не из реестра платформ
+// с доменов, разрешенных в domains, разбирает yt-dlp (nil - выключить)
+func (us *UniversalService) SetGenericExtractor(domains *DomainList) {
+	us.genericDomains = domains
+}
+
+// detectPlatform определяет платформу по реестру, а ссылки с разрешенных доменов
+// считает платформой yt-dlp (ID известен после GetVideoInfo)
+func (us *UniversalService) detectPlatform(url string) *PlatformInfo {
 	platformInfo := us.platformDetector.DetectPlatform(url)
+	if platformInfo.Supported || us.genericDomains == nil {
+		return platformInfo
+	}
+	host := linkHost(url)
+	if !us.genericDomains.Allowed(host) {
+		return platformInfo
+	}
+
+	url = strings.TrimSpace(url)
+	us.resolvedMux.Lock()
+	resolved, ok := us.resolved[url]
+	us.resolvedMux.Unlock()
+	if ok {
+		return resolved
+	}
+	return newGenericPlatformInfo(url, NormalizeDomain(host))
+}
+
+// rememberGeneric запоминает платформу и ID ссылки по ответу yt-dlp
+func (us *UniversalService) rememberGeneric(url string, info *VideoInfo) (*PlatformInfo, error) {
+	url = strings.TrimSpace(url)
+	platformInfo, err := resolvedGenericPlatformInfo(url, info)
+	if err != nil {
+		return nil, err
+	}
+
+	us.resolvedMux.Lock()
+	defer us.resolvedMux.Unlock()
+	if len(us.resolved) >= genericResolvedLimit {
+		us.resolved = make(map[string]*PlatformInfo)
+	}
+	us.resolved[url] = platformInfo
+	return platformInfo, nil
+}
+
+// GetVideoInfo получает метаданные и форматы для любой платформы одним вызовом yt-dlp
+func (us *UniversalService) GetVideoInfo(url string) (*VideoInfo, error) {
+	// Определяем платформу
+	platformInfo := us.detectPlatform(url)
 	us.platformDetector.LogPlatformInfo(platformInfo, url)
 	
 	if !platformInfo.Supported {
 		return nil, fmt.Errorf("платформа %s не поддерживается", platformInfo.DisplayName)
 	}
 	
-	// Добавляем аргументы для получения форматов
-	formatArgs := []string{
-		"--list-formats",
-		"--no-playlist",
-		"--no-check-certificates",
-	}
-	
-	// Добавляем аргументы прокси
-	proxyArgs := getProxyArgs()
-	
-	// Объединяем все аргументы (без дублирования)
-	allArgs := append(formatArgs, proxyArgs...)
-	allArgs = append(allArgs, url)
+	udebugf("🚀 Получаю информацию для %s: %s", platformInfo.DisplayName, url)
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
 	
-	// Выполняем команду yt-dlp
-	cmd := exec.Command(getYtDlpPath(), allArgs...)
-	udebugf("🚀 Выполняю команду для %s: %s", platformInfo.DisplayName, strings.Join(cmd.Args, " "))
-	
-	output, err := cmd.CombinedOutput()
+	var probeArgs []string
+	if platformInfo.Type == PlatformGeneric {
+		probeArgs = genericExtractorArgs
+	}
+	info, err := us.downloader.Probe(ctx, url, probeArgs...)
 	if err != nil {
-		log.Printf("❌ Ошибка yt-dlp для %s: %s", platformInfo.DisplayName, string(output))
+		log.Printf("❌ Ошибка yt-dlp для %s: %v", platformInfo.DisplayName, err)
 		return nil, fmt.Errorf("ошибка получения форматов для %s: %v", platformInfo.DisplayName, err)
 	}
+	if platformInfo.Type == PlatformGeneric {
+		// Платформа и ID - из ответа yt-dlp: ключ экстрактора и поле id
+		if platformInfo, err = us.rememberGeneric(url, info); err != nil {
+			return nil, err
+		}
+		log.Printf("🌐 yt-dlp распознал ссылку: %s, ID %s (кэш: %s)", platformInfo.DisplayName, platformInfo.VideoID, platformInfo.CacheNamespace)
+	}
+	
+	formats := filterPlatformFormats(platformInfo.Platform, pickBestAudio(info.AllFormats))
+	info.Formats = us.filterTelegramCompatibleFormats(formats, platformInfo.Platform.MaxFileSize())
 	
-	// Парсим форматы
-	formats, err := us.parseVideoFormats(string(output), platformInfo.Type)
+	udebugf("📊 Найдено %d форматов для %s", len(info.Formats), platformInfo.DisplayName)
+	return info, nil
+}
+
+// GetVideoFormats получает доступные форматы для любой платформы
+func (us *UniversalService) GetVideoFormats(url string) ([]VideoFormat, error) {
+	info, err := us.GetVideoInfo(url)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка парсинга форматов для %s: %v", platformInfo.DisplayName, err)
+		return nil, err
 	}
-	
-	udebugf("📊 Найдено %d форматов для %s", len(formats), platformInfo.DisplayName)
-	return formats, nil
+	return info.Formats, nil
 }
 
 // DownloadVideoWithFormat скачивает видео в конкретном формате
 func (us *UniversalService) DownloadVideoWithFormat(url, formatID string) (string, error) {
+	return us.DownloadVideoWithProgress(context.Background(), url, formatID, nil)
+}
+
+// DownloadVideoWithProgress скачивает видео в формате, сообщая прогресс в onProgress (может быть nil).
+// Одновременные запросы одного видео и формата объединяются в одно скачивание.
+// Отмена ctx останавливает yt-dlp (если скачивание больше никто не ждет) и удаляет недокачанные файлы.
+func (us *UniversalService) DownloadVideoWithProgress(ctx context.Context, url, formatID string, onProgress ProgressFunc) (string, error) {
+	return us.DownloadWithOptions(ctx, url, formatID, DownloadOptions{Audio: IsAudioFormatID(formatID)}, onProgress)
+}
+
+// DownloadWithOptions скачивает видео с параметрами opts: фрагмент сохраняется под ClipFormatID
+// и не пересекается с полным видео, в аудиорежиме звук извлекается в opts.AudioFormat с тегами из opts.Metadata.
+func (us *UniversalService) DownloadWithOptions(ctx context.Context, url, formatID string, opts DownloadOptions, onProgress ProgressFunc) (string, error) {
 	// Определяем платформу
-	platformInfo := us.platformDetector.DetectPlatform(url)
+	platformInfo := us.detectPlatform(url)
 	if !platformInfo.Supported {
 		return "", fmt.Errorf("платформа %s не поддерживается", platformInfo.DisplayName)
 	}
-	
-	// Создаем папку для загрузок если не существует
-	if err := os.MkdirAll(us.downloadDir, 0755); err != nil {
-		return "", fmt.Errorf("не удалось создать папку для загрузок: %v", err)
+	if platformInfo.Type == PlatformGeneric && platformInfo.VideoID == "" {
+		// Ссылку еще не разбирали: ID для имени файла и кэша берем у yt-dlp
+		if _, err := us.GetVideoInfo(url); err != nil {
+			return "", err
+		}
+		platformInfo = us.detectPlatform(url)
 	}
 	
-	// Добавляем специфичные аргументы для скачивания
-	downloadArgs := []string{
-		"--format", formatID,
-		"--output", filepath.Join(us.downloadDir, "%(id)s_" + formatID + ".%(ext)s"),
-		"--no-playlist",
-		"--no-check-certificates",
-		"--max-filesize", "2G",
-		"--socket-timeout", "60",
-		"--retries", "5",
+	// Shorts сохраняются под тем же ID, что и обычные видео YouTube: ключ - пространство кэша платформы
+	key := downloadKey{platform: platformInfo.CacheNamespace, videoID: platformInfo.VideoID, formatID: opts.FileFormatID(formatID)}
+	return inflightDownloads.do(ctx, key, onProgress, func(ctx context.Context, onProgress ProgressFunc) (string, error) {
+		return us.downloadWithFormat(ctx, url, platformInfo, formatID, opts, onProgress)
+	})
+}
+
+// downloadWithFormat выполняет скачивание; вызывается только через inflightDownloads
+func (us *UniversalService) downloadWithFormat(ctx context.Context, url string, platformInfo *PlatformInfo, formatID string, opts DownloadOptions, onProgress ProgressFunc) (string, error) {
+	fileFormatID := opts.FileFormatID(formatID)
+	req := DownloadRequest{
+		URL:        url,
+		Format:     formatID,
+		OutputDir:  us.downloadDir,
+		FilePrefix: downloadFilePrefix(platformInfo, fileFormatID),
+		Args: []string{
+			"--no-playlist",
+			"--no-check-certificates",
+			"--socket-timeout", "60",
+			"--retries", "5",
+		},
+		Progress: onProgress,
+	}
+	if !us.splitOversized {
+		req.Args = append(req.Args, "--max-filesize", fmt.Sprintf("%d", platformInfo.Platform.MaxFileSize()))
+	}
+	// Аргументы платформы из реестра (заголовки, обход водяных знаков и т.п.)
+	req.Args = append(req.Args, platformInfo.Platform.YtDlpArgs()...)
+	if opts.Clip != nil {
+		// Скачиваем только фрагмент; резы по ключевым кадрам, чтобы начало не было битым
+		req.Args = append(req.Args, "--download-sections", opts.Clip.Section(), "--force-keyframes-at-cuts")
+		log.Printf("✂️ Скачиваю фрагмент %s", opts.Clip)
 	}
 	
-	// Если это аудиоформат, принудительно конвертируем в MP3
-	// Проверяем по ID формата - если содержит "drc", "audio", "webm" или другие аудио ID, это аудио
-	if strings.Contains(formatID, "drc") || strings.Contains(formatID, "audio") || strings.Contains(formatID, "bestaudio") || strings.Contains(formatID, "webm") {
-		downloadArgs = append(downloadArgs, "--extract-audio", "--audio-format", "mp3", "--audio-quality", "0")
+	if opts.Audio {
 		// Для аудио не используем merge-output-format, чтобы получить правильное расширение
-		log.Printf("🎵 Обнаружен аудиоформат %s, принудительно конвертирую в MP3", formatID)
+		output := opts.AudioOutput()
+		req.Format = output.formatSelector(formatID)
+		req.Args = append(req.Args, output.args()...)
+		log.Printf("🎵 Аудиорежим для формата %s, извлекаю звук в %s", formatID, output.Key)
 	} else {
-		// Только для видео используем merge-output-format
-		downloadArgs = append(downloadArgs, "--merge-output-format", "mp4")
+		req.Format = platformFormatSelector(platformInfo.Platform, formatID)
+		if formatID == DefaultVideoFormat {
+			// Формат не выбирали - берем формат платформы по умолчанию
+			req.Format = platformInfo.Platform.DefaultFormat()
+		}
+		req.Args = append(req.Args, "--merge-output-format", "mp4")
+		
+		// Если формат может дать webm файл, принудительно конвертируем в MP4
+		if strings.Contains(formatID, "webm") {
+			req.Args = append(req.Args, "--recode-video", "mp4")
+			log.Printf("🎬 Обнаружен WebM формат %s, принудительно конвертирую в MP4", formatID)
+		}
 	}
 	
-	// Дополнительная проверка: если формат может дать webm файл, принудительно конвертируем в MP4
-	// Это нужно для случаев когда видео скачивается в webm формате
-	if strings.Contains(formatID, "webm") || strings.Contains(formatID, "251") || strings.Contains(formatID, "250") {
-		downloadArgs = append(downloadArgs, "--recode-video", "mp4")
-		log.Printf("🎬 Обнаружен WebM формат %s, принудительно конвертирую в MP4", formatID)
+	log.Printf("🚀 Скачиваю %s: %s (формат %s)", platformInfo.DisplayName, url, formatID)
+	videoFile, err := downloadWithRetry(ctx, us.downloader, req, !us.splitOversized)
+	if err == ErrCancelled {
+		return "", err
 	}
-	
-	// Добавляем аргументы прокси
-	proxyArgs := getProxyArgs()
-	
-	// Объединяем все аргументы (без дублирования)
-	allArgs := append(downloadArgs, proxyArgs...)
-	allArgs = append(allArgs, url)
-	
-	// Выполняем команду yt-dlp
-	cmd := exec.Command(getYtDlpPath(), allArgs...)
-	log.Printf("🚀 Скачиваю %s: %s", platformInfo.DisplayName, strings.Join(cmd.Args, " "))
-	
-	output, err := cmd.CombinedOutput()
 	if err != nil {
-		log.Printf("❌ Ошибка скачивания %s: %s", platformInfo.DisplayName, string(output))
-		return "", fmt.Errorf("ошибка скачивания для %s: %v", platformInfo.DisplayName, err)
-	}
-	
-	// Ищем скачанный файл
-	videoFile, err := us.findDownloadedFile(url, platformInfo, formatID)
-	if err != nil {
-		return "", fmt.Errorf("не найден скачанный файл для %s: %v", platformInfo.DisplayName, err)
+		log.Printf("❌ Ошибка скачивания %s: %v", platformInfo.DisplayName, err)
+		return "", fmt.Errorf("ошибка скачивания для %s: %w", platformInfo.DisplayName, err)
 	}
 	
 	log.Printf("✅ Файл скачан для %s: %s", platformInfo.DisplayName, videoFile)
+	if opts.Audio {
+		tagDownloadedAudio(ctx, videoFile, opts.Metadata)
+	}
 	return videoFile, nil
 }
 
-// parseVideoFormats парсит вывод yt-dlp для любой платформы
-func (us *UniversalService) parseVideoFormats(output string, platformType PlatformType) ([]VideoFormat, error) {
-	udebugf("📋 Парсинг форматов для %s", platformType)
-	
-	var allFormats []VideoFormat
-	lines := strings.Split(output, "\n")
-	
-	startParsing := false
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		
-		// Начинаем парсинг после заголовка
-		if strings.Contains(line, "Available formats") || strings.Contains(line, "ID  EXT") || 
-		   strings.Contains(line, "ID EXT") || strings.Contains(line, "format code") {
-			startParsing = true
-			continue
-		}
-		
-		// Пропускаем разделители
-		if strings.Contains(line, "---") {
-			continue
-		}
-		
-		// Парсим строки с форматами
-		if startParsing && len(strings.Fields(line)) >= 4 {
-			parts := strings.Fields(line)
-			
-			// Проверяем, что это действительно формат
-			if len(parts) >= 4 && (parts[1] == "mp4" || parts[1] == "webm" || parts[1] == "audio" || 
-			   strings.Contains(parts[1], "video") || strings.Contains(parts[1], "audio")) {
-				
-				// Если это webm аудио - помечаем как audio для конвертации в MP3
-				if parts[1] == "webm" && strings.Contains(strings.ToLower(line), "audio") {
-					parts[1] = "audio" // Принудительно меняем на audio для конвертации
-				}
-				
-				format := VideoFormat{
-					ID:         parts[0],
-					Extension:  parts[1],
-					Resolution: parts[2],
-					FPS:        parts[3],
-					HasAudio:   strings.Contains(strings.ToLower(line), "audio") || parts[1] == "audio",
-				}
-				
-				// Извлекаем размер файла если есть
-				for i := 4; i < len(parts); i++ {
-					if strings.Contains(parts[i], "MiB") || strings.Contains(parts[i], "GiB") || 
-					   strings.Contains(parts[i], "KiB") || strings.Contains(parts[i], "B") {
-						format.FileSize = parts[i]
-						break
-					}
-				}
-				
-				allFormats = append(allFormats, format)
-			}
-		}
-	}
-	
-	// Фильтруем форматы совместимые с Telegram
-	return us.filterTelegramCompatibleFormats(allFormats), nil
+// downloadFilePrefix возвращает имя файла загрузки без расширения: пространство кэша,
+// ID и формат. У разных сайтов универсального извлечения бывают одинаковые ID ("video",
+// "index"), поэтому без пространства кэша они писали бы в один файл.
+func downloadFilePrefix(platformInfo *PlatformInfo, fileFormatID string) string {
+	namespace := genericIDPattern.ReplaceAllString(platformInfo.CacheNamespace, "_")
+	return namespace + "_" + platformInfo.VideoID + "_" + fileFormatID
 }
 
-// filterTelegramCompatibleFormats фильтрует форматы совместимые с Telegram
-func (us *UniversalService) filterTelegramCompatibleFormats(formats []VideoFormat) []VideoFormat {
+// filterTelegramCompatibleFormats фильтрует форматы совместимые с Telegram и не больше maxFileSize байт
+func (us *UniversalService) filterTelegramCompatibleFormats(formats []VideoFormat, maxFileSize int64) []VideoFormat {
 	var compatible []VideoFormat
 	
 	for _, format := range formats {
 		// Telegram поддерживает MP4, MOV, MP3, M4A, OGG (webm конвертируется в mp3)
-		if format.Extension == "mp4" || format.Extension == "mov" || format.Extension == "audio" {
-			// Проверяем размер файла (максимум 2GB для Telegram)
-			if !us.isFileTooLarge(format.FileSize, 2048) { // 2GB в MB
+		if format.Extension == "mp4" || format.Extension == "mov" || format.IsAudioOnly() {
+			// Проверяем размер файла (лимит платформы, по умолчанию 2GB для Telegram)
+			if us.splitOversized || !us.isFileTooLarge(format.FileSize, int(maxFileSize/(1024*1024))) {
 				compatible = append(compatible, format)
 			}
 		}
@@ -217,55 +261,9 @@ func (us *UniversalService) filterTelegramCompatibleFormats(formats []VideoForma
 }
 
 // isFileTooLarge проверяет, превышает ли файл максимальный размер
-func (us *UniversalService) isFileTooLarge(fileSize string, maxSizeMB int) bool {
-	if fileSize == "" {
-		return false // Если размер неизвестен, не блокируем
-	}
-	
-	// Парсим размер файла
-	if strings.Contains(fileSize, "MiB") {
-		sizeStr := strings.Replace(fileSize, "MiB", "", 1)
-		if size, err := strconv.ParseFloat(sizeStr, 64); err == nil {
-			return size > float64(maxSizeMB)
-		}
-	}
-	
-	if strings.Contains(fileSize, "GiB") {
-		sizeStr := strings.Replace(fileSize, "GiB", "", 1)
-		if size, err := strconv.ParseFloat(sizeStr, 64); err == nil {
-			return size*1024 > float64(maxSizeMB) // Конвертируем GB в MB
-		}
-	}
-	
-	return false
-}
-
-// findDownloadedFile ищет скачанный файл
-func (us *UniversalService) findDownloadedFile(url string, platformInfo *PlatformInfo, formatID string) (string, error) {
-	files, err := os.ReadDir(us.downloadDir)
-	if err != nil {
-		return "", fmt.Errorf("не удалось прочитать папку загрузок: %v", err)
-	}
-	
-	// Ищем файл с ID видео и formatID
-	var videoFile string
-	expectedPattern := platformInfo.VideoID + "_" + formatID
-	for _, file := range files {
-		if !file.IsDir() && !strings.HasSuffix(file.Name(), ".webp") {
-			// Проверяем, что файл содержит ID видео и formatID
-			if strings.Contains(file.Name(), expectedPattern) {
-				videoFile = filepath.Join(us.downloadDir, file.Name())
-				log.Printf("🎯 Найден файл для %s %s (формат %s): %s", platformInfo.Icon, platformInfo.DisplayName, formatID, file.Name())
-				break
-			}
-		}
-	}
-	
-	if videoFile == "" {
-		return "", fmt.Errorf("не найден скачанный файл для %s %s", platformInfo.Icon, platformInfo.DisplayName)
-	}
-	
-	return videoFile, nil
+func (us *UniversalService) isFileTooLarge(fileSize int64, maxSizeMB int) bool {
+	// Если размер неизвестен (0), не блокируем
+	return fileSize > int64(maxSizeMB)*1024*1024
 }
 
 // CheckYtDlp проверяет доступность yt-dlp
@@ -297,14 +295,15 @@ func (us *UniversalService) GetSupportedPlatforms() []PlatformInfo {
 	return us.platformDetector.GetSupportedPlatforms()
 }
 
-// IsValidURL проверяет, является ли URL валидным
+// IsValidURL проверяет, является ли URL валидным: платформа из реестра или разрешенный
+// домен для универсального извлечения
 func (us *UniversalService) IsValidURL(url string) bool {
-	return us.platformDetector.IsValidURL(url)
+	return us.platformDetector.IsValidURL(url) || us.detectPlatform(url).Type == PlatformGeneric
 }
 
 // GetPlatformInfo возвращает информацию о платформе по URL
 func (us *UniversalService) GetPlatformInfo(url string) *PlatformInfo {
-	return us.platformDetector.DetectPlatform(url)
+	return us.detectPlatform(url)
 }
 
 // Debug logging toggle via LOG_LEVEL=debug
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUniversalServiceGetVideoInfo(t *testing.T) {
+	service := NewUniversalServiceWithDownloader(t.TempDir(), NewFakeDownloader(fixtureDir))
+
+	info, err := service.GetVideoInfo("https://www.tiktok.com/@user/video/7301234567890123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ID != "7301234567890123456" {
+		t.Errorf("id = %s", info.ID)
+	}
+	for _, format := range info.Formats {
+		if format.ID == "download_addr-0" {
+			t.Error("watermarked format download_addr-0 should be filtered out")
+		}
+	}
+}
+
+func TestUniversalServiceDownloadWithProgress(t *testing.T) {
+	fake := NewFakeDownloader(mediaFixtureDir(t, "7301234567890123456"))
+	downloadDir := t.TempDir()
+	service := NewUniversalServiceWithDownloader(downloadDir, fake)
+
+	var progress []DownloadProgress
+	path, err := service.DownloadVideoWithProgress(context.Background(), "https://www.tiktok.com/@user/video/7301234567890123456", "play_addr-0", func(p DownloadProgress) {
+		progress = append(progress, p)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(downloadDir, "tiktok_7301234567890123456_play_addr-0.mp4"); path != want {
+		t.Errorf("path = %s, want %s", path, want)
+	}
+	if len(progress) == 0 || progress[len(progress)-1].Status != ProgressFinished {
+		t.Errorf("progress = %+v", progress)
+	}
+}
+
+func TestUniversalServiceErrors(t *testing.T) {
+	fake := NewFakeDownloader(mediaFixtureDir(t, "7301234567890123456"))
+	service := NewUniversalServiceWithDownloader(t.TempDir(), fake)
+	url := "https://www.tiktok.com/@user/video/7301234567890123456"
+
+	fake.Errors["probe"] = errors.New("probe failed")
+	if _, err := service.GetVideoInfo(url); err == nil || !strings.Contains(err.Error(), "probe failed") {
+		t.Errorf("GetVideoInfo err = %v", err)
+	}
+
+	defer func(delay time.Duration) { downloadRetryDelay = delay }(downloadRetryDelay)
+	downloadRetryDelay = 0
+	downloadErr := errors.New("download failed")
+	fake.Errors["download"] = downloadErr
+	if _, err := service.DownloadVideoWithProgress(context.Background(), url, "play_addr-0", nil); !errors.Is(err, downloadErr) {
+		t.Errorf("Download err = %v", err)
+	}
+
+	if _, err := service.GetVideoInfo("https://example.com/video/123"); err == nil {
+		t.Error("unsupported link should fail without the generic extractor")
+	}
+	for _, call := range fake.Calls() {
+		if strings.Contains(call, "example.com") {
+			t.Errorf("unsupported link reached the downloader: %s", call)
+		}
+	}
+}
+
+func TestUniversalServiceDownloadCancelled(t *testing.T) {
+	fake := NewFakeDownloader(mediaFixtureDir(t, "7301234567890123456"))
+	service := NewUniversalServiceWithDownloader(t.TempDir(), fake)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := service.DownloadVideoWithProgress(ctx, "https://www.tiktok.com/@user/video/7301234567890123456", "play_addr-0", nil); err != ErrCancelled {
+		t.Errorf("err = %v, want ErrCancelled", err)
+	}
+}
+
+func TestUniversalServiceAttemptTimeout(t *testing.T) {
+	for _, split := range []bool{false, true} {
+		downloader := &deadlineDownloader{FakeDownloader: NewFakeDownloader(mediaFixtureDir(t, "7301234567890123456"))}
+		service := NewUniversalServiceWithDownloader(t.TempDir(), downloader)
+		service.SetSplitOversized(split)
+
+		if _, err := service.DownloadVideoWithProgress(context.Background(), "https://www.tiktok.com/@user/video/7301234567890123456", "play_addr-0", nil); err != nil {
+			t.Fatal(err)
+		}
+		if downloader.hasDeadline == split {
+			t.Errorf("split %v: attempt deadline = %v", split, downloader.hasDeadline)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// uploadField - текстовое поле multipart-запроса
+type uploadField struct {
+	name  string
+	value string
+}
+
+// uploadFile - файл multipart-запроса
+type uploadFile struct {
+	field string
+	path  string
+	size  int64
+}
+
+// MultipartUpload - multipart-запрос к Telegram, тело которого формируется на лету через io.Pipe.
+// Файлы читаются с диска по мере отправки, поэтому загрузка 2 ГБ видео не требует 2 ГБ памяти.
+type MultipartUpload struct {
+	fields []uploadField
+	files  []uploadFile
+
+	// Progress получает события со статусом ProgressUploading (может быть nil)
+	Progress ProgressFunc
+}
+
+// NewMultipartUpload создает пустой multipart-запрос
+func NewMultipartUpload() *MultipartUpload {
+	return &MultipartUpload{}
+}
+
+// AddField добавляет текстовое поле
+func (u *MultipartUpload) AddField(name, value string) {
+	u.fields = append(u.fields, uploadField{name: name, value: value})
+}
+
+// AddFile добавляет файл с диска под именем поля field
+func (u *MultipartUpload) AddFile(field, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("ошибка получения информации о файле: %v", err)
+	}
+	u.files = append(u.files, uploadFile{field: field, path: path, size: info.Size()})
+	return nil
+}
+
+// Post отправляет запрос. Content-Length считается заранее, чтобы сервер Bot API
+// получил обычный (не chunked) запрос. Тело ответа закрывает вызывающий.
+func (u *MultipartUpload) Post(client *http.Client, url string) (*http.Response, error) {
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+
+	// Считаем размер служебной части multipart (заголовки полей и границы) без содержимого файлов
+	counter := &countingWriter{}
+	if err := u.write(counter, boundary, false); err != nil {
+		return nil, fmt.Errorf("ошибка подготовки multipart: %v", err)
+	}
+	var filesSize int64
+	for _, file := range u.files {
+		filesSize += file.size
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(u.write(pw, boundary, true))
+	}()
+
+	req, err := http.NewRequest("POST", url, pr)
+	if err != nil {
+		pr.Close()
+		return nil, fmt.Errorf("ошибка создания запроса: %v", err)
+	}
+	req.ContentLength = counter.n + filesSize
+	req.Header.Set("Content-Type", "multipart/form-data; boundary="+boundary)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// Останавливаем горутину, пишущую тело
+		pr.CloseWithError(err)
+		return nil, err
+	}
+	return resp, nil
+}
+
+// write пишет тело запроса в w; при withFiles=false содержимое файлов пропускается
+func (u *MultipartUpload) write(w io.Writer, boundary string, withFiles bool) error {
+	writer := multipart.NewWriter(w)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return err
+	}
+
+	for _, field := range u.fields {
+		if err := writer.WriteField(field.name, field.value); err != nil {
+			return err
+		}
+	}
+
+	var total int64
+	for _, file := range u.files {
+		total += file.size
+	}
+
+	progress := &uploadProgress{total: total, report: u.Progress, lastPercent: -1}
+	for _, file := range u.files {
+		part, err := writer.CreateFormFile(file.field, filepath.Base(file.path))
+		if err != nil {
+			return err
+		}
+		if !withFiles {
+			continue
+		}
+		if err := copyFileTo(part, file.path, progress); err != nil {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+// copyFileTo копирует файл в w, сообщая о прогрессе
+func copyFileTo(w io.Writer, path string, progress *uploadProgress) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("ошибка открытия файла: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(w, io.TeeReader(file, progress)); err != nil {
+		return fmt.Errorf("ошибка отправки файла: %v", err)
+	}
+	return nil
+}
+
+// uploadProgress считает отправленные байты и сообщает о каждом новом проценте
+type uploadProgress struct {
+	sent        int64
+	total       int64
+	lastPercent int
+	report      ProgressFunc
+}
+
+// Write реализует io.Writer для io.TeeReader
+func (p *uploadProgress) Write(data []byte) (int, error) {
+	p.sent += int64(len(data))
+	if p.report == nil || p.total <= 0 {
+		return len(data), nil
+	}
+
+	percent := int(p.sent * 100 / p.total)
+	if percent != p.lastPercent {
+		p.lastPercent = percent
+		p.report(DownloadProgress{
+			Status:          ProgressUploading,
+			Percent:         float64(percent),
+			DownloadedBytes: p.sent,
+			TotalBytes:      p.total,
+		})
+	}
+	return len(data), nil
+}
+
+// countingWriter считает записанные байты
+type countingWriter struct {
+	n int64
+}
+
+// Write реализует io.Writer
+func (c *countingWriter) Write(data []byte) (int, error) {
+	c.n += int64(len(data))
+	return len(data), nil
+}
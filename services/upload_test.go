@@ -0,0 +1,133 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// receivedUpload - то, что тестовый сервер получил в запросе
+type receivedUpload struct {
+	contentLength    int64
+	transferEncoding []string
+	body             []byte
+	contentType      string
+}
+
+func TestMultipartUpload(t *testing.T) {
+	dir := t.TempDir()
+	video := make([]byte, 3<<20+123)
+	rand.New(rand.NewSource(1)).Read(video)
+	videoPath := filepath.Join(dir, "video.mp4")
+	thumbPath := filepath.Join(dir, "thumb.jpg")
+	if err := os.WriteFile(videoPath, video, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(thumbPath, []byte("jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan receivedUpload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("read body: %v", err)
+		}
+		received <- receivedUpload{
+			contentLength:    r.ContentLength,
+			transferEncoding: r.TransferEncoding,
+			body:             body,
+			contentType:      r.Header.Get("Content-Type"),
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	upload := NewMultipartUpload()
+	upload.AddField("chat_id", "42")
+	upload.AddField("caption", "Видео в формате 18")
+	if err := upload.AddFile("video", videoPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := upload.AddFile("thumbnail", thumbPath); err != nil {
+		t.Fatal(err)
+	}
+	var progress []DownloadProgress
+	upload.Progress = func(p DownloadProgress) { progress = append(progress, p) }
+
+	resp, err := upload.Post(server.Client(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	got := <-received
+
+	// Заранее посчитанная длина совпадает с отправленным телом, запрос не chunked
+	if got.contentLength != int64(len(got.body)) {
+		t.Errorf("Content-Length %d, body %d bytes", got.contentLength, len(got.body))
+	}
+	if len(got.transferEncoding) != 0 {
+		t.Errorf("Transfer-Encoding = %v, want none", got.transferEncoding)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(got.contentType)
+	if err != nil || mediaType != "multipart/form-data" {
+		t.Fatalf("Content-Type %q: %v", got.contentType, err)
+	}
+	form, err := multipart.NewReader(bytes.NewReader(got.body), params["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer form.RemoveAll()
+	if form.Value["chat_id"][0] != "42" || form.Value["caption"][0] != "Видео в формате 18" {
+		t.Errorf("fields = %v", form.Value)
+	}
+	for field, want := range map[string][]byte{"video": video, "thumbnail": []byte("jpeg")} {
+		headers := form.File[field]
+		if len(headers) != 1 {
+			t.Fatalf("%s: %d files", field, len(headers))
+		}
+		file, err := headers[0].Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(file)
+		file.Close()
+		if !bytes.Equal(data, want) {
+			t.Errorf("%s: received %d bytes, want %d", field, len(data), len(want))
+		}
+	}
+	if name := form.File["video"][0].Filename; name != "video.mp4" {
+		t.Errorf("video file name = %q", name)
+	}
+
+	// Прогресс растет монотонно и заканчивается на всем объеме файлов
+	total := int64(len(video) + len("jpeg"))
+	if len(progress) == 0 {
+		t.Fatal("no progress reported")
+	}
+	for i, p := range progress {
+		if p.Status != ProgressUploading || p.TotalBytes != total {
+			t.Errorf("progress %d = %+v", i, p)
+		}
+		if i > 0 && (p.Percent <= progress[i-1].Percent || p.DownloadedBytes <= progress[i-1].DownloadedBytes) {
+			t.Errorf("progress not monotonic at %d: %+v after %+v", i, p, progress[i-1])
+		}
+	}
+	if last := progress[len(progress)-1]; last.Percent != 100 || last.DownloadedBytes != total {
+		t.Errorf("last progress = %+v", last)
+	}
+}
+
+func TestMultipartUploadMissingFile(t *testing.T) {
+	if err := NewMultipartUpload().AddFile("video", filepath.Join(t.TempDir(), "missing.mp4")); err == nil {
+		t.Error("AddFile of a missing file should fail")
+	}
+}
@@ -2,45 +2,107 @@ package services
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"time"
-	"strconv"
 	
 	"youtubeBot/utils"
 )
 
 // VideoFormat представляет формат видео
 type VideoFormat struct {
-	ID         string
-	Extension  string
-	Resolution string
-	FPS        string
-	HasAudio   bool
-	FileSize   string
+	ID             string
+	Extension      string  // Расширение файла (mp4, webm, m4a)
+	Container      string  // Контейнер по данным yt-dlp (mp4_dash, webm_dash)
+	Note           string  // Пометка формата (1080p60, medium, Default)
+	Resolution     string  // "1920x1080" или "audio" для аудио форматов
+	Width          int
+	Height         int
+	FPS            float64
+	VCodec         string  // "none" если видеодорожки нет
+	ACodec         string  // "none" если аудиодорожки нет
+	HasAudio       bool
+	TBR            float64 // Общий битрейт, кбит/с
+	ABR            float64 // Битрейт аудио, кбит/с
+	DynamicRange   string  // SDR, HDR10, HLG...
+	Language       string
+	FileSize       int64   // Размер в байтах (0 - неизвестен)
+	FileSizeApprox bool    // Размер является оценкой
+}
+
+// IsAudioOnly возвращает true для форматов без видеодорожки
+func (f VideoFormat) IsAudioOnly() bool {
+	if f.VCodec == "none" {
+		return true
+	}
+	return f.VCodec == "" && f.Width == 0 && f.Height == 0 && f.ACodec != "" && f.ACodec != "none"
+}
+
+// IsHDR возвращает true для форматов с расширенным динамическим диапазоном
+func (f VideoFormat) IsHDR() bool {
+	return f.DynamicRange != "" && f.DynamicRange != "SDR"
+}
+
+// SizeString возвращает размер в читаемом виде ("≈301.82MiB", "52.91MiB")
+func (f VideoFormat) SizeString() string {
+	if f.FileSize <= 0 {
+		return ""
+	}
+	size := formatBytes(f.FileSize)
+	if f.FileSizeApprox {
+		return "≈" + size
+	}
+	return size
+}
+
+// formatBytes форматирует размер в байтах в единицах yt-dlp (KiB, MiB, GiB)
+func formatBytes(size int64) string {
+	const (
+		KB = 1024
+		MB = 1024 * KB
+		GB = 1024 * MB
+	)
+	switch {
+	case size >= GB:
+		return fmt.Sprintf("%.2fGiB", float64(size)/float64(GB))
+	case size >= MB:
+		return fmt.Sprintf("%.2fMiB", float64(size)/float64(MB))
+	case size >= KB:
+		return fmt.Sprintf("%.2fKiB", float64(size)/float64(KB))
+	default:
+		return fmt.Sprintf("%dB", size)
+	}
 }
 
 // VideoMetadata представляет метаданные видео
 type VideoMetadata struct {
-	Title       string
-	Author      string
-	Duration    string
-	Views       string
-	Description string
-	Thumbnail   string
-	UploadDate  string
-	OriginalURL string
+	VideoID         string
+	Title           string
+	Author          string
+	Duration        string
+	DurationSeconds int
+	Views           string
+	Description     string
+	Thumbnail       string
+	UploadDate      string
+	OriginalURL     string
+	Track           string          // Название трека для музыкальных видео (если yt-dlp его знает)
+	Artist          string          // Исполнитель
+	Album           string          // Альбом
+	Year            string          // Год выпуска или загрузки (YYYY)
+	Chapters        []Chapter       // Главы видео (пусто, если их нет)
+	Subtitles       []SubtitleTrack // Доступные субтитры: сначала ручные, потом автоматические
 }
 
 // YouTubeService предоставляет методы для работы с YouTube
 type YouTubeService struct {
-	downloadDir string
+	downloadDir    string
+	downloader     Downloader
+	splitOversized bool // Форматы больше 2GB не скрываются: после скачивания их режут на части
 }
 
 // getYtDlpPath возвращает путь к yt-dlp
@@ -97,344 +159,73 @@ func getProxyArgs() []string {
 
 // NewYouTubeService создает новый экземпляр YouTubeService
 func NewYouTubeService(downloadDir string) *YouTubeService {
+	return NewYouTubeServiceWithDownloader(downloadDir, NewYtDlpDownloader())
+}
+
+// NewYouTubeServiceWithDownloader создает YouTubeService с заданным Downloader (например, фейком)
+func NewYouTubeServiceWithDownloader(downloadDir string, downloader Downloader) *YouTubeService {
 	return &YouTubeService{
 		downloadDir: downloadDir,
+		downloader:  downloader,
 	}
 }
 
-// GetVideoFormats получает список доступных форматов видео
-func (s *YouTubeService) GetVideoFormats(url string) ([]VideoFormat, error) {
-	log.Printf("🔍 Получение форматов для: %s", url)
+// SetSplitOversized разрешает форматы больше лимита Telegram (их режут на части после скачивания)
+func (s *YouTubeService) SetSplitOversized(enabled bool) {
+	s.splitOversized = enabled
+}
+
+// GetVideoInfo получает метаданные и форматы видео одним вызовом yt-dlp
+func (s *YouTubeService) GetVideoInfo(url string) (*VideoInfo, error) {
+	log.Printf("🔍 Получение информации о видео: %s", url)
 	log.Printf("🚀 Запуск yt-dlp для анализа видео...")
 
-	var formats []VideoFormat
-	var lastErr error
-	
-	// Используем retry механизм для получения форматов
+	var info *VideoInfo
 	err := utils.RetryWithBackoff(func() error {
-		// Используем --list-formats для получения списка форматов
 		ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
 		defer cancel()
 
-		log.Printf("⏱️ Таймаут установлен на 120 секунд")
-
-		// Получаем аргументы прокси
-		proxyArgs := getProxyArgs()
-		
-		// Формируем команду с прокси (упрощаем для получения всех форматов)
-		args := []string{
-			"--list-formats",
-			"--no-playlist",
-			"--no-check-certificates",
-			"--no-warnings",
-			// Убираем --quiet для лучшего вывода
-			// Убираем --extractor-args для получения всех форматов
-		}
-		
-		// Добавляем аргументы прокси
-		args = append(args, proxyArgs...)
-		args = append(args, url)
-		
-		cmd := exec.CommandContext(ctx, getYtDlpPath(), args...)
-
-		output, err := cmd.CombinedOutput()
+		probed, err := s.downloader.Probe(ctx, url)
 		if err != nil {
-			if ctx.Err() == context.DeadlineExceeded {
-				return fmt.Errorf("таймаут получения форматов (120 сек) - видео слишком большое или медленный интернет")
-			}
-			log.Printf("❌ yt-dlp ошибка: %v", err)
-			log.Printf("📋 Вывод yt-dlp: %s", string(output))
-			return fmt.Errorf("ошибка yt-dlp: %v", err)
-		}
-		
-		// Парсим результат
-		parsedFormats, parseErr := s.parseVideoFormats(string(output))
-		if parseErr != nil {
-			return parseErr
+			return err
 		}
-		
-		formats = parsedFormats
+		info = probed
 		return nil
 	}, 3, 2*time.Second) // 3 попытки с базовой задержкой 2 секунды
-	
 	if err != nil {
-		lastErr = err
-		log.Printf("💥 Не удалось получить форматы после всех попыток: %v", err)
-		return nil, lastErr
+		log.Printf("💥 Не удалось получить информацию о видео после всех попыток: %v", err)
+		return nil, err
 	}
 
-	log.Printf("📊 Найдено %d форматов, %d совместимых с Telegram", len(formats), len(s.filterTelegramCompatibleFormats(formats)))
-	return s.filterTelegramCompatibleFormats(formats), nil
-}
+	info.Formats = s.filterTelegramCompatibleFormats(pickBestAudio(info.AllFormats))
 
-// parseVideoFormats парсит вывод yt-dlp и возвращает список форматов
-func (s *YouTubeService) parseVideoFormats(output string) ([]VideoFormat, error) {
-	debugf("📋 Парсинг вывода yt-dlp")
-	debugf("🔍 Сырой вывод yt-dlp:\n%s", output)
-	// Парсим вывод yt-dlp
-	var allFormats []VideoFormat
-	lines := strings.Split(output, "\n")
-	debugf("📊 Всего строк в выводе: %d", len(lines))
-	
-	startParsing := false
-	headerFound := false
-
-	// compile once outside the loop
-	reDigits := regexp.MustCompile(`^\d+`)
-	for i, line := range lines {
-		line = strings.TrimSpace(line)
-		
-		debugf("🔍 Строка %d: '%s'", i+1, line)
-		// Пропускаем пустые строки
-		if line == "" {
-			continue
-		}
-
-		// Начинаем парсинг после строки "Available formats for" или заголовка таблицы
-		if strings.Contains(line, "Available formats for") || strings.Contains(line, "ID  EXT") || 
-		   strings.Contains(line, "ID EXT") || strings.Contains(line, "format code") {
-			startParsing = true
-			headerFound = true
-			debugf("✅ Найден заголовок таблицы: '%s'", line)
-			continue
-		}
-
-		// Пропускаем разделители
-		if strings.Contains(line, "---") {
-			continue
-		}
-
-			// Парсим строки с форматами (начинаются с ID)
-		if startParsing && reDigits.MatchString(line) {
-			parts := strings.Fields(line)
-			debugf("🔍 Парсинг строки: %s (частей: %d)", line, len(parts))
-			
-			// Пропускаем строки, которые не являются видео/аудио форматами
-			if len(parts) < 4 {
-				log.Printf("⚠️ Строка слишком короткая для парсинга: %s (частей: %d)", line, len(parts))
-				continue
-			}
-			
-			// Проверяем, что это действительно формат (не служебная информация)
-			if parts[1] == "audio" || parts[1] == "mp4" || parts[1] == "webm" || parts[1] == "mov" {
-				log.Printf("✅ Найден формат: %s %s %s", parts[0], parts[1], parts[2])
-			} else {
-				log.Printf("⏭️ Пропускаю неформатную строку: %s", line)
-				continue
-			}
-			
-			if len(parts) >= 4 {
-				// Пропускаем storyboard форматы
-				if strings.HasPrefix(parts[0], "sb") {
-					log.Printf("⏭️ Пропускаю storyboard формат: %s", parts[0])
-					continue
-				}
-
-				// Определяем наличие аудио по колонке CH (каналы)
-				hasAudio := false
-				if len(parts) >= 5 {
-					// Если в колонке CH есть число больше 0, значит есть аудио
-					if channels, err := strconv.Atoi(parts[4]); err == nil && channels > 0 {
-						hasAudio = true
-						log.Printf("🎵 Найдены аудио каналы: %d", channels)
-					}
-				}
-				
-				// Дополнительная проверка по тексту
-				if !hasAudio {
-					hasAudio = !strings.Contains(line, "video only")
-				}
-				
-				// Дополнительные проверки для YouTube
-				if !hasAudio && strings.Contains(line, "mp4") {
-					// Для MP4 форматов YouTube часто есть аудио
-					if !strings.Contains(line, "video only") && !strings.Contains(line, "audio only") {
-						hasAudio = true
-						log.Printf("🎵 MP4 формат без 'video only' - считаю что есть аудио")
-					}
-				}
-				
-				// Проверяем, есть ли в строке "video only" - это означает что аудио НЕТ
-				if strings.Contains(line, "video only") {
-					hasAudio = false
-					log.Printf("🔇 Найдено 'video only' - аудио отсутствует")
-				}
-				
-				log.Printf("🔍 Анализ аудио для %s: hasAudio=%v, строка='%s'", parts[0], hasAudio, line)
-				
-				// Определяем тип формата
-				formatType := parts[1] // EXT колонка
-				log.Printf("🔍 Анализирую тип формата: '%s' для ID %s", formatType, parts[0])
-				
-				if formatType == "audio" {
-					// Это аудио формат
-					formatType = "audio"
-					hasAudio = true
-					log.Printf("🎵 Обнаружен аудио формат: ID %s", parts[0])
-				} else if strings.Contains(line, "audio only") {
-					// Альтернативная проверка для аудио
-					formatType = "audio"
-					hasAudio = true
-					log.Printf("🎵 Обнаружен аудио формат (по тексту): ID %s", parts[0])
-				} else if strings.Contains(line, "webm") && strings.Contains(line, "audio") {
-					// WebM аудио формат - принудительно конвертируем в MP3
-					formatType = "audio"
-					hasAudio = true
-					log.Printf("🎵 Обнаружен WebM аудио формат: ID %s - будет конвертирован в MP3", parts[0])
-				}
-
-				format := VideoFormat{
-					ID:         parts[0],
-					Extension:  formatType, // Используем определенный тип
-					Resolution: parts[2],
-					FPS:        parts[3],
-					HasAudio:   hasAudio,
-				}
-				
-				log.Printf("📝 Создана структура: ID=%s, Extension='%s', Resolution=%s, HasAudio=%v", 
-					format.ID, format.Extension, format.Resolution, format.HasAudio)
-
-				// Извлекаем размер файла если есть
-				// Ищем размер файла в разных колонках (yt-dlp может менять порядок)
-				format.FileSize = ""
-				for i := 5; i < len(parts); i++ {
-					if strings.Contains(parts[i], "MiB") || strings.Contains(parts[i], "GiB") || 
-					   strings.Contains(parts[i], "KiB") || strings.Contains(parts[i], "B") {
-						format.FileSize = parts[i]
-						log.Printf("📏 Размер файла: %s (колонка %d)", parts[i], i)
-						break
-					}
-				}
-				
-				if format.FileSize == "" {
-					log.Printf("⚠️ Размер файла не найден в строке: %s", line)
-				}
-
-				// Фильтруем дублирующиеся форматы (после извлечения размера)
-				if format.Extension == "audio" {
-					// Для аудио: оставляем только лучшие качества (не дублирующиеся)
-					isDuplicate := false
-					for _, existing := range allFormats {
-						if existing.Extension == "audio" {
-							// Если размер одинаковый - это дубликат
-							if existing.FileSize == format.FileSize {
-								isDuplicate = true
-								log.Printf("⏭️ Пропускаю дублирующийся аудио формат: %s (размер: %s)", format.ID, format.FileSize)
-								break
-							}
-							// Если разрешение одинаковое - оставляем лучший (больший размер)
-							if existing.Resolution == format.Resolution {
-								if s.isBetterAudioQuality(format, existing) {
-									// Заменяем худший на лучший
-									log.Printf("🔄 Заменяю худший аудио формат %s на лучший %s для разрешения %s", 
-										existing.ID, format.ID, format.Resolution)
-									// Находим и заменяем в списке
-									for i, f := range allFormats {
-										if f.ID == existing.ID {
-											allFormats[i] = format
-											break
-										}
-									}
-									goto nextFormat
-								} else {
-									// Пропускаем худший
-									log.Printf("⏭️ Пропускаю худший аудио формат %s для разрешения %s", 
-										format.ID, format.Resolution)
-									goto nextFormat
-								}
-							}
-						}
-					}
-					if isDuplicate {
-						continue
-					}
-				} else {
-					// ВРЕМЕННО: Показываем ВСЕ видео форматы для отладки
-					// Позже можно будет включить фильтрацию по звуку обратно
-					/*
-					if !format.HasAudio {
-						log.Printf("⏭️ Пропускаю видео без звука: %s (%s)", format.ID, format.Resolution)
-						goto nextFormat
-					}
-					*/
-					
-					log.Printf("✅ Видео формат добавлен: %s (%s) - %s (аудио: %v)", 
-						format.ID, format.Resolution, format.FileSize, format.HasAudio)
-				}
-
-				allFormats = append(allFormats, format)
-				log.Printf("📹 Найден формат: %s %s %s (аудио: %v, размер: %s)",
-					format.ID, format.Resolution, format.Extension, format.HasAudio, format.FileSize)
-			nextFormat:
-				continue
-			} else {
-				log.Printf("⚠️ Строка слишком короткая для парсинга: %s (частей: %d)", line, len(parts))
-			}
-		}
-	}
-
-	// Логируем все найденные форматы
-	log.Printf("🔍 ВСЕ найденные форматы (до фильтрации):")
-	var audioCount, videoWithAudioCount, videoWithoutAudioCount int
-	for _, f := range allFormats {
-		log.Printf("  - %s: %s %s (аудио: %v, размер: %s)", 
-			f.ID, f.Resolution, f.Extension, f.HasAudio, f.FileSize)
-		
-		if f.Extension == "audio" {
-			audioCount++
-		} else if f.HasAudio {
-			videoWithAudioCount++
-		} else {
-			videoWithoutAudioCount++
-		}
-	}
-	log.Printf("📊 Статистика: %d аудио, %d видео со звуком, %d видео без звука", 
-		audioCount, videoWithAudioCount, videoWithoutAudioCount)
-	
-	// Дополнительная отладка для видео форматов
-	if videoWithAudioCount == 0 {
-		log.Printf("⚠️ ВНИМАНИЕ: Не найдено видео форматов со звуком!")
-		log.Printf("🔍 Проверяю все видео форматы:")
-		for _, f := range allFormats {
-			if f.Extension != "audio" {
-				log.Printf("  🎥 %s: %s %s (аудио: %v, размер: %s)", 
-					f.ID, f.Resolution, f.Extension, f.HasAudio, f.FileSize)
-			}
-		}
-	}
+	log.Printf("✅ Метаданные получены: %s - %s", info.Metadata.Title, info.Metadata.Author)
+	log.Printf("📊 Найдено %d форматов, %d совместимых с Telegram", len(info.AllFormats), len(info.Formats))
+	return info, nil
+}
 
-	// Проверяем, что мы действительно нашли форматы
-	if len(allFormats) == 0 {
-		log.Printf("❌ КРИТИЧЕСКАЯ ОШИБКА: Не найдено ни одного формата!")
-		log.Printf("🔍 Проверьте вывод yt-dlp выше")
-		if !headerFound {
-			log.Printf("❌ Заголовок таблицы форматов не найден!")
-		}
+// GetVideoFormats получает список доступных форматов видео
+func (s *YouTubeService) GetVideoFormats(url string) ([]VideoFormat, error) {
+	info, err := s.GetVideoInfo(url)
+	if err != nil {
+		return nil, err
 	}
-
-	// Фильтруем форматы для совместимости с Telegram
-	telegramFormats := s.filterTelegramCompatibleFormats(allFormats)
-
-	log.Printf("📊 Найдено %d форматов, %d совместимых с Telegram", len(allFormats), len(telegramFormats))
-	return telegramFormats, nil
+	return info.Formats, nil
 }
 
 // filterTelegramCompatibleFormats фильтрует форматы для совместимости с Telegram
 func (s *YouTubeService) filterTelegramCompatibleFormats(formats []VideoFormat) []VideoFormat {
 	var compatible []VideoFormat
 
-	log.Printf("🔍 Фильтрация %d форматов для совместимости с Telegram", len(formats))
+	debugf("🔍 Фильтрация %d форматов для совместимости с Telegram", len(formats))
 
 	for _, format := range formats {
-		log.Printf("🔍 Проверяю формат %s: %s %s (аудио: %v, размер: %s)", 
-			format.ID, format.Resolution, format.Extension, format.HasAudio, format.FileSize)
-		
+		debugf("🔍 Проверяю формат %s: %s %s [%s/%s] (аудио: %v, размер: %s)",
+			format.ID, format.Resolution, format.Extension, format.VCodec, format.ACodec, format.HasAudio, format.SizeString())
+
 		// Telegram поддерживает только определенные форматы
 		if s.isTelegramCompatible(format) {
 			compatible = append(compatible, format)
-			log.Printf("✅ Формат %s прошел фильтрацию", format.ID)
-		} else {
-			log.Printf("❌ Формат %s не прошел фильтрацию", format.ID)
 		}
 	}
 
@@ -445,265 +236,144 @@ func (s *YouTubeService) filterTelegramCompatibleFormats(formats []VideoFormat)
 // isTelegramCompatible проверяет совместимость формата с Telegram
 func (s *YouTubeService) isTelegramCompatible(format VideoFormat) bool {
 	// Разрешаем все аудио форматы (webm будет конвертирован в mp3)
-	if format.Extension == "audio" {
-		log.Printf("✅ Аудио формат %s совместим с Telegram: %s (размер: %s) - будет конвертирован в MP3", 
-			format.ID, format.Resolution, format.FileSize)
+	if format.IsAudioOnly() {
 		return true
 	}
-	
+
 	// Для видео: только MP4 и MOV
 	if format.Extension != "mp4" && format.Extension != "mov" {
-		log.Printf("❌ Формат %s не поддерживается: %s", format.ID, format.Extension)
+		debugf("❌ Формат %s не поддерживается: %s", format.ID, format.Extension)
 		return false
 	}
 
-	// Проверяем размер файла (максимум 2GB)
-	if format.FileSize != "" {
-		if s.isFileSizeTooLarge(format.FileSize) {
-			log.Printf("📏 Формат %s превышает лимит 2GB: %s", format.ID, format.FileSize)
-			return false
-		}
+	// Проверяем размер файла (максимум 2GB, если большие файлы не режутся на части)
+	if !s.splitOversized && s.isFileSizeTooLarge(format.FileSize) {
+		log.Printf("📏 Формат %s превышает лимит 2GB: %s", format.ID, format.SizeString())
+		return false
 	}
 
-	log.Printf("✅ Формат %s совместим с Telegram: %s %s (размер: %s)", 
-		format.ID, format.Resolution, format.Extension, format.FileSize)
 	return true
 }
 
 // isFileSizeTooLarge проверяет, превышает ли размер файла лимит (2GB)
-func (s *YouTubeService) isFileSizeTooLarge(fileSize string) bool {
+func (s *YouTubeService) isFileSizeTooLarge(fileSize int64) bool {
 	// Локальный сервер поддерживает файлы до 2GB
-	const maxSizeMB = 2048 // 2GB в MB
-	
-	// Парсим размер файла (например: "≈301.82MiB", "52.91MiB", "1.2GiB", "500KiB")
-	fileSize = strings.TrimSpace(fileSize)
-	
-	// Убираем символы ≈, ~, если есть
-	fileSize = strings.TrimPrefix(fileSize, "≈")
-	fileSize = strings.TrimPrefix(fileSize, "~")
-	fileSize = strings.TrimSpace(fileSize)
-	
-	// Если размер в гигабайтах - проверяем значение
-	if strings.Contains(fileSize, "GiB") {
-		// Извлекаем числовое значение
-		sizeStr := strings.Replace(fileSize, "GiB", "", 1)
-		if size, err := strconv.ParseFloat(sizeStr, 64); err == nil {
-			isTooLarge := size > 2.0 // Максимум 2GB
-			log.Printf("📏 Размер в гигабайтах: %s (%.2f GB) - %s", fileSize, size, 
-				func() string { if isTooLarge { return "превышает лимит 2GB" } else { return "в пределах лимита 2GB" } }())
-			return isTooLarge
-		}
-	}
-	
-	// Если размер в мегабайтах - проверяем значение
-	if strings.Contains(fileSize, "MiB") {
-		// Извлекаем числовое значение
-		sizeStr := strings.Replace(fileSize, "MiB", "", 1)
-		if size, err := strconv.ParseFloat(sizeStr, 64); err == nil {
-			isTooLarge := size > float64(maxSizeMB)
-				log.Printf("📏 Размер в мегабайтах: %s (%.2f MB) - %s", fileSize, size, 
-		func() string { if isTooLarge { return "превышает лимит 2GB" } else { return "в пределах лимита 2GB" } }())
-	return isTooLarge
-		}
-	}
-	
-	// Если размер в килобайтах - точно не превышает
-	if strings.Contains(fileSize, "KiB") {
-		log.Printf("📏 Размер в килобайтах: %s - в пределах лимита", fileSize)
-		return false
-	}
-	
-	// Если размер в байтах - проверяем
-	if strings.Contains(fileSize, "B") && !strings.Contains(fileSize, "KiB") && !strings.Contains(fileSize, "MiB") && !strings.Contains(fileSize, "GiB") {
-		sizeStr := strings.Replace(fileSize, "B", "", 1)
-		if size, err := strconv.ParseFloat(sizeStr, 64); err == nil {
-			isTooLarge := size > float64(maxSizeMB*1024*1024) // 50MB в байтах
-			log.Printf("📏 Размер в байтах: %s (%.0f B) - %s", fileSize, size, 
-				func() string { if isTooLarge { return "превышает лимит" } else { return "в пределах лимита" } }())
-			return isTooLarge
-		}
-	}
-	
-	// Если не можем распарсить - пропускаем (лучше перестраховаться)
-	log.Printf("⚠️ Не удалось распарсить размер файла: %s", fileSize)
-	return true
+	const maxSize = 2048 * 1024 * 1024
+	return fileSize > maxSize
 }
 
 // DownloadVideo скачивает видео с YouTube
 func (s *YouTubeService) DownloadVideo(url string) (string, error) {
-	// Создаем папку для загрузок если не существует
-	if err := os.MkdirAll(s.downloadDir, 0755); err != nil {
-		return "", fmt.Errorf("не удалось создать папку для загрузок: %v", err)
-	}
-
 	log.Printf("💾 Скачивание видео: %s", url)
 
-	// Получаем аргументы прокси
-	proxyArgs := getProxyArgs()
-	
-	// Команда yt-dlp для скачивания лучшего MP4 формата (поддержка до 2GB)
-	args := []string{
-		"--format", "best[ext=mp4]/best", // Лучший MP4 или любой лучший
-		"--output", filepath.Join(s.downloadDir, "%(id)s.%(ext)s"), // Имя файла по ID
-		"--no-playlist",           // Только одно видео
-		"--no-check-certificates", // Ускоряем процесс
-		"--max-filesize", "2G",    // Максимальный размер файла 2GB
-		"--socket-timeout", "60",  // Увеличенный таймаут для больших файлов
-		"--retries", "5",          // Больше попыток для больших файлов
-	}
-	
-	// Добавляем аргументы прокси
-	args = append(args, proxyArgs...)
-	args = append(args, url)
-	
 	// Добавляем timeout для команды
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
 	defer cancel()
-	
-	cmd := exec.CommandContext(ctx, getYtDlpPath(), args...)
 
-	log.Printf("🚀 Выполняю команду: %s", strings.Join(cmd.Args, " "))
+	// Скачиваем лучший MP4 формат (поддержка до 2GB)
+	return s.downloader.Download(ctx, DownloadRequest{
+		URL:        url,
+		Format:     "best[ext=mp4]/best", // Лучший MP4 или любой лучший
+		OutputDir:  s.downloadDir,
+		FilePrefix: extractVideoID(url), // Имя файла по ID
+		Args: []string{
+			"--no-playlist",           // Только одно видео
+			"--no-check-certificates", // Ускоряем процесс
+			"--max-filesize", "2G",    // Максимальный размер файла 2GB
+			"--socket-timeout", "60",  // Увеличенный таймаут для больших файлов
+			"--retries", "5",          // Больше попыток для больших файлов
+		},
+	})
+}
 
-	// Запускаем команду
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("❌ Ошибка yt-dlp: %s", string(output))
-		return "", fmt.Errorf("ошибка yt-dlp: %v", err)
-	}
+// DownloadVideoWithFormat скачивает видео в конкретном формате
+func (s *YouTubeService) DownloadVideoWithFormat(videoURL, formatID string) (string, error) {
+	return s.DownloadVideoWithProgress(context.Background(), videoURL, formatID, nil)
+}
 
-	log.Printf("✅ yt-dlp выполнен успешно: %s", string(output))
+// DownloadVideoWithProgress скачивает видео в формате, сообщая прогресс в onProgress (может быть nil).
+// Одновременные запросы одного видео и формата объединяются в одно скачивание.
+// Отмена ctx останавливает yt-dlp (если скачивание больше никто не ждет) и удаляет недокачанные файлы.
+func (s *YouTubeService) DownloadVideoWithProgress(ctx context.Context, videoURL, formatID string, onProgress ProgressFunc) (string, error) {
+	return s.DownloadWithOptions(ctx, videoURL, formatID, DownloadOptions{Audio: IsAudioFormatID(formatID)}, onProgress)
+}
 
-	// Ищем скачанный файл для конкретного видео (без формата для старого метода)
-	videoFile, err := s.findDownloadedFileOld(url)
-	if err != nil {
-		return "", err
+// DownloadWithOptions скачивает видео с параметрами opts: фрагмент сохраняется под ClipFormatID
+// и не пересекается с полным видео, в аудиорежиме звук извлекается в opts.AudioFormat с тегами из opts.Metadata.
+func (s *YouTubeService) DownloadWithOptions(ctx context.Context, videoURL, formatID string, opts DownloadOptions, onProgress ProgressFunc) (string, error) {
+	videoID := extractVideoID(videoURL)
+	if videoID == "" {
+		return "", fmt.Errorf("не удалось извлечь ID видео из URL: %s", videoURL)
 	}
 
-	return videoFile, nil
+	key := downloadKey{platform: string(PlatformYouTube), videoID: videoID, formatID: opts.FileFormatID(formatID)}
+	return inflightDownloads.do(ctx, key, onProgress, func(ctx context.Context, onProgress ProgressFunc) (string, error) {
+		return s.downloadWithFormat(ctx, videoURL, videoID, formatID, opts, onProgress)
+	})
 }
 
-// DownloadVideoWithFormat скачивает видео в конкретном формате
-func (s *YouTubeService) DownloadVideoWithFormat(videoURL, formatID string) (string, error) {
-	// Создаем папку для загрузок если не существует
-	if err := os.MkdirAll(s.downloadDir, 0755); err != nil {
-		return "", fmt.Errorf("не удалось создать папку для загрузок: %v", err)
-	}
+// downloadWithFormat выполняет скачивание; вызывается только через inflightDownloads,
+// поэтому файлы с этим префиксом больше никто не пишет
+func (s *YouTubeService) downloadWithFormat(ctx context.Context, videoURL, videoID, formatID string, opts DownloadOptions, onProgress ProgressFunc) (string, error) {
+	fileFormatID := opts.FileFormatID(formatID)
 
 	// Очищаем только файлы для конкретного видео ID и формата
-	if err := s.cleanVideoFiles(videoURL, formatID); err != nil {
+	if err := s.cleanVideoFiles(videoURL, fileFormatID); err != nil {
 		log.Printf("⚠️ Не удалось очистить файлы для видео: %v", err)
 	}
 
-	log.Printf("💾 Скачивание видео %s в формате %s + аудио", videoURL, formatID)
-
-	var videoFile string
-	var lastErr error
-	
-	// Используем retry механизм для скачивания
-	err := utils.RetryWithBackoff(func() error {
-		// Получаем аргументы прокси
-		proxyArgs := getProxyArgs()
-		
-		// Команда yt-dlp для скачивания видео + аудио (поддержка до 2GB)
-		args := []string{
-			"--format", formatID + "+bestaudio/best", // Скачиваем видео + лучшее аудио
-			"--output", filepath.Join(s.downloadDir, "%(id)s_" + formatID + ".%(ext)s"),
+	req := DownloadRequest{
+		URL:        videoURL,
+		Format:     formatID + "+bestaudio/best", // Скачиваем видео + лучшее аудио
+		OutputDir:  s.downloadDir,
+		FilePrefix: videoID + "_" + fileFormatID,
+		Args: []string{
 			"--no-playlist",
 			"--no-check-certificates",
-			"--max-filesize", "2G",    // Максимальный размер файла 2GB
-			"--socket-timeout", "60",  // Увеличенный таймаут для больших файлов
-		"--retries", "5",          // Больше попыток для больших файлов
-		"--force-overwrites",      // Принудительно перезаписываем существующие файлы
-		}
-		
-		// Если это аудиоформат, принудительно конвертируем в MP3
-		// Проверяем по ID формата - если содержит "drc", "audio", "webm" или другие аудио ID, это аудио
-		if strings.Contains(formatID, "drc") || strings.Contains(formatID, "audio") || strings.Contains(formatID, "bestaudio") || strings.Contains(formatID, "webm") {
-			args = append(args, "--extract-audio", "--audio-format", "mp3", "--audio-quality", "0")
-			// Для аудио не используем merge-output-format, чтобы получить правильное расширение
-			log.Printf("🎵 Обнаружен аудиоформат %s, принудительно конвертирую в MP3", formatID)
-		} else {
-			// Только для видео используем merge-output-format
-			args = append(args, "--merge-output-format", "mp4")
-		}
-		
-		// Дополнительная проверка: если формат может дать webm файл, принудительно конвертируем в MP4
-		// Это нужно для случаев когда видео скачивается в webm формате
-		if strings.Contains(formatID, "webm") || strings.Contains(formatID, "251") || strings.Contains(formatID, "250") {
-			args = append(args, "--recode-video", "mp4")
-			log.Printf("🎬 Обнаружен WebM формат %s, принудительно конвертирую в MP4", formatID)
-		}
-		
-		// Добавляем аргументы прокси
-		args = append(args, proxyArgs...)
-		args = append(args, videoURL)
-		
-		// Добавляем timeout для команды
-		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
-		defer cancel()
-		
-		cmd := exec.CommandContext(ctx, getYtDlpPath(), args...)
-
-		log.Printf("🚀 Выполняю команду: %s", strings.Join(cmd.Args, " "))
-
-		// Запускаем команду
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			log.Printf("❌ Ошибка yt-dlp: %s", string(output))
-			return fmt.Errorf("ошибка yt-dlp: %v", err)
-		}
+			"--socket-timeout", "60", // Увеличенный таймаут для больших файлов
+			"--retries", "5",         // Больше попыток для больших файлов
+			"--force-overwrites",     // Принудительно перезаписываем существующие файлы
+		},
+		Progress: onProgress,
+	}
+	if !s.splitOversized {
+		req.Args = append(req.Args, "--max-filesize", "2G") // Максимальный размер файла 2GB
+	}
+	if opts.Clip != nil {
+		// Скачиваем только фрагмент; резы по ключевым кадрам, чтобы начало не было битым
+		req.Args = append(req.Args, "--download-sections", opts.Clip.Section(), "--force-keyframes-at-cuts")
+		log.Printf("✂️ Скачиваю фрагмент %s", opts.Clip)
+	}
 
-		log.Printf("✅ yt-dlp выполнен успешно: %s", string(output))
+	if opts.Audio {
+		// Аудиоформат скачиваем без видео и извлекаем звук в выбранный формат
+		log.Printf("🎵 Скачивание аудио %s в формате %s -> %s", videoURL, formatID, opts.AudioOutput().Key)
+		output := opts.AudioOutput()
+		req.Format = output.formatSelector(formatID)
+		req.Args = append(req.Args, output.args()...)
+	} else {
+		log.Printf("💾 Скачивание видео %s в формате %s + аудио", videoURL, formatID)
+		req.Args = append(req.Args, "--merge-output-format", "mp4")
 
-		// Ищем скачанный файл для конкретного видео
-		foundFile, findErr := s.findDownloadedFile(videoURL, formatID)
-		if findErr != nil {
-			return findErr
+		// Если формат может дать webm файл, принудительно конвертируем в MP4
+		if strings.Contains(formatID, "webm") {
+			req.Args = append(req.Args, "--recode-video", "mp4")
+			log.Printf("🎬 Обнаружен WebM формат %s, принудительно конвертирую в MP4", formatID)
 		}
-		
-		videoFile = foundFile
-		return nil
-	}, 2, 5*time.Second) // 2 попытки с базовой задержкой 5 секунд
-	
-	if err != nil {
-		lastErr = err
-		log.Printf("💥 Не удалось скачать видео после всех попыток: %v", err)
-		return "", lastErr
 	}
 
-	return videoFile, nil
-}
-
-// findDownloadedFileOld ищет скачанный видео файл для конкретного URL (старая версия)
-func (s *YouTubeService) findDownloadedFileOld(videoURL string) (string, error) {
-	// Извлекаем ID видео из URL
-	videoID := extractVideoID(videoURL)
-	if videoID == "" {
-		return "", fmt.Errorf("не удалось извлечь ID видео из URL: %s", videoURL)
+	videoFile, err := downloadWithRetry(ctx, s.downloader, req, !s.splitOversized)
+	if err == ErrCancelled {
+		return "", err
 	}
-
-	files, err := os.ReadDir(s.downloadDir)
 	if err != nil {
-		return "", fmt.Errorf("не удалось прочитать папку загрузок: %v", err)
-	}
-
-	// Ищем файл с конкретным ID видео
-	var videoFile string
-	for _, file := range files {
-		if !file.IsDir() && !strings.HasSuffix(file.Name(), ".webp") {
-			// Проверяем, что файл содержит ID видео
-			if strings.Contains(file.Name(), videoID) {
-				videoFile = filepath.Join(s.downloadDir, file.Name())
-				log.Printf("🎯 Найден файл для видео %s: %s", videoID, file.Name())
-				break
-			}
-		}
+		log.Printf("💥 Не удалось скачать видео после всех попыток: %v", err)
+		return "", err
 	}
 
-	if videoFile == "" {
-		return "", fmt.Errorf("не найден скачанный видео файл для видео %s", videoID)
+	if opts.Audio {
+		tagDownloadedAudio(ctx, videoFile, opts.Metadata)
 	}
-
 	return videoFile, nil
 }
 
@@ -721,11 +391,12 @@ func (s *YouTubeService) cleanVideoFiles(videoURL, formatID string) error {
 		return fmt.Errorf("не удалось прочитать папку загрузок: %v", err)
 	}
 
-	// Удаляем только файлы с этим ID видео и форматом
+	// Удаляем только файлы с этим ID видео и форматом (точное совпадение префикса,
+	// чтобы формат 18 не задевал файлы формата 180)
 	deletedCount := 0
-	expectedPattern := videoID + "_" + formatID
+	expectedPattern := videoID + "_" + formatID + "."
 	for _, file := range files {
-		if !file.IsDir() && strings.Contains(file.Name(), expectedPattern) {
+		if !file.IsDir() && strings.HasPrefix(file.Name(), expectedPattern) {
 			filePath := filepath.Join(s.downloadDir, file.Name())
 			if err := os.Remove(filePath); err != nil {
 				log.Printf("⚠️ Не удалось удалить файл %s: %v", filePath, err)
@@ -744,80 +415,29 @@ func (s *YouTubeService) cleanVideoFiles(videoURL, formatID string) error {
 	return nil
 }
 
-// extractVideoID извлекает ID видео из YouTube URL
+// extractVideoID извлекает ID видео из ссылки на видео или Shorts YouTube по реестру платформ
 func extractVideoID(url string) string {
-	// Поддерживаем разные форматы YouTube URL
-	patterns := []string{
-		`youtube\.com/watch\?v=([a-zA-Z0-9_-]+)`,
-		`youtu\.be/([a-zA-Z0-9_-]+)`,
-		`youtube\.com/embed/([a-zA-Z0-9_-]+)`,
-		`youtube\.com/shorts/([a-zA-Z0-9_-]+)`, // Добавляем поддержку YouTube Shorts
+	info := NewPlatformDetector().DetectPlatform(url)
+	if info.Type != PlatformYouTube && info.Type != PlatformYouTubeShorts {
+		return ""
 	}
-
-	for _, pattern := range patterns {
-		re := regexp.MustCompile(pattern)
-		matches := re.FindStringSubmatch(url)
-		if len(matches) > 1 {
-			return matches[1]
-		}
-	}
-
-	return ""
-}
-
-// findDownloadedFile ищет скачанный видео файл для конкретного URL и формата
-func (s *YouTubeService) findDownloadedFile(videoURL, formatID string) (string, error) {
-	// Извлекаем ID видео из URL
-	videoID := extractVideoID(videoURL)
-	if videoID == "" {
-		return "", fmt.Errorf("не удалось извлечь ID видео из URL: %s", videoURL)
-	}
-
-	files, err := os.ReadDir(s.downloadDir)
-	if err != nil {
-		return "", fmt.Errorf("не удалось прочитать папку загрузок: %v", err)
-	}
-
-	// Ищем файл с конкретным ID видео и форматом
-	var videoFile string
-	expectedPattern := videoID + "_" + formatID
-	for _, file := range files {
-		if !file.IsDir() && !strings.HasSuffix(file.Name(), ".webp") {
-			// Проверяем, что файл содержит ID видео и formatID
-			if strings.Contains(file.Name(), expectedPattern) {
-				videoFile = filepath.Join(s.downloadDir, file.Name())
-				log.Printf("🎯 Найден файл для видео %s (формат %s): %s", videoID, formatID, file.Name())
-				break
-			}
-		}
-	}
-
-	if videoFile == "" {
-		return "", fmt.Errorf("не найден скачанный видео файл для видео %s", videoID)
-	}
-
-	return videoFile, nil
+	return info.VideoID
 }
 
 // DownloadVideoFast быстро скачивает видео без анализа форматов
 func (s *YouTubeService) DownloadVideoFast(url string) (string, error) {
-	// Создаем папку для загрузок если не существует
-	if err := os.MkdirAll(s.downloadDir, 0755); err != nil {
-		return "", fmt.Errorf("не удалось создать папку для загрузок: %v", err)
-	}
-
 	log.Printf("⚡ Быстрое скачивание видео: %s", url)
 
 	// Пробуем разные стратегии скачивания
 	strategies := []struct {
-		name string
-		args []string
+		name   string
+		format string
+		args   []string
 	}{
 		{
 			name: "Стандартное скачивание (до 2GB)",
+			format: "best[ext=mp4]/best",
 			args: []string{
-				"--format", "best[ext=mp4]/best",
-				"--output", filepath.Join(s.downloadDir, "%(id)s.%(ext)s"),
 				"--no-playlist",
 				"--no-check-certificates",
 				"--no-warnings",
@@ -829,9 +449,8 @@ func (s *YouTubeService) DownloadVideoFast(url string) (string, error) {
 		},
 		{
 			name: "Скачивание с обходом ограничений (до 2GB)",
+			format: "best",
 			args: []string{
-				"--format", "best",
-				"--output", filepath.Join(s.downloadDir, "%(id)s.%(ext)s"),
 				"--no-playlist",
 				"--no-check-certificates",
 				"--no-warnings",
@@ -845,9 +464,8 @@ func (s *YouTubeService) DownloadVideoFast(url string) (string, error) {
 		},
 		{
 			name: "Скачивание с прокси (до 2GB)",
+			format: "best",
 			args: []string{
-				"--format", "best",
-				"--output", filepath.Join(s.downloadDir, "%(id)s.%(ext)s"),
 				"--no-playlist",
 				"--no-check-certificates",
 				"--no-warnings",
@@ -863,35 +481,22 @@ func (s *YouTubeService) DownloadVideoFast(url string) (string, error) {
 	for i, strategy := range strategies {
 		log.Printf("🔄 Попытка %d: %s", i+1, strategy.name)
 		
-		// Получаем аргументы прокси
-		proxyArgs := getProxyArgs()
-		
-		// Добавляем аргументы прокси к стратегии
-		args := append(strategy.args, proxyArgs...)
-		args = append(args, url)
-		
 		// Добавляем timeout для команды
 		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
-		defer cancel()
-		
-		cmd := exec.CommandContext(ctx, getYtDlpPath(), args...)
-		
-		log.Printf("🚀 Выполняю команду: %s", strings.Join(cmd.Args, " "))
-		
-		output, err := cmd.CombinedOutput()
+		videoFile, err := s.downloader.Download(ctx, DownloadRequest{
+			URL:        url,
+			Format:     strategy.format,
+			OutputDir:  s.downloadDir,
+			FilePrefix: extractVideoID(url),
+			Args:       strategy.args,
+		})
+		cancel()
 		if err == nil {
-			log.Printf("✅ %s выполнен успешно: %s", strategy.name, string(output))
-			
-			// Ищем скачанный файл для конкретного видео (без формата для старого метода)
-			videoFile, err := s.findDownloadedFileOld(url)
-			if err != nil {
-				continue // Пробуем следующую стратегию
-			}
-			
+			log.Printf("✅ %s выполнен успешно", strategy.name)
 			return videoFile, nil
 		}
 		
-		log.Printf("❌ %s не удался: %s", strategy.name, string(output))
+		log.Printf("❌ %s не удался: %v", strategy.name, err)
 	}
 
 	return "", fmt.Errorf("все стратегии скачивания не удались")
@@ -948,215 +553,17 @@ func (s *YouTubeService) CheckNetwork() error {
 	return nil
 }
 
-// isBetterAudioQuality проверяет, является ли новый аудио формат лучше существующего
-func (s *YouTubeService) isBetterAudioQuality(new, existing VideoFormat) bool {
-	// Для аудио: больший размер обычно означает лучшее качество
-	if new.FileSize != "" && existing.FileSize != "" {
-		newSize := s.parseFileSize(new.FileSize)
-		existingSize := s.parseFileSize(existing.FileSize)
-		return newSize > existingSize
-	}
-	
-	// Если не можем сравнить - считаем новый лучше
-	return true
-}
-
-// isBetterQuality проверяет, является ли новый формат лучше существующего
-func (s *YouTubeService) isBetterQuality(new, existing VideoFormat) bool {
-	// Если у нового формата есть аудио, а у существующего нет - новый лучше
-	if new.HasAudio && !existing.HasAudio {
-		return true
-	}
-	
-	// Если у обоих есть аудио или у обоих нет - сравниваем по размеру
-	// Больший размер обычно означает лучшее качество
-	if new.FileSize != "" && existing.FileSize != "" {
-		newSize := s.parseFileSize(new.FileSize)
-		existingSize := s.parseFileSize(existing.FileSize)
-		return newSize > existingSize
-	}
-	
-	// Если не можем сравнить - считаем новый лучше
-	return true
-}
-
-// parseFileSize парсит размер файла в байты для сравнения
-func (s *YouTubeService) parseFileSize(fileSize string) int64 {
-	fileSize = strings.TrimSpace(fileSize)
-	fileSize = strings.TrimPrefix(fileSize, "≈")
-	fileSize = strings.TrimPrefix(fileSize, "~")
-	
-	var multiplier int64 = 1
-	if strings.Contains(fileSize, "GiB") {
-		multiplier = 1024 * 1024 * 1024
-		fileSize = strings.Replace(fileSize, "GiB", "", 1)
-	} else if strings.Contains(fileSize, "MiB") {
-		multiplier = 1024 * 1024
-		fileSize = strings.Replace(fileSize, "MiB", "", 1)
-	} else if strings.Contains(fileSize, "KiB") {
-		multiplier = 1024
-		fileSize = strings.Replace(fileSize, "KiB", "", 1)
-	} else if strings.Contains(fileSize, "B") {
-		multiplier = 1
-		fileSize = strings.Replace(fileSize, "B", "", 1)
-	}
-	
-	if size, err := strconv.ParseFloat(fileSize, 64); err == nil {
-		return int64(size * float64(multiplier))
-	}
-	
-	return 0
-}
-
 // GetVideoMetadata получает метаданные видео (название, автор, длительность, просмотры)
 func (s *YouTubeService) GetVideoMetadata(url string) (*VideoMetadata, error) {
-	log.Printf("📊 Получение метаданных для: %s", url)
-	
-	// Получаем аргументы прокси
-	proxyArgs := getProxyArgs()
-	
-	// Команда yt-dlp для получения метаданных
-	args := []string{
-		"--dump-json",           // Получаем JSON с метаданными
-		"--no-playlist",         // Только одно видео
-		"--no-check-certificates",
-		"--no-warnings",
-		"--quiet",
-	}
-	
-	// Добавляем аргументы прокси
-	args = append(args, proxyArgs...)
-	args = append(args, url)
-	
-	// Добавляем timeout для команды метаданных
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-	defer cancel()
-	
-	cmd := exec.CommandContext(ctx, getYtDlpPath(), args...)
-	
-	log.Printf("🚀 Выполняю команду для метаданных: %s", strings.Join(cmd.Args, " "))
-	
-	// Запускаем команду
-	output, err := cmd.CombinedOutput()
+	info, err := s.GetVideoInfo(url)
 	if err != nil {
-		log.Printf("❌ Ошибка получения метаданных: %s", string(output))
 		return nil, fmt.Errorf("ошибка получения метаданных: %v", err)
 	}
-	
-	// Парсим JSON ответ
-	metadata, err := s.parseVideoMetadata(string(output))
-	if err != nil {
-		return nil, fmt.Errorf("ошибка парсинга метаданных: %v", err)
-	}
-	
-	// Устанавливаем оригинальный URL
-	metadata.OriginalURL = url
-	
-	log.Printf("✅ Метаданные получены: %s - %s", metadata.Title, metadata.Author)
-	log.Printf("🖼️ Миниатюра: %s", metadata.Thumbnail)
-	log.Printf("⏱️ Длительность: %s", metadata.Duration)
-	log.Printf("👁️ Просмотры: %s", metadata.Views)
-	log.Printf("🔗 Оригинал: %s", metadata.OriginalURL)
-	return metadata, nil
-}
-
-// parseVideoMetadata парсит JSON ответ yt-dlp и извлекает метаданные
-func (s *YouTubeService) parseVideoMetadata(jsonOutput string) (*VideoMetadata, error) {
-	// Парсим JSON
-	var data map[string]interface{}
-	if err := json.Unmarshal([]byte(jsonOutput), &data); err != nil {
-		return nil, fmt.Errorf("ошибка парсинга JSON: %v", err)
-	}
-	
-	// Логируем ключи JSON для отладки
-	log.Printf("🔍 Ключи в JSON ответе: %v", getKeys(data))
-	
-	metadata := &VideoMetadata{}
-	
-	// Извлекаем название
-	if title, ok := data["title"].(string); ok {
-		metadata.Title = title
-	}
-	
-	// Извлекаем автора
-	if uploader, ok := data["uploader"].(string); ok {
-		metadata.Author = uploader
-	}
-	
-	// Извлекаем длительность
-	if duration, ok := data["duration"].(float64); ok {
-		metadata.Duration = s.formatDuration(int(duration))
-	}
-	
-	// Извлекаем количество просмотров
-	if viewCount, ok := data["view_count"].(float64); ok {
-		metadata.Views = s.formatViews(int64(viewCount))
-	}
-	
-	// Извлекаем описание
-	if description, ok := data["description"].(string); ok {
-		// Ограничиваем описание до 200 символов
-		if len(description) > 200 {
-			metadata.Description = description[:200] + "..."
-		} else {
-			metadata.Description = description
-		}
-	}
-	
-	// Извлекаем миниатюру (берем лучшую по качеству)
-	if thumbnails, ok := data["thumbnails"].([]interface{}); ok && len(thumbnails) > 0 {
-		// Ищем миниатюру с максимальным разрешением
-		var bestThumbnail string
-		var maxWidth int
-		
-		for _, thumb := range thumbnails {
-			if thumbMap, ok := thumb.(map[string]interface{}); ok {
-				if url, ok := thumbMap["url"].(string); ok {
-					// Если есть информация о ширине - используем её
-					if width, ok := thumbMap["width"].(float64); ok {
-						if int(width) > maxWidth {
-							maxWidth = int(width)
-							bestThumbnail = url
-						}
-					} else {
-						// Если нет информации о ширине - берем первую
-						if bestThumbnail == "" {
-							bestThumbnail = url
-						}
-					}
-				}
-			}
-		}
-		
-		if bestThumbnail != "" {
-			metadata.Thumbnail = bestThumbnail
-			log.Printf("🖼️ Выбрана миниатюра: %s (ширина: %dpx)", bestThumbnail, maxWidth)
-		}
-	} else {
-		// Альтернативный способ - используем thumbnail из корня JSON
-		if thumbnail, ok := data["thumbnail"].(string); ok && thumbnail != "" {
-			metadata.Thumbnail = thumbnail
-			log.Printf("🖼️ Использована основная миниатюра: %s", thumbnail)
-		} else {
-			log.Printf("⚠️ Миниатюра не найдена в JSON ответе")
-		}
-	}
-	
-	// Извлекаем дату загрузки
-	if uploadDate, ok := data["upload_date"].(string); ok {
-		metadata.UploadDate = s.formatUploadDate(uploadDate)
-	}
-	
-	// Извлекаем оригинальный URL
-	if webpageURL, ok := data["webpage_url"].(string); ok {
-		metadata.OriginalURL = webpageURL
-	}
-	
-	return metadata, nil
+	return info.Metadata, nil
 }
 
 // formatDuration форматирует длительность в читаемый вид
-func (s *YouTubeService) formatDuration(seconds int) string {
+func formatDuration(seconds int) string {
 	if seconds < 60 {
 		return fmt.Sprintf("%d сек", seconds)
 	} else if seconds < 3600 {
@@ -1177,7 +584,7 @@ func (s *YouTubeService) formatDuration(seconds int) string {
 }
 
 // formatViews форматирует количество просмотров
-func (s *YouTubeService) formatViews(views int64) string {
+func formatViews(views int64) string {
 	if views < 1000 {
 		return fmt.Sprintf("%d", views)
 	} else if views < 1000000 {
@@ -1190,7 +597,7 @@ func (s *YouTubeService) formatViews(views int64) string {
 }
 
 // formatUploadDate форматирует дату загрузки
-func (s *YouTubeService) formatUploadDate(uploadDate string) string {
+func formatUploadDate(uploadDate string) string {
 	// Формат: YYYYMMDD
 	if len(uploadDate) >= 8 {
 		year := uploadDate[:4]
@@ -1201,15 +608,6 @@ func (s *YouTubeService) formatUploadDate(uploadDate string) string {
 	return uploadDate
 }
 
-// getKeys возвращает ключи из map для отладки
-func getKeys(data map[string]interface{}) []string {
-	keys := make([]string, 0, len(data))
-	for k := range data {
-		keys = append(keys, k)
-	}
-	return keys
-}
-
 // Debug logging toggle via LOG_LEVEL=debug
 var debugEnabled = strings.ToLower(os.Getenv("LOG_LEVEL")) == "debug"
 
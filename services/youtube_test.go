@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestYouTubeServiceGetVideoInfo(t *testing.T) {
+	service := NewYouTubeServiceWithDownloader(t.TempDir(), NewFakeDownloader(fixtureDir))
+
+	info, err := service.GetVideoInfo("https://www.youtube.com/watch?v=dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Metadata.Title != "Rick Astley - Never Gonna Give You Up (Official Music Video)" {
+		t.Errorf("title = %q", info.Metadata.Title)
+	}
+	if len(info.Formats) == 0 || len(info.Formats) > len(info.AllFormats) {
+		t.Errorf("formats: %d compatible of %d", len(info.Formats), len(info.AllFormats))
+	}
+}
+
+func TestYouTubeServiceDownloadWithProgress(t *testing.T) {
+	fake := NewFakeDownloader(mediaFixtureDir(t, "dQw4w9WgXcQ"))
+	downloadDir := t.TempDir()
+	service := NewYouTubeServiceWithDownloader(downloadDir, fake)
+
+	var progress []DownloadProgress
+	path, err := service.DownloadVideoWithProgress(context.Background(), "https://youtu.be/dQw4w9WgXcQ", "18", func(p DownloadProgress) {
+		progress = append(progress, p)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(downloadDir, "dQw4w9WgXcQ_18.mp4"); path != want {
+		t.Errorf("path = %s, want %s", path, want)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "fake video dQw4w9WgXcQ" {
+		t.Errorf("downloaded file: %q, %v", data, err)
+	}
+	if len(progress) == 0 || progress[len(progress)-1].Status != ProgressFinished || progress[len(progress)-1].Percent != 100 {
+		t.Errorf("progress = %+v", progress)
+	}
+}
+
+func TestYouTubeServiceDownloadCancelled(t *testing.T) {
+	fake := NewFakeDownloader(mediaFixtureDir(t, "dQw4w9WgXcQ"))
+	service := NewYouTubeServiceWithDownloader(t.TempDir(), fake)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := service.DownloadVideoWithProgress(ctx, "https://youtu.be/dQw4w9WgXcQ", "18", nil); err != ErrCancelled {
+		t.Errorf("err = %v, want ErrCancelled", err)
+	}
+	for _, call := range fake.Calls() {
+		if strings.HasPrefix(call, "download ") {
+			t.Errorf("cancelled download reached the downloader: %s", call)
+		}
+	}
+}
+
+// deadlineDownloader запоминает, был ли у контекста скачивания срок
+type deadlineDownloader struct {
+	*FakeDownloader
+	hasDeadline bool
+}
+
+func (d *deadlineDownloader) Download(ctx context.Context, req DownloadRequest) (string, error) {
+	_, d.hasDeadline = ctx.Deadline()
+	return d.FakeDownloader.Download(ctx, req)
+}
+
+func TestYouTubeServiceAttemptTimeout(t *testing.T) {
+	for _, split := range []bool{false, true} {
+		downloader := &deadlineDownloader{FakeDownloader: NewFakeDownloader(mediaFixtureDir(t, "dQw4w9WgXcQ"))}
+		service := NewYouTubeServiceWithDownloader(t.TempDir(), downloader)
+		service.SetSplitOversized(split)
+
+		if _, err := service.DownloadVideoWithProgress(context.Background(), "https://youtu.be/dQw4w9WgXcQ", "137", nil); err != nil {
+			t.Fatal(err)
+		}
+		// Разрезаемые на части файлы ограничены только отменой задачи
+		if downloader.hasDeadline == split {
+			t.Errorf("split %v: attempt deadline = %v", split, downloader.hasDeadline)
+		}
+	}
+}
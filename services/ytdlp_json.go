@@ -0,0 +1,274 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// VideoInfo объединяет метаданные и форматы, полученные одним вызовом yt-dlp
+type VideoInfo struct {
+	ID           string
+	ExtractorKey string
+	Metadata     *VideoMetadata
+	Formats      []VideoFormat // Форматы, совместимые с Telegram
+	AllFormats   []VideoFormat // Все форматы из ответа yt-dlp (без storyboard)
+}
+
+// ytDlpInfo - поля ответа yt-dlp --dump-single-json, которые использует бот
+type ytDlpInfo struct {
+	ID          string           `json:"id"`
+	Title       string           `json:"title"`
+	Uploader    string           `json:"uploader"`
+	Channel     string           `json:"channel"`
+	Duration    float64          `json:"duration"`
+	ViewCount   int64            `json:"view_count"`
+	Description string           `json:"description"`
+	Thumbnail   string           `json:"thumbnail"`
+	Thumbnails  []ytDlpThumbnail `json:"thumbnails"`
+	UploadDate  string           `json:"upload_date"`
+	Track       string           `json:"track"`
+	Artist      string           `json:"artist"`
+	Album       string           `json:"album"`
+	ReleaseYear int              `json:"release_year"`
+	Chapters    []ytDlpChapter   `json:"chapters"`
+
+	Subtitles         map[string][]ytDlpSubtitle `json:"subtitles"`
+	AutomaticCaptions map[string][]ytDlpSubtitle `json:"automatic_captions"`
+	WebpageURL        string                     `json:"webpage_url"`
+	Extractor         string                     `json:"extractor"`
+	ExtractorKey      string                     `json:"extractor_key"`
+	Formats           []ytDlpFormat              `json:"formats"`
+
+	// Поля плейлиста (--flat-playlist)
+	Type          string               `json:"_type"`
+	Entries       []ytDlpPlaylistEntry `json:"entries"`
+	PlaylistCount int                  `json:"playlist_count"`
+}
+
+// ytDlpPlaylistEntry - запись плейлиста из ответа yt-dlp --flat-playlist
+type ytDlpPlaylistEntry struct {
+	ID       string  `json:"id"`
+	Title    string  `json:"title"`
+	URL      string  `json:"url"`
+	Duration float64 `json:"duration"`
+	IEKey    string  `json:"ie_key"`
+}
+
+// ytDlpThumbnail - миниатюра из ответа yt-dlp
+type ytDlpThumbnail struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// ytDlpChapter - глава видео из ответа yt-dlp
+type ytDlpChapter struct {
+	Title     string  `json:"title"`
+	StartTime float64 `json:"start_time"`
+	EndTime   float64 `json:"end_time"`
+}
+
+// ytDlpSubtitle - вариант дорожки субтитров из ответа yt-dlp
+type ytDlpSubtitle struct {
+	Ext  string `json:"ext"`
+	Name string `json:"name"`
+}
+
+// ytDlpFormat - формат из ответа yt-dlp
+type ytDlpFormat struct {
+	FormatID       string  `json:"format_id"`
+	FormatNote     string  `json:"format_note"`
+	Ext            string  `json:"ext"`
+	Container      string  `json:"container"`
+	Protocol       string  `json:"protocol"`
+	VCodec         string  `json:"vcodec"`
+	ACodec         string  `json:"acodec"`
+	Width          int     `json:"width"`
+	Height         int     `json:"height"`
+	Resolution     string  `json:"resolution"`
+	FPS            float64 `json:"fps"`
+	TBR            float64 `json:"tbr"`
+	ABR            float64 `json:"abr"`
+	VBR            float64 `json:"vbr"`
+	FileSize       float64 `json:"filesize"`
+	FileSizeApprox float64 `json:"filesize_approx"`
+	DynamicRange   string  `json:"dynamic_range"`
+	Language       string  `json:"language"`
+}
+
+// parseYtDlpInfo разбирает JSON ответ yt-dlp
+func parseYtDlpInfo(data []byte) (*ytDlpInfo, error) {
+	var info ytDlpInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("ошибка парсинга JSON yt-dlp: %v", err)
+	}
+	return &info, nil
+}
+
+// videoInfo собирает VideoInfo из ответа yt-dlp (форматы без фильтрации под Telegram)
+func (info *ytDlpInfo) videoInfo(url string) *VideoInfo {
+	result := &VideoInfo{
+		ID:           info.ID,
+		ExtractorKey: info.ExtractorKey,
+		Metadata:     info.metadata(),
+		AllFormats:   info.videoFormats(),
+	}
+	if result.Metadata.OriginalURL == "" {
+		result.Metadata.OriginalURL = url
+	}
+	return result
+}
+
+// metadata извлекает метаданные видео из ответа yt-dlp
+func (info *ytDlpInfo) metadata() *VideoMetadata {
+	metadata := &VideoMetadata{
+		VideoID:         info.ID,
+		Title:           info.Title,
+		Author:          info.Uploader,
+		DurationSeconds: int(info.Duration),
+		OriginalURL:     info.WebpageURL,
+		Track:           info.Track,
+		Artist:          info.Artist,
+		Album:           info.Album,
+	}
+	if metadata.Author == "" {
+		metadata.Author = info.Channel
+	}
+	if info.Duration > 0 {
+		metadata.Duration = formatDuration(int(info.Duration))
+	}
+	if info.ViewCount > 0 {
+		metadata.Views = formatViews(info.ViewCount)
+	}
+
+	// Ограничиваем описание до 200 символов (по рунам, чтобы не резать UTF-8)
+	description := []rune(info.Description)
+	if len(description) > 200 {
+		metadata.Description = string(description[:200]) + "..."
+	} else {
+		metadata.Description = info.Description
+	}
+
+	// Берем миниатюру с максимальной шириной, иначе основную
+	var maxWidth int
+	for _, thumb := range info.Thumbnails {
+		if thumb.URL == "" {
+			continue
+		}
+		if metadata.Thumbnail == "" || thumb.Width > maxWidth {
+			maxWidth = thumb.Width
+			metadata.Thumbnail = thumb.URL
+		}
+	}
+	if metadata.Thumbnail == "" {
+		metadata.Thumbnail = info.Thumbnail
+	}
+
+	if info.UploadDate != "" {
+		metadata.UploadDate = formatUploadDate(info.UploadDate)
+	}
+	for _, chapter := range info.Chapters {
+		if chapter.EndTime > chapter.StartTime {
+			metadata.Chapters = append(metadata.Chapters, Chapter{Title: chapter.Title, Start: chapter.StartTime, End: chapter.EndTime})
+		}
+	}
+	metadata.Subtitles = subtitleTracks(info.Subtitles, info.AutomaticCaptions)
+	if info.ReleaseYear > 0 {
+		metadata.Year = strconv.Itoa(info.ReleaseYear)
+	} else if len(info.UploadDate) >= 4 {
+		metadata.Year = info.UploadDate[:4]
+	}
+	return metadata
+}
+
+// videoFormats преобразует форматы yt-dlp в VideoFormat, пропуская storyboard и служебные форматы
+func (info *ytDlpInfo) videoFormats() []VideoFormat {
+	var formats []VideoFormat
+	for _, f := range info.Formats {
+		if f.FormatID == "" || f.Ext == "mhtml" || strings.HasPrefix(f.FormatID, "sb") {
+			continue
+		}
+		// Форматы без видео и без аудио (например, манифесты) не нужны
+		if f.VCodec == "none" && f.ACodec == "none" {
+			continue
+		}
+		formats = append(formats, f.toVideoFormat(info.Duration))
+	}
+	return formats
+}
+
+// toVideoFormat конвертирует формат yt-dlp в VideoFormat
+func (f ytDlpFormat) toVideoFormat(duration float64) VideoFormat {
+	format := VideoFormat{
+		ID:           f.FormatID,
+		Extension:    f.Ext,
+		Container:    f.Container,
+		Note:         f.FormatNote,
+		Width:        f.Width,
+		Height:       f.Height,
+		FPS:          f.FPS,
+		VCodec:       f.VCodec,
+		ACodec:       f.ACodec,
+		TBR:          f.TBR,
+		ABR:          f.ABR,
+		DynamicRange: f.DynamicRange,
+		Language:     f.Language,
+	}
+
+	// Кодек "none" означает отсутствие дорожки, пустое значение - неизвестно
+	format.HasAudio = f.ACodec != "none" && (f.ACodec != "" || f.VCodec == "")
+
+	if format.IsAudioOnly() {
+		format.Resolution = "audio"
+	} else if f.Width > 0 && f.Height > 0 {
+		format.Resolution = fmt.Sprintf("%dx%d", f.Width, f.Height)
+	} else {
+		format.Resolution = f.Resolution
+	}
+
+	// Точный размер, если известен, иначе оценка yt-dlp или оценка по битрейту
+	switch {
+	case f.FileSize > 0:
+		format.FileSize = int64(f.FileSize)
+	case f.FileSizeApprox > 0:
+		format.FileSize = int64(f.FileSizeApprox)
+		format.FileSizeApprox = true
+	case f.TBR > 0 && duration > 0:
+		format.FileSize = int64(f.TBR * 1000 / 8 * duration)
+		format.FileSizeApprox = true
+	}
+
+	return format
+}
+
+// pickBestAudio оставляет один аудио формат - с максимальным битрейтом
+func pickBestAudio(formats []VideoFormat) []VideoFormat {
+	var result []VideoFormat
+	bestAudio := -1
+
+	for _, format := range formats {
+		if !format.IsAudioOnly() {
+			result = append(result, format)
+			continue
+		}
+		if bestAudio < 0 {
+			bestAudio = len(result)
+			result = append(result, format)
+		} else if isBetterAudioQuality(format, result[bestAudio]) {
+			debugf("🔄 Заменяю аудио формат %s на лучший %s", result[bestAudio].ID, format.ID)
+			result[bestAudio] = format
+		}
+	}
+	return result
+}
+
+// isBetterAudioQuality проверяет, является ли новый аудио формат лучше существующего
+func isBetterAudioQuality(new, existing VideoFormat) bool {
+	// Сначала сравниваем битрейт аудио, потом размер
+	if new.ABR != existing.ABR && new.ABR > 0 && existing.ABR > 0 {
+		return new.ABR > existing.ABR
+	}
+	return new.FileSize > existing.FileSize
+}
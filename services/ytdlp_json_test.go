@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const fixtureDir = "testdata/ytdlp"
+
+func TestParseFixtures(t *testing.T) {
+	tests := []struct {
+		fixture   string
+		id        string
+		extractor string
+		title     string
+		formats   []string
+	}{
+		{"dQw4w9WgXcQ.json", "dQw4w9WgXcQ", "Youtube", "Rick Astley - Never Gonna Give You Up (Official Music Video)",
+			[]string{"140", "251", "18", "136", "137", "248", "701"}},
+		{"7301234567890123456.json", "7301234567890123456", "TikTok", "cat vs cucumber #fyp",
+			[]string{"download_addr-0", "play_addr-0", "bytevc1_720p_1080000-0", "h264_540p_1650000-0"}},
+		{"C0abcDEFghi.json", "C0abcDEFghi", "Instagram", "Video by natgeo",
+			[]string{"dash-1018740425579212a", "dash-699474565491011v", "dash-1349473432620795v", "8"}},
+		{"1723456789012345678.json", "1723456789012345678", "Twitter", "NASA - Liftoff of Artemis II",
+			[]string{"hls-audio-128000-Audio", "hls-832", "http-832", "http-2176"}},
+		{"17xyzab.json", "b8w2k4z1yq0c1", "Reddit", "Dog learns to open the fridge",
+			[]string{"dash-audio_AAC_128", "hls-1013", "dash-video_480", "dash-video_720"}},
+	}
+
+	for _, tt := range tests {
+		data, err := os.ReadFile(filepath.Join(fixtureDir, tt.fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := parseYtDlpInfo(data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.fixture, err)
+		}
+		info := raw.videoInfo("https://example.com/source")
+
+		if info.ID != tt.id || info.ExtractorKey != tt.extractor {
+			t.Errorf("%s: id/extractor = %s/%s, want %s/%s", tt.fixture, info.ID, info.ExtractorKey, tt.id, tt.extractor)
+		}
+		if info.Metadata.Title != tt.title {
+			t.Errorf("%s: title = %q, want %q", tt.fixture, info.Metadata.Title, tt.title)
+		}
+		if info.Metadata.OriginalURL == "" {
+			t.Errorf("%s: empty OriginalURL", tt.fixture)
+		}
+		var ids []string
+		for _, format := range info.AllFormats {
+			ids = append(ids, format.ID)
+		}
+		if !reflect.DeepEqual(ids, tt.formats) {
+			t.Errorf("%s: formats = %v, want %v", tt.fixture, ids, tt.formats)
+		}
+	}
+}
+
+func TestParseFixtureFormatDetails(t *testing.T) {
+	info, err := NewFakeDownloader(fixtureDir).Probe(context.Background(), "https://www.youtube.com/watch?v=dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	formats := make(map[string]VideoFormat)
+	for _, format := range info.AllFormats {
+		formats[format.ID] = format
+	}
+
+	if f := formats["140"]; !f.IsAudioOnly() || f.Resolution != "audio" || f.FileSize != 3433514 {
+		t.Errorf("140: %+v", f)
+	}
+	if f := formats["18"]; !f.HasAudio || f.Height != 360 {
+		t.Errorf("18: %+v", f)
+	}
+	if f := formats["136"]; f.HasAudio || f.Height != 720 {
+		t.Errorf("136: %+v", f)
+	}
+	if _, ok := formats["sb0"]; ok {
+		t.Error("storyboard format sb0 should be skipped")
+	}
+}
+
+func TestFakeDownloaderProbesPlatformFixtures(t *testing.T) {
+	tests := []struct {
+		url string
+		id  string
+	}{
+		{"https://www.tiktok.com/@user/video/7301234567890123456", "7301234567890123456"},
+		{"https://www.instagram.com/reel/C0abcDEFghi/", "C0abcDEFghi"},
+		{"https://x.com/NASA/status/1723456789012345678", "1723456789012345678"},
+		{"https://www.reddit.com/r/aww/comments/17xyzab/dog/", "b8w2k4z1yq0c1"},
+	}
+	fake := NewFakeDownloader(fixtureDir)
+	for _, tt := range tests {
+		info, err := fake.Probe(context.Background(), tt.url)
+		if err != nil {
+			t.Errorf("%s: %v", tt.url, err)
+			continue
+		}
+		if info.ID != tt.id {
+			t.Errorf("%s: id = %s, want %s", tt.url, info.ID, tt.id)
+		}
+		if info.Metadata.OriginalURL == "" {
+			t.Errorf("%s: empty OriginalURL", tt.url)
+		}
+	}
+}
+
+func TestTikTokFixtureHidesWatermark(t *testing.T) {
+	url := "https://www.tiktok.com/@user/video/7301234567890123456"
+	info, err := NewFakeDownloader(fixtureDir).Probe(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	platform := NewPlatformDetector().DetectPlatform(url).Platform
+	for _, format := range filterPlatformFormats(platform, info.AllFormats) {
+		if format.ID == "download_addr-0" {
+			t.Fatal("watermarked format download_addr-0 should be filtered out")
+		}
+	}
+}
+
+func TestFakeDownloaderPlaylistFixture(t *testing.T) {
+	fake := NewFakeDownloader(fixtureDir)
+	playlist, err := fake.Playlist(context.Background(), "https://www.youtube.com/playlist?list=PLfixturePlaylist01", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if playlist.ID != "PLfixturePlaylist01" || playlist.Title != "Fixture Playlist" {
+		t.Errorf("playlist = %s %q", playlist.ID, playlist.Title)
+	}
+	if len(playlist.Entries) == 0 {
+		t.Fatal("no entries")
+	}
+	for _, entry := range playlist.Entries {
+		if entry.ID == "" || entry.URL == "" {
+			t.Errorf("incomplete entry %+v", entry)
+		}
+	}
+
+	limited, err := fake.Playlist(context.Background(), "https://www.youtube.com/playlist?list=PLfixturePlaylist01", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(limited.Entries) > 1 {
+		t.Errorf("limit 1: got %d entries", len(limited.Entries))
+	}
+}
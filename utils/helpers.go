@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"log"
 	"strings"
 	"time"
@@ -47,6 +48,11 @@ func SanitizeFilename(filename string) string {
 
 // RetryWithBackoff выполняет функцию с повторными попытками и экспоненциальной задержкой
 func RetryWithBackoff(operation func() error, maxRetries int, baseDelay time.Duration) error {
+	return RetryWithBackoffContext(context.Background(), operation, maxRetries, baseDelay)
+}
+
+// RetryWithBackoffContext как RetryWithBackoff, но прекращает попытки при отмене контекста
+func RetryWithBackoffContext(ctx context.Context, operation func() error, maxRetries int, baseDelay time.Duration) error {
 	var lastErr error
 	
 	for attempt := 0; attempt <= maxRetries; attempt++ {
@@ -54,7 +60,11 @@ func RetryWithBackoff(operation func() error, maxRetries int, baseDelay time.Dur
 			// Экспоненциальная задержка: 1s, 2s, 4s, 8s, 16s
 			delay := baseDelay * time.Duration(1<<uint(attempt-1))
 			log.Printf("🔄 Попытка %d/%d через %v...", attempt+1, maxRetries+1, delay)
-			time.Sleep(delay)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return lastErr
+			}
 		}
 		
 		err := operation()
@@ -67,6 +77,11 @@ func RetryWithBackoff(operation func() error, maxRetries int, baseDelay time.Dur
 		
 		lastErr = err
 		log.Printf("❌ Попытка %d/%d неудачна: %v", attempt+1, maxRetries+1, err)
+		
+		// Отмененную операцию не повторяем
+		if ctx.Err() != nil {
+			return lastErr
+		}
 	}
 	
 	log.Printf("💥 Все %d попыток исчерпаны", maxRetries+1)